@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"TaruApp/database"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Entry 一条审计日志
+type Entry struct {
+	ActorID    int64
+	ActorName  string
+	Action     string // 操作类型，如 user.set_level、app.review
+	TargetType string // 操作对象类型，如 user、board
+	TargetID   string
+	Before     any // 操作前的数据，为空时不记录
+	After      any // 操作后的数据，为空时不记录
+	IP         string
+}
+
+// Write 写入审计日志（只追加，数据库触发器禁止修改和删除）
+func Write(entry Entry) error {
+	before, err := marshal(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshal(entry.After)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO audit_logs (actor_id, actor_name, action, target_type, target_id, before_data, after_data, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.ActorID, entry.ActorName, entry.Action, entry.TargetType, entry.TargetID, before, after, entry.IP)
+	return err
+}
+
+// marshal 把数据转成 JSON，已经是 JSON 的原样保存
+func marshal(v any) (any, error) {
+	switch data := v.(type) {
+	case nil:
+		return nil, nil
+	case json.RawMessage:
+		if len(data) == 0 {
+			return nil, nil
+		}
+		return string(data), nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// 处理器通过以下函数补充审计信息，由 middleware.Audit 在请求成功后统一写入
+const (
+	keyTarget = "audit_target"
+	keyBefore = "audit_before"
+	keyAfter  = "audit_after"
+	keySkip   = "audit_skip"
+)
+
+// SetTarget 设置操作对象（默认使用路由参数 id）
+func SetTarget(c *gin.Context, targetType string, targetID any) {
+	c.Set(keyTarget, [2]string{targetType, fmt.Sprint(targetID)})
+}
+
+// SetBefore 设置操作前的数据
+func SetBefore(c *gin.Context, v any) {
+	c.Set(keyBefore, v)
+}
+
+// SetAfter 设置操作后的数据（默认使用 JSON 请求体）
+func SetAfter(c *gin.Context, v any) {
+	c.Set(keyAfter, v)
+}
+
+// Skip 本次请求不需要记录（如作者删除自己的帖子）
+func Skip(c *gin.Context) {
+	c.Set(keySkip, true)
+}
+
+// FromContext 根据请求上下文生成审计日志，请求被标记为跳过时返回 false
+func FromContext(c *gin.Context, action, targetType string, body json.RawMessage) (Entry, bool) {
+	if c.GetBool(keySkip) {
+		return Entry{}, false
+	}
+
+	entry := Entry{
+		ActorID:    c.GetInt64("user_id"),
+		ActorName:  c.GetString("username"),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   c.Param("id"),
+		IP:         c.ClientIP(),
+	}
+	if target, ok := c.Get(keyTarget); ok {
+		t := target.([2]string)
+		entry.TargetType, entry.TargetID = t[0], t[1]
+	}
+	if before, ok := c.Get(keyBefore); ok {
+		entry.Before = before
+	}
+	if after, ok := c.Get(keyAfter); ok {
+		entry.After = after
+	} else if json.Valid(body) {
+		entry.After = body
+	}
+	return entry, true
+}
@@ -0,0 +1,350 @@
+// Package bsdiff 生成和应用二进制差分补丁。
+//
+// 算法与 bsdiff 4.3 相同（qsufsort 后缀数组 + 近似匹配），补丁格式参考 endsley/bsdiff，
+// 只是把 bzip2 换成了 gzip：
+//
+//	0   8 字节  魔数 "BSDIFFGZ"
+//	8   8 字节  新文件大小
+//	16  ...     gzip 压缩的数据块序列，每块为 控制数据(3×8 字节) + 差异数据 + 额外数据
+//
+// 控制数据依次为差异数据长度 x、额外数据长度 y 和旧文件读取位置的偏移 z。
+// 应用补丁时，新文件的接下来 x 个字节为旧文件当前位置的 x 个字节与差异数据逐字节相加（溢出截断），
+// 再接 y 个字节的额外数据，然后旧文件读取位置移动 x+z。
+// 所有整数都是 8 字节小端序，最高位为符号位（与 bsdiff 的 offtout 相同）。
+package bsdiff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Magic 补丁文件头部的魔数
+const Magic = "BSDIFFGZ"
+
+// ErrTooLarge 文件超过后缀数组（int32）能处理的大小
+var ErrTooLarge = errors.New("bsdiff: 文件过大")
+
+// Diff 生成把 oldData 变成 newData 的补丁。
+// 内存占用约为旧文件大小的 9 倍加新文件大小
+func Diff(oldData, newData []byte) ([]byte, error) {
+	if len(oldData) >= math.MaxInt32 || len(newData) >= math.MaxInt32 {
+		return nil, ErrTooLarge
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(Magic)
+	writeInt(&buf, int64(len(newData)))
+
+	zw := gzip.NewWriter(&buf)
+	if err := diff(zw, oldData, newData); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// diff 按 bsdiff 的方式查找匹配并写出数据块
+func diff(w *gzip.Writer, oldData, newData []byte) error {
+	I := suffixSort(oldData)
+	oldSize, newSize := len(oldData), len(newData)
+
+	var scan, pos, length int
+	var lastScan, lastPos, lastOffset int
+	var ctrl bytes.Buffer
+	for scan < newSize {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < newSize; scan++ {
+			pos, length = search(I, oldData, newData[scan:])
+
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < oldSize && oldData[scsc+lastOffset] == newData[scsc] {
+					oldScore++
+				}
+			}
+
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+
+			if scan+lastOffset < oldSize && oldData[scan+lastOffset] == newData[scan] {
+				oldScore--
+			}
+		}
+
+		if length == oldScore && scan != newSize {
+			continue
+		}
+
+		// 向前扩展上一个匹配
+		s, sf, lenF := 0, 0, 0
+		for i := 0; lastScan+i < scan && lastPos+i < oldSize; {
+			if oldData[lastPos+i] == newData[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > sf*2-lenF {
+				sf, lenF = s, i
+			}
+		}
+
+		// 向后扩展当前匹配
+		lenB := 0
+		if scan < newSize {
+			s, sb := 0, 0
+			for i := 1; scan >= lastScan+i && pos >= i; i++ {
+				if oldData[pos-i] == newData[scan-i] {
+					s++
+				}
+				if s*2-i > sb*2-lenB {
+					sb, lenB = s, i
+				}
+			}
+		}
+
+		// 两段重叠时选择最佳的分割点
+		if lastScan+lenF > scan-lenB {
+			overlap := (lastScan + lenF) - (scan - lenB)
+			s, ss, lenS := 0, 0, 0
+			for i := 0; i < overlap; i++ {
+				if newData[lastScan+lenF-overlap+i] == oldData[lastPos+lenF-overlap+i] {
+					s++
+				}
+				if newData[scan-lenB+i] == oldData[pos-lenB+i] {
+					s--
+				}
+				if s > ss {
+					ss, lenS = s, i+1
+				}
+			}
+			lenF += lenS - overlap
+			lenB -= lenS
+		}
+
+		extraLen := (scan - lenB) - (lastScan + lenF)
+		ctrl.Reset()
+		writeInt(&ctrl, int64(lenF))
+		writeInt(&ctrl, int64(extraLen))
+		writeInt(&ctrl, int64((pos-lenB)-(lastPos+lenF)))
+		if _, err := w.Write(ctrl.Bytes()); err != nil {
+			return err
+		}
+
+		diffBytes := make([]byte, lenF)
+		for i := range diffBytes {
+			diffBytes[i] = newData[lastScan+i] - oldData[lastPos+i]
+		}
+		if _, err := w.Write(diffBytes); err != nil {
+			return err
+		}
+		if _, err := w.Write(newData[lastScan+lenF : lastScan+lenF+extraLen]); err != nil {
+			return err
+		}
+
+		lastScan = scan - lenB
+		lastPos = pos - lenB
+		lastOffset = pos - scan
+	}
+	return nil
+}
+
+// suffixSort 使用 Larsson-Sadakane 的 qsufsort 算法构造后缀数组（包含空后缀，长度为 len(data)+1）
+func suffixSort(data []byte) []int32 {
+	n := len(data)
+	I := make([]int32, n+1)
+	V := make([]int32, n+1)
+
+	var buckets [256]int32
+	for _, b := range data {
+		buckets[b]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+
+	for i, b := range data {
+		buckets[b]++
+		I[buckets[b]] = int32(i)
+	}
+	I[0] = int32(n)
+	for i, b := range data {
+		V[i] = buckets[b]
+	}
+	V[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := int32(1); I[0] != -int32(n+1); h += h {
+		var length int32
+		i := int32(0)
+		for i < int32(n+1) {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+				continue
+			}
+			if length != 0 {
+				I[i-length] = -length
+			}
+			length = V[I[i]] + 1 - i
+			split(I, V, i, length, h)
+			i += length
+			length = 0
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+
+	for i := 0; i < n+1; i++ {
+		I[V[i]] = int32(i)
+	}
+	return I
+}
+
+// split 按第 h 个字符之后的排名对 I[start:start+length] 做三路快速排序
+func split(I, V []int32, start, length, h int32) {
+	if length < 16 {
+		var j int32
+		for k := start; k < start+length; k += j {
+			j = 1
+			x := V[I[k]+h]
+			for i := int32(1); k+i < start+length; i++ {
+				if V[I[k+i]+h] < x {
+					x = V[I[k+i]+h]
+					j = 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i := int32(0); i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+		}
+		return
+	}
+
+	x := V[I[start+length/2]+h]
+	var jj, kk int32
+	for i := start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, int32(0), int32(0)
+	for i < jj {
+		switch {
+		case V[I[i]+h] < x:
+			i++
+		case V[I[i]+h] == x:
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		default:
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(I, V, start, jj-start, h)
+	}
+	for i := int32(0); i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+	if start+length > kk {
+		split(I, V, kk, start+length-kk, h)
+	}
+}
+
+// search 在后缀数组中二分查找与 target 前缀匹配最长的位置
+func search(I []int32, oldData, target []byte) (pos, length int) {
+	st, en := 0, len(oldData)
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		suffix := oldData[I[x]:]
+		n := min(len(suffix), len(target))
+		if bytes.Compare(suffix[:n], target[:n]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+
+	x := matchLen(oldData[I[st]:], target)
+	y := matchLen(oldData[I[en]:], target)
+	if x > y {
+		return int(I[st]), x
+	}
+	return int(I[en]), y
+}
+
+// matchLen 返回两个字节串的公共前缀长度
+func matchLen(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// writeInt 按 bsdiff 的格式写入整数：小端序，最高位为符号位
+func writeInt(buf *bytes.Buffer, x int64) {
+	var b [8]byte
+	if x < 0 {
+		binary.LittleEndian.PutUint64(b[:], uint64(-x))
+		b[7] |= 0x80
+	} else {
+		binary.LittleEndian.PutUint64(b[:], uint64(x))
+	}
+	buf.Write(b[:])
+}
+
+// readInt 读取 writeInt 写入的整数
+func readInt(b []byte) int64 {
+	negative := b[7]&0x80 != 0
+	var tmp [8]byte
+	copy(tmp[:], b)
+	tmp[7] &^= 0x80
+	x := int64(binary.LittleEndian.Uint64(tmp[:]))
+	if negative {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,145 @@
+package bsdiff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math/rand"
+	"testing"
+)
+
+// randomBytes 生成固定种子的随机数据
+func randomBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+// roundTrip 生成补丁并应用，检查结果与新文件相同
+func roundTrip(t *testing.T, oldData, newData []byte) []byte {
+	t.Helper()
+	patch, err := Diff(oldData, newData)
+	if err != nil {
+		t.Fatalf("Diff 失败: %v", err)
+	}
+	restored, err := Patch(oldData, patch)
+	if err != nil {
+		t.Fatalf("Patch 失败: %v", err)
+	}
+	if !bytes.Equal(restored, newData) {
+		t.Fatalf("还原结果不一致: 长度 %d, 期望 %d", len(restored), len(newData))
+	}
+	return patch
+}
+
+func TestRoundTrip(t *testing.T) {
+	base := randomBytes(1, 64<<10)
+
+	modified := append([]byte(nil), base...)
+	for i := 0; i < len(modified); i += 997 {
+		modified[i] ^= 0x5a
+	}
+	inserted := append(append(append([]byte(nil), base[:30000]...), randomBytes(2, 1000)...), base[30000:]...)
+
+	tests := []struct {
+		name     string
+		old, new []byte
+	}{
+		{"两者都为空", nil, nil},
+		{"旧文件为空", nil, randomBytes(3, 4096)},
+		{"新文件为空", base, nil},
+		{"内容相同", base, base},
+		{"完全随机", randomBytes(4, 10000), randomBytes(5, 12000)},
+		{"末尾追加", base, append(append([]byte(nil), base...), randomBytes(6, 5000)...)},
+		{"截断", base, base[:len(base)/2]},
+		{"去掉开头", base, base[len(base)/3:]},
+		{"分散修改", base, modified},
+		{"中间插入", base, inserted},
+		{"重复内容", bytes.Repeat([]byte("abcdefgh"), 4096), bytes.Repeat([]byte("abcdefgi"), 4096)},
+		{"单个字节", []byte{1}, []byte{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roundTrip(t, tt.old, tt.new)
+		})
+	}
+}
+
+func TestSimilarFilesProduceSmallPatch(t *testing.T) {
+	base := randomBytes(7, 256<<10)
+	newData := append(append([]byte(nil), base...), []byte("appended")...)
+	newData[1000] ^= 0xff
+
+	patch := roundTrip(t, base, newData)
+	if len(patch) > len(newData)/10 {
+		t.Fatalf("补丁大小 %d，没有明显小于新文件 %d", len(patch), len(newData))
+	}
+}
+
+func TestPatchRejectsCorruptInput(t *testing.T) {
+	oldData := randomBytes(8, 8192)
+	newData := append(append([]byte(nil), oldData[:4000]...), randomBytes(9, 3000)...)
+	patch, err := Diff(oldData, newData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withSize := func(size int64) []byte {
+		var header bytes.Buffer
+		writeInt(&header, size)
+		p := append([]byte(nil), patch...)
+		copy(p[len(Magic):], header.Bytes())
+		return p
+	}
+	flipped := append([]byte(nil), patch...)
+	for i := len(Magic) + 8 + 10; i < len(flipped); i += 7 {
+		flipped[i] ^= 0xff
+	}
+
+	cases := map[string][]byte{
+		"空补丁":     nil,
+		"只有魔数":    []byte(Magic),
+		"魔数错误":    append([]byte("BSDIFF40"), patch[len(Magic):]...),
+		"缺少数据块":   patch[:len(Magic)+8],
+		"数据截断":    patch[:len(patch)/2],
+		"去掉最后一字节": patch[:len(patch)-1],
+		"数据损坏":    flipped,
+		"新文件大小过大": withSize(1 << 62),
+		"新文件大小为负": withSize(-5),
+		"新文件大小偏大": withSize(int64(len(newData)) + 100),
+	}
+	for name, p := range cases {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("Patch panic: %v", r)
+				}
+			}()
+			if _, err := Patch(oldData, p); err == nil {
+				t.Fatal("损坏的补丁应当返回错误")
+			}
+		})
+	}
+}
+
+func TestPatchRejectsOverflowingControlData(t *testing.T) {
+	var body bytes.Buffer
+	writeInt(&body, 1<<62) // 差异数据长度
+	writeInt(&body, 1<<62) // 额外数据长度
+	writeInt(&body, 0)
+
+	var buf bytes.Buffer
+	buf.WriteString(Magic)
+	writeInt(&buf, 16)
+	zw := gzip.NewWriter(&buf)
+	zw.Write(body.Bytes())
+	zw.Close()
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("Patch panic: %v", r)
+		}
+	}()
+	if _, err := Patch(nil, buf.Bytes()); err == nil {
+		t.Fatal("控制数据溢出时应当返回错误")
+	}
+}
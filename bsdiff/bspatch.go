@@ -0,0 +1,68 @@
+package bsdiff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math"
+)
+
+// ErrCorruptPatch 补丁格式错误或与旧文件不匹配
+var ErrCorruptPatch = errors.New("bsdiff: 补丁已损坏")
+
+// Patch 把补丁应用到 oldData 上，返回新文件
+func Patch(oldData, patch []byte) ([]byte, error) {
+	if len(patch) < len(Magic)+8 || string(patch[:len(Magic)]) != Magic {
+		return nil, ErrCorruptPatch
+	}
+	// Diff 不会生成超过 int32 范围的文件，大小异常时直接拒绝，避免按损坏的头部分配内存
+	newSize := readInt(patch[len(Magic):])
+	if newSize < 0 || newSize >= math.MaxInt32 {
+		return nil, ErrCorruptPatch
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(patch[len(Magic)+8:]))
+	if err != nil {
+		return nil, ErrCorruptPatch
+	}
+	defer zr.Close()
+
+	newData := make([]byte, newSize)
+	var ctrl [24]byte
+	var oldPos, newPos int64
+	for newPos < newSize {
+		if _, err := io.ReadFull(zr, ctrl[:]); err != nil {
+			return nil, ErrCorruptPatch
+		}
+		diffLen, extraLen, seek := readInt(ctrl[0:]), readInt(ctrl[8:]), readInt(ctrl[16:])
+		// 分别比较剩余长度，避免损坏的控制数据相加后溢出
+		if diffLen < 0 || extraLen < 0 || diffLen > newSize-newPos || extraLen > newSize-newPos-diffLen {
+			return nil, ErrCorruptPatch
+		}
+
+		segment := newData[newPos : newPos+diffLen]
+		if _, err := io.ReadFull(zr, segment); err != nil {
+			return nil, ErrCorruptPatch
+		}
+		for i := range segment {
+			if p := oldPos + int64(i); p >= 0 && p < int64(len(oldData)) {
+				segment[i] += oldData[p]
+			}
+		}
+		newPos += diffLen
+		oldPos += diffLen
+
+		if _, err := io.ReadFull(zr, newData[newPos:newPos+extraLen]); err != nil {
+			return nil, ErrCorruptPatch
+		}
+		newPos += extraLen
+		oldPos += seek
+	}
+
+	// 读完剩余数据以校验 gzip 的 CRC 和长度，补丁末尾不能有多余的数据
+	if n, err := io.Copy(io.Discard, zr); err != nil || n != 0 {
+		return nil, ErrCorruptPatch
+	}
+	return newData, nil
+}
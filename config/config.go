@@ -1,9 +1,14 @@
 package config
 
 import (
+	"TaruApp/utils"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config 应用配置
@@ -13,6 +18,102 @@ type Config struct {
 	LogLevel     string
 	MaxPageSize  int
 	EnableCORS   bool
+
+	// 硬币对账任务间隔（分钟），0 表示不启用定时对账
+	CoinReconcileInterval int
+
+	// 经验/硬币奖励规则文件路径，文件不存在时使用内置默认规则
+	RewardRulesPath string
+
+	// 成就定义文件路径，文件不存在时使用内置默认成就
+	AchievementsPath string
+
+	// 应用投币分成给上传者的比例（百分比，0-100），其余由系统回收
+	AppCoinSharePercent int
+
+	// 增量更新补丁的存放目录
+	PatchDir string
+	// 生成增量更新补丁的任务间隔（分钟），0 表示不启用
+	PatchJobInterval int
+	// 生成补丁时安装包的大小上限（MB），超过时只提供完整下载。
+	// 后缀数组和新旧安装包都在内存中，上限为 64 MB 时单个任务峰值约 1 GB
+	PatchMaxFileSize int
+
+	// 计算下载客户端标识哈希的密钥，默认使用 TokenSecret
+	DownloadHashSecret string
+	// 同一 IP 同一版本每天最多计入的不同客户端数，超过后不再增加下载数（用于防止刷量），0 表示不限制
+	DownloadMaxClientsPerIP int
+	// 下载统计汇总任务的间隔（分钟），0 表示不启用
+	DownloadRollupInterval int
+	// 下载记录的保留天数，汇总后删除更早的记录（每日汇总一直保留），0 表示不删除
+	DownloadRetentionDays int
+
+	// 审核员认领上传任务后的锁定时间（分钟），超时后其他审核员可以认领
+	ReviewClaimTimeout int
+	// 被要求修改的上传任务多少天内未重新提交则过期（不再占用包名），0 表示不过期
+	ChangesRequestedExpireDays int
+
+	// 创建板块是否需要消耗板块创建券（管理员不受限制）
+	BoardCreateRequiresTicket bool
+	// 补签卡可补签的最早天数（补签最近N天内漏签的日期）
+	MakeupCheckInDays int
+
+	// 访问令牌签名密钥；轮换时把旧密钥移到 TokenPreviousSecrets，旧令牌在过期前仍可通过校验
+	TokenSecret          string
+	TokenPreviousSecrets []string
+	// 访问令牌有效期（分钟）
+	AccessTokenTTL int
+	// 刷新令牌有效期（天）
+	RefreshTokenTTL int
+	// 过期会话和令牌的清理间隔（分钟），0 表示不启用
+	SessionCleanupInterval int
+
+	// 邮件发送方式：smtp、file（写入 MailFileDir 目录）或 log（只输出到日志）
+	MailDriver   string
+	MailFrom     string
+	MailFileDir  string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	// 邮箱验证码和密码重置码的有效期（分钟）
+	VerificationCodeTTL int
+
+	// 两步验证器应用中显示的发行方名称
+	TOTPIssuer string
+	// 管理员和审核员接口是否要求使用两步验证登录
+	AdminRequire2FA bool
+
+	// 启动时确保拥有管理员角色的用户名（用于初始化第一个管理员）
+	AdminUsernames []string
+
+	// 第三方登录回调地址的前缀（如 https://api.example.com，默认 http://localhost:{端口}），回调地址为 {前缀}/api/auth/oauth/{provider}/callback
+	OAuthRedirectBaseURL string
+	// GitHub 登录，Client ID 为空时不启用
+	GitHubClientID     string
+	GitHubClientSecret string
+	// Google 登录，Client ID 为空时不启用
+	GoogleClientID     string
+	GoogleClientSecret string
+	// 通用 OIDC 登录，Issuer 为空时不启用，端点通过 {Issuer}/.well-known/openid-configuration 发现
+	OIDCProviderName string
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCScopes       []string
+
+	// 是否启用接口限流
+	RateLimitEnabled bool
+	// 覆盖内置限流规则，格式为 规则名=次数/时间（如 login=10/1m），值为 off 时关闭该规则
+	RateLimits []string
+	// 信任的反向代理地址（IP 或 CIDR），只有来自这些地址的请求才使用 X-Forwarded-For 识别客户端 IP
+	TrustedProxies []string
+	// 同一用户名和 IP 连续登录失败的次数上限，0 表示不锁定
+	LoginMaxFailures int
+	// 统计登录失败次数的时间窗口（分钟）
+	LoginFailureWindow int
+	// 登录失败次数达到上限后的锁定时间（分钟）
+	LoginLockoutDuration int
 }
 
 var AppConfig *Config
@@ -25,6 +126,80 @@ func InitConfig() {
 		LogLevel:     getEnv("LOG_LEVEL", "info"),
 		MaxPageSize:  getEnvAsInt("MAX_PAGE_SIZE", 100),
 		EnableCORS:   getEnvAsBool("ENABLE_CORS", true),
+
+		CoinReconcileInterval: getEnvAsInt("COIN_RECONCILE_INTERVAL", 60),
+
+		RewardRulesPath:  getEnv("REWARD_RULES_PATH", "./reward_rules.json"),
+		AchievementsPath: getEnv("ACHIEVEMENTS_PATH", "./achievements.json"),
+
+		AppCoinSharePercent: getEnvAsInt("APP_COIN_SHARE_PERCENT", 70),
+
+		PatchDir:         getEnv("PATCH_DIR", "./patches"),
+		PatchJobInterval: getEnvAsInt("PATCH_JOB_INTERVAL", 30),
+		PatchMaxFileSize: getEnvAsInt("PATCH_MAX_FILE_SIZE", 64),
+
+		DownloadHashSecret:      getEnv("DOWNLOAD_HASH_SECRET", ""),
+		DownloadMaxClientsPerIP: getEnvAsInt("DOWNLOAD_MAX_CLIENTS_PER_IP", 10),
+		DownloadRollupInterval:  getEnvAsInt("DOWNLOAD_ROLLUP_INTERVAL", 10),
+		DownloadRetentionDays:   getEnvAsInt("DOWNLOAD_RETENTION_DAYS", 90),
+
+		ReviewClaimTimeout:         getEnvAsInt("REVIEW_CLAIM_TIMEOUT", 30),
+		ChangesRequestedExpireDays: getEnvAsInt("CHANGES_REQUESTED_EXPIRE_DAYS", 30),
+
+		BoardCreateRequiresTicket: getEnvAsBool("BOARD_CREATE_REQUIRES_TICKET", false),
+		MakeupCheckInDays:         getEnvAsInt("MAKEUP_CHECKIN_DAYS", 7),
+
+		TokenSecret:          getEnv("TOKEN_SECRET", ""),
+		TokenPreviousSecrets: getEnvAsList("TOKEN_PREVIOUS_SECRETS"),
+		AccessTokenTTL:       getEnvAsInt("ACCESS_TOKEN_TTL", 15),
+		RefreshTokenTTL:      getEnvAsInt("REFRESH_TOKEN_TTL", 30),
+
+		SessionCleanupInterval: getEnvAsInt("SESSION_CLEANUP_INTERVAL", 60),
+
+		MailDriver:          getEnv("MAIL_DRIVER", "log"),
+		MailFrom:            getEnv("MAIL_FROM", "TaruApp <noreply@taruapp.local>"),
+		MailFileDir:         getEnv("MAIL_FILE_DIR", "./mail_outbox"),
+		SMTPHost:            getEnv("SMTP_HOST", ""),
+		SMTPPort:            getEnvAsInt("SMTP_PORT", 587),
+		SMTPUsername:        getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:        getEnv("SMTP_PASSWORD", ""),
+		VerificationCodeTTL: getEnvAsInt("VERIFICATION_CODE_TTL", 15),
+
+		TOTPIssuer:      getEnv("TOTP_ISSUER", "TaruApp"),
+		AdminRequire2FA: getEnvAsBool("ADMIN_REQUIRE_2FA", false),
+
+		AdminUsernames: getEnvAsList("ADMIN_USERNAMES"),
+
+		OAuthRedirectBaseURL: strings.TrimRight(getEnv("OAUTH_REDIRECT_BASE_URL", ""), "/"),
+		GitHubClientID:       getEnv("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret:   getEnv("GITHUB_CLIENT_SECRET", ""),
+		GoogleClientID:       getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret:   getEnv("GOOGLE_CLIENT_SECRET", ""),
+		OIDCProviderName:     getEnv("OIDC_PROVIDER_NAME", "oidc"),
+		OIDCIssuer:           strings.TrimRight(getEnv("OIDC_ISSUER", ""), "/"),
+		OIDCClientID:         getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:     getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCScopes:           getEnvAsList("OIDC_SCOPES"),
+
+		RateLimitEnabled:     getEnvAsBool("RATE_LIMIT_ENABLED", true),
+		RateLimits:           getEnvAsList("RATE_LIMITS"),
+		TrustedProxies:       getEnvAsList("TRUSTED_PROXIES"),
+		LoginMaxFailures:     getEnvAsInt("LOGIN_MAX_FAILURES", 5),
+		LoginFailureWindow:   getEnvAsInt("LOGIN_FAILURE_WINDOW", 15),
+		LoginLockoutDuration: getEnvAsInt("LOGIN_LOCKOUT_DURATION", 15),
+	}
+
+	if AppConfig.TokenSecret == "" {
+		// 未配置密钥时使用随机密钥，重启后所有访问令牌失效（刷新令牌不受影响）
+		AppConfig.TokenSecret, _ = utils.RandomHex(32)
+		log.Println("警告: 未设置 TOKEN_SECRET，已生成临时签名密钥")
+	}
+	if AppConfig.DownloadHashSecret == "" {
+		// 不直接复用令牌签名密钥，而是从中派生独立的密钥
+		AppConfig.DownloadHashSecret = deriveSecret(AppConfig.TokenSecret, "download-hash")
+	}
+	if AppConfig.OAuthRedirectBaseURL == "" {
+		AppConfig.OAuthRedirectBaseURL = "http://localhost:" + AppConfig.ServerPort
 	}
 
 	log.Println("配置加载完成:")
@@ -33,6 +208,23 @@ func InitConfig() {
 	log.Printf("  日志级别: %s", AppConfig.LogLevel)
 	log.Printf("  最大分页大小: %d", AppConfig.MaxPageSize)
 	log.Printf("  启用CORS: %v", AppConfig.EnableCORS)
+	log.Printf("  硬币对账间隔: %d 分钟", AppConfig.CoinReconcileInterval)
+	log.Printf("  奖励规则文件: %s", AppConfig.RewardRulesPath)
+	log.Printf("  成就定义文件: %s", AppConfig.AchievementsPath)
+	log.Printf("  应用投币分成比例: %d%%", AppConfig.AppCoinSharePercent)
+	log.Printf("  增量更新补丁: 目录 %s, 任务间隔 %d 分钟, 安装包上限 %d MB", AppConfig.PatchDir, AppConfig.PatchJobInterval, AppConfig.PatchMaxFileSize)
+	log.Printf("  下载统计: 每个IP每版本每天最多 %d 个客户端, 汇总间隔 %d 分钟, 下载记录保留 %d 天", AppConfig.DownloadMaxClientsPerIP, AppConfig.DownloadRollupInterval, AppConfig.DownloadRetentionDays)
+	log.Printf("  审核任务认领锁定时间: %d 分钟", AppConfig.ReviewClaimTimeout)
+	log.Printf("  要求修改的任务过期时间: %d 天", AppConfig.ChangesRequestedExpireDays)
+	log.Printf("  创建板块需要创建券: %v", AppConfig.BoardCreateRequiresTicket)
+	log.Printf("  补签范围: 最近 %d 天", AppConfig.MakeupCheckInDays)
+	log.Printf("  令牌签名密钥ID: %s (历史密钥 %d 个)", utils.SigningKeyID(AppConfig.TokenSecret), len(AppConfig.TokenPreviousSecrets))
+	log.Printf("  访问令牌有效期: %d 分钟, 刷新令牌有效期: %d 天", AppConfig.AccessTokenTTL, AppConfig.RefreshTokenTTL)
+	log.Printf("  会话清理间隔: %d 分钟", AppConfig.SessionCleanupInterval)
+	log.Printf("  邮件发送方式: %s", AppConfig.MailDriver)
+	log.Printf("  验证码有效期: %d 分钟", AppConfig.VerificationCodeTTL)
+	log.Printf("  管理接口要求两步验证: %v", AppConfig.AdminRequire2FA)
+	log.Printf("  第三方登录回调地址前缀: %s", AppConfig.OAuthRedirectBaseURL)
 }
 
 // getEnv 获取环境变量，如果不存在则返回默认值
@@ -44,6 +236,13 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+// deriveSecret 用 HMAC-SHA256 从 secret 派生用于 purpose 的独立密钥
+func deriveSecret(secret, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 // getEnvAsInt 获取整数类型的环境变量
 func getEnvAsInt(key string, defaultValue int) int {
 	valueStr := os.Getenv(key)
@@ -76,3 +275,18 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	return value
 }
 
+// getEnvAsList 获取逗号分隔的列表类型环境变量
+func getEnvAsList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// TokenSecrets 返回所有可用于校验访问令牌的密钥（当前密钥在前）
+func TokenSecrets() []string {
+	return append([]string{AppConfig.TokenSecret}, AppConfig.TokenPreviousSecrets...)
+}
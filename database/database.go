@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
@@ -12,8 +14,15 @@ var DB *sql.DB
 
 // InitDB 初始化数据库
 func InitDB() error {
+	return Open("./taruapp.db")
+}
+
+// Open 打开指定路径的数据库并创建数据表（测试中用于打开临时数据库）
+func Open(path string) error {
 	var err error
-	DB, err = sql.Open("sqlite", "./taruapp.db")
+	// 后台任务（如生成增量更新补丁）会与请求同时写入，遇到锁时等待而不是直接失败。
+	// 事务开始时就获取写锁：先读后写的并发事务升级写锁时 SQLite 不会等待，而是直接返回 SQLITE_BUSY
+	DB, err = sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_txlock=immediate")
 	if err != nil {
 		return err
 	}
@@ -64,6 +73,16 @@ func createTables() error {
 				coins INTEGER DEFAULT 0,
 				exp INTEGER DEFAULT 0,
 				user_level INTEGER DEFAULT 1,
+				email_verified INTEGER DEFAULT 0,
+				totp_secret TEXT,
+				totp_enabled INTEGER DEFAULT 0,
+				totp_last_step INTEGER DEFAULT 0,
+				has_password INTEGER DEFAULT 1,
+				status TEXT DEFAULT 'active',
+				status_until DATETIME,
+				status_reason TEXT,
+				status_by INTEGER,
+				status_at DATETIME,
 				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 			);`,
@@ -95,12 +114,173 @@ func createTables() error {
 			);`,
 		},
 		{
-			Name: "tokens",
-			SQL: `CREATE TABLE IF NOT EXISTS tokens (
+			Name: "sessions",
+			SQL: `CREATE TABLE IF NOT EXISTS sessions (
+				id TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL,
+				device_name TEXT,
+				user_agent TEXT,
+				ip TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				expires_at DATETIME NOT NULL,
+				revoked_at DATETIME,
+				two_factor INTEGER DEFAULT 0,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);`,
+			Repair: repairSessionsTable,
+		},
+		{
+			Name: "recovery_codes",
+			SQL: `CREATE TABLE IF NOT EXISTS recovery_codes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				code_hash TEXT NOT NULL,
+				used_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);`,
+		},
+		{
+			Name: "login_challenges",
+			SQL: `CREATE TABLE IF NOT EXISTS login_challenges (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				challenge_hash TEXT NOT NULL UNIQUE,
+				device_name TEXT,
+				attempts INTEGER DEFAULT 0,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);`,
+		},
+		{
+			Name: "roles",
+			SQL: `CREATE TABLE IF NOT EXISTS roles (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				display_name TEXT NOT NULL,
+				description TEXT,
+				is_system INTEGER DEFAULT 0,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+		{
+			Name: "role_permissions",
+			SQL: `CREATE TABLE IF NOT EXISTS role_permissions (
+				role_id INTEGER NOT NULL,
+				permission TEXT NOT NULL,
+				PRIMARY KEY (role_id, permission),
+				FOREIGN KEY (role_id) REFERENCES roles(id)
+			);`,
+		},
+		{
+			Name: "user_roles",
+			SQL: `CREATE TABLE IF NOT EXISTS user_roles (
+				user_id INTEGER NOT NULL,
+				role_id INTEGER NOT NULL,
+				granted_by INTEGER,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (user_id, role_id),
+				FOREIGN KEY (user_id) REFERENCES users(id),
+				FOREIGN KEY (role_id) REFERENCES roles(id)
+			);`,
+		},
+		{
+			Name: "user_restrictions",
+			SQL: `CREATE TABLE IF NOT EXISTS user_restrictions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				status TEXT NOT NULL,
+				until DATETIME,
+				reason TEXT,
+				operator_id INTEGER NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);`,
+		},
+		{
+			Name: "audit_logs",
+			SQL: `CREATE TABLE IF NOT EXISTS audit_logs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				actor_id INTEGER NOT NULL,
+				actor_name TEXT,
+				action TEXT NOT NULL,
+				target_type TEXT,
+				target_id TEXT,
+				before_data TEXT,
+				after_data TEXT,
+				ip TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+		{
+			// 用户每日活跃记录（访问需要认证的接口即算活跃），day 为服务器时区的日期
+			Name: "user_daily_activity",
+			SQL: `CREATE TABLE IF NOT EXISTS user_daily_activity (
+				user_id INTEGER NOT NULL,
+				day TEXT NOT NULL,
+				PRIMARY KEY (user_id, day),
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);`,
+		},
+		{
+			Name: "user_identities",
+			SQL: `CREATE TABLE IF NOT EXISTS user_identities (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				provider TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				email TEXT,
+				name TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				last_login_at DATETIME,
+				FOREIGN KEY (user_id) REFERENCES users(id),
+				UNIQUE(provider, subject),
+				UNIQUE(user_id, provider)
+			);`,
+		},
+		{
+			Name: "oauth_states",
+			SQL: `CREATE TABLE IF NOT EXISTS oauth_states (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				state_hash TEXT NOT NULL UNIQUE,
+				provider TEXT NOT NULL,
+				code_verifier TEXT NOT NULL,
+				user_id INTEGER,
+				device_name TEXT,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+		{
+			Name: "verification_codes",
+			SQL: `CREATE TABLE IF NOT EXISTS verification_codes (
 				id INTEGER PRIMARY KEY AUTOINCREMENT,
 				user_id INTEGER NOT NULL,
-				token TEXT NOT NULL UNIQUE,
+				purpose TEXT NOT NULL,
+				target TEXT NOT NULL,
+				code_hash TEXT NOT NULL,
+				attempts INTEGER DEFAULT 0,
 				expires_at DATETIME NOT NULL,
+				used_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);`,
+		},
+		{
+			Name: "refresh_tokens",
+			SQL: `CREATE TABLE IF NOT EXISTS refresh_tokens (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				token_hash TEXT NOT NULL UNIQUE,
+				family_id TEXT NOT NULL,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME,
+				revoked_at DATETIME,
 				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 				FOREIGN KEY (user_id) REFERENCES users(id)
 			);`,
@@ -151,6 +331,7 @@ func createTables() error {
 				attachment_type TEXT,
 				comment_count INTEGER DEFAULT 0,
 				view_count INTEGER DEFAULT 0,
+				is_featured INTEGER DEFAULT 0,
 				last_reply_time DATETIME DEFAULT CURRENT_TIMESTAMP,
 				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
@@ -260,6 +441,7 @@ func createTables() error {
 				ad_level TEXT,
 				payment_type TEXT,
 				operation_type TEXT,
+				developer_id INTEGER,
 				rating REAL DEFAULT 0,
 				rating_count INTEGER DEFAULT 0,
 				total_coins INTEGER DEFAULT 0,
@@ -281,15 +463,134 @@ func createTables() error {
 				download_url TEXT NOT NULL,
 				update_content TEXT,
 				screenshots TEXT,
+				channel TEXT,
+				signer_fingerprint TEXT,
 				uploader_id INTEGER NOT NULL,
 				uploader_name TEXT NOT NULL,
 				is_latest BOOLEAN DEFAULT 0,
+				download_count INTEGER DEFAULT 0,
+				withdrawn_at DATETIME,
+				withdrawn_by INTEGER,
+				withdraw_reason TEXT,
+				file_sha256 TEXT,
 				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 				UNIQUE(package_name, version),
 				FOREIGN KEY (app_id) REFERENCES apps(id),
 				FOREIGN KEY (uploader_id) REFERENCES users(id)
 			);`,
+			Repair: repairAppVersionsTable,
+		},
+		{
+			// 下载记录：同一客户端同一版本每天只记录一条，重复下载只增加 hits。
+			// day 为服务器时区的日期，client_hash、ip_hash 为带密钥和日期的哈希（不保存原始 IP，不同日期之间无法关联）
+			Name: "app_downloads",
+			SQL: `CREATE TABLE IF NOT EXISTS app_downloads (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				app_id INTEGER NOT NULL,
+				version_id INTEGER,
+				package_name TEXT NOT NULL,
+				day TEXT,
+				channel TEXT,
+				client_hash TEXT,
+				ip_hash TEXT,
+				hits INTEGER DEFAULT 1,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (app_id) REFERENCES apps(id),
+				FOREIGN KEY (version_id) REFERENCES app_versions(id)
+			);`,
+			Repair: repairAppDownloadsTable,
+		},
+		{
+			// 每个版本每天的下载汇总，由汇总任务根据 app_downloads 生成（下载记录过期删除后仍保留）。
+			// downloads 为去重后的下载数，requests 为包括重复下载在内的请求数
+			Name: "app_download_daily",
+			SQL: `CREATE TABLE IF NOT EXISTS app_download_daily (
+				app_id INTEGER NOT NULL,
+				version_id INTEGER NOT NULL,
+				day TEXT NOT NULL,
+				channel TEXT NOT NULL DEFAULT '',
+				downloads INTEGER NOT NULL DEFAULT 0,
+				requests INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (app_id, version_id, day),
+				FOREIGN KEY (app_id) REFERENCES apps(id)
+			);`,
+		},
+		{
+			// 应用标签，名称为规范化后的形式（英文小写、合并空白）
+			Name: "tags",
+			SQL: `CREATE TABLE IF NOT EXISTS tags (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+		{
+			Name: "app_tags",
+			SQL: `CREATE TABLE IF NOT EXISTS app_tags (
+				app_id INTEGER NOT NULL,
+				tag_id INTEGER NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (app_id, tag_id),
+				FOREIGN KEY (app_id) REFERENCES apps(id),
+				FOREIGN KEY (tag_id) REFERENCES tags(id)
+			);`,
+		},
+		{
+			// 应用大分类，apps 和 app_upload_tasks 中按名称引用
+			Name: "app_categories",
+			SQL: `CREATE TABLE IF NOT EXISTS app_categories (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				icon_url TEXT,
+				sort_order INTEGER DEFAULT 0,
+				enabled BOOLEAN DEFAULT 1,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+		{
+			// 应用小分类，不同大分类下可以有同名的小分类
+			Name: "app_subcategories",
+			SQL: `CREATE TABLE IF NOT EXISTS app_subcategories (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				category_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				icon_url TEXT,
+				sort_order INTEGER DEFAULT 0,
+				enabled BOOLEAN DEFAULT 1,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(category_id, name),
+				FOREIGN KEY (category_id) REFERENCES app_categories(id)
+			);`,
+		},
+		{
+			// 相邻版本之间的增量更新补丁，status: pending（生成中）、ready、failed、skipped（不生成）
+			Name: "app_patches",
+			SQL: `CREATE TABLE IF NOT EXISTS app_patches (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				app_id INTEGER NOT NULL,
+				package_name TEXT NOT NULL,
+				from_version_id INTEGER NOT NULL,
+				to_version_id INTEGER NOT NULL,
+				from_version_code INTEGER NOT NULL,
+				to_version_code INTEGER NOT NULL,
+				status TEXT NOT NULL DEFAULT 'pending',
+				file_path TEXT,
+				patch_size INTEGER,
+				patch_sha256 TEXT,
+				target_size INTEGER,
+				target_sha256 TEXT,
+				error TEXT,
+				attempts INTEGER DEFAULT 0,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(from_version_id, to_version_id),
+				FOREIGN KEY (app_id) REFERENCES apps(id),
+				FOREIGN KEY (from_version_id) REFERENCES app_versions(id),
+				FOREIGN KEY (to_version_id) REFERENCES app_versions(id)
+			);`,
 		},
 		{
 			Name: "app_upload_tasks",
@@ -314,15 +615,256 @@ func createTables() error {
 				payment_type TEXT NOT NULL,
 				operation_type TEXT NOT NULL,
 				download_url TEXT NOT NULL,
+				signer_fingerprint TEXT,
+				proposed_tags TEXT,
 				status TEXT DEFAULT 'pending',
 				reject_reason TEXT,
 				reviewer_id INTEGER,
 				review_time DATETIME,
+				claimed_by INTEGER,
+				claim_expires_at DATETIME,
+				assigned_by INTEGER,
+				revision INTEGER DEFAULT 1,
+				developer_id INTEGER,
 				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 				FOREIGN KEY (user_id) REFERENCES users(id),
 				FOREIGN KEY (reviewer_id) REFERENCES users(id)
 			);`,
+			Repair: repairAppUploadTasksTable,
+		},
+		{
+			// 审核记录：每次审核的结论、检查清单和内部备注（备注只对审核员可见）
+			Name: "app_review_records",
+			SQL: `CREATE TABLE IF NOT EXISTS app_review_records (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				task_id INTEGER NOT NULL,
+				reviewer_id INTEGER NOT NULL,
+				decision TEXT NOT NULL,
+				ad_level_verified INTEGER NOT NULL DEFAULT 0,
+				permissions_reasonable INTEGER NOT NULL DEFAULT 0,
+				no_malware_found INTEGER NOT NULL DEFAULT 0,
+				notes TEXT,
+				reject_reason TEXT,
+				field_comments TEXT,
+				revision INTEGER NOT NULL DEFAULT 1,
+				batch INTEGER NOT NULL DEFAULT 0,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (task_id) REFERENCES app_upload_tasks(id),
+				FOREIGN KEY (reviewer_id) REFERENCES users(id)
+			);`,
+			Repair: repairAppReviewRecordsTable,
+		},
+		{
+			// 上传任务每次提交的内容快照（JSON），用于显示修改历史
+			Name: "app_upload_submissions",
+			SQL: `CREATE TABLE IF NOT EXISTS app_upload_submissions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				task_id INTEGER NOT NULL,
+				revision INTEGER NOT NULL,
+				data TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(task_id, revision),
+				FOREIGN KEY (task_id) REFERENCES app_upload_tasks(id)
+			);`,
+		},
+		{
+			// 开发者资料，可以由用户认领，管理员审核认领后标记为已认证
+			Name: "developers",
+			SQL: `CREATE TABLE IF NOT EXISTS developers (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+				avatar_url TEXT,
+				website TEXT,
+				email TEXT,
+				contact TEXT,
+				description TEXT,
+				verified BOOLEAN DEFAULT 0,
+				verified_by INTEGER,
+				verified_at DATETIME,
+				created_by INTEGER,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+		{
+			// 开发者成员，role: owner（可以修改资料、管理成员和转移应用）、member
+			Name: "developer_members",
+			SQL: `CREATE TABLE IF NOT EXISTS developer_members (
+				developer_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				role TEXT NOT NULL DEFAULT 'member',
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (developer_id, user_id),
+				FOREIGN KEY (developer_id) REFERENCES developers(id),
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);`,
+		},
+		{
+			// 开发者认领申请，status: pending、approved、rejected
+			Name: "developer_claims",
+			SQL: `CREATE TABLE IF NOT EXISTS developer_claims (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				developer_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				message TEXT NOT NULL,
+				status TEXT NOT NULL DEFAULT 'pending',
+				reviewer_id INTEGER,
+				review_note TEXT,
+				reviewed_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (developer_id) REFERENCES developers(id),
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);`,
+		},
+		{
+			// 应用在开发者之间的所有权转移，status: pending、accepted、rejected、cancelled
+			Name: "app_transfers",
+			SQL: `CREATE TABLE IF NOT EXISTS app_transfers (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				app_id INTEGER NOT NULL,
+				from_developer_id INTEGER NOT NULL,
+				to_developer_id INTEGER NOT NULL,
+				requested_by INTEGER NOT NULL,
+				note TEXT,
+				status TEXT NOT NULL DEFAULT 'pending',
+				responded_by INTEGER,
+				responded_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (app_id) REFERENCES apps(id),
+				FOREIGN KEY (from_developer_id) REFERENCES developers(id),
+				FOREIGN KEY (to_developer_id) REFERENCES developers(id)
+			);`,
+		},
+		{
+			// 开发者成员邀请，status: pending、accepted、rejected、cancelled
+			Name: "developer_invites",
+			SQL: `CREATE TABLE IF NOT EXISTS developer_invites (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				developer_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				role TEXT NOT NULL DEFAULT 'member',
+				invited_by INTEGER NOT NULL,
+				status TEXT NOT NULL DEFAULT 'pending',
+				responded_at DATETIME,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (developer_id) REFERENCES developers(id),
+				FOREIGN KEY (user_id) REFERENCES users(id)
+			);`,
+		},
+		{
+			// 硬币流水（复式记账）：每笔转移写入付款方和收款方两条记录，金额合计为0
+			// user_id/counterparty_id 为 0 表示系统账户
+			Name: "coin_transactions",
+			SQL: `CREATE TABLE IF NOT EXISTS coin_transactions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				tx_no TEXT NOT NULL,
+				user_id INTEGER NOT NULL,
+				counterparty_id INTEGER NOT NULL,
+				amount INTEGER NOT NULL,
+				balance_after INTEGER NOT NULL,
+				type TEXT NOT NULL,
+				ref_type TEXT,
+				ref_id INTEGER,
+				idempotency_key TEXT NOT NULL,
+				remark TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(idempotency_key, user_id)
+			);`,
+		},
+		{
+			Name: "reward_logs",
+			SQL: `CREATE TABLE IF NOT EXISTS reward_logs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				action TEXT NOT NULL,
+				ref_key TEXT NOT NULL,
+				exp INTEGER DEFAULT 0,
+				coins INTEGER DEFAULT 0,
+				reward_date TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id),
+				UNIQUE(user_id, action, ref_key)
+			);`,
+		},
+		{
+			Name: "user_badges",
+			SQL: `CREATE TABLE IF NOT EXISTS user_badges (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				achievement_code TEXT NOT NULL,
+				name TEXT NOT NULL,
+				description TEXT,
+				icon_url TEXT,
+				is_displayed INTEGER DEFAULT 0,
+				display_order INTEGER DEFAULT 0,
+				awarded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id),
+				UNIQUE(user_id, achievement_code)
+			);`,
+		},
+		{
+			Name: "tips",
+			SQL: `CREATE TABLE IF NOT EXISTS tips (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				tx_no TEXT NOT NULL,
+				tipper_id INTEGER NOT NULL,
+				receiver_id INTEGER DEFAULT 0,
+				target_type TEXT NOT NULL,
+				target_id INTEGER NOT NULL,
+				amount INTEGER NOT NULL,
+				receiver_amount INTEGER DEFAULT 0,
+				message TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (tipper_id) REFERENCES users(id)
+			);`,
+		},
+		{
+			Name: "shop_items",
+			SQL: `CREATE TABLE IF NOT EXISTS shop_items (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				description TEXT,
+				type TEXT NOT NULL,
+				value TEXT,
+				icon_url TEXT,
+				price INTEGER NOT NULL DEFAULT 0,
+				stock INTEGER DEFAULT -1,
+				sold_count INTEGER DEFAULT 0,
+				per_user_limit INTEGER DEFAULT 0,
+				is_active INTEGER DEFAULT 1,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`,
+		},
+		{
+			Name: "user_items",
+			SQL: `CREATE TABLE IF NOT EXISTS user_items (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				item_id INTEGER NOT NULL,
+				quantity INTEGER DEFAULT 0,
+				is_equipped INTEGER DEFAULT 0,
+				acquired_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id),
+				FOREIGN KEY (item_id) REFERENCES shop_items(id),
+				UNIQUE(user_id, item_id)
+			);`,
+		},
+		{
+			Name: "shop_purchases",
+			SQL: `CREATE TABLE IF NOT EXISTS shop_purchases (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				item_id INTEGER NOT NULL,
+				quantity INTEGER NOT NULL,
+				total_price INTEGER NOT NULL,
+				tx_no TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id),
+				FOREIGN KEY (item_id) REFERENCES shop_items(id)
+			);`,
 		},
 	}
 
@@ -352,11 +894,21 @@ func createTables() error {
 		}
 	}
 
+	// 旧版本的 tokens 表已被 sessions 和 refresh_tokens 取代，其中的令牌不再有效
+	if _, err := DB.Exec("DROP TABLE IF EXISTS tokens"); err != nil {
+		log.Printf("删除旧的 tokens 表失败: %v", err)
+	}
+
 	// 创建索引
 	if err := createIndexes(); err != nil {
 		return err
 	}
 
+	// 创建触发器
+	if err := createTriggers(); err != nil {
+		return err
+	}
+
 	// 确保默认数据存在
 	if err := ensureDefaultData(); err != nil {
 		return err
@@ -386,8 +938,20 @@ func createTable(table TableDefinition) error {
 func createIndexes() error {
 	log.Println("开始创建索引...")
 	indexes := []string{
-		`CREATE INDEX IF NOT EXISTS idx_tokens_user_id ON tokens(user_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_tokens_token ON tokens(token);`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_verification_codes_user ON verification_codes(user_id, purpose);`,
+		`CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_user_roles_role_id ON user_roles(role_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_user_restrictions_user_id ON user_restrictions(user_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);`,
+		`CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_user_daily_activity_day ON user_daily_activity(day);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_actor ON audit_logs(actor_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs(action, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_target ON audit_logs(target_type, target_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_user_tags_user_id ON user_tags(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_follows_user_id ON follows(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_follows_followed_id ON follows(followed_id);`,
@@ -399,11 +963,13 @@ func createIndexes() error {
 		`CREATE INDEX IF NOT EXISTS idx_posts_publish_time ON posts(publish_time DESC);`,
 		`CREATE INDEX IF NOT EXISTS idx_posts_last_reply_time ON posts(last_reply_time DESC);`,
 		`CREATE INDEX IF NOT EXISTS idx_posts_likes ON posts(likes DESC);`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at);`,
 		`CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_comments_likes ON comments(likes DESC);`,
 		`CREATE INDEX IF NOT EXISTS idx_comments_floor ON comments(floor);`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_created_at ON comments(created_at);`,
 		`CREATE INDEX IF NOT EXISTS idx_favorite_folders_user_id ON favorite_folders(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_favorite_items_folder_id ON favorite_items(folder_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_favorite_items_post_id ON favorite_items(post_id);`,
@@ -417,14 +983,45 @@ func createIndexes() error {
 		`CREATE INDEX IF NOT EXISTS idx_apps_package_name ON apps(package_name);`,
 		`CREATE INDEX IF NOT EXISTS idx_apps_rating ON apps(rating DESC);`,
 		`CREATE INDEX IF NOT EXISTS idx_apps_download_count ON apps(download_count DESC);`,
+		`CREATE INDEX IF NOT EXISTS idx_apps_category ON apps(main_category, sub_category);`,
 		`CREATE INDEX IF NOT EXISTS idx_app_versions_app_id ON app_versions(app_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_app_versions_package_name ON app_versions(package_name);`,
 		`CREATE INDEX IF NOT EXISTS idx_app_versions_version_code ON app_versions(version_code DESC);`,
 		`CREATE INDEX IF NOT EXISTS idx_app_versions_is_latest ON app_versions(is_latest);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_tags_tag_id ON app_tags(tag_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_subcategories_category_id ON app_subcategories(category_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_patches_package_name ON app_patches(package_name, status);`,
 		`CREATE INDEX IF NOT EXISTS idx_app_upload_tasks_user_id ON app_upload_tasks(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_upload_tasks_created_at ON app_upload_tasks(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_upload_tasks_review_time ON app_upload_tasks(review_time);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_downloads_created_at ON app_downloads(created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_downloads_app_id ON app_downloads(app_id, created_at);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_app_downloads_client ON app_downloads(version_id, day, client_hash);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_downloads_ip ON app_downloads(version_id, day, ip_hash);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_downloads_day ON app_downloads(day);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_download_daily_day ON app_download_daily(day);`,
 		`CREATE INDEX IF NOT EXISTS idx_app_upload_tasks_status ON app_upload_tasks(status);`,
 		`CREATE INDEX IF NOT EXISTS idx_app_upload_tasks_package_name ON app_upload_tasks(package_name);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_upload_tasks_claimed_by ON app_upload_tasks(claimed_by);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_review_records_task_id ON app_review_records(task_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_review_records_reviewer ON app_review_records(reviewer_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_apps_developer_id ON apps(developer_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_developer_members_user_id ON developer_members(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_developer_claims_status ON developer_claims(status, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_transfers_app_id ON app_transfers(app_id, status);`,
+		`CREATE INDEX IF NOT EXISTS idx_developer_invites_user_id ON developer_invites(user_id, status);`,
+		`CREATE INDEX IF NOT EXISTS idx_developer_invites_developer_id ON developer_invites(developer_id, status);`,
 		`CREATE INDEX IF NOT EXISTS idx_app_upload_tasks_created_at ON app_upload_tasks(created_at DESC);`,
+		`CREATE INDEX IF NOT EXISTS idx_coin_transactions_user_id ON coin_transactions(user_id, created_at DESC);`,
+		`CREATE INDEX IF NOT EXISTS idx_coin_transactions_tx_no ON coin_transactions(tx_no);`,
+		`CREATE INDEX IF NOT EXISTS idx_coin_transactions_ref ON coin_transactions(ref_type, ref_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_reward_logs_user_date ON reward_logs(user_id, reward_date, action);`,
+		`CREATE INDEX IF NOT EXISTS idx_user_badges_user_id ON user_badges(user_id, is_displayed);`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_featured ON posts(user_id, is_featured);`,
+		`CREATE INDEX IF NOT EXISTS idx_tips_target ON tips(target_type, target_id, created_at DESC);`,
+		`CREATE INDEX IF NOT EXISTS idx_tips_receiver ON tips(receiver_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_user_items_equipped ON user_items(user_id, is_equipped);`,
+		`CREATE INDEX IF NOT EXISTS idx_shop_purchases_user_item ON shop_purchases(user_id, item_id);`,
 	}
 
 	for _, index := range indexes {
@@ -436,6 +1033,24 @@ func createIndexes() error {
 	return nil
 }
 
+// createTriggers 创建触发器
+func createTriggers() error {
+	triggers := []string{
+		// 审计日志只能追加，不能修改和删除
+		`CREATE TRIGGER IF NOT EXISTS trg_audit_logs_no_update BEFORE UPDATE ON audit_logs
+		BEGIN SELECT RAISE(ABORT, 'audit_logs is append-only'); END;`,
+		`CREATE TRIGGER IF NOT EXISTS trg_audit_logs_no_delete BEFORE DELETE ON audit_logs
+		BEGIN SELECT RAISE(ABORT, 'audit_logs is append-only'); END;`,
+	}
+
+	for _, trigger := range triggers {
+		if _, err := DB.Exec(trigger); err != nil {
+			return fmt.Errorf("创建触发器失败: %v", err)
+		}
+	}
+	return nil
+}
+
 // ensureDefaultData 确保默认数据存在
 func ensureDefaultData() error {
 	log.Println("检查默认数据...")
@@ -454,6 +1069,242 @@ func ensureDefaultData() error {
 		}
 	}
 
+	// 创建默认应用分类（分类表为空时）
+	if err := ensureDefaultCategories(); err != nil {
+		log.Printf("创建默认应用分类失败: %v", err)
+	}
+
+	// 把旧的逗号分隔标签迁移到标签表
+	if err := migrateAppTags(); err != nil {
+		log.Printf("迁移应用标签失败: %v", err)
+	}
+
+	// 为开发者资料上线前的应用按开发者名称创建（未认领的）开发者资料
+	if err := migrateAppDevelopers(); err != nil {
+		log.Printf("迁移应用开发者失败: %v", err)
+	}
+
+	// 为去重上线前的下载记录补充日期和渠道，使其可以被汇总（旧记录没有客户端标识，每条算一次下载）
+	if err := migrateAppDownloadDays(); err != nil {
+		log.Printf("迁移下载记录失败: %v", err)
+	}
+
+	// 为流水上线前已有硬币的用户补录期初余额，保证余额可以和流水对账
+	if err := ensureOpeningBalances(); err != nil {
+		log.Printf("补录硬币期初余额失败: %v", err)
+	}
+
+	return nil
+}
+
+// defaultAppCategories 默认应用分类（按显示顺序）
+var defaultAppCategories = []struct {
+	name          string
+	subCategories []string
+}{
+	{"动作冒险", []string{"跑酷闯关", "网游RPG", "赛车体育", "飞行空战", "动作枪战", "格斗快打"}},
+	{"休闲益智", []string{"休闲创意", "棋牌桌游", "模拟经营", "战争策略", "塔防迷宫", "儿童益智"}},
+	{"影音视听", []string{"视频", "音乐", "直播", "电台", "播放器"}},
+	{"实用工具", []string{"系统", "安全", "浏览器", "输入法", "小工具"}},
+	{"聊天社交", []string{"聊天", "婚恋", "通讯", "交友", "社区"}},
+	{"图书阅读", []string{"听书", "漫画", "电子书", "小说", "杂志"}},
+	{"时尚购物", []string{"电商", "团购", "海淘", "导购", "时尚"}},
+	{"摄影摄像", []string{"美图", "相机", "图片分享", "相册", "视频"}},
+	{"学习教育", []string{"外语", "考试", "教育", "育儿", "驾考"}},
+	{"旅行交通", []string{"用车", "地图", "旅游", "酒店", "票务", "公交地铁"}},
+	{"金融理财", []string{"银行", "股票", "基金", "记账", "支付", "贷款"}},
+	{"娱乐消遣", []string{"搞怪", "消遣", "星座运势", "笑话"}},
+	{"新闻资讯", []string{"新闻", "资讯", "科技", "热点", "头条"}},
+	{"居家生活", []string{"闹钟", "查违章", "天气日历", "美食", "电影票", "房产家居"}},
+	{"体育运动", []string{"健身", "计步", "球类", "直播"}},
+	{"医疗健康", []string{"减肥", "经期", "养生", "孕育", "美容", "医疗"}},
+	{"效率办公", []string{"办公", "邮箱", "笔记", "云盘", "日程"}},
+	{"玩机", []string{"系统", "调度", "美化", "其他"}},
+	{"定制系统应用", []string{"OPPO", "真我", "华为", "荣耀", "小米", "VIVO", "三星", "一加", "金立", "LG", "海信", "夏普", "摩托罗拉", "谷歌Google", "iQOO", "红魔", "魅族", "TCL", "百度", "小辣椒", "Fairphone", "Nothing", "努比亚", "索尼", "诺基亚", "黑鲨", "联想", "威图Vertu", "华硕", "酷派", "飞利浦", "乐视", "朵唯", "FreemeOS", "HTC", "柔宇", "黑莓BlackBerry", "AGM", "8848", "鼎桥", "ROG", "中兴", "其他"}},
+}
+
+// ensureDefaultCategories 分类表为空时写入默认应用分类
+func ensureDefaultCategories() error {
+	var count int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM app_categories").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, category := range defaultAppCategories {
+		result, err := tx.Exec("INSERT INTO app_categories (name, sort_order) VALUES (?, ?)", category.name, (i+1)*10)
+		if err != nil {
+			return err
+		}
+		categoryID, _ := result.LastInsertId()
+		for j, sub := range category.subCategories {
+			if _, err := tx.Exec(
+				"INSERT INTO app_subcategories (category_id, name, sort_order) VALUES (?, ?, ?)", categoryID, sub, (j+1)*10,
+			); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Println("✓ 创建默认应用分类成功")
+	return nil
+}
+
+// migrateAppTags 把 apps.tags 中逗号分隔的旧标签迁移到 tags 和 app_tags 表（只处理还没有标签关联的应用）。
+// 迁移后清空 apps.tags，该字段不再使用
+func migrateAppTags() error {
+	rows, err := DB.Query(`
+		SELECT id, tags FROM apps
+		WHERE tags IS NOT NULL AND tags != '' AND id NOT IN (SELECT app_id FROM app_tags)
+	`)
+	if err != nil {
+		return err
+	}
+	legacy := map[int64]string{}
+	for rows.Next() {
+		var appID int64
+		var tags string
+		if rows.Scan(&appID, &tags) == nil {
+			legacy[appID] = tags
+		}
+	}
+	rows.Close()
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for appID, tags := range legacy {
+		for _, tag := range strings.Split(tags, ",") {
+			tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+			if tag == "" {
+				continue
+			}
+			if _, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(
+				"INSERT OR IGNORE INTO app_tags (app_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", appID, tag,
+			); err != nil {
+				return err
+			}
+		}
+		// 清空旧字段，否则标签被清空后下次启动会再次迁移回来
+		if _, err := tx.Exec("UPDATE apps SET tags = '' WHERE id = ?", appID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("✓ 迁移 %d 个应用的标签", len(legacy))
+	return nil
+}
+
+// migrateAppDownloadDays 为没有日期的旧下载记录按下载时间（换算为服务器时区）补充日期，并补充下载版本的渠道
+func migrateAppDownloadDays() error {
+	_, offset := time.Now().Zone()
+	result, err := DB.Exec(fmt.Sprintf(`
+		UPDATE app_downloads SET
+			day = date(created_at, '%+d seconds'),
+			channel = COALESCE(
+				(SELECT COALESCE(v.channel, a.channel, '') FROM app_versions v JOIN apps a ON v.app_id = a.id
+					WHERE v.id = app_downloads.version_id),
+				'')
+		WHERE day IS NULL`, offset))
+	if err != nil {
+		return err
+	}
+	if migrated, _ := result.RowsAffected(); migrated > 0 {
+		log.Printf("✓ 为 %d 条旧下载记录补充日期", migrated)
+	}
+	return nil
+}
+
+// migrateAppDevelopers 为还没有关联开发者资料的应用按开发者名称关联开发者资料（名称相同的共用一个，不存在时创建）
+func migrateAppDevelopers() error {
+	var count int
+	if err := DB.QueryRow(
+		"SELECT COUNT(*) FROM apps WHERE developer_id IS NULL AND TRIM(COALESCE(developer_name, '')) != ''",
+	).Scan(&count); err != nil || count == 0 {
+		return err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO developers (name)
+		SELECT DISTINCT TRIM(developer_name) FROM apps
+		WHERE developer_id IS NULL AND TRIM(COALESCE(developer_name, '')) != ''
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE apps SET developer_id = (SELECT id FROM developers WHERE name = TRIM(apps.developer_name))
+		WHERE developer_id IS NULL AND TRIM(COALESCE(developer_name, '')) != ''
+	`); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("✓ 为 %d 个应用关联开发者资料", count)
+	return nil
+}
+
+// ensureOpeningBalances 为没有任何流水但余额不为0的用户补录期初余额
+func ensureOpeningBalances() error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 先写系统账户一侧，再写用户一侧（用户一侧写入后 NOT EXISTS 条件不再成立）
+	_, err = tx.Exec(`
+		INSERT INTO coin_transactions (tx_no, user_id, counterparty_id, amount, balance_after, type, ref_type, ref_id, idempotency_key, remark)
+		SELECT 'opening-' || u.id, 0, u.id, -u.coins, 0, 'opening', 'user', u.id, 'opening:' || u.id, '期初余额'
+		FROM users u
+		WHERE u.coins != 0 AND NOT EXISTS (SELECT 1 FROM coin_transactions t WHERE t.user_id = u.id)
+	`)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO coin_transactions (tx_no, user_id, counterparty_id, amount, balance_after, type, ref_type, ref_id, idempotency_key, remark)
+		SELECT 'opening-' || u.id, u.id, 0, u.coins, u.coins, 'opening', 'user', u.id, 'opening:' || u.id, '期初余额'
+		FROM users u
+		WHERE u.coins != 0 AND NOT EXISTS (SELECT 1 FROM coin_transactions t WHERE t.user_id = u.id)
+	`)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("✓ 已为 %d 个用户补录硬币期初余额", n)
+	}
 	return nil
 }
 
@@ -468,6 +1319,16 @@ func repairUsersTable() error {
 		{"coins", "INTEGER DEFAULT 0", "0"},
 		{"exp", "INTEGER DEFAULT 0", "0"},
 		{"user_level", "INTEGER DEFAULT 1", "1"},
+		{"email_verified", "INTEGER DEFAULT 0", "0"},
+		{"totp_secret", "TEXT", ""},
+		{"totp_enabled", "INTEGER DEFAULT 0", "0"},
+		{"totp_last_step", "INTEGER DEFAULT 0", "0"},
+		{"has_password", "INTEGER DEFAULT 1", "1"},
+		{"status", "TEXT DEFAULT 'active'", "'active'"},
+		{"status_until", "DATETIME", ""},
+		{"status_reason", "TEXT", ""},
+		{"status_by", "INTEGER", ""},
+		{"status_at", "DATETIME", ""},
 	}
 
 	for _, col := range columns {
@@ -495,6 +1356,7 @@ func repairPostsTable() error {
 		{"user_id", "INTEGER", ""},
 		{"attachment_url", "TEXT", ""},
 		{"attachment_type", "TEXT", ""},
+		{"is_featured", "INTEGER DEFAULT 0", "0"},
 	}
 
 	for _, col := range columns {
@@ -565,6 +1427,134 @@ func repairBoardsTable() error {
 	return nil
 }
 
+// repairSessionsTable 修复sessions表
+func repairSessionsTable() error {
+	if !columnExists("sessions", "two_factor") {
+		log.Printf("为sessions表添加字段: two_factor")
+		if _, err := DB.Exec("ALTER TABLE sessions ADD COLUMN two_factor INTEGER DEFAULT 0"); err != nil {
+			log.Printf("添加字段 two_factor 失败: %v", err)
+		} else {
+			log.Printf("✓ 字段 two_factor 添加成功")
+		}
+	}
+	return nil
+}
+
+// repairAppVersionsTable 修复app_versions表（添加版本下载数和下架相关字段）
+func repairAppVersionsTable() error {
+	columns := []struct {
+		name       string
+		definition string
+	}{
+		{"download_count", "INTEGER DEFAULT 0"},
+		{"withdrawn_at", "DATETIME"},
+		{"withdrawn_by", "INTEGER"},
+		{"withdraw_reason", "TEXT"},
+		{"channel", "TEXT"},
+		{"signer_fingerprint", "TEXT"},
+		{"file_sha256", "TEXT"},
+	}
+
+	for _, col := range columns {
+		if !columnExists("app_versions", col.name) {
+			log.Printf("为app_versions表添加字段: %s", col.name)
+			_, err := DB.Exec(fmt.Sprintf("ALTER TABLE app_versions ADD COLUMN %s %s", col.name, col.definition))
+			if err != nil {
+				log.Printf("添加字段 %s 失败: %v", col.name, err)
+			} else {
+				log.Printf("✓ 字段 %s 添加成功", col.name)
+			}
+		}
+	}
+
+	// 旧版本没有记录渠道，使用应用当前的渠道
+	if _, err := DB.Exec(
+		"UPDATE app_versions SET channel = (SELECT channel FROM apps WHERE apps.id = app_versions.app_id) WHERE channel IS NULL",
+	); err != nil {
+		log.Printf("补全版本渠道失败: %v", err)
+	}
+	return nil
+}
+
+// repairAppReviewRecordsTable 修复app_review_records表
+func repairAppReviewRecordsTable() error {
+	columns := []struct {
+		name       string
+		definition string
+	}{
+		{"field_comments", "TEXT"},
+		{"revision", "INTEGER NOT NULL DEFAULT 1"},
+	}
+
+	for _, col := range columns {
+		if !columnExists("app_review_records", col.name) {
+			log.Printf("为app_review_records表添加字段: %s", col.name)
+			if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE app_review_records ADD COLUMN %s %s", col.name, col.definition)); err != nil {
+				log.Printf("添加字段 %s 失败: %v", col.name, err)
+			} else {
+				log.Printf("✓ 字段 %s 添加成功", col.name)
+			}
+		}
+	}
+	return nil
+}
+
+// repairAppUploadTasksTable 修复app_upload_tasks表
+func repairAppUploadTasksTable() error {
+	columns := []struct {
+		name       string
+		definition string
+	}{
+		{"signer_fingerprint", "TEXT"},
+		{"proposed_tags", "TEXT"},
+		{"claimed_by", "INTEGER"},
+		{"claim_expires_at", "DATETIME"},
+		{"assigned_by", "INTEGER"},
+		{"revision", "INTEGER DEFAULT 1"},
+		{"developer_id", "INTEGER"},
+	}
+
+	for _, col := range columns {
+		if !columnExists("app_upload_tasks", col.name) {
+			log.Printf("为app_upload_tasks表添加字段: %s", col.name)
+			if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE app_upload_tasks ADD COLUMN %s %s", col.name, col.definition)); err != nil {
+				log.Printf("添加字段 %s 失败: %v", col.name, err)
+			} else {
+				log.Printf("✓ 字段 %s 添加成功", col.name)
+			}
+		}
+	}
+	return nil
+}
+
+// repairAppDownloadsTable 修复app_downloads表
+func repairAppDownloadsTable() error {
+	columns := []struct {
+		name       string
+		definition string
+	}{
+		{"version_id", "INTEGER"},
+		{"day", "TEXT"},
+		{"channel", "TEXT"},
+		{"client_hash", "TEXT"},
+		{"ip_hash", "TEXT"},
+		{"hits", "INTEGER DEFAULT 1"},
+	}
+
+	for _, col := range columns {
+		if !columnExists("app_downloads", col.name) {
+			log.Printf("为app_downloads表添加字段: %s", col.name)
+			_, err := DB.Exec(fmt.Sprintf("ALTER TABLE app_downloads ADD COLUMN %s %s", col.name, col.definition))
+			if err != nil {
+				log.Printf("添加字段 %s 失败: %v", col.name, err)
+			} else {
+				log.Printf("✓ 字段 %s 添加成功", col.name)
+			}
+		}
+	}
+	return nil
+}
+
 // columnExists 检查字段是否存在
 func columnExists(tableName, columnName string) bool {
 	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
@@ -607,6 +1597,7 @@ func repairAppsTable() error {
 		{"ad_level", "TEXT", ""},
 		{"payment_type", "TEXT", ""},
 		{"operation_type", "TEXT", ""},
+		{"developer_id", "INTEGER", ""},
 	}
 
 	for _, col := range columns {
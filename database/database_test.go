@@ -0,0 +1,41 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateAppTagsDoesNotRestoreClearedTags(t *testing.T) {
+	if err := Open(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(CloseDB)
+
+	result, err := DB.Exec("INSERT INTO apps (package_name, name, tags) VALUES ('com.example.legacy', 'Legacy', 'Tools, Games')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appID, _ := result.LastInsertId()
+
+	countTags := func() int {
+		var n int
+		DB.QueryRow("SELECT COUNT(*) FROM app_tags WHERE app_id = ?", appID).Scan(&n)
+		return n
+	}
+
+	if err := migrateAppTags(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countTags(); n != 2 {
+		t.Fatalf("迁移后标签数 = %d, 期望 2", n)
+	}
+
+	// 审核时清空标签后再次启动迁移，不应恢复旧标签
+	DB.Exec("DELETE FROM app_tags WHERE app_id = ?", appID)
+	if err := migrateAppTags(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countTags(); n != 0 {
+		t.Fatalf("再次迁移后标签数 = %d, 期望 0", n)
+	}
+}
@@ -0,0 +1,531 @@
+package handlers
+
+import (
+	"TaruApp/config"
+	"TaruApp/database"
+	"TaruApp/mailer"
+	"TaruApp/models"
+	"TaruApp/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 验证码用途
+const (
+	codePurposeEmailVerify   = "email_verify"
+	codePurposePasswordReset = "password_reset"
+)
+
+const (
+	verificationCodeLength = 6           // 验证码位数
+	maxCodeAttempts        = 5           // 每个验证码最多尝试次数
+	codeResendInterval     = time.Minute // 同一用途两次发送验证码的最短间隔
+)
+
+var (
+	errCodeTooFrequent    = errors.New("验证码发送过于频繁，请稍后再试")
+	errCodeInvalid        = errors.New("验证码错误或已过期")
+	errPasswordInvalid    = errors.New("密码错误")
+	errOldPasswordInvalid = errors.New("旧密码错误")
+	errReauthNotAvailable = errors.New("请先通过找回密码设置密码或开启两步验证")
+)
+
+// createVerificationCode 生成新的验证码（同一用户同一用途之前未使用的验证码作废）
+func createVerificationCode(userID int64, purpose, target string) (string, error) {
+	var recent int
+	err := database.DB.QueryRow(
+		"SELECT COUNT(*) FROM verification_codes WHERE user_id = ? AND purpose = ? AND created_at > ?",
+		userID, purpose, formatDBTime(time.Now().Add(-codeResendInterval)),
+	).Scan(&recent)
+	if err != nil {
+		return "", err
+	}
+	if recent > 0 {
+		return "", errCodeTooFrequent
+	}
+
+	code, err := utils.RandomDigits(verificationCodeLength)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE verification_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		userID, purpose,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := time.Now().Add(time.Duration(config.AppConfig.VerificationCodeTTL) * time.Minute)
+	_, err = tx.Exec(
+		"INSERT INTO verification_codes (user_id, purpose, target, code_hash, expires_at) VALUES (?, ?, ?, ?, ?)",
+		userID, purpose, target, utils.HashToken(code), formatDBTime(expiresAt),
+	)
+	if err != nil {
+		return "", err
+	}
+	return code, tx.Commit()
+}
+
+// consumeVerificationCode 校验验证码并在事务中标记为已使用，错误次数过多的验证码直接作废。
+// 验证码错误时在同一事务中记录错误次数并提交，调用方不能再使用该事务
+func consumeVerificationCode(tx *sql.Tx, userID int64, purpose, target, code string) error {
+	var id int64
+	var codeHash string
+	var attempts int
+	err := tx.QueryRow(`
+		SELECT id, code_hash, attempts FROM verification_codes
+		WHERE user_id = ? AND purpose = ? AND target = ? AND used_at IS NULL AND expires_at > ?
+		ORDER BY id DESC LIMIT 1
+	`, userID, purpose, target, formatDBTime(time.Now())).Scan(&id, &codeHash, &attempts)
+	if err == sql.ErrNoRows {
+		return errCodeInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	if attempts >= maxCodeAttempts || utils.HashToken(code) != codeHash {
+		// 事务持有数据库锁，错误次数必须在同一事务中写入并提交，不能随调用方的事务回滚
+		if _, err = tx.Exec("UPDATE verification_codes SET attempts = attempts + 1 WHERE id = ?", id); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		return errCodeInvalid
+	}
+
+	_, err = tx.Exec("UPDATE verification_codes SET used_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return err
+}
+
+// sendEmailVerification 向用户邮箱发送验证码
+func sendEmailVerification(userID int64, username, email string) error {
+	code, err := createVerificationCode(userID, codePurposeEmailVerify, email)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("%s，你好：\n\n你的邮箱验证码是 %s，%d 分钟内有效。\n\n如果这不是你本人的操作，请忽略此邮件。",
+		username, code, config.AppConfig.VerificationCodeTTL)
+	return mailer.Send(email, "TaruApp 邮箱验证", body)
+}
+
+// respondCodeError 根据验证码相关错误写入响应
+func respondCodeError(c *gin.Context, err error, message string) {
+	switch err {
+	case errCodeTooFrequent:
+		c.JSON(http.StatusTooManyRequests, models.Response{
+			Code:    429,
+			Message: err.Error(),
+		})
+	case errCodeInvalid, errPasswordInvalid, errOldPasswordInvalid, errReauthNotAvailable:
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: message + ": " + err.Error(),
+		})
+	}
+}
+
+// verifyCurrentCredential 敏感操作前在事务中再次确认身份：设置了密码的账号校验当前密码，
+// 第三方登录创建、尚未设置密码的账号校验两步验证码或恢复码
+func verifyCurrentCredential(tx *sql.Tx, userID int64, password, code string) error {
+	var storedPassword string
+	var hasPassword, totpEnabled bool
+	err := tx.QueryRow(
+		"SELECT password, has_password, totp_enabled FROM users WHERE id = ?", userID,
+	).Scan(&storedPassword, &hasPassword, &totpEnabled)
+	if err != nil {
+		return err
+	}
+
+	if hasPassword {
+		if password == "" || utils.VerifyPassword(storedPassword, password) != nil {
+			return errPasswordInvalid
+		}
+		return nil
+	}
+	if !totpEnabled {
+		return errReauthNotAvailable
+	}
+	if code == "" {
+		return errCodeInvalid
+	}
+	return verifySecondFactor(tx, userID, code, true)
+}
+
+// emailTakenByOther 检查邮箱是否已被其他账号验证绑定
+func emailTakenByOther(email string, userID int64) bool {
+	var count int
+	database.DB.QueryRow(
+		"SELECT COUNT(*) FROM users WHERE email = ? AND email_verified = 1 AND id != ?",
+		email, userID,
+	).Scan(&count)
+	return count > 0
+}
+
+// ChangePassword 修改密码（需要旧密码，尚未设置密码的账号需要两步验证码或恢复码），成功后所有登录会话失效，并为当前设备重新签发令牌
+func ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	sessionID, _ := c.Get("session_id")
+	uid := userID.(int64)
+
+	var user models.User
+	err := database.DB.QueryRow(
+		"SELECT username, level FROM users WHERE id = ?", uid,
+	).Scan(&user.Username, &user.Level)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询用户失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 尚未设置密码的账号使用两步验证码确认身份，防止访问令牌泄露后被设置密码接管账号
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondCodeError(c, err, "修改密码失败")
+		return
+	}
+	defer tx.Rollback()
+	if err = verifyCurrentCredential(tx, uid, req.OldPassword, req.Code); err != nil {
+		if err == errPasswordInvalid {
+			err = errOldPasswordInvalid
+		}
+		respondCodeError(c, err, "修改密码失败")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		respondCodeError(c, err, "修改密码失败")
+		return
+	}
+
+	if err = updatePassword(uid, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "修改密码失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 当前设备使用新的会话继续登录（保留设备名称和两步验证状态）
+	var deviceName string
+	var twoFactor bool
+	database.DB.QueryRow(
+		"SELECT COALESCE(device_name, ''), two_factor FROM sessions WHERE id = ?", sessionID,
+	).Scan(&deviceName, &twoFactor)
+	pair, err := startSession(database.DB, c, uid, user.Username, user.Level, deviceName, twoFactor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "密码已修改，但生成令牌失败，请重新登录: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "修改密码成功，其他设备已退出登录",
+		Data:    pair,
+	})
+}
+
+// updatePassword 更新密码并注销用户的所有登录会话
+func updatePassword(userID int64, newPassword string) error {
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.Exec(
+		"UPDATE users SET password = ?, has_password = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		hashedPassword, userID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = revokeUserSessions(userID, "")
+	return err
+}
+
+// ForgotPassword 忘记密码，向已验证的邮箱发送重置验证码（无论邮箱是否存在都返回成功，避免泄露注册信息）
+func ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var userID int64
+	var username string
+	err := database.DB.QueryRow(
+		"SELECT id, username FROM users WHERE email = ? AND email_verified = 1",
+		req.Email,
+	).Scan(&userID, &username)
+	if err == nil {
+		code, err := createVerificationCode(userID, codePurposePasswordReset, req.Email)
+		if err == nil {
+			body := fmt.Sprintf("%s，你好：\n\n你正在重置 TaruApp 账号密码，验证码是 %s，%d 分钟内有效，只能使用一次。\n\n如果这不是你本人的操作，请忽略此邮件，你的密码不会改变。",
+				username, code, config.AppConfig.VerificationCodeTTL)
+			err = mailer.Send(req.Email, "TaruApp 密码重置", body)
+		}
+		if err != nil && err != errCodeTooFrequent {
+			log.Printf("发送密码重置邮件失败: user_id=%d err=%v", userID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "如果该邮箱已绑定账号，重置验证码将发送到该邮箱",
+	})
+}
+
+// ResetPassword 使用邮箱验证码重置密码，成功后所有登录会话失效
+func ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var userID int64
+	err := database.DB.QueryRow(
+		"SELECT id FROM users WHERE email = ? AND email_verified = 1",
+		req.Email,
+	).Scan(&userID)
+	if err != nil {
+		respondCodeError(c, errCodeInvalid, "重置密码失败")
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondCodeError(c, err, "重置密码失败")
+		return
+	}
+	defer tx.Rollback()
+
+	if err = consumeVerificationCode(tx, userID, codePurposePasswordReset, req.Email, req.Code); err != nil {
+		respondCodeError(c, err, "重置密码失败")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		respondCodeError(c, err, "重置密码失败")
+		return
+	}
+
+	if err = updatePassword(userID, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "重置密码失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "重置密码成功，请使用新密码登录",
+	})
+}
+
+// SendEmailVerification 重新发送邮箱验证码
+func SendEmailVerification(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(int64)
+
+	var username, email string
+	var verified bool
+	err := database.DB.QueryRow(
+		"SELECT username, COALESCE(email, ''), email_verified FROM users WHERE id = ?", uid,
+	).Scan(&username, &email, &verified)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询用户失败: " + err.Error(),
+		})
+		return
+	}
+	if email == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "尚未设置邮箱",
+		})
+		return
+	}
+	if verified {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "邮箱已验证",
+		})
+		return
+	}
+
+	if err = sendEmailVerification(uid, username, email); err != nil {
+		respondCodeError(c, err, "发送验证码失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "验证码已发送",
+	})
+}
+
+// VerifyEmail 使用验证码验证邮箱
+func VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(int64)
+
+	var email string
+	database.DB.QueryRow("SELECT COALESCE(email, '') FROM users WHERE id = ?", uid).Scan(&email)
+	if email == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "尚未设置邮箱",
+		})
+		return
+	}
+	if emailTakenByOther(email, uid) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该邮箱已被其他账号绑定",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondCodeError(c, err, "验证邮箱失败")
+		return
+	}
+	defer tx.Rollback()
+
+	if err = consumeVerificationCode(tx, uid, codePurposeEmailVerify, email, req.Code); err != nil {
+		respondCodeError(c, err, "验证邮箱失败")
+		return
+	}
+	_, err = tx.Exec("UPDATE users SET email_verified = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?", uid)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		respondCodeError(c, err, "验证邮箱失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "邮箱验证成功",
+		Data: gin.H{
+			"email":          email,
+			"email_verified": true,
+		},
+	})
+}
+
+// ChangeEmail 修改邮箱（需要当前密码，未设置密码的账号需要两步验证码或恢复码），新邮箱需要重新验证
+func ChangeEmail(c *gin.Context) {
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	username, _ := c.Get("username")
+	uid := userID.(int64)
+
+	if emailTakenByOther(req.Email, uid) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该邮箱已被其他账号绑定",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondCodeError(c, err, "修改邮箱失败")
+		return
+	}
+	defer tx.Rollback()
+
+	// 邮箱可用于重置密码，修改前必须再次确认身份，防止访问令牌泄露后账号被接管
+	if err = verifyCurrentCredential(tx, uid, req.Password, req.Code); err != nil {
+		respondCodeError(c, err, "修改邮箱失败")
+		return
+	}
+	_, err = tx.Exec(
+		"UPDATE users SET email = ?, email_verified = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		req.Email, uid,
+	)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		respondCodeError(c, err, "修改邮箱失败")
+		return
+	}
+
+	// 邮箱已修改，验证码发送失败时可以稍后重新发送
+	sent := true
+	if err = sendEmailVerification(uid, username.(string), req.Email); err != nil {
+		log.Printf("发送邮箱验证码失败: user_id=%d err=%v", uid, err)
+		sent = false
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "修改邮箱成功，请查收验证码完成验证",
+		Data: gin.H{
+			"email":             req.Email,
+			"email_verified":    false,
+			"verification_sent": sent,
+		},
+	})
+}
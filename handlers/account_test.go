@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResetPasswordLocksCodeAfterMaxAttempts(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "alice", "old-password", "alice@example.com")
+
+	code, err := createVerificationCode(uid, codePurposePasswordReset, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	req := models.ResetPasswordRequest{Email: "alice@example.com", Code: wrong, NewPassword: "new-password"}
+	for i := 0; i < maxCodeAttempts; i++ {
+		start := time.Now()
+		w := performJSON(ResetPassword, http.MethodPost, 0, req)
+		assertStatus(t, w, http.StatusBadRequest)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("第 %d 次错误尝试耗时 %v，记录错误次数时可能在等待数据库锁", i+1, elapsed)
+		}
+	}
+
+	var attempts int
+	database.DB.QueryRow(
+		"SELECT attempts FROM verification_codes WHERE user_id = ? AND purpose = ?", uid, codePurposePasswordReset,
+	).Scan(&attempts)
+	if attempts != maxCodeAttempts {
+		t.Fatalf("attempts = %d, 期望 %d", attempts, maxCodeAttempts)
+	}
+
+	// 错误次数用完后，正确的验证码也不能再使用
+	req.Code = code
+	w := performJSON(ResetPassword, http.MethodPost, 0, req)
+	assertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestResetPasswordWithValidCode(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "bob", "old-password", "bob@example.com")
+
+	code, err := createVerificationCode(uid, codePurposePasswordReset, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := models.ResetPasswordRequest{Email: "bob@example.com", Code: code, NewPassword: "new-password"}
+	assertStatus(t, performJSON(ResetPassword, http.MethodPost, 0, req), http.StatusOK)
+	// 验证码只能使用一次
+	assertStatus(t, performJSON(ResetPassword, http.MethodPost, 0, req), http.StatusBadRequest)
+}
+
+func TestChangeEmailRequiresCurrentPassword(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "carol", "current-password", "carol@example.com")
+
+	w := performJSON(ChangeEmail, http.MethodPut, uid, models.ChangeEmailRequest{Email: "evil@example.com"})
+	assertStatus(t, w, http.StatusBadRequest)
+
+	w = performJSON(ChangeEmail, http.MethodPut, uid, models.ChangeEmailRequest{Email: "evil@example.com", Password: "wrong-password"})
+	assertStatus(t, w, http.StatusBadRequest)
+
+	var email string
+	database.DB.QueryRow("SELECT email FROM users WHERE id = ?", uid).Scan(&email)
+	if email != "carol@example.com" {
+		t.Fatalf("密码错误时邮箱被修改为 %s", email)
+	}
+
+	w = performJSON(ChangeEmail, http.MethodPut, uid, models.ChangeEmailRequest{Email: "carol2@example.com", Password: "current-password"})
+	assertStatus(t, w, http.StatusOK)
+}
+
+func TestChangeEmailWithoutPasswordRequiresSecondFactor(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "dave", "", "dave@example.com")
+	database.DB.Exec("UPDATE users SET has_password = 0 WHERE id = ?", uid)
+
+	w := performJSON(ChangeEmail, http.MethodPut, uid, models.ChangeEmailRequest{Email: "dave2@example.com"})
+	assertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestChangeEmailWithoutPasswordAcceptsRecoveryCode(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "gina", "", "gina@example.com")
+	database.DB.Exec("UPDATE users SET has_password = 0 WHERE id = ?", uid)
+	codes := enableTestTwoFactor(t, uid)
+
+	w := performJSON(ChangeEmail, http.MethodPut, uid, models.ChangeEmailRequest{Email: "gina2@example.com", Code: codes[0]})
+	assertStatus(t, w, http.StatusOK)
+}
+
+func TestChangePasswordWithoutPasswordRequiresSecondFactor(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "hank", "", "hank@example.com")
+	database.DB.Exec("UPDATE users SET has_password = 0 WHERE id = ?", uid)
+
+	// 没有密码也没有开启两步验证时不能只凭访问令牌设置密码
+	w := performJSON(ChangePassword, http.MethodPut, uid, models.ChangePasswordRequest{NewPassword: "attacker-password"})
+	assertStatus(t, w, http.StatusBadRequest)
+
+	codes := enableTestTwoFactor(t, uid)
+	w = performJSON(ChangePassword, http.MethodPut, uid, models.ChangePasswordRequest{NewPassword: "attacker-password"})
+	assertStatus(t, w, http.StatusBadRequest)
+
+	var hasPassword bool
+	database.DB.QueryRow("SELECT has_password FROM users WHERE id = ?", uid).Scan(&hasPassword)
+	if hasPassword {
+		t.Fatal("没有提供验证码时不应设置密码")
+	}
+
+	w = performJSON(ChangePassword, http.MethodPut, uid, models.ChangePasswordRequest{NewPassword: "new-password", Code: codes[0]})
+	assertStatus(t, w, http.StatusOK)
+}
+
+func TestChangePasswordRequiresOldPassword(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "ivan", "old-password", "ivan@example.com")
+
+	w := performJSON(ChangePassword, http.MethodPut, uid, models.ChangePasswordRequest{OldPassword: "wrong-password", NewPassword: "new-password"})
+	assertStatus(t, w, http.StatusBadRequest)
+
+	w = performJSON(ChangePassword, http.MethodPut, uid, models.ChangePasswordRequest{OldPassword: "old-password", NewPassword: "new-password"})
+	assertStatus(t, w, http.StatusOK)
+}
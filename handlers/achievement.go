@@ -0,0 +1,520 @@
+package handlers
+
+import (
+	"TaruApp/config"
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDisplayedBadges 个人主页最多展示的徽章数量
+const maxDisplayedBadges = 5
+
+// 成就统计指标
+const (
+	achievementMetricCheckInCount      = "checkin_count"       // 累计签到天数
+	achievementMetricPostCount         = "post_count"          // 累计发帖数
+	achievementMetricCommentCount      = "comment_count"       // 累计评论数
+	achievementMetricReceivedLikes     = "received_likes"      // 帖子和评论累计获得的点赞数
+	achievementMetricReceivedCoins     = "received_coins"      // 帖子和评论累计获得的投币数
+	achievementMetricApprovedAppCount  = "approved_app_count"  // 审核通过的应用上传数
+	achievementMetricFeaturedPostCount = "featured_post_count" // 精华帖数
+	achievementMetricUserLevel         = "user_level"          // 用户等级
+)
+
+// achievementMetricQueries 各统计指标的查询语句，参数均为用户ID
+var achievementMetricQueries = map[string]string{
+	achievementMetricCheckInCount:      "SELECT COUNT(*) FROM check_ins WHERE user_id = ?",
+	achievementMetricPostCount:         "SELECT COUNT(*) FROM posts WHERE user_id = ?",
+	achievementMetricCommentCount:      "SELECT COUNT(*) FROM comments WHERE user_id = ?",
+	achievementMetricReceivedLikes:     "SELECT (SELECT COALESCE(SUM(likes), 0) FROM posts WHERE user_id = ?) + (SELECT COALESCE(SUM(likes), 0) FROM comments WHERE user_id = ?)",
+	achievementMetricReceivedCoins:     "SELECT COALESCE(SUM(amount), 0) FROM coin_transactions WHERE user_id = ? AND type IN ('coin_post', 'coin_comment') AND amount > 0",
+	achievementMetricApprovedAppCount:  "SELECT COUNT(*) FROM app_upload_tasks WHERE user_id = ? AND status = 'approved'",
+	achievementMetricFeaturedPostCount: "SELECT COUNT(*) FROM posts WHERE user_id = ? AND is_featured = 1",
+	achievementMetricUserLevel:         "SELECT user_level FROM users WHERE id = ?",
+}
+
+// rewardActionMetrics 奖励动作发生后需要重新检查的成就指标
+var rewardActionMetrics = map[string][]string{
+	rewardActionCheckIn:      {achievementMetricCheckInCount},
+	rewardActionPost:         {achievementMetricPostCount},
+	rewardActionComment:      {achievementMetricCommentCount},
+	rewardActionReceivedLike: {achievementMetricReceivedLikes},
+	rewardActionReceivedCoin: {achievementMetricReceivedCoins},
+	rewardActionAppApproved:  {achievementMetricApprovedAppCount},
+}
+
+var (
+	achievementsMu sync.RWMutex
+	achievements   = defaultAchievements()
+)
+
+// defaultAchievements 内置默认成就
+func defaultAchievements() []models.Achievement {
+	return []models.Achievement{
+		{Code: "first_checkin", Name: "初来乍到", Description: "完成第一次签到", IconURL: "/badges/first_checkin.png", Metric: achievementMetricCheckInCount, Threshold: 1},
+		{Code: "checkin_100", Name: "签到达人", Description: "累计签到100天", IconURL: "/badges/checkin_100.png", Metric: achievementMetricCheckInCount, Threshold: 100},
+		{Code: "first_post", Name: "初次发声", Description: "发布第一个帖子", IconURL: "/badges/first_post.png", Metric: achievementMetricPostCount, Threshold: 1},
+		{Code: "first_app", Name: "应用开发者", Description: "第一个应用审核通过", IconURL: "/badges/first_app.png", Metric: achievementMetricApprovedAppCount, Threshold: 1},
+		{Code: "likes_1000", Name: "人气之星", Description: "帖子和评论累计获得1000个赞", IconURL: "/badges/likes_1000.png", Metric: achievementMetricReceivedLikes, Threshold: 1000},
+		{Code: "featured_10", Name: "精华作者", Description: "累计10篇帖子被设为精华", IconURL: "/badges/featured_10.png", Metric: achievementMetricFeaturedPostCount, Threshold: 10},
+		{Code: "level_5", Name: "资深用户", Description: "用户等级达到Lv5", IconURL: "/badges/level_5.png", Metric: achievementMetricUserLevel, Threshold: 5},
+	}
+}
+
+// currentAchievements 获取当前生效的成就定义（返回值只读）
+func currentAchievements() []models.Achievement {
+	achievementsMu.RLock()
+	defer achievementsMu.RUnlock()
+	return achievements
+}
+
+// LoadAchievements 从配置文件加载成就定义，文件不存在时使用内置默认成就
+func LoadAchievements(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		achievementsMu.Lock()
+		achievements = defaultAchievements()
+		achievementsMu.Unlock()
+		log.Printf("成就定义文件 %s 不存在，使用内置默认成就", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var defs []models.Achievement
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return fmt.Errorf("解析成就定义文件失败: %v", err)
+	}
+
+	codes := make(map[string]bool)
+	for _, def := range defs {
+		if def.Code == "" || def.Name == "" {
+			return fmt.Errorf("成就的 code 和 name 不能为空")
+		}
+		if codes[def.Code] {
+			return fmt.Errorf("成就 %s 重复定义", def.Code)
+		}
+		if _, ok := achievementMetricQueries[def.Metric]; !ok {
+			return fmt.Errorf("成就 %s 使用了未知的指标: %s", def.Code, def.Metric)
+		}
+		if def.Threshold <= 0 {
+			return fmt.Errorf("成就 %s 的达成阈值必须大于0", def.Code)
+		}
+		codes[def.Code] = true
+	}
+
+	achievementsMu.Lock()
+	achievements = defs
+	achievementsMu.Unlock()
+	log.Printf("✓ 已加载 %d 个成就: %s", len(defs), path)
+	return nil
+}
+
+// rowQueryer 可以执行单行查询的对象（*sql.DB 或 *sql.Tx）
+type rowQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// queryAchievementMetric 查询用户某个统计指标的当前值
+func queryAchievementMetric(q rowQueryer, userID int64, metric string) (int, error) {
+	query := achievementMetricQueries[metric]
+	args := make([]interface{}, strings.Count(query, "?"))
+	for i := range args {
+		args[i] = userID
+	}
+
+	var value int
+	err := q.QueryRow(query, args...).Scan(&value)
+	return value, err
+}
+
+// checkAchievements 在事务中检查用户与指定指标相关的成就，授予新达成的徽章
+// 不指定指标时检查全部成就；新徽章在展示数量未满时自动展示
+func checkAchievements(tx *sql.Tx, userID int64, metrics ...string) ([]models.UserBadge, error) {
+	owned := make(map[string]bool)
+	rows, err := tx.Query("SELECT achievement_code FROM user_badges WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err == nil {
+			owned[code] = true
+		}
+	}
+	rows.Close()
+
+	var displayedCount int
+	if err := tx.QueryRow(
+		"SELECT COUNT(*) FROM user_badges WHERE user_id = ? AND is_displayed = 1",
+		userID,
+	).Scan(&displayedCount); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]int)
+	awarded := []models.UserBadge{}
+	for _, def := range currentAchievements() {
+		if owned[def.Code] {
+			continue
+		}
+		if len(metrics) > 0 && !utils.Contains(metrics, def.Metric) {
+			continue
+		}
+
+		value, ok := values[def.Metric]
+		if !ok {
+			value, err = queryAchievementMetric(tx, userID, def.Metric)
+			if err != nil {
+				return nil, err
+			}
+			values[def.Metric] = value
+		}
+		if value < def.Threshold {
+			continue
+		}
+
+		badge := models.UserBadge{
+			UserID:          userID,
+			AchievementCode: def.Code,
+			Name:            def.Name,
+			Description:     def.Description,
+			IconURL:         def.IconURL,
+			IsDisplayed:     displayedCount < maxDisplayedBadges,
+			AwardedAt:       time.Now(),
+		}
+		if badge.IsDisplayed {
+			displayedCount++
+			badge.DisplayOrder = displayedCount
+		}
+
+		result, err := tx.Exec(
+			`INSERT INTO user_badges (user_id, achievement_code, name, description, icon_url, is_displayed, display_order, awarded_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			badge.UserID, badge.AchievementCode, badge.Name, badge.Description, badge.IconURL,
+			badge.IsDisplayed, badge.DisplayOrder, badge.AwardedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		badge.ID, _ = result.LastInsertId()
+		owned[def.Code] = true
+		awarded = append(awarded, badge)
+	}
+
+	return awarded, nil
+}
+
+// getUserBadges 查询用户的徽章，displayedOnly 为 true 时只返回展示中的徽章
+func getUserBadges(userID interface{}, displayedOnly bool) ([]models.UserBadge, error) {
+	query := `SELECT id, user_id, achievement_code, name, COALESCE(description, ''), COALESCE(icon_url, ''),
+		is_displayed, display_order, awarded_at
+		FROM user_badges WHERE user_id = ?`
+	if displayedOnly {
+		query += " AND is_displayed = 1 ORDER BY display_order ASC"
+	} else {
+		query += " ORDER BY awarded_at DESC"
+	}
+
+	rows, err := database.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	badges := []models.UserBadge{}
+	for rows.Next() {
+		var badge models.UserBadge
+		if err := rows.Scan(
+			&badge.ID, &badge.UserID, &badge.AchievementCode, &badge.Name, &badge.Description, &badge.IconURL,
+			&badge.IsDisplayed, &badge.DisplayOrder, &badge.AwardedAt,
+		); err != nil {
+			continue
+		}
+		badges = append(badges, badge)
+	}
+	return badges, nil
+}
+
+// GetMyAchievements 获取我的成就进度（会先补发已满足条件但未授予的徽章）
+func GetMyAchievements(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(int64)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询成就失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	newBadges, err := checkAchievements(tx, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "检查成就失败: " + err.Error(),
+		})
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "检查成就失败: " + err.Error(),
+		})
+		return
+	}
+
+	badges, err := getUserBadges(uid, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询徽章失败: " + err.Error(),
+		})
+		return
+	}
+	awardedAt := make(map[string]time.Time)
+	for _, badge := range badges {
+		awardedAt[badge.AchievementCode] = badge.AwardedAt
+	}
+
+	values := make(map[string]int)
+	list := []models.AchievementProgress{}
+	for _, def := range currentAchievements() {
+		value, ok := values[def.Metric]
+		if !ok {
+			value, _ = queryAchievementMetric(database.DB, uid, def.Metric)
+			values[def.Metric] = value
+		}
+
+		item := models.AchievementProgress{Achievement: def, Progress: value}
+		if t, ok := awardedAt[def.Code]; ok {
+			item.Achieved = true
+			item.AwardedAt = &t
+		}
+		list = append(list, item)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取成就成功",
+		Data: gin.H{
+			"achievements": list,
+			"new_badges":   newBadges,
+		},
+	})
+}
+
+// GetUserBadges 获取用户获得的所有徽章
+func GetUserBadges(c *gin.Context) {
+	userID := c.Param("id")
+
+	badges, err := getUserBadges(userID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询徽章失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取徽章成功",
+		Data:    badges,
+	})
+}
+
+// SetDisplayedBadges 设置个人主页展示的徽章
+func SetDisplayedBadges(c *gin.Context) {
+	var req models.SetDisplayedBadgesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	if len(req.Codes) > maxDisplayedBadges {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: fmt.Sprintf("最多只能展示 %d 个徽章", maxDisplayedBadges),
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "设置展示徽章失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE user_badges SET is_displayed = 0, display_order = 0 WHERE user_id = ?", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "设置展示徽章失败: " + err.Error(),
+		})
+		return
+	}
+
+	for i, code := range req.Codes {
+		result, err := tx.Exec(
+			"UPDATE user_badges SET is_displayed = 1, display_order = ? WHERE user_id = ? AND achievement_code = ? AND is_displayed = 0",
+			i+1, userID, code,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "设置展示徽章失败: " + err.Error(),
+			})
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "未获得该徽章或重复设置: " + code,
+			})
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "设置展示徽章失败: " + err.Error(),
+		})
+		return
+	}
+
+	badges, _ := getUserBadges(userID, true)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "设置展示徽章成功",
+		Data:    badges,
+	})
+}
+
+// FeaturePost 设置或取消精华帖（管理员权限）
+func FeaturePost(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.FeaturePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "设置精华帖失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var postUserID int64
+	err = tx.QueryRow("SELECT user_id FROM posts WHERE id = ?", id).Scan(&postUserID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "帖子不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询帖子失败: " + err.Error(),
+		})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE posts SET is_featured = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", req.Featured, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "设置精华帖失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 精华帖数量变化后检查作者的成就
+	newBadges := []models.UserBadge{}
+	if req.Featured {
+		newBadges, err = checkAchievements(tx, postUserID, achievementMetricFeaturedPostCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "检查成就失败: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "设置精华帖失败: " + err.Error(),
+		})
+		return
+	}
+
+	message := "设置精华帖成功"
+	if !req.Featured {
+		message = "取消精华帖成功"
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: message,
+		Data: gin.H{
+			"post_id":           id,
+			"is_featured":       req.Featured,
+			"author_new_badges": newBadges,
+		},
+	})
+}
+
+// ReloadAchievements 重新加载成就定义文件（管理员权限）
+func ReloadAchievements(c *gin.Context) {
+	if err := LoadAchievements(config.AppConfig.AchievementsPath); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "加载成就定义失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "成就定义已重新加载",
+		Data:    currentAchievements(),
+	})
+}
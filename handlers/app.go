@@ -5,37 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
+	"time"
 
+	"TaruApp/config"
 	"TaruApp/database"
 	"TaruApp/models"
 
 	"github.com/gin-gonic/gin"
 )
 
-// 定义应用分类数据
-var appCategories = map[string][]string{
-	"动作冒险":   {"跑酷闯关", "网游RPG", "赛车体育", "飞行空战", "动作枪战", "格斗快打"},
-	"休闲益智":   {"休闲创意", "棋牌桌游", "模拟经营", "战争策略", "塔防迷宫", "儿童益智"},
-	"影音视听":   {"视频", "音乐", "直播", "电台", "播放器"},
-	"实用工具":   {"系统", "安全", "浏览器", "输入法", "小工具"},
-	"聊天社交":   {"聊天", "婚恋", "通讯", "交友", "社区"},
-	"图书阅读":   {"听书", "漫画", "电子书", "小说", "杂志"},
-	"时尚购物":   {"电商", "团购", "海淘", "导购", "时尚"},
-	"摄影摄像":   {"美图", "相机", "图片分享", "相册", "视频"},
-	"学习教育":   {"外语", "考试", "教育", "育儿", "驾考"},
-	"旅行交通":   {"用车", "地图", "旅游", "酒店", "票务", "公交地铁"},
-	"金融理财":   {"银行", "股票", "基金", "记账", "支付", "贷款"},
-	"娱乐消遣":   {"搞怪", "消遣", "星座运势", "笑话"},
-	"新闻资讯":   {"新闻", "资讯", "科技", "热点", "头条"},
-	"居家生活":   {"闹钟", "查违章", "天气日历", "美食", "电影票", "房产家居"},
-	"体育运动":   {"健身", "计步", "球类", "直播"},
-	"医疗健康":   {"减肥", "经期", "养生", "孕育", "美容", "医疗"},
-	"效率办公":   {"办公", "邮箱", "笔记", "云盘", "日程"},
-	"玩机":     {"系统", "调度", "美化", "其他"},
-	"定制系统应用": {"OPPO", "真我", "华为", "荣耀", "小米", "VIVO", "三星", "一加", "金立", "LG", "海信", "夏普", "摩托罗拉", "谷歌Google", "iQOO", "红魔", "魅族", "TCL", "百度", "小辣椒", "Fairphone", "Nothing", "努比亚", "索尼", "诺基亚", "黑鲨", "联想", "威图Vertu", "华硕", "酷派", "飞利浦", "乐视", "朵唯", "FreemeOS", "HTC", "柔宇", "黑莓BlackBerry", "AGM", "8848", "鼎桥", "ROG", "中兴", "其他"},
-}
-
 // GetApps 获取应用列表
 func GetApps(c *gin.Context) {
 	var query models.GetAppsQuery
@@ -71,13 +49,13 @@ func GetApps(c *gin.Context) {
 	args := []interface{}{}
 	countArgs := []interface{}{}
 
-	// 分类筛选
-	if query.Category != "" {
-		baseQuery += " AND a.tags LIKE ?"
-		countQuery += " AND a.tags LIKE ?"
-		categoryArg := "%" + query.Category + "%"
-		args = append(args, categoryArg)
-		countArgs = append(countArgs, categoryArg)
+	// 标签筛选：tags 和旧参数 category 必须全部包含，any_tags 至少包含一个
+	allTags := splitTagsParam(query.Tags + "," + query.Category)
+	if condition, tagArgs := appTagFilter(allTags, splitTagsParam(query.AnyTags)); condition != "" {
+		baseQuery += " AND " + condition
+		countQuery += " AND " + condition
+		args = append(args, tagArgs...)
+		countArgs = append(countArgs, tagArgs...)
 	}
 
 	// 排序
@@ -166,17 +144,18 @@ func GetAppDetail(c *gin.Context) {
 	// 首先获取应用基本信息
 	var app models.App
 	var mainCategory, subCategory, channel, shareDesc, developerName, adLevel, paymentType, operationType sql.NullString
+	var developerID sql.NullInt64
 	err := database.DB.QueryRow(
 		`SELECT id, package_name, name, icon_url, description, tags, main_category, sub_category,
 			channel, share_desc, developer_name, ad_level, payment_type, operation_type,
-			rating, rating_count, total_coins, download_count 
+			rating, rating_count, total_coins, download_count, developer_id 
 		FROM apps WHERE package_name = ?`,
 		packageName,
 	).Scan(
 		&app.ID, &app.PackageName, &app.Name, &app.IconURL, &app.Description,
 		&app.Tags, &mainCategory, &subCategory, &channel, &shareDesc, &developerName,
-		&adLevel, &paymentType, &operationType, &app.Rating, &app.RatingCount, 
-		&app.TotalCoins, &app.DownloadCount,
+		&adLevel, &paymentType, &operationType, &app.Rating, &app.RatingCount,
+		&app.TotalCoins, &app.DownloadCount, &developerID,
 	)
 
 	if err == sql.ErrNoRows {
@@ -202,7 +181,7 @@ func GetAppDetail(c *gin.Context) {
 		// 查询指定版本
 		versionQuery = `
 			SELECT version, version_code, size, download_url, update_content, 
-				screenshots, uploader_name, created_at
+				screenshots, uploader_name, COALESCE(download_count, 0), withdrawn_at, created_at
 			FROM app_versions 
 			WHERE app_id = ? AND version = ?
 		`
@@ -211,7 +190,7 @@ func GetAppDetail(c *gin.Context) {
 		// 查询最新版本
 		versionQuery = `
 			SELECT version, version_code, size, download_url, update_content, 
-				screenshots, uploader_name, created_at
+				screenshots, uploader_name, COALESCE(download_count, 0), withdrawn_at, created_at
 			FROM app_versions 
 			WHERE app_id = ? AND is_latest = 1
 			ORDER BY version_code DESC
@@ -222,10 +201,12 @@ func GetAppDetail(c *gin.Context) {
 
 	var version models.AppVersion
 	var screenshotsJSON string
+	var versionDownloads int
+	var withdrawnAt *time.Time
 	err = database.DB.QueryRow(versionQuery, versionArgs...).Scan(
 		&version.Version, &version.VersionCode, &version.Size,
 		&version.DownloadURL, &version.UpdateContent, &screenshotsJSON,
-		&version.UploaderName, &version.CreatedAt,
+		&version.UploaderName, &versionDownloads, &withdrawnAt, &version.CreatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -242,6 +223,13 @@ func GetAppDetail(c *gin.Context) {
 		})
 		return
 	}
+	if withdrawnAt != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "该版本已下架",
+		})
+		return
+	}
 
 	// 解析截图JSON
 	var screenshots []string
@@ -251,42 +239,50 @@ func GetAppDetail(c *gin.Context) {
 		}
 	}
 
-	// 解析标签
-	tags := []string{}
-	if app.Tags != "" {
-		tags = strings.Split(app.Tags, ",")
-		for i := range tags {
-			tags[i] = strings.TrimSpace(tags[i])
-		}
-	}
+	// 标签
+	tags := loadAppTags(app.ID)
 
 	// 构建响应
 	detail := models.AppDetail{
-		PackageName:   app.PackageName,
-		Name:          app.Name,
-		IconURL:       app.IconURL,
-		Version:       version.Version,
-		VersionCode:   version.VersionCode,
-		Size:          version.Size,
-		Rating:        app.Rating,
-		RatingCount:   app.RatingCount,
-		Description:   app.Description,
-		Screenshots:   screenshots,
-		Tags:          tags,
-		DownloadURL:   version.DownloadURL,
-		TotalCoins:    app.TotalCoins,
-		DownloadCount: app.DownloadCount,
-		UploaderName:  version.UploaderName,
-		UpdateContent: version.UpdateContent,
-		UpdateTime:    version.CreatedAt.Format("2006-01-02 15:04:05"),
-		MainCategory:  mainCategory.String,
-		SubCategory:   subCategory.String,
-		Channel:       channel.String,
-		ShareDesc:     shareDesc.String,
-		DeveloperName: developerName.String,
-		AdLevel:       adLevel.String,
-		PaymentType:   paymentType.String,
-		OperationType: operationType.String,
+		PackageName:          app.PackageName,
+		Name:                 app.Name,
+		IconURL:              app.IconURL,
+		Version:              version.Version,
+		VersionCode:          version.VersionCode,
+		Size:                 version.Size,
+		Rating:               app.Rating,
+		RatingCount:          app.RatingCount,
+		Description:          app.Description,
+		Screenshots:          screenshots,
+		Tags:                 tags,
+		DownloadURL:          version.DownloadURL,
+		TotalCoins:           app.TotalCoins,
+		DownloadCount:        app.DownloadCount,
+		VersionDownloadCount: versionDownloads,
+		UploaderName:         version.UploaderName,
+		UpdateContent:        version.UpdateContent,
+		UpdateTime:           version.CreatedAt.Format("2006-01-02 15:04:05"),
+		MainCategory:         mainCategory.String,
+		SubCategory:          subCategory.String,
+		Channel:              channel.String,
+		ShareDesc:            shareDesc.String,
+		DeveloperName:        developerName.String,
+		AdLevel:              adLevel.String,
+		PaymentType:          paymentType.String,
+		OperationType:        operationType.String,
+	}
+
+	// 关联了开发者资料时显示资料中的名称和认证状态
+	if developerID.Valid {
+		if developer, err := loadDeveloper(database.DB, developerID.Int64); err == nil && developer != nil {
+			detail.DeveloperName = developer.Name
+			detail.Developer = &models.DeveloperBrief{
+				ID:        developer.ID,
+				Name:      developer.Name,
+				AvatarURL: developer.AvatarURL,
+				Verified:  developer.Verified,
+			}
+		}
 	}
 
 	c.JSON(http.StatusOK, models.Response{
@@ -329,7 +325,8 @@ func CoinApp(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	var req struct {
-		Coins int `json:"coins" binding:"required,min=1,max=10"`
+		Coins   int    `json:"coins" binding:"required,min=1,max=10"`
+		Message string `json:"message"` // 打赏留言（可选）
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.Response{
@@ -338,6 +335,13 @@ func CoinApp(c *gin.Context) {
 		})
 		return
 	}
+	if !validTipMessage(req.Message) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: fmt.Sprintf("留言不能超过%d个字符", maxTipMessageLength),
+		})
+		return
+	}
 
 	// 检查应用是否存在
 	var appID int64
@@ -393,19 +397,110 @@ func CoinApp(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
-	// 扣除用户硬币
-	_, err = tx.Exec(
-		"UPDATE users SET coins = coins - ? WHERE id = ?",
-		req.Coins, userID,
-	)
+	// 查询当前版本的上传者，投币收益按比例分给上传者
+	var uploaderID int64
+	err = tx.QueryRow(
+		"SELECT COALESCE(uploader_id, 0) FROM app_versions WHERE app_id = ? AND is_latest = 1",
+		appID,
+	).Scan(&uploaderID)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询应用上传者失败: " + err.Error(),
+		})
+		return
+	}
+
+	shareCoins := 0
+	if uploaderID != 0 && uploaderID != userID.(int64) {
+		// 按分成比例四舍五入
+		shareCoins = (req.Coins*config.AppConfig.AppCoinSharePercent + 50) / 100
+		if shareCoins < 0 {
+			shareCoins = 0
+		}
+		if shareCoins > req.Coins {
+			shareCoins = req.Coins
+		}
+	}
+	platformCoins := req.Coins - shareCoins
+
+	// 分成部分转给上传者，其余由系统回收（均记入硬币流水）
+	idempotencyKey := coinIdempotencyKey(c, coinTxCoinApp, userID.(int64), "app", appID)
+	var txNo string
+	if shareCoins > 0 {
+		txNo, err = transferCoins(tx, coinTransfer{
+			FromUserID:     userID.(int64),
+			ToUserID:       uploaderID,
+			Amount:         shareCoins,
+			Type:           coinTxCoinApp,
+			RefType:        "app",
+			RefID:          appID,
+			IdempotencyKey: idempotencyKey,
+			Remark:         "投币应用 " + packageName,
+		})
+		if err != nil {
+			respondCoinTransferError(c, err, "投币失败")
+			return
+		}
+		if idempotencyKey != "" {
+			idempotencyKey += ":platform"
+		}
+	}
+	if platformCoins > 0 {
+		platformTxNo, err := transferCoins(tx, coinTransfer{
+			FromUserID:     userID.(int64),
+			ToUserID:       systemAccountID,
+			Amount:         platformCoins,
+			Type:           coinTxCoinApp,
+			RefType:        "app",
+			RefID:          appID,
+			IdempotencyKey: idempotencyKey,
+			Remark:         "投币应用 " + packageName + "（平台回收）",
+		})
+		if err != nil {
+			respondCoinTransferError(c, err, "投币失败")
+			return
+		}
+		if txNo == "" {
+			txNo = platformTxNo
+		}
+	}
+
+	// 记录打赏
+	receiverID := uploaderID
+	if shareCoins == 0 {
+		receiverID = 0
+	}
+	err = recordTip(tx, models.Tip{
+		TxNo:           txNo,
+		TipperID:       userID.(int64),
+		ReceiverID:     receiverID,
+		TargetType:     tipTargetApp,
+		TargetID:       appID,
+		Amount:         req.Coins,
+		ReceiverAmount: shareCoins,
+		Message:        req.Message,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
-			Message: "投币失败: " + err.Error(),
+			Message: "记录打赏失败: " + err.Error(),
 		})
 		return
 	}
 
+	// 给上传者发放被投币奖励
+	if shareCoins > 0 {
+		_, err = grantReward(tx, uploaderID, rewardActionReceivedCoin, "coin:"+txNo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "发放投币奖励失败: " + err.Error(),
+			})
+			return
+		}
+	}
+
 	// 增加应用投币数
 	_, err = tx.Exec(
 		"UPDATE apps SET total_coins = total_coins + ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
@@ -435,20 +530,71 @@ func CoinApp(c *gin.Context) {
 		Code:    200,
 		Message: fmt.Sprintf("投币成功，投了%d个硬币", req.Coins),
 		Data: gin.H{
-			"total_coins": totalCoins,
+			"total_coins":    totalCoins,
+			"uploader_coins": shareCoins,
+			"platform_coins": platformCoins,
 		},
 	})
 }
 
-// DownloadApp 记录应用下载
+// DownloadApp 记录应用下载。同一客户端同一版本每天只计一次（同时计入应用和对应版本的下载次数），重复下载只记录请求数
 func DownloadApp(c *gin.Context) {
 	packageName := c.Param("package_name")
 
-	// 增加下载计数
-	_, err := database.DB.Exec(
-		"UPDATE apps SET download_count = download_count + 1 WHERE package_name = ?",
-		packageName,
-	)
+	var query models.DownloadAppQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	// 查询下载的版本，不指定时为最新版本
+	versionQuery := `SELECT v.id, v.app_id, COALESCE(v.channel, a.channel, '') FROM app_versions v
+		JOIN apps a ON v.app_id = a.id
+		WHERE a.package_name = ? AND v.is_latest = 1 AND v.withdrawn_at IS NULL`
+	args := []any{packageName}
+	if query.Version != "" {
+		versionQuery = `SELECT v.id, v.app_id, COALESCE(v.channel, a.channel, '') FROM app_versions v
+			JOIN apps a ON v.app_id = a.id
+			WHERE a.package_name = ? AND v.version = ? AND v.withdrawn_at IS NULL`
+		args = append(args, query.Version)
+	}
+	event := newDownloadEvent(c, query.ClientID)
+	event.packageName = packageName
+	err := database.DB.QueryRow(versionQuery, args...).Scan(&event.versionID, &event.appID, &event.channel)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "应用版本不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "记录下载失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 记录下载明细用于按天统计，去重后计入的下载才增加下载计数
+	var counted bool
+	tx, err := database.DB.Begin()
+	if err == nil {
+		defer tx.Rollback()
+		counted, err = recordDownload(tx, event)
+	}
+	if err == nil && counted {
+		_, err = tx.Exec("UPDATE apps SET download_count = download_count + 1 WHERE id = ?", event.appID)
+		if err == nil {
+			_, err = tx.Exec("UPDATE app_versions SET download_count = download_count + 1 WHERE id = ?", event.versionID)
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
@@ -460,14 +606,24 @@ func DownloadApp(c *gin.Context) {
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
 		Message: "下载记录成功",
+		Data:    gin.H{"counted": counted},
 	})
 }
 
-// GetMainCategories 获取所有大分类
+// GetMainCategories 获取所有启用的大分类（按排序值排列）
 func GetMainCategories(c *gin.Context) {
-	mainCategories := make([]string, 0, len(appCategories))
-	for category := range appCategories {
-		mainCategories = append(mainCategories, category)
+	categories, err := enabledCategories()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+
+	mainCategories := make([]string, 0, len(categories))
+	for _, category := range categories {
+		mainCategories = append(mainCategories, category.Name)
 	}
 
 	c.JSON(http.StatusOK, models.Response{
@@ -488,8 +644,15 @@ func GetSubCategories(c *gin.Context) {
 		return
 	}
 
-	subCategories, exists := appCategories[mainCategory]
-	if !exists {
+	category, err := findEnabledCategory(mainCategory)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+	if category == nil {
 		c.JSON(http.StatusNotFound, models.Response{
 			Code:    404,
 			Message: "大分类不存在",
@@ -497,6 +660,11 @@ func GetSubCategories(c *gin.Context) {
 		return
 	}
 
+	subCategories := make([]string, 0, len(category.SubCategories))
+	for _, sub := range category.SubCategories {
+		subCategories = append(subCategories, sub.Name)
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
 		Message: "获取小分类成功",
@@ -507,6 +675,24 @@ func GetSubCategories(c *gin.Context) {
 	})
 }
 
+// GetCategoryTree 获取启用的分类树（大分类和小分类，包含图标和排序值）
+func GetCategoryTree(c *gin.Context) {
+	categories, err := enabledCategories()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取分类成功",
+		Data:    categories,
+	})
+}
+
 // GetAppsByCategory 根据分类获取应用列表
 func GetAppsByCategory(c *gin.Context) {
 	var query models.GetAppsByCategoryQuery
@@ -519,8 +705,15 @@ func GetAppsByCategory(c *gin.Context) {
 	}
 
 	// 验证分类是否存在
-	subCategories, exists := appCategories[query.MainCategory]
-	if !exists {
+	category, err := findEnabledCategory(query.MainCategory)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+	if category == nil {
 		c.JSON(http.StatusNotFound, models.Response{
 			Code:    404,
 			Message: "大分类不存在",
@@ -530,8 +723,8 @@ func GetAppsByCategory(c *gin.Context) {
 
 	// 验证小分类是否存在
 	subCategoryExists := false
-	for _, sub := range subCategories {
-		if sub == query.SubCategory {
+	for _, sub := range category.SubCategories {
+		if sub.Name == query.SubCategory {
 			subCategoryExists = true
 			break
 		}
@@ -0,0 +1,835 @@
+package handlers
+
+import (
+	"TaruApp/audit"
+	"TaruApp/database"
+	"TaruApp/models"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// categoryCacheTTL 分类缓存时间，管理员修改分类时会主动失效
+const categoryCacheTTL = time.Minute
+
+var (
+	categoryCacheMu       sync.RWMutex
+	categoryCache         []models.AppMainCategory
+	categoryCacheLoadedAt time.Time
+)
+
+// loadCategories 获取全部分类（包括已停用的），按排序值排列。返回的数据与缓存共用，调用方不能修改
+func loadCategories() ([]models.AppMainCategory, error) {
+	categoryCacheMu.RLock()
+	if categoryCache != nil && time.Since(categoryCacheLoadedAt) < categoryCacheTTL {
+		categories := categoryCache
+		categoryCacheMu.RUnlock()
+		return categories, nil
+	}
+	categoryCacheMu.RUnlock()
+
+	rows, err := database.DB.Query(`
+		SELECT id, name, COALESCE(icon_url, ''), sort_order, enabled
+		FROM app_categories
+		ORDER BY sort_order, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	categories := []models.AppMainCategory{}
+	index := map[int64]int{}
+	for rows.Next() {
+		var category models.AppMainCategory
+		if err := rows.Scan(&category.ID, &category.Name, &category.IconURL, &category.SortOrder, &category.Enabled); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		category.SubCategories = []models.AppSubCategory{}
+		index[category.ID] = len(categories)
+		categories = append(categories, category)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = database.DB.Query(`
+		SELECT id, category_id, name, COALESCE(icon_url, ''), sort_order, enabled
+		FROM app_subcategories
+		ORDER BY sort_order, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sub models.AppSubCategory
+		if err := rows.Scan(&sub.ID, &sub.CategoryID, &sub.Name, &sub.IconURL, &sub.SortOrder, &sub.Enabled); err != nil {
+			return nil, err
+		}
+		if i, ok := index[sub.CategoryID]; ok {
+			categories[i].SubCategories = append(categories[i].SubCategories, sub)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	categoryCacheMu.Lock()
+	categoryCache = categories
+	categoryCacheLoadedAt = time.Now()
+	categoryCacheMu.Unlock()
+	return categories, nil
+}
+
+// invalidateCategoryCache 分类变更后清除缓存
+func invalidateCategoryCache() {
+	categoryCacheMu.Lock()
+	categoryCache = nil
+	categoryCacheMu.Unlock()
+}
+
+// enabledCategories 获取启用的大分类及其中启用的小分类
+func enabledCategories() ([]models.AppMainCategory, error) {
+	categories, err := loadCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.AppMainCategory{}
+	for _, category := range categories {
+		if !category.Enabled {
+			continue
+		}
+		subs := []models.AppSubCategory{}
+		for _, sub := range category.SubCategories {
+			if sub.Enabled {
+				subs = append(subs, sub)
+			}
+		}
+		category.SubCategories = subs
+		result = append(result, category)
+	}
+	return result, nil
+}
+
+// findEnabledCategory 按名称查找启用的大分类，不存在或已停用时返回 nil
+func findEnabledCategory(name string) (*models.AppMainCategory, error) {
+	categories, err := enabledCategories()
+	if err != nil {
+		return nil, err
+	}
+	for i := range categories {
+		if categories[i].Name == name {
+			return &categories[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// bindCategoryRequest 解析并校验分类请求
+func bindCategoryRequest(c *gin.Context) (models.SaveAppCategoryRequest, bool) {
+	var req models.SaveAppCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return req, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "分类名称不能为空",
+		})
+		return req, false
+	}
+	if req.Enabled == nil {
+		enabled := true
+		req.Enabled = &enabled
+	}
+	return req, true
+}
+
+// parseCategoryID 解析路径中的分类ID
+func parseCategoryID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "无效的分类ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// loadMainCategory 查询大分类（不含小分类）
+func loadMainCategory(q rowQueryer, id int64) (*models.AppMainCategory, error) {
+	var category models.AppMainCategory
+	err := q.QueryRow(
+		"SELECT id, name, COALESCE(icon_url, ''), sort_order, enabled FROM app_categories WHERE id = ?", id,
+	).Scan(&category.ID, &category.Name, &category.IconURL, &category.SortOrder, &category.Enabled)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// loadSubCategory 查询小分类及其所属大分类的名称
+func loadSubCategory(q rowQueryer, id int64) (*models.AppSubCategory, string, error) {
+	var sub models.AppSubCategory
+	var mainName string
+	err := q.QueryRow(`
+		SELECT s.id, s.category_id, s.name, COALESCE(s.icon_url, ''), s.sort_order, s.enabled, c.name
+		FROM app_subcategories s
+		JOIN app_categories c ON s.category_id = c.id
+		WHERE s.id = ?
+	`, id).Scan(&sub.ID, &sub.CategoryID, &sub.Name, &sub.IconURL, &sub.SortOrder, &sub.Enabled, &mainName)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &sub, mainName, nil
+}
+
+// repointCategory 把应用和上传任务从一个分类改到另一个分类，返回更新的应用数和上传任务数。
+// fromSub 为空时改动整个大分类（小分类名称不变）
+func repointCategory(tx *sql.Tx, fromMain, fromSub, toMain, toSub string) (apps, tasks int64, err error) {
+	for _, table := range []string{"apps", "app_upload_tasks"} {
+		var result sql.Result
+		if fromSub == "" {
+			result, err = tx.Exec("UPDATE "+table+" SET main_category = ? WHERE main_category = ?", toMain, fromMain)
+		} else {
+			result, err = tx.Exec(
+				"UPDATE "+table+" SET main_category = ?, sub_category = ? WHERE main_category = ? AND sub_category = ?",
+				toMain, toSub, fromMain, fromSub,
+			)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		n, _ := result.RowsAffected()
+		if table == "apps" {
+			apps = n
+		} else {
+			tasks = n
+		}
+	}
+	return apps, tasks, nil
+}
+
+// countCategoryUsage 统计引用分类的应用和上传任务数量，subCategory 为空时统计整个大分类
+func countCategoryUsage(mainCategory, subCategory string) (apps, tasks int, err error) {
+	where, args := "main_category = ?", []interface{}{mainCategory}
+	if subCategory != "" {
+		where += " AND sub_category = ?"
+		args = append(args, subCategory)
+	}
+	if err = database.DB.QueryRow("SELECT COUNT(*) FROM apps WHERE "+where, args...).Scan(&apps); err != nil {
+		return 0, 0, err
+	}
+	err = database.DB.QueryRow("SELECT COUNT(*) FROM app_upload_tasks WHERE "+where, args...).Scan(&tasks)
+	return apps, tasks, err
+}
+
+// AdminGetCategories 获取全部应用分类，包括已停用的（管理员权限）
+func AdminGetCategories(c *gin.Context) {
+	categories, err := loadCategories()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取分类成功",
+		Data:    categories,
+	})
+}
+
+// CreateCategory 创建大分类（管理员权限）
+func CreateCategory(c *gin.Context) {
+	req, ok := bindCategoryRequest(c)
+	if !ok {
+		return
+	}
+
+	var count int
+	database.DB.QueryRow("SELECT COUNT(*) FROM app_categories WHERE name = ?", req.Name).Scan(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "分类名称已存在",
+		})
+		return
+	}
+
+	result, err := database.DB.Exec(
+		"INSERT INTO app_categories (name, icon_url, sort_order, enabled) VALUES (?, ?, ?, ?)",
+		req.Name, req.IconURL, req.SortOrder, *req.Enabled,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "创建分类失败: " + err.Error(),
+		})
+		return
+	}
+	invalidateCategoryCache()
+
+	id, _ := result.LastInsertId()
+	audit.SetTarget(c, "app_category", id)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "创建分类成功",
+		Data: gin.H{
+			"id": id,
+		},
+	})
+}
+
+// UpdateCategory 更新大分类（管理员权限）。修改名称时同步更新已有应用和上传任务的分类
+func UpdateCategory(c *gin.Context) {
+	id, ok := parseCategoryID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindCategoryRequest(c)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "更新分类失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := loadMainCategory(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "分类不存在",
+		})
+		return
+	}
+
+	var apps, tasks int64
+	if req.Name != before.Name {
+		var count int
+		tx.QueryRow("SELECT COUNT(*) FROM app_categories WHERE name = ? AND id != ?", req.Name, id).Scan(&count)
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "分类名称已存在，如需合并请使用合并接口",
+			})
+			return
+		}
+		apps, tasks, err = repointCategory(tx, before.Name, "", req.Name, "")
+	}
+	if err == nil {
+		_, err = tx.Exec(
+			"UPDATE app_categories SET name = ?, icon_url = ?, sort_order = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			req.Name, req.IconURL, req.SortOrder, *req.Enabled, id,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "更新分类失败: " + err.Error(),
+		})
+		return
+	}
+	invalidateCategoryCache()
+
+	audit.SetBefore(c, before)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "更新分类成功",
+		Data: gin.H{
+			"apps_updated":         apps,
+			"upload_tasks_updated": tasks,
+		},
+	})
+}
+
+// DeleteCategory 删除大分类及其小分类（管理员权限）。仍有应用或上传任务使用时不能删除，需要先合并或停用
+func DeleteCategory(c *gin.Context) {
+	id, ok := parseCategoryID(c)
+	if !ok {
+		return
+	}
+
+	before, err := loadMainCategory(database.DB, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "分类不存在",
+		})
+		return
+	}
+
+	apps, tasks, err := countCategoryUsage(before.Name, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类使用情况失败: " + err.Error(),
+		})
+		return
+	}
+	if apps > 0 || tasks > 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: fmt.Sprintf("该分类下还有 %d 个应用和 %d 个上传任务，请先合并到其他分类或停用", apps, tasks),
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "删除分类失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM app_subcategories WHERE category_id = ?", id)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM app_categories WHERE id = ?", id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "删除分类失败: " + err.Error(),
+		})
+		return
+	}
+	invalidateCategoryCache()
+
+	audit.SetBefore(c, before)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "删除分类成功",
+	})
+}
+
+// MergeCategory 把大分类合并到另一个大分类（管理员权限）：应用和上传任务改到目标分类，
+// 同名的小分类合并，其余小分类移到目标分类下，最后删除原分类
+func MergeCategory(c *gin.Context) {
+	id, ok := parseCategoryID(c)
+	if !ok {
+		return
+	}
+	var req models.MergeAppCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.TargetID == id {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "不能合并到自身",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "合并分类失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	source, err := loadMainCategory(tx, id)
+	var target *models.AppMainCategory
+	if err == nil {
+		target, err = loadMainCategory(tx, req.TargetID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+	if source == nil || target == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "分类不存在",
+		})
+		return
+	}
+
+	apps, tasks, err := repointCategory(tx, source.Name, "", target.Name, "")
+	if err == nil {
+		// 同名的小分类直接删除（应用已经按名称归入目标分类下的同名小分类），其余的排在目标分类的小分类之后
+		_, err = tx.Exec(`
+			DELETE FROM app_subcategories
+			WHERE category_id = ? AND name IN (SELECT name FROM app_subcategories WHERE category_id = ?)
+		`, id, req.TargetID)
+	}
+	if err == nil {
+		_, err = tx.Exec(`
+			UPDATE app_subcategories
+			SET category_id = ?,
+				sort_order = sort_order + (SELECT COALESCE(MAX(sort_order), 0) FROM app_subcategories WHERE category_id = ?),
+				updated_at = CURRENT_TIMESTAMP
+			WHERE category_id = ?
+		`, req.TargetID, req.TargetID, id)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM app_categories WHERE id = ?", id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "合并分类失败: " + err.Error(),
+		})
+		return
+	}
+	invalidateCategoryCache()
+
+	audit.SetBefore(c, gin.H{"source": source.Name})
+	audit.SetAfter(c, gin.H{"target_id": target.ID, "target": target.Name})
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "合并分类成功",
+		Data: gin.H{
+			"apps_updated":         apps,
+			"upload_tasks_updated": tasks,
+		},
+	})
+}
+
+// CreateSubCategory 在大分类下创建小分类（管理员权限）
+func CreateSubCategory(c *gin.Context) {
+	categoryID, ok := parseCategoryID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindCategoryRequest(c)
+	if !ok {
+		return
+	}
+
+	category, err := loadMainCategory(database.DB, categoryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+	if category == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "分类不存在",
+		})
+		return
+	}
+
+	var count int
+	database.DB.QueryRow(
+		"SELECT COUNT(*) FROM app_subcategories WHERE category_id = ? AND name = ?", categoryID, req.Name,
+	).Scan(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该大分类下已有同名的小分类",
+		})
+		return
+	}
+
+	result, err := database.DB.Exec(
+		"INSERT INTO app_subcategories (category_id, name, icon_url, sort_order, enabled) VALUES (?, ?, ?, ?, ?)",
+		categoryID, req.Name, req.IconURL, req.SortOrder, *req.Enabled,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "创建分类失败: " + err.Error(),
+		})
+		return
+	}
+	invalidateCategoryCache()
+
+	id, _ := result.LastInsertId()
+	audit.SetTarget(c, "app_subcategory", id)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "创建分类成功",
+		Data: gin.H{
+			"id": id,
+		},
+	})
+}
+
+// UpdateSubCategory 更新小分类（管理员权限）。修改名称时同步更新已有应用和上传任务的分类
+func UpdateSubCategory(c *gin.Context) {
+	id, ok := parseCategoryID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindCategoryRequest(c)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "更新分类失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	before, mainName, err := loadSubCategory(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "分类不存在",
+		})
+		return
+	}
+
+	var apps, tasks int64
+	if req.Name != before.Name {
+		var count int
+		tx.QueryRow(
+			"SELECT COUNT(*) FROM app_subcategories WHERE category_id = ? AND name = ? AND id != ?",
+			before.CategoryID, req.Name, id,
+		).Scan(&count)
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "该大分类下已有同名的小分类，如需合并请使用合并接口",
+			})
+			return
+		}
+		apps, tasks, err = repointCategory(tx, mainName, before.Name, mainName, req.Name)
+	}
+	if err == nil {
+		_, err = tx.Exec(
+			"UPDATE app_subcategories SET name = ?, icon_url = ?, sort_order = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			req.Name, req.IconURL, req.SortOrder, *req.Enabled, id,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "更新分类失败: " + err.Error(),
+		})
+		return
+	}
+	invalidateCategoryCache()
+
+	audit.SetBefore(c, before)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "更新分类成功",
+		Data: gin.H{
+			"apps_updated":         apps,
+			"upload_tasks_updated": tasks,
+		},
+	})
+}
+
+// DeleteSubCategory 删除小分类（管理员权限）。仍有应用或上传任务使用时不能删除，需要先合并或停用
+func DeleteSubCategory(c *gin.Context) {
+	id, ok := parseCategoryID(c)
+	if !ok {
+		return
+	}
+
+	before, mainName, err := loadSubCategory(database.DB, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+	if before == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "分类不存在",
+		})
+		return
+	}
+
+	apps, tasks, err := countCategoryUsage(mainName, before.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类使用情况失败: " + err.Error(),
+		})
+		return
+	}
+	if apps > 0 || tasks > 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: fmt.Sprintf("该分类下还有 %d 个应用和 %d 个上传任务，请先合并到其他分类或停用", apps, tasks),
+		})
+		return
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM app_subcategories WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "删除分类失败: " + err.Error(),
+		})
+		return
+	}
+	invalidateCategoryCache()
+
+	audit.SetBefore(c, gin.H{"main_category": mainName, "sub_category": before})
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "删除分类成功",
+	})
+}
+
+// MergeSubCategory 把小分类合并到另一个小分类（管理员权限，可以跨大分类）：
+// 应用和上传任务改到目标分类，然后删除原分类
+func MergeSubCategory(c *gin.Context) {
+	id, ok := parseCategoryID(c)
+	if !ok {
+		return
+	}
+	var req models.MergeAppCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.TargetID == id {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "不能合并到自身",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "合并分类失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	source, sourceMain, err := loadSubCategory(tx, id)
+	var target *models.AppSubCategory
+	var targetMain string
+	if err == nil {
+		target, targetMain, err = loadSubCategory(tx, req.TargetID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询分类失败: " + err.Error(),
+		})
+		return
+	}
+	if source == nil || target == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "分类不存在",
+		})
+		return
+	}
+
+	apps, tasks, err := repointCategory(tx, sourceMain, source.Name, targetMain, target.Name)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM app_subcategories WHERE id = ?", id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "合并分类失败: " + err.Error(),
+		})
+		return
+	}
+	invalidateCategoryCache()
+
+	audit.SetBefore(c, gin.H{"main_category": sourceMain, "sub_category": source.Name})
+	audit.SetAfter(c, gin.H{"target_id": target.ID, "main_category": targetMain, "sub_category": target.Name})
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "合并分类成功",
+		Data: gin.H{
+			"apps_updated":         apps,
+			"upload_tasks_updated": tasks,
+		},
+	})
+}
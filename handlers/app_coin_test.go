@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"TaruApp/config"
+	"TaruApp/database"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCoinAppShareFollowsConfiguredPercent(t *testing.T) {
+	setupTestDB(t)
+	uploader := createTestUser(t, "uploader", "password123", "uploader@example.com")
+	reviewer := createTestUser(t, "reviewer", "password123", "reviewer@example.com")
+	tipper := createTestUser(t, "tipper", "password123", "tipper@example.com")
+	const pkg = "com.example.coin"
+
+	taskID := createTestUploadTask(t, uploader, pkg, 1, "")
+	if _, err := reviewUploadTask(reviewer, taskID, reviewDecision{accept: 1}); err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Exec("UPDATE users SET coins = 100 WHERE id = ?", tipper)
+	config.AppConfig.AppCoinSharePercent = 10
+
+	tests := []struct {
+		coins, wantShare int
+	}{
+		{1, 0}, // 不足半个硬币时上传者得不到分成
+		{5, 1}, // 0.5 四舍五入为 1
+		{10, 1},
+	}
+	param := gin.Param{Key: "package_name", Value: pkg}
+	for _, tt := range tests {
+		var before, after int
+		database.DB.QueryRow("SELECT coins FROM users WHERE id = ?", uploader).Scan(&before)
+		w := performJSON(CoinApp, http.MethodPost, tipper, gin.H{"coins": tt.coins}, param)
+		assertStatus(t, w, http.StatusOK)
+		database.DB.QueryRow("SELECT coins FROM users WHERE id = ?", uploader).Scan(&after)
+		if got := after - before; got != tt.wantShare {
+			t.Errorf("投 %d 个硬币上传者得到 %d 个, 期望 %d", tt.coins, got, tt.wantShare)
+		}
+	}
+}
+
+func TestConcurrentCoinAppWithSameIdempotencyKeyChargesOnce(t *testing.T) {
+	setupTestDB(t)
+	uploader := createTestUser(t, "uploader", "password123", "uploader@example.com")
+	reviewer := createTestUser(t, "reviewer", "password123", "reviewer@example.com")
+	tipper := createTestUser(t, "tipper", "password123", "tipper@example.com")
+	const pkg = "com.example.coin"
+
+	taskID := createTestUploadTask(t, uploader, pkg, 1, "")
+	if _, err := reviewUploadTask(reviewer, taskID, reviewDecision{accept: 1}); err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Exec("UPDATE users SET coins = 100 WHERE id = ?", tipper)
+
+	const requests = 8
+	codes := make([]int, requests)
+	bodies := make([]string, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"coins": 5}`)))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Request.Header.Set("Idempotency-Key", "same-request")
+			c.Params = gin.Params{{Key: "package_name", Value: pkg}}
+			c.Set("user_id", tipper)
+			c.Set("username", "tipper")
+			CoinApp(c)
+			codes[i] = w.Code
+			bodies[i] = w.Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for i, code := range codes {
+		switch code {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusConflict:
+		default:
+			t.Fatalf("第 %d 个请求状态码 = %d, 期望 200 或 409: %s", i, code, bodies[i])
+		}
+	}
+	var coins int
+	database.DB.QueryRow("SELECT coins FROM users WHERE id = ?", tipper).Scan(&coins)
+	if succeeded != 1 || coins != 95 {
+		t.Fatalf("成功 %d 次, 余额 %d, 期望成功 1 次、余额 95", succeeded, coins)
+	}
+}
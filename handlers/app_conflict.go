@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"TaruApp/config"
+	"TaruApp/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上传冲突的类型
+const (
+	conflictVersionExists     = "version_exists"     // 版本已上架过（包括已下架的版本）
+	conflictVersionCodeLower  = "version_code_lower" // 版本代码不大于当前最新版本
+	conflictPendingTask       = "pending_task"       // 同一上传者（或同一开发者）还有该应用未完成的上传任务
+	conflictOtherPendingTask  = "other_pending_task" // 其他用户还有该应用未完成的上传任务
+	conflictUploaderMismatch  = "uploader_mismatch"  // 应用此前的版本都由其他用户上传
+	conflictSignerMismatch    = "signer_mismatch"    // 签名证书与当前最新版本不同
+	conflictDeveloperMismatch = "developer_mismatch" // 指定的开发者与应用所属的开发者不同
+)
+
+// uploadBlockingConflicts 上传和重新提交时直接拒绝的冲突，其余冲突只作为警告提示审核员
+var uploadBlockingConflicts = []string{conflictVersionExists, conflictVersionCodeLower, conflictPendingTask}
+
+// reviewBlockingConflicts 审核通过时不能发布的冲突（其他任务可能在等待审核期间先通过了）
+var reviewBlockingConflicts = []string{conflictVersionExists, conflictVersionCodeLower}
+
+var errVersionConflict = errors.New("版本冲突")
+
+// sqlQueryer 可以执行查询的数据库连接或事务
+type sqlQueryer interface {
+	rowQueryer
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// uploadCandidate 需要检查冲突的上传内容
+type uploadCandidate struct {
+	taskID            int64 // 任务自身的ID，检查其他任务时排除；新上传为 0
+	userID            int64
+	developerID       int64 // 上传时指定的开发者，0 表示未指定
+	packageName       string
+	version           string
+	versionCode       int
+	signerFingerprint string
+}
+
+// detectUploadConflicts 检查上传内容与已上架版本、其他上传任务的冲突，没有冲突时返回空列表
+func detectUploadConflicts(db sqlQueryer, u uploadCandidate) ([]models.UploadConflict, error) {
+	conflicts := []models.UploadConflict{}
+
+	var existing int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM app_versions WHERE package_name = ? AND version = ?", u.packageName, u.version,
+	).Scan(&existing)
+	if err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		conflicts = append(conflicts, models.UploadConflict{
+			Code:    conflictVersionExists,
+			Message: fmt.Sprintf("版本 %s 已经存在，请修改版本号后再上传", u.version),
+		})
+	}
+
+	var latest struct {
+		Version      string
+		VersionCode  int
+		UploaderName string
+		Signer       string
+	}
+	err = db.QueryRow(
+		`SELECT version, version_code, uploader_name, COALESCE(signer_fingerprint, '')
+		FROM app_versions WHERE package_name = ? AND is_latest = 1 LIMIT 1`, u.packageName,
+	).Scan(&latest.Version, &latest.VersionCode, &latest.UploaderName, &latest.Signer)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		if u.versionCode <= latest.VersionCode {
+			conflicts = append(conflicts, models.UploadConflict{
+				Code: conflictVersionCodeLower,
+				Message: fmt.Sprintf("版本代码 %d 必须大于当前最新版本 %s 的版本代码 %d",
+					u.versionCode, latest.Version, latest.VersionCode),
+			})
+		}
+		if u.signerFingerprint != "" && latest.Signer != "" && u.signerFingerprint != latest.Signer {
+			conflicts = append(conflicts, models.UploadConflict{
+				Code:    conflictSignerMismatch,
+				Message: fmt.Sprintf("签名证书与当前最新版本 %s 不同", latest.Version),
+			})
+		}
+
+		// 应用所属开发者的成员（开发者还没被认领时为上传过该应用版本的用户）算作该应用的上传者
+		var maintainer bool
+		err = db.QueryRow(
+			"SELECT "+appMaintainerExpr+" FROM apps a WHERE a.package_name = ?", u.userID, u.userID, u.packageName,
+		).Scan(&maintainer)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if !maintainer {
+			conflicts = append(conflicts, models.UploadConflict{
+				Code:    conflictUploaderMismatch,
+				Message: fmt.Sprintf("该应用此前由其他用户上传（最新版本由 %s 上传）", latest.UploaderName),
+			})
+		}
+	}
+
+	if u.developerID != 0 {
+		var appDeveloperID int64
+		var appDeveloperName string
+		err = db.QueryRow(`
+			SELECT a.developer_id, COALESCE(d.name, '') FROM apps a
+			JOIN developers d ON a.developer_id = d.id
+			WHERE a.package_name = ?`, u.packageName,
+		).Scan(&appDeveloperID, &appDeveloperName)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err == nil && appDeveloperID != u.developerID {
+			conflicts = append(conflicts, models.UploadConflict{
+				Code:    conflictDeveloperMismatch,
+				Message: fmt.Sprintf("该应用属于开发者 %s，审核通过后不会改变应用所属的开发者（需要通过所有权转移）", appDeveloperName),
+			})
+		}
+	}
+
+	// 同一上传者或同一开发者的未完成任务直接拒绝；其他用户的任务只提示审核员，
+	// 避免有人上传一次后不再处理，长期占用包名
+	activeCondition, activeArgs := activeUploadTaskCondition()
+	rows, err := db.Query(
+		`SELECT id, user_id, COALESCE(developer_id, 0), version, status FROM app_upload_tasks
+		WHERE package_name = ? AND id != ? AND `+activeCondition+`
+		ORDER BY id`,
+		append([]any{u.packageName, u.taskID}, activeArgs...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ownFound, otherFound bool
+	for rows.Next() {
+		var taskID, userID, developerID int64
+		var version, status string
+		if err := rows.Scan(&taskID, &userID, &developerID, &version, &status); err != nil {
+			return nil, err
+		}
+
+		own := userID == u.userID || (u.developerID != 0 && developerID == u.developerID)
+		if own && !ownFound {
+			ownFound = true
+			message := fmt.Sprintf("该应用已有等待审核的上传任务 #%d（版本 %s）", taskID, version)
+			if status == "changes_requested" {
+				message = fmt.Sprintf("该应用已有等待修改的上传任务 #%d（版本 %s）", taskID, version)
+				if userID == u.userID {
+					message += "，请修改后重新提交该任务"
+				}
+			}
+			conflicts = append(conflicts, models.UploadConflict{
+				Code:    conflictPendingTask,
+				Message: message,
+				TaskID:  taskID,
+			})
+		}
+		if !own && !otherFound {
+			otherFound = true
+			conflicts = append(conflicts, models.UploadConflict{
+				Code:    conflictOtherPendingTask,
+				Message: fmt.Sprintf("其他用户也上传了该应用，任务 #%d（版本 %s）尚未完成", taskID, version),
+				TaskID:  taskID,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// activeUploadTaskCondition 返回未完成的上传任务的查询条件：等待审核的任务，
+// 以及被要求修改后还没有过期的任务（过期任务由 expireUploadTasks 定时标记为 expired）
+func activeUploadTaskCondition() (string, []any) {
+	days := config.AppConfig.ChangesRequestedExpireDays
+	if days <= 0 {
+		return "status IN ('pending', 'changes_requested')", nil
+	}
+	cutoff := formatDBTime(time.Now().AddDate(0, 0, -days))
+	return "(status = 'pending' OR (status = 'changes_requested' AND COALESCE(review_time, updated_at) > ?))", []any{cutoff}
+}
+
+// firstBlockingConflict 返回 conflicts 中第一个类型属于 blocking 的冲突，没有时返回 nil
+func firstBlockingConflict(conflicts []models.UploadConflict, blocking []string) *models.UploadConflict {
+	for i := range conflicts {
+		for _, code := range blocking {
+			if conflicts[i].Code == code {
+				return &conflicts[i]
+			}
+		}
+	}
+	return nil
+}
+
+// checkUploadConflicts 上传或重新提交时检查冲突：有需要拒绝的冲突时返回 409（data 中列出全部冲突）并返回 false，
+// 否则返回只作为警告的冲突
+func checkUploadConflicts(c *gin.Context, db sqlQueryer, u uploadCandidate) ([]models.UploadConflict, bool) {
+	conflicts, err := detectUploadConflicts(db, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "检查版本冲突失败: " + err.Error(),
+		})
+		return nil, false
+	}
+	if conflict := firstBlockingConflict(conflicts, uploadBlockingConflicts); conflict != nil {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: conflict.Message,
+			Data:    gin.H{"conflicts": conflicts},
+		})
+		return nil, false
+	}
+	return conflicts, true
+}
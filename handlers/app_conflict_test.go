@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"testing"
+	"time"
+)
+
+// conflictCodes 返回冲突类型列表
+func conflictCodes(conflicts []models.UploadConflict) []string {
+	codes := []string{}
+	for _, c := range conflicts {
+		codes = append(codes, c.Code)
+	}
+	return codes
+}
+
+func TestPendingTaskOnlyBlocksSameUploader(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice", "password123", "alice@example.com")
+	bob := createTestUser(t, "bob", "password123", "bob@example.com")
+	const pkg = "com.example.squat"
+	taskID := createTestUploadTask(t, alice, pkg, 1, "")
+
+	// 其他用户的未完成任务只作为警告
+	conflicts, err := detectUploadConflicts(database.DB, uploadCandidate{userID: bob, packageName: pkg, version: "2.0", versionCode: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstBlockingConflict(conflicts, uploadBlockingConflicts) != nil {
+		t.Fatalf("其他用户的任务不应阻止上传: %v", conflictCodes(conflicts))
+	}
+	if len(conflicts) != 1 || conflicts[0].Code != conflictOtherPendingTask || conflicts[0].TaskID != taskID {
+		t.Fatalf("冲突 = %v, 期望 other_pending_task", conflictCodes(conflicts))
+	}
+
+	// 自己的未完成任务直接拒绝
+	conflicts, err = detectUploadConflicts(database.DB, uploadCandidate{userID: alice, packageName: pkg, version: "2.0", versionCode: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conflict := firstBlockingConflict(conflicts, uploadBlockingConflicts); conflict == nil || conflict.Code != conflictPendingTask {
+		t.Fatalf("冲突 = %v, 期望 pending_task", conflictCodes(conflicts))
+	}
+}
+
+func TestStaleChangesRequestedTaskExpires(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice", "password123", "alice@example.com")
+	const pkg = "com.example.stale"
+	staleID := createTestUploadTask(t, alice, pkg, 1, "")
+	freshID := createTestUploadTask(t, alice, "com.example.fresh", 1, "")
+
+	old := formatDBTime(time.Now().AddDate(0, 0, -31))
+	database.DB.Exec("UPDATE app_upload_tasks SET status = 'changes_requested', review_time = ? WHERE id = ?", old, staleID)
+	database.DB.Exec("UPDATE app_upload_tasks SET status = 'changes_requested', review_time = ? WHERE id = ?",
+		formatDBTime(time.Now()), freshID)
+
+	// 超过期限的任务不再阻止上传，即使还没被定时任务标记
+	conflicts, err := detectUploadConflicts(database.DB, uploadCandidate{userID: alice, packageName: pkg, version: "2.0", versionCode: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 0 {
+		t.Fatalf("冲突 = %v, 期望没有冲突", conflictCodes(conflicts))
+	}
+
+	expired, err := expireUploadTasks(30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 {
+		t.Fatalf("过期任务数 = %d, 期望 1", expired)
+	}
+	var staleStatus, freshStatus string
+	database.DB.QueryRow("SELECT status FROM app_upload_tasks WHERE id = ?", staleID).Scan(&staleStatus)
+	database.DB.QueryRow("SELECT status FROM app_upload_tasks WHERE id = ?", freshID).Scan(&freshStatus)
+	if staleStatus != "expired" || freshStatus != "changes_requested" {
+		t.Fatalf("状态 = %s/%s, 期望 expired/changes_requested", staleStatus, freshStatus)
+	}
+}
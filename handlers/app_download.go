@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"TaruApp/config"
+	"TaruApp/database"
+	"TaruApp/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downloadHash 计算下载客户端标识的哈希。密钥和日期参与计算，数据库中不保存原始 IP，
+// 同一客户端在不同日期的哈希也无法关联
+func downloadHash(day string, parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.DownloadHashSecret))
+	mac.Write([]byte(day))
+	for _, part := range parts {
+		mac.Write([]byte{0})
+		mac.Write([]byte(part))
+	}
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// downloadEvent 一次下载请求
+type downloadEvent struct {
+	appID       int64
+	versionID   int64
+	packageName string
+	channel     string
+	day         string // 服务器时区的日期
+	clientHash  string // IP 和客户端标识的哈希
+	ipHash      string // IP 的哈希，用于限制同一 IP 计入的客户端数
+}
+
+// newDownloadEvent 根据请求生成下载记录，客户端标识优先使用 client_id 参数，没有时使用 User-Agent
+func newDownloadEvent(c *gin.Context, clientID string) downloadEvent {
+	day := time.Now().Format("2006-01-02")
+	ip := c.ClientIP()
+	client := "ua:" + c.Request.UserAgent()
+	if clientID != "" {
+		client = "id:" + clientID
+	}
+	return downloadEvent{
+		day:        day,
+		clientHash: downloadHash(day, ip, client),
+		ipHash:     downloadHash(day, ip),
+	}
+}
+
+// recordDownload 在事务中记录下载，返回是否计入下载数。
+// 同一客户端同一版本每天只计一次，重复下载和超过同一 IP 客户端数上限的下载只增加请求数
+func recordDownload(tx *sql.Tx, e downloadEvent) (bool, error) {
+	result, err := tx.Exec(
+		"UPDATE app_downloads SET hits = hits + 1 WHERE version_id = ? AND day = ? AND client_hash = ?",
+		e.versionID, e.day, e.clientHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return false, nil
+	}
+
+	if limit := config.AppConfig.DownloadMaxClientsPerIP; limit > 0 {
+		var clients int
+		if err := tx.QueryRow(
+			"SELECT COUNT(*) FROM app_downloads WHERE version_id = ? AND day = ? AND ip_hash = ?",
+			e.versionID, e.day, e.ipHash,
+		).Scan(&clients); err != nil {
+			return false, err
+		}
+		if clients >= limit {
+			// 记到该 IP 最早的一条记录上，汇总时仍能看到请求数
+			_, err = tx.Exec(`
+				UPDATE app_downloads SET hits = hits + 1 WHERE id = (
+					SELECT id FROM app_downloads WHERE version_id = ? AND day = ? AND ip_hash = ? ORDER BY id LIMIT 1
+				)`, e.versionID, e.day, e.ipHash,
+			)
+			return false, err
+		}
+	}
+
+	// 并发的相同下载可能都没查到记录，唯一索引冲突时由先插入的请求计数，这里只增加请求数
+	result, err = tx.Exec(
+		`INSERT INTO app_downloads (app_id, version_id, package_name, day, channel, client_hash, ip_hash, hits, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?)
+		ON CONFLICT(version_id, day, client_hash) DO NOTHING`,
+		e.appID, e.versionID, e.packageName, e.day, e.channel, e.clientHash, e.ipHash, formatDBTime(time.Now()),
+	)
+	if err != nil {
+		return false, err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return true, nil
+	}
+	_, err = tx.Exec(
+		"UPDATE app_downloads SET hits = hits + 1 WHERE version_id = ? AND day = ? AND client_hash = ?",
+		e.versionID, e.day, e.clientHash,
+	)
+	return false, err
+}
+
+// rollupDownloads 把下载记录汇总到每日汇总表：从已汇总的最后一天（可能只汇总了一部分）开始重新汇总，
+// 然后删除超过保留天数且已汇总的下载记录。返回重新汇总的天数
+func rollupDownloads(retentionDays int) (int, error) {
+	var start sql.NullString
+	if err := database.DB.QueryRow("SELECT MAX(day) FROM app_download_daily").Scan(&start); err != nil {
+		return 0, err
+	}
+	if !start.Valid {
+		if err := database.DB.QueryRow("SELECT MIN(day) FROM app_downloads").Scan(&start); err != nil {
+			return 0, err
+		}
+		if !start.Valid {
+			return 0, nil
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM app_download_daily WHERE day >= ?", start.String); err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec(`
+		INSERT INTO app_download_daily (app_id, version_id, day, channel, downloads, requests)
+		SELECT app_id, COALESCE(version_id, 0), day, MAX(COALESCE(channel, '')), COUNT(*), SUM(COALESCE(hits, 1))
+		FROM app_downloads
+		WHERE day >= ?
+		GROUP BY app_id, COALESCE(version_id, 0), day`, start.String,
+	); err != nil {
+		return 0, err
+	}
+	var days int
+	if err = tx.QueryRow(
+		"SELECT COUNT(DISTINCT day) FROM app_download_daily WHERE day >= ?", start.String,
+	).Scan(&days); err != nil {
+		return 0, err
+	}
+
+	if retentionDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -retentionDays).Format("2006-01-02")
+		if _, err = tx.Exec(
+			"DELETE FROM app_downloads WHERE day < ? AND day < ?", cutoff, start.String,
+		); err != nil {
+			return 0, err
+		}
+	}
+	return days, tx.Commit()
+}
+
+// StartDownloadRollupJob 启动下载统计汇总的后台任务，启动时先汇总一次
+func StartDownloadRollupJob(interval time.Duration, retentionDays int) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := rollupDownloads(retentionDays); err != nil {
+				log.Printf("汇总下载统计失败: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// GetAppDownloadStats 获取应用的下载统计（上传者、开发者成员或拥有 app.manage 权限）：
+// 去重后的下载数和请求数的时间序列，以及按版本、渠道的分组
+func GetAppDownloadStats(c *gin.Context) {
+	appID, ok := loadManagedApp(c)
+	if !ok {
+		return
+	}
+	var query models.AppDownloadStatsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	r, err := parseStatsRange(models.AdminStatsQuery{From: query.From, To: query.To, Bucket: query.Bucket})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	stats := models.AppDownloadStats{
+		PackageName: c.Param("package_name"),
+		From:        r.from.Format("2006-01-02"),
+		To:          r.to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Bucket:      r.bucket,
+		Series:      []models.DownloadStatsPoint{},
+		Versions:    []models.VersionDownloadStats{},
+		Channels:    []models.ChannelDownloadStats{},
+	}
+	if err = queryAppDownloadStats(appID, r, &stats); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询下载统计失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取下载统计成功",
+		Data:    stats,
+	})
+}
+
+// queryAppDownloadStats 从每日汇总中查询应用在统计范围内的下载数据，没有数据的时间段补0
+func queryAppDownloadStats(appID int64, r statsRange, stats *models.AppDownloadStats) error {
+	args := append([]any{appID}, r.dateArgs()...)
+	where := "d.app_id = ? AND d.day >= ? AND d.day <= ?"
+
+	index := map[string]int{}
+	for t := r.bucketStart(r.from); t.Before(r.to); t = r.nextBucket(t) {
+		date := t.Format("2006-01-02")
+		index[date] = len(stats.Series)
+		stats.Series = append(stats.Series, models.DownloadStatsPoint{Date: date})
+	}
+	rows, err := database.DB.Query(
+		"SELECT "+r.bucketExpr("d.day", false)+", SUM(d.downloads), SUM(d.requests) FROM app_download_daily d WHERE "+where+" GROUP BY 1",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var point models.DownloadStatsPoint
+		if err := rows.Scan(&point.Date, &point.Downloads, &point.Requests); err != nil {
+			continue
+		}
+		if i, ok := index[point.Date]; ok {
+			stats.Series[i] = point
+		}
+	}
+	rows.Close()
+
+	if err := database.DB.QueryRow(
+		"SELECT COALESCE(SUM(d.downloads), 0), COALESCE(SUM(d.requests), 0) FROM app_download_daily d WHERE "+where, args...,
+	).Scan(&stats.Totals.Downloads, &stats.Totals.Requests); err != nil {
+		return err
+	}
+	if err := database.DB.QueryRow(
+		"SELECT COALESCE(download_count, 0) FROM apps WHERE id = ?", appID,
+	).Scan(&stats.DownloadCount); err != nil {
+		return err
+	}
+
+	// 旧的下载记录可能没有版本（version_id 为 0），显示为空版本号
+	rows, err = database.DB.Query(`
+		SELECT COALESCE(v.version, ''), COALESCE(v.version_code, 0), MAX(d.channel), SUM(d.downloads), SUM(d.requests)
+		FROM app_download_daily d
+		LEFT JOIN app_versions v ON d.version_id = v.id
+		WHERE `+where+`
+		GROUP BY d.version_id
+		ORDER BY COALESCE(v.version_code, 0) DESC`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var item models.VersionDownloadStats
+		if err := rows.Scan(&item.Version, &item.VersionCode, &item.Channel, &item.Downloads, &item.Requests); err == nil {
+			stats.Versions = append(stats.Versions, item)
+		}
+	}
+	rows.Close()
+
+	rows, err = database.DB.Query(
+		"SELECT d.channel, SUM(d.downloads), SUM(d.requests) FROM app_download_daily d WHERE "+where+
+			" GROUP BY d.channel ORDER BY SUM(d.downloads) DESC, d.channel",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item models.ChannelDownloadStats
+		if err := rows.Scan(&item.Channel, &item.Downloads, &item.Requests); err == nil {
+			stats.Channels = append(stats.Channels, item)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConcurrentIdenticalDownloadsCountOnce(t *testing.T) {
+	setupTestDB(t)
+	uploader := createTestUser(t, "uploader", "password123", "uploader@example.com")
+	reviewer := createTestUser(t, "reviewer", "password123", "reviewer@example.com")
+	const pkg = "com.example.download"
+
+	taskID := createTestUploadTask(t, uploader, pkg, 1, "")
+	if _, err := reviewUploadTask(reviewer, taskID, reviewDecision{accept: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 8
+	codes := make([]int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/?client_id=same-client", nil)
+			c.Request.RemoteAddr = "203.0.113.7:1234"
+			c.Params = gin.Params{{Key: "package_name", Value: pkg}}
+			DownloadApp(c)
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("第 %d 个请求状态码 = %d, 期望 200", i, code)
+		}
+	}
+	var downloads, hits int
+	database.DB.QueryRow("SELECT download_count FROM apps WHERE package_name = ?", pkg).Scan(&downloads)
+	database.DB.QueryRow("SELECT COALESCE(SUM(hits), 0) FROM app_downloads WHERE package_name = ?", pkg).Scan(&hits)
+	if downloads != 1 {
+		t.Fatalf("download_count = %d, 期望 1", downloads)
+	}
+	if hits != requests {
+		t.Fatalf("hits = %d, 期望 %d", hits, requests)
+	}
+}
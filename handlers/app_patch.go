@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"TaruApp/bsdiff"
+	"TaruApp/config"
+	"TaruApp/database"
+	"TaruApp/models"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 补丁生成失败后的最大重试次数
+const patchMaxAttempts = 3
+
+// patchJobWake 审核通过新版本后唤醒补丁生成任务
+var patchJobWake = make(chan struct{}, 1)
+
+// patchHTTPClient 下载安装包用于生成补丁。下载地址由上传者填写，
+// 连接时校验解析后的地址（包括重定向后的地址），不允许访问内网、本机和云平台元数据服务
+var patchHTTPClient = &http.Client{
+	Timeout: 10 * time.Minute,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				return checkPublicIP(net.ParseIP(host))
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("重定向次数过多")
+		}
+		return checkPackageURL(req.URL)
+	},
+}
+
+// carrierGradeNAT 运营商级 NAT 地址段（100.64.0.0/10），同样视为内网地址
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// checkPublicIP 只允许连接公网地址
+func checkPublicIP(ip net.IP) error {
+	if ip == nil {
+		return errors.New("无效的下载地址")
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || carrierGradeNAT.Contains(ip) {
+		return fmt.Errorf("不允许从内网地址 %s 下载安装包", ip)
+	}
+	return nil
+}
+
+// checkPackageURL 安装包下载地址只能是 http 或 https
+func checkPackageURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("不支持的下载地址协议: %s", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("下载地址缺少主机名")
+	}
+	return nil
+}
+
+// patchVersion 参与生成补丁的应用版本
+type patchVersion struct {
+	ID          int64
+	AppID       int64
+	PackageName string
+	VersionCode int
+	Channel     string
+	Fingerprint string
+	Size        int64
+	DownloadURL string
+}
+
+// patchPair 需要生成补丁的相邻版本
+type patchPair struct {
+	From, To patchVersion
+}
+
+// TriggerPatchJob 通知补丁生成任务尽快运行（任务未启用时不做任何事）
+func TriggerPatchJob() {
+	select {
+	case patchJobWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartPatchJob 启动为相邻版本生成增量更新补丁的后台任务
+func StartPatchJob(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			generated, failed, err := runPatchJob()
+			if err != nil {
+				log.Printf("生成增量更新补丁失败: %v", err)
+			} else if generated > 0 || failed > 0 {
+				log.Printf("生成增量更新补丁完成: 成功 %d 个，失败 %d 个", generated, failed)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-patchJobWake:
+			}
+		}
+	}()
+}
+
+// findPatchPairs 查找还没有补丁（或生成失败可以重试、上次生成被中断）的相邻版本。
+// 同一应用同一渠道内，按版本代码排序的相邻未下架版本组成一对；双方签名不同时无法覆盖安装，不生成补丁
+func findPatchPairs() ([]patchPair, error) {
+	rows, err := database.DB.Query(`
+		SELECT v.id, v.app_id, v.package_name, v.version_code, COALESCE(v.channel, ''),
+			COALESCE(v.signer_fingerprint, ''), v.size, v.download_url
+		FROM app_versions v
+		WHERE v.withdrawn_at IS NULL
+		ORDER BY v.app_id, v.channel, v.version_code, v.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var versions []patchVersion
+	for rows.Next() {
+		var v patchVersion
+		if err := rows.Scan(&v.ID, &v.AppID, &v.PackageName, &v.VersionCode, &v.Channel,
+			&v.Fingerprint, &v.Size, &v.DownloadURL); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	done := map[[2]int64]bool{}
+	rows, err = database.DB.Query(
+		"SELECT from_version_id, to_version_id FROM app_patches WHERE status NOT IN ('failed', 'pending') OR attempts >= ?",
+		patchMaxAttempts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key [2]int64
+		if err := rows.Scan(&key[0], &key[1]); err != nil {
+			return nil, err
+		}
+		done[key] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pairs []patchPair
+	for i := 1; i < len(versions); i++ {
+		from, to := versions[i-1], versions[i]
+		if from.AppID != to.AppID || from.Channel != to.Channel || from.VersionCode >= to.VersionCode {
+			continue
+		}
+		if from.Fingerprint != "" && to.Fingerprint != "" && from.Fingerprint != to.Fingerprint {
+			continue
+		}
+		if !done[[2]int64{from.ID, to.ID}] {
+			pairs = append(pairs, patchPair{From: from, To: to})
+		}
+	}
+	return pairs, nil
+}
+
+// runPatchJob 生成所有缺少的补丁，返回成功和失败的数量
+func runPatchJob() (generated, failed int, err error) {
+	pairs, err := findPatchPairs()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 相邻的两对共用一个版本，保留上一次下载的安装包避免重复下载
+	var cachedID int64
+	var cachedData []byte
+	fetch := func(v patchVersion) ([]byte, error) {
+		if v.ID == cachedID {
+			return cachedData, nil
+		}
+		data, err := fetchPackage(v.DownloadURL)
+		if err != nil {
+			return nil, err
+		}
+		cachedID, cachedData = v.ID, data
+		return data, nil
+	}
+
+	for _, pair := range pairs {
+		if err := generatePatch(pair, fetch); err != nil {
+			failed++
+			log.Printf("生成补丁 %s %d -> %d 失败: %v", pair.From.PackageName, pair.From.VersionCode, pair.To.VersionCode, err)
+			continue
+		}
+		generated++
+	}
+	return generated, failed, nil
+}
+
+// generatePatch 下载两个版本的安装包并生成补丁，结果写入 app_patches
+func generatePatch(pair patchPair, fetch func(patchVersion) ([]byte, error)) error {
+	now := formatDBTime(time.Now())
+	_, err := database.DB.Exec(`
+		INSERT INTO app_patches (app_id, package_name, from_version_id, to_version_id, from_version_code, to_version_code,
+			status, attempts, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, 'pending', 1, ?, ?)
+		ON CONFLICT(from_version_id, to_version_id) DO UPDATE SET status = 'pending', attempts = attempts + 1, updated_at = excluded.updated_at
+	`, pair.From.AppID, pair.From.PackageName, pair.From.ID, pair.To.ID, pair.From.VersionCode, pair.To.VersionCode, now, now)
+	if err != nil {
+		return err
+	}
+	var patchID int64
+	if err := database.DB.QueryRow(
+		"SELECT id FROM app_patches WHERE from_version_id = ? AND to_version_id = ?", pair.From.ID, pair.To.ID,
+	).Scan(&patchID); err != nil {
+		return err
+	}
+
+	finish := func(status, message string) {
+		database.DB.Exec("UPDATE app_patches SET status = ?, error = NULLIF(?, ''), updated_at = ? WHERE id = ?",
+			status, message, formatDBTime(time.Now()), patchID)
+	}
+
+	maxSize := int64(config.AppConfig.PatchMaxFileSize) << 20
+	if pair.From.Size > maxSize || pair.To.Size > maxSize {
+		finish("skipped", "安装包超过补丁生成的大小上限")
+		return nil
+	}
+
+	oldData, err := fetch(pair.From)
+	if err == nil {
+		var newData []byte
+		newData, err = fetch(pair.To)
+		if err == nil {
+			err = writePatch(patchID, pair, oldData, newData, finish)
+		}
+	}
+	if err != nil {
+		finish("failed", err.Error())
+		return err
+	}
+	return nil
+}
+
+// writePatch 生成补丁并校验可以还原出新版本，补丁没有明显小于完整安装包时不保存
+func writePatch(patchID int64, pair patchPair, oldData, newData []byte, finish func(status, message string)) error {
+	patch, err := bsdiff.Diff(oldData, newData)
+	if err != nil {
+		return err
+	}
+	restored, err := bsdiff.Patch(oldData, patch)
+	if err != nil || !bytes.Equal(restored, newData) {
+		return errors.New("补丁校验失败")
+	}
+
+	oldSum := sha256.Sum256(oldData)
+	newSum := sha256.Sum256(newData)
+	patchSum := sha256.Sum256(patch)
+	database.DB.Exec("UPDATE app_versions SET file_sha256 = ? WHERE id = ?", hex.EncodeToString(oldSum[:]), pair.From.ID)
+	database.DB.Exec("UPDATE app_versions SET file_sha256 = ? WHERE id = ?", hex.EncodeToString(newSum[:]), pair.To.ID)
+
+	if len(patch) >= len(newData)*9/10 {
+		finish("skipped", fmt.Sprintf("补丁大小 %d 字节，没有明显小于完整安装包", len(patch)))
+		return nil
+	}
+
+	dir := filepath.Join(config.AppConfig.PatchDir, fmt.Sprint(pair.From.AppID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d.patch", patchID))
+	if err := os.WriteFile(path, patch, 0644); err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE app_patches SET status = 'ready', file_path = ?, patch_size = ?, patch_sha256 = ?,
+			target_size = ?, target_sha256 = ?, error = NULL, updated_at = ?
+		WHERE id = ?
+	`, path, len(patch), hex.EncodeToString(patchSum[:]), len(newData), hex.EncodeToString(newSum[:]),
+		formatDBTime(time.Now()), patchID)
+	return err
+}
+
+// fetchPackage 下载安装包，超过大小上限时返回错误
+func fetchPackage(rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPackageURL(u); err != nil {
+		return nil, err
+	}
+	resp, err := patchHTTPClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载安装包失败: HTTP %d", resp.StatusCode)
+	}
+
+	maxSize := int64(config.AppConfig.PatchMaxFileSize) << 20
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errors.New("安装包超过补丁生成的大小上限")
+	}
+	return data, nil
+}
+
+// readyPatches 查询多个应用已生成的补丁，按 (起始版本ID, 目标版本ID) 索引
+func readyPatches(packageNames []string) (map[[2]int64]models.AppPatch, error) {
+	result := map[[2]int64]models.AppPatch{}
+	if len(packageNames) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(packageNames)), ", ")
+	args := make([]any, len(packageNames))
+	for i, name := range packageNames {
+		args[i] = name
+	}
+	rows, err := database.DB.Query(`
+		SELECT id, package_name, from_version_id, to_version_id, from_version_code, patch_size, patch_sha256,
+			target_size, target_sha256
+		FROM app_patches
+		WHERE status = 'ready' AND package_name IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var packageName string
+		var key [2]int64
+		var p models.AppPatch
+		if err := rows.Scan(&id, &packageName, &key[0], &key[1], &p.FromVersionCode, &p.Size, &p.SHA256,
+			&p.TargetSize, &p.TargetSHA256); err != nil {
+			continue
+		}
+		p.DownloadURL = fmt.Sprintf("/api/apps/%s/patches/%d", packageName, id)
+		result[key] = p
+	}
+	return result, rows.Err()
+}
+
+// DownloadAppPatch 下载增量更新补丁
+func DownloadAppPatch(c *gin.Context) {
+	packageName := c.Param("package_name")
+
+	var fromCode, toCode int
+	var path, patchSHA, targetSHA string
+	err := database.DB.QueryRow(`
+		SELECT from_version_code, to_version_code, file_path, patch_sha256, target_sha256
+		FROM app_patches
+		WHERE id = ? AND package_name = ? AND status = 'ready'
+	`, c.Param("id"), packageName).Scan(&fromCode, &toCode, &path, &patchSHA, &targetSHA)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "补丁不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询补丁失败: " + err.Error(),
+		})
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "补丁文件不存在",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("X-Patch-SHA256", patchSHA)
+	c.Header("X-Target-SHA256", targetSHA)
+	c.FileAttachment(path, fmt.Sprintf("%s_%d_%d.patch", packageName, fromCode, toCode))
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckPublicIP(t *testing.T) {
+	blocked := []string{
+		"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"fe80::1", "fc00::1", "0.0.0.0", "100.64.0.1", "::ffff:127.0.0.1", "224.0.0.1",
+	}
+	for _, addr := range blocked {
+		if checkPublicIP(net.ParseIP(addr)) == nil {
+			t.Errorf("%s 应当被拒绝", addr)
+		}
+	}
+
+	allowed := []string{"8.8.8.8", "1.1.1.1", "2001:4860:4860::8888"}
+	for _, addr := range allowed {
+		if err := checkPublicIP(net.ParseIP(addr)); err != nil {
+			t.Errorf("%s 应当允许: %v", addr, err)
+		}
+	}
+}
+
+func TestFetchPackageRejectsInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer srv.Close()
+
+	urls := []string{
+		srv.URL + "/app.apk",
+		"http://localhost:1/app.apk",
+		"file:///etc/passwd",
+		"ftp://example.com/app.apk",
+		"/relative/app.apk",
+	}
+	for _, u := range urls {
+		if _, err := fetchPackage(u); err == nil {
+			t.Errorf("%s 应当被拒绝", u)
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package handlers
+
+import (
+	"TaruApp/audit"
+	"TaruApp/config"
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/rbac"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// claimAvailableCondition 上传任务可以被指定审核员认领或审核的条件：未被认领、已被该审核员认领或认领已超时。
+// 组长分配的任务没有超时时间，参数依次为审核员ID和当前时间
+const claimAvailableCondition = `(claimed_by IS NULL OR claimed_by = ? OR claim_expires_at <= ?)`
+
+// taskClaim 上传任务的认领状态
+type taskClaim struct {
+	Status      string
+	ClaimedBy   int64
+	ClaimerName string
+	ExpiresAt   *time.Time // 为空表示由组长分配，不会超时
+	AssignedBy  int64
+}
+
+// active 认领是否仍然有效
+func (t *taskClaim) active(now time.Time) bool {
+	return t.ClaimedBy != 0 && (t.ExpiresAt == nil || t.ExpiresAt.After(now))
+}
+
+// data 返回认领信息，用于响应
+func (t *taskClaim) data() gin.H {
+	data := gin.H{
+		"claimed_by":       t.ClaimedBy,
+		"claimer_name":     t.ClaimerName,
+		"claim_expires_at": nil,
+		"assigned":         t.AssignedBy != 0,
+	}
+	if t.ExpiresAt != nil {
+		data["claim_expires_at"] = t.ExpiresAt.Format("2006-01-02 15:04:05")
+	}
+	return data
+}
+
+// loadTaskClaim 获取上传任务的状态和认领信息
+func loadTaskClaim(taskID int64) (*taskClaim, error) {
+	var claim taskClaim
+	var claimedBy, assignedBy sql.NullInt64
+	var claimerName sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT t.status, t.claimed_by, u.username, t.claim_expires_at, t.assigned_by
+		FROM app_upload_tasks t
+		LEFT JOIN users u ON t.claimed_by = u.id
+		WHERE t.id = ?
+	`, taskID).Scan(&claim.Status, &claimedBy, &claimerName, &claim.ExpiresAt, &assignedBy)
+	if err != nil {
+		return nil, err
+	}
+	claim.ClaimedBy = claimedBy.Int64
+	claim.ClaimerName = claimerName.String
+	claim.AssignedBy = assignedBy.Int64
+	return &claim, nil
+}
+
+// parseTaskID 解析路由参数中的上传任务ID
+func parseTaskID(c *gin.Context) (int64, bool) {
+	taskID, err := strconv.ParseInt(c.Param("task_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "任务ID无效",
+		})
+		return 0, false
+	}
+	return taskID, true
+}
+
+// ClaimUploadTask 认领待审核的上传任务，认领后其他审核员在锁定时间内不能认领或审核。
+// 重复认领会延长锁定时间，组长分配给自己的任务保持不超时
+func ClaimUploadTask(c *gin.Context) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+	reviewerID := c.GetInt64("user_id")
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(config.AppConfig.ReviewClaimTimeout) * time.Minute)
+
+	result, err := database.DB.Exec(`
+		UPDATE app_upload_tasks
+		SET claim_expires_at = CASE WHEN claimed_by = ? AND assigned_by IS NOT NULL THEN claim_expires_at ELSE ? END,
+			assigned_by = CASE WHEN claimed_by = ? THEN assigned_by ELSE NULL END,
+			claimed_by = ?
+		WHERE id = ? AND status = 'pending' AND `+claimAvailableCondition,
+		reviewerID, formatDBTime(expiresAt), reviewerID, reviewerID,
+		taskID, reviewerID, formatDBTime(now),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "认领任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	claim, err := loadTaskClaim(taskID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if claim.Status != "pending" {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "该任务已经审核过了",
+			})
+			return
+		}
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: fmt.Sprintf("任务已被 %s 认领", claim.ClaimerName),
+			Data:    claim.data(),
+		})
+		return
+	}
+
+	data := claim.data()
+	data["task_id"] = taskID
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "认领任务成功",
+		Data:    data,
+	})
+}
+
+// ReleaseUploadTask 释放认领的上传任务（认领者本人或拥有 app.review_lead 权限的用户）
+func ReleaseUploadTask(c *gin.Context) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt64("user_id")
+
+	claim, err := loadTaskClaim(taskID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询任务失败: " + err.Error(),
+		})
+		return
+	}
+	if claim.Status != "pending" || !claim.active(time.Now()) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "任务没有被认领",
+		})
+		return
+	}
+	if claim.ClaimedBy != userID && !rbac.Can(userID, rbac.PermAppReviewLead) {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只能释放自己认领的任务",
+		})
+		return
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE app_upload_tasks SET claimed_by = NULL, claim_expires_at = NULL, assigned_by = NULL
+		WHERE id = ? AND claimed_by = ?
+	`, taskID, claim.ClaimedBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "释放任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已释放任务",
+		Data: gin.H{
+			"task_id":    taskID,
+			"claimed_by": claim.ClaimedBy,
+		},
+	})
+}
+
+// uniqueTaskIDs 去掉重复的任务ID并保持原有顺序
+func uniqueTaskIDs(ids []int64) []int64 {
+	result := make([]int64, 0, len(ids))
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// joinTaskIDs 把任务ID列表拼成逗号分隔的字符串（用于审计日志）
+func joinTaskIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// AssignUploadTasks 把待审核的上传任务分配给审核员（需要 app.review_lead 权限）。
+// 分配会覆盖原有的认领，分配的任务不会超时，直到审核完成或被释放
+func AssignUploadTasks(c *gin.Context) {
+	var req models.AssignReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var reviewerName string
+	err := database.DB.QueryRow("SELECT username FROM users WHERE id = ?", req.ReviewerID).Scan(&reviewerName)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "审核员不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询审核员失败: " + err.Error(),
+		})
+		return
+	}
+	if !rbac.Can(req.ReviewerID, rbac.PermAppReview) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该用户没有审核权限",
+		})
+		return
+	}
+
+	taskIDs := uniqueTaskIDs(req.TaskIDs)
+	args := []interface{}{req.ReviewerID, c.GetInt64("user_id")}
+	for _, id := range taskIDs {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(taskIDs)), ", ")
+	rows, err := database.DB.Query(`
+		UPDATE app_upload_tasks SET claimed_by = ?, claim_expires_at = NULL, assigned_by = ?
+		WHERE status = 'pending' AND id IN (`+placeholders+`)
+		RETURNING id
+	`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "分配任务失败: " + err.Error(),
+		})
+		return
+	}
+	assigned := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			assigned[id] = true
+		}
+	}
+	rows.Close()
+
+	// 按请求顺序返回，不是待审核状态或不存在的任务不分配
+	assignedIDs, skippedIDs := []int64{}, []int64{}
+	for _, id := range taskIDs {
+		if assigned[id] {
+			assignedIDs = append(assignedIDs, id)
+		} else {
+			skippedIDs = append(skippedIDs, id)
+		}
+	}
+	audit.SetTarget(c, "app_upload_task", joinTaskIDs(assignedIDs))
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: fmt.Sprintf("已分配 %d 个任务给 %s", len(assignedIDs), reviewerName),
+		Data: gin.H{
+			"reviewer_id":   req.ReviewerID,
+			"reviewer_name": reviewerName,
+			"assigned":      assignedIDs,
+			"skipped":       skippedIDs,
+		},
+	})
+}
+
+// BatchReviewApps 批量通过或拒绝上传任务（需要 app.review_lead 权限）。
+// 每个任务单独审核，被其他审核员认领的任务会失败，不影响其他任务
+func BatchReviewApps(c *gin.Context) {
+	var req models.BatchReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.Accept == 0 && req.RejectReason == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "拒绝时必须提供拒绝原因",
+		})
+		return
+	}
+
+	decision := reviewDecision{
+		accept:       req.Accept,
+		rejectReason: req.RejectReason,
+		checklist:    req.Checklist,
+		notes:        strings.TrimSpace(req.Notes),
+		batch:        true,
+	}
+	reviewerID := c.GetInt64("user_id")
+
+	results := []models.BatchReviewResult{}
+	succeededIDs := []int64{}
+	for _, taskID := range uniqueTaskIDs(req.TaskIDs) {
+		outcome, err := reviewUploadTask(reviewerID, taskID, decision)
+		if err != nil {
+			results = append(results, models.BatchReviewResult{TaskID: taskID, Message: err.Error()})
+			continue
+		}
+		results = append(results, models.BatchReviewResult{TaskID: taskID, Success: true, Status: outcome.status})
+		succeededIDs = append(succeededIDs, taskID)
+	}
+
+	if req.Accept == 1 && len(succeededIDs) > 0 {
+		TriggerPatchJob()
+	}
+	audit.SetTarget(c, "app_upload_task", joinTaskIDs(succeededIDs))
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: fmt.Sprintf("批量审核完成：成功 %d 个，失败 %d 个", len(succeededIDs), len(results)-len(succeededIDs)),
+		Data: gin.H{
+			"succeeded": len(succeededIDs),
+			"failed":    len(results) - len(succeededIDs),
+			"results":   results,
+		},
+	})
+}
+
+// loadReviewRecords 获取上传任务的审核记录（按时间顺序）
+func loadReviewRecords(taskID int64) ([]models.ReviewRecord, error) {
+	rows, err := database.DB.Query(`
+		SELECT r.id, r.reviewer_id, COALESCE(u.username, ''), r.decision, r.revision, r.ad_level_verified,
+			r.permissions_reasonable, r.no_malware_found, COALESCE(r.notes, ''),
+			COALESCE(r.reject_reason, ''), COALESCE(r.field_comments, ''), r.batch, r.created_at
+		FROM app_review_records r
+		LEFT JOIN users u ON r.reviewer_id = u.id
+		WHERE r.task_id = ?
+		ORDER BY r.id
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []models.ReviewRecord{}
+	for rows.Next() {
+		var r models.ReviewRecord
+		var fieldComments string
+		var createdAt time.Time
+		if err := rows.Scan(&r.ID, &r.ReviewerID, &r.ReviewerName, &r.Decision, &r.Revision, &r.Checklist.AdLevelVerified,
+			&r.Checklist.PermissionsReasonable, &r.Checklist.NoMalwareFound, &r.Notes,
+			&r.RejectReason, &fieldComments, &r.Batch, &createdAt); err != nil {
+			return nil, err
+		}
+		if fieldComments != "" {
+			json.Unmarshal([]byte(fieldComments), &r.FieldComments)
+		}
+		r.CreatedAt = createdAt.Format("2006-01-02 15:04:05")
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// roundHours 把小时数保留两位小数
+func roundHours(h float64) float64 {
+	return math.Round(h*100) / 100
+}
+
+// GetReviewStats 审核统计：待审核队列和各审核员在统计范围内的审核数量、各结论的数量和平均等待时间
+func GetReviewStats(c *gin.Context) {
+	var query models.AdminStatsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	r, err := parseStatsRange(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+	now := formatDBTime(time.Now())
+
+	stats := models.ReviewStats{
+		From:      r.from.Format("2006-01-02"),
+		To:        r.to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Reviewers: []models.ReviewerStats{},
+	}
+	err = database.DB.QueryRow(`
+		SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN claimed_by IS NULL OR claim_expires_at <= ? THEN 1 ELSE 0 END), 0)
+		FROM app_upload_tasks WHERE status = 'pending'
+	`, now).Scan(&stats.Pending, &stats.Unclaimed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询审核统计失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 各审核员在统计范围内的审核记录，等待时间从任务上传算起
+	rows, err := database.DB.Query(`
+		SELECT r.reviewer_id, COALESCE(u.username, ''), COUNT(*),
+			SUM(CASE WHEN r.decision = 'approved' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN r.decision = 'rejected' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN r.decision = 'changes_requested' THEN 1 ELSE 0 END),
+			SUM(r.batch),
+			AVG((julianday(r.created_at) - julianday(t.created_at)) * 24)
+		FROM app_review_records r
+		JOIN app_upload_tasks t ON r.task_id = t.id
+		LEFT JOIN users u ON r.reviewer_id = u.id
+		WHERE r.created_at >= ? AND r.created_at < ?
+		GROUP BY r.reviewer_id
+		ORDER BY COUNT(*) DESC
+	`, r.timeArgs()...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询审核统计失败: " + err.Error(),
+		})
+		return
+	}
+	index := map[int64]int{}
+	var totalWait float64
+	for rows.Next() {
+		var s models.ReviewerStats
+		if err := rows.Scan(&s.ReviewerID, &s.ReviewerName, &s.Reviewed, &s.Approved, &s.Rejected,
+			&s.ChangesRequested, &s.Batch, &s.AvgWaitHours); err != nil {
+			continue
+		}
+		stats.Reviewed += s.Reviewed
+		totalWait += s.AvgWaitHours * float64(s.Reviewed)
+		s.AvgWaitHours = roundHours(s.AvgWaitHours)
+		index[s.ReviewerID] = len(stats.Reviewers)
+		stats.Reviewers = append(stats.Reviewers, s)
+	}
+	rows.Close()
+	if stats.Reviewed > 0 {
+		stats.AvgWaitHours = roundHours(totalWait / float64(stats.Reviewed))
+	}
+
+	// 当前认领中的任务，没有审核记录的审核员也列出
+	rows, err = database.DB.Query(`
+		SELECT t.claimed_by, COALESCE(u.username, ''), COUNT(*)
+		FROM app_upload_tasks t
+		LEFT JOIN users u ON t.claimed_by = u.id
+		WHERE t.status = 'pending' AND t.claimed_by IS NOT NULL
+			AND (t.claim_expires_at IS NULL OR t.claim_expires_at > ?)
+		GROUP BY t.claimed_by
+	`, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询审核统计失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reviewerID int64
+		var name string
+		var claims int
+		if err := rows.Scan(&reviewerID, &name, &claims); err != nil {
+			continue
+		}
+		if i, ok := index[reviewerID]; ok {
+			stats.Reviewers[i].ActiveClaims = claims
+			continue
+		}
+		stats.Reviewers = append(stats.Reviewers, models.ReviewerStats{
+			ReviewerID:   reviewerID,
+			ReviewerName: name,
+			ActiveClaims: claims,
+		})
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取审核统计成功",
+		Data:    stats,
+	})
+}
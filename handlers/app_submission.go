@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadTaskFields 上传任务中可以被审核员提出意见的字段（与上传应用请求的 JSON 字段名相同），
+// 也是时间线中比较修改内容的顺序
+var uploadTaskFields = []string{
+	"package_name", "name", "icon_url", "version", "version_code", "size", "channel",
+	"main_category", "sub_category", "screenshots", "description", "share_desc",
+	"update_content", "developer_name", "ad_level", "payment_type", "operation_type",
+	"download_url", "signer_fingerprint", "tags", "developer_id",
+}
+
+// normalizeFieldComments 检查字段意见：字段名必须是上传任务的字段，去掉空白意见。不合法时返回错误信息
+func normalizeFieldComments(comments []models.FieldComment) ([]models.FieldComment, string) {
+	result := []models.FieldComment{}
+	for _, fc := range comments {
+		fc.Field = strings.TrimSpace(fc.Field)
+		fc.Comment = strings.TrimSpace(fc.Comment)
+		if fc.Comment == "" {
+			continue
+		}
+		valid := false
+		for _, field := range uploadTaskFields {
+			if field == fc.Field {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Sprintf("未知的字段: %s", fc.Field)
+		}
+		result = append(result, fc)
+	}
+	return result, ""
+}
+
+// saveUploadSubmission 在事务中保存上传任务某次提交的内容快照
+func saveUploadSubmission(tx *sql.Tx, taskID int64, revision int, req models.UploadAppRequest) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO app_upload_submissions (task_id, revision, data, created_at) VALUES (?, ?, ?, ?)",
+		taskID, revision, string(data), formatDBTime(time.Now()),
+	)
+	return err
+}
+
+// ResubmitUploadTask 上传者修改并重新提交被要求修改的上传任务（不能修改包名），任务回到待审核状态
+func ResubmitUploadTask(c *gin.Context) {
+	taskID, ok := parseTaskID(c)
+	if !ok {
+		return
+	}
+	var req models.UploadAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var ownerID int64
+	var packageName, status string
+	var revision int
+	err := database.DB.QueryRow(
+		"SELECT user_id, package_name, status, COALESCE(revision, 1) FROM app_upload_tasks WHERE id = ?", taskID,
+	).Scan(&ownerID, &packageName, &status, &revision)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询任务失败: " + err.Error(),
+		})
+		return
+	}
+	if ownerID != c.GetInt64("user_id") {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只能重新提交自己的上传任务",
+		})
+		return
+	}
+	if status == "expired" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "任务已过期，请重新上传",
+		})
+		return
+	}
+	if status != "changes_requested" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "只有被要求修改的任务可以重新提交",
+		})
+		return
+	}
+	if req.PackageName != packageName {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "重新提交不能修改包名",
+		})
+		return
+	}
+	if !validateUploadRequest(c, &req) {
+		return
+	}
+
+	screenshotsJSON, _ := json.Marshal(req.Screenshots)
+	proposedTagsJSON, _ := json.Marshal(req.Tags)
+	now := formatDBTime(time.Now())
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "重新提交失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	warnings, ok := checkUploadConflicts(c, tx, uploadCandidate{
+		taskID:            taskID,
+		userID:            ownerID,
+		developerID:       req.DeveloperID,
+		packageName:       req.PackageName,
+		version:           req.Version,
+		versionCode:       req.VersionCode,
+		signerFingerprint: req.SignerFingerprint,
+	})
+	if !ok {
+		return
+	}
+
+	// 已超过重新提交期限但还没被定时任务标记的任务同样不能重新提交
+	activeCondition, activeArgs := activeUploadTaskCondition()
+	result, err := tx.Exec(
+		`UPDATE app_upload_tasks SET
+			name = ?, icon_url = ?, version = ?, version_code = ?, size = ?, channel = ?,
+			main_category = ?, sub_category = ?, screenshots = ?, description = ?, share_desc = ?,
+			update_content = ?, developer_name = ?, ad_level = ?, payment_type = ?, operation_type = ?,
+			download_url = ?, signer_fingerprint = NULLIF(?, ''), proposed_tags = ?, developer_id = NULLIF(?, 0),
+			status = 'pending', reject_reason = NULL, reviewer_id = NULL, review_time = NULL,
+			revision = ?, updated_at = ?
+		WHERE id = ? AND status = 'changes_requested' AND `+activeCondition,
+		append([]any{
+			req.Name, req.IconURL, req.Version, req.VersionCode, req.Size, req.Channel,
+			req.MainCategory, req.SubCategory, string(screenshotsJSON), req.Description, req.ShareDesc,
+			req.UpdateContent, req.DeveloperName, req.AdLevel, req.PaymentType, req.OperationType,
+			req.DownloadURL, req.SignerFingerprint, string(proposedTagsJSON), req.DeveloperID,
+			revision + 1, now, taskID,
+		}, activeArgs...)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "重新提交失败: " + err.Error(),
+		})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: "任务状态已变化或已过期，请刷新后重试",
+		})
+		return
+	}
+	if err = saveUploadSubmission(tx, taskID, revision+1, req); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "重新提交失败: " + err.Error(),
+		})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "重新提交失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已重新提交，等待审核",
+		Data: gin.H{
+			"task_id":  taskID,
+			"status":   "pending",
+			"revision": revision + 1,
+			"warnings": warnings,
+		},
+	})
+}
+
+// changedUploadFields 比较两次提交的内容，返回修改了的字段
+func changedUploadFields(before, after map[string]any) []string {
+	changed := []string{}
+	for _, field := range uploadTaskFields {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changed = append(changed, field)
+		}
+	}
+	return changed
+}
+
+// loadUploadTimeline 获取上传任务的时间线：每次提交（含修改了的字段）和每次审核的结论，按先后顺序排列。
+// internal 为 true 时包含审核员、检查清单和内部备注
+func loadUploadTimeline(taskID int64, createdAt time.Time, internal bool) ([]models.UploadTimelineEvent, error) {
+	events := []models.UploadTimelineEvent{}
+
+	rows, err := database.DB.Query(
+		"SELECT revision, data, created_at FROM app_upload_submissions WHERE task_id = ? ORDER BY revision", taskID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var previous map[string]any
+	for rows.Next() {
+		var revision int
+		var data string
+		var submittedAt time.Time
+		if err := rows.Scan(&revision, &data, &submittedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		var current map[string]any
+		json.Unmarshal([]byte(data), &current)
+
+		event := models.UploadTimelineEvent{
+			Type:     "submitted",
+			Revision: revision,
+			Time:     submittedAt.Format("2006-01-02 15:04:05"),
+		}
+		if revision > 1 {
+			event.Type = "resubmitted"
+			if previous != nil {
+				event.ChangedFields = changedUploadFields(previous, current)
+			}
+		}
+		previous = current
+		events = append(events, event)
+	}
+	rows.Close()
+
+	// 提交快照上线前创建的任务没有快照，用任务的创建时间作为第一次提交
+	if len(events) == 0 {
+		events = append(events, models.UploadTimelineEvent{
+			Type:     "submitted",
+			Revision: 1,
+			Time:     createdAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	records, err := loadReviewRecords(taskID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		event := models.UploadTimelineEvent{
+			Type:          "reviewed",
+			Revision:      r.Revision,
+			Time:          r.CreatedAt,
+			Decision:      r.Decision,
+			Message:       r.RejectReason,
+			FieldComments: r.FieldComments,
+		}
+		if internal {
+			checklist := r.Checklist
+			event.ReviewerName = r.ReviewerName
+			event.Checklist = &checklist
+			event.Notes = r.Notes
+		}
+		events = append(events, event)
+	}
+
+	// 每次提交之后是对这次提交的审核，按提交次数排列比按时间排列可靠（同一秒内可能有多条记录）
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Revision != events[j].Revision {
+			return events[i].Revision < events[j].Revision
+		}
+		return events[i].Type != "reviewed" && events[j].Type == "reviewed"
+	})
+	return events, nil
+}
+
+// expireUploadTasks 把超过 days 天没有重新提交的要求修改任务标记为已过期，返回过期的任务数
+func expireUploadTasks(days int) (int64, error) {
+	if days <= 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	result, err := database.DB.Exec(
+		`UPDATE app_upload_tasks SET status = 'expired', updated_at = ?
+		WHERE status = 'changes_requested' AND COALESCE(review_time, updated_at) <= ?`,
+		formatDBTime(now), formatDBTime(now.AddDate(0, 0, -days)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// StartUploadTaskExpiryJob 启动标记过期上传任务的后台任务，启动时先运行一次
+func StartUploadTaskExpiryJob(interval time.Duration, days int) {
+	if interval <= 0 || days <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			expired, err := expireUploadTasks(days)
+			if err != nil {
+				log.Printf("标记过期上传任务失败: %v", err)
+			} else if expired > 0 {
+				log.Printf("已将 %d 个超过 %d 天未重新提交的上传任务标记为过期", expired, days)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxAppTags   = 10 // 每个应用最多的标签数
+	maxTagLength = 20 // 标签最大长度（字符）
+)
+
+// normalizeTag 规范化标签：去掉首尾空白、合并连续空白、英文转为小写
+func normalizeTag(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// normalizeTags 规范化并去重标签列表，标签不合法时返回错误信息
+func normalizeTags(tags []string) ([]string, string) {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, raw := range tags {
+		tag := normalizeTag(raw)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength || strings.ContainsAny(tag, ",，") {
+			return nil, fmt.Sprintf("标签「%s」不合法：最多%d个字符，不能包含逗号", raw, maxTagLength)
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > maxAppTags {
+		return nil, fmt.Sprintf("每个应用最多%d个标签", maxAppTags)
+	}
+	return result, ""
+}
+
+// splitTagsParam 解析逗号分隔的标签查询参数（规范化并去重）
+func splitTagsParam(s string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(s, ",") {
+		if tag = normalizeTag(tag); tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseProposedTags 解析上传任务中以JSON数组保存的提议标签
+func parseProposedTags(s string) []string {
+	tags := []string{}
+	if s != "" {
+		json.Unmarshal([]byte(s), &tags)
+	}
+	return tags
+}
+
+// setAppTags 在事务中把应用的标签替换为 tags
+func setAppTags(tx *sql.Tx, appID int64, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM app_tags WHERE app_id = ?", appID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			"INSERT OR IGNORE INTO app_tags (app_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", appID, tag,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAppTags 获取应用的标签（按名称排序）
+func loadAppTags(appID int64) []string {
+	tags := []string{}
+	rows, err := database.DB.Query(`
+		SELECT t.name FROM app_tags at
+		JOIN tags t ON at.tag_id = t.id
+		WHERE at.app_id = ?
+		ORDER BY t.name
+	`, appID)
+	if err != nil {
+		return tags
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag string
+		if rows.Scan(&tag) == nil {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// appTagFilter 生成标签筛选条件：allTags 中的标签必须全部包含，anyTags 中的标签至少包含一个。
+// 两个列表都为空时返回空字符串
+func appTagFilter(allTags, anyTags []string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if len(allTags) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(allTags)), ", ")
+		conditions = append(conditions, `a.id IN (
+			SELECT at.app_id FROM app_tags at JOIN tags t ON at.tag_id = t.id
+			WHERE t.name IN (`+placeholders+`)
+			GROUP BY at.app_id HAVING COUNT(DISTINCT at.tag_id) = ?)`)
+		for _, tag := range allTags {
+			args = append(args, tag)
+		}
+		args = append(args, len(allTags))
+	}
+	if len(anyTags) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(anyTags)), ", ")
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM app_tags at JOIN tags t ON at.tag_id = t.id
+			WHERE at.app_id = a.id AND t.name IN (`+placeholders+`))`)
+		for _, tag := range anyTags {
+			args = append(args, tag)
+		}
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// SuggestTags 标签自动补全：按前缀匹配，使用的应用多的排在前面
+func SuggestTags(c *gin.Context) {
+	prefix := normalizeTag(c.Query("q"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+	rows, err := database.DB.Query(`
+		SELECT t.name, COUNT(at.app_id) AS app_count
+		FROM tags t
+		JOIN app_tags at ON at.tag_id = t.id
+		WHERE t.name LIKE ? ESCAPE '\'
+		GROUP BY t.id
+		ORDER BY app_count DESC, t.name
+		LIMIT ?
+	`, escaped+"%", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询标签失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.TagSuggestion{}
+	for rows.Next() {
+		var tag models.TagSuggestion
+		if err := rows.Scan(&tag.Name, &tag.AppCount); err != nil {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取标签成功",
+		Data:    tags,
+	})
+}
+
+// GetSimilarApps 获取相似应用：按共同标签数和是否同一小分类计算相似度（同一小分类相当于2个共同标签）
+func GetSimilarApps(c *gin.Context) {
+	packageName := c.Param("package_name")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	var appID int64
+	var mainCategory, subCategory string
+	err := database.DB.QueryRow(
+		"SELECT id, COALESCE(main_category, ''), COALESCE(sub_category, '') FROM apps WHERE package_name = ?", packageName,
+	).Scan(&appID, &mainCategory, &subCategory)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "应用不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询应用失败: " + err.Error(),
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT package_name, name, icon_url, rating, version, size, shared_tags, same_sub_category
+		FROM (
+			SELECT a.package_name, a.name, a.icon_url, a.rating, a.download_count, v.version, v.size,
+				(SELECT COUNT(*) FROM app_tags x
+					WHERE x.app_id = a.id AND x.tag_id IN (SELECT tag_id FROM app_tags WHERE app_id = ?)) AS shared_tags,
+				(a.main_category = ? AND a.sub_category = ?) AS same_sub_category
+			FROM apps a
+			INNER JOIN app_versions v ON a.id = v.app_id AND v.is_latest = 1
+			WHERE a.id != ?
+		)
+		WHERE shared_tags > 0 OR same_sub_category
+		ORDER BY shared_tags + same_sub_category * 2 DESC, download_count DESC
+		LIMIT ?
+	`, appID, mainCategory, subCategory, appID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询相似应用失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	apps := []models.SimilarApp{}
+	for rows.Next() {
+		var app models.SimilarApp
+		if err := rows.Scan(&app.PackageName, &app.Name, &app.IconURL, &app.Rating, &app.Version, &app.Size,
+			&app.SharedTags, &app.SameSubCategory); err != nil {
+			continue
+		}
+		apps = append(apps, app)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取相似应用成功",
+		Data:    apps,
+	})
+}
@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"TaruApp/audit"
+	"TaruApp/database"
+	"TaruApp/models"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errTransferNotPending 转移申请在处理过程中已被其他请求接受、拒绝或撤回
+var errTransferNotPending = errors.New("该转移申请已经处理过了")
+
+// appTransfer 所有权转移申请的状态
+type appTransfer struct {
+	ID              int64
+	AppID           int64
+	PackageName     string
+	FromDeveloperID int64
+	ToDeveloperID   int64
+	Status          string
+}
+
+// loadAppTransfer 解析路径中的转移申请ID并查询申请，不存在时返回 404
+func loadAppTransfer(c *gin.Context) (*appTransfer, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "无效的转移申请ID",
+		})
+		return nil, false
+	}
+	var t appTransfer
+	err = database.DB.QueryRow(`
+		SELECT t.id, t.app_id, a.package_name, t.from_developer_id, t.to_developer_id, t.status
+		FROM app_transfers t
+		JOIN apps a ON t.app_id = a.id
+		WHERE t.id = ?
+	`, id).Scan(&t.ID, &t.AppID, &t.PackageName, &t.FromDeveloperID, &t.ToDeveloperID, &t.Status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "转移申请不存在",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询转移申请失败: " + err.Error(),
+		})
+		return nil, false
+	}
+	if t.Status != "pending" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该转移申请已经处理过了",
+		})
+		return nil, false
+	}
+	return &t, true
+}
+
+// TransferApp 申请把应用转移给另一个开发者（当前开发者的所有者），对方开发者的所有者接受后生效。
+// 同一个应用同时只能有一个待处理的转移申请
+func TransferApp(c *gin.Context) {
+	packageName := c.Param("package_name")
+	var req models.TransferAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	userID := c.GetInt64("user_id")
+
+	var appID int64
+	var developerID sql.NullInt64
+	err := database.DB.QueryRow(
+		"SELECT id, developer_id FROM apps WHERE package_name = ?", packageName,
+	).Scan(&appID, &developerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "应用不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询应用失败: " + err.Error(),
+		})
+		return
+	}
+	if !developerID.Valid || developerRole(database.DB, developerID.Int64, userID) != "owner" {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有应用所属开发者的所有者可以转移应用",
+		})
+		return
+	}
+	if req.ToDeveloperID == developerID.Int64 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "应用已经属于该开发者",
+		})
+		return
+	}
+	target, err := loadDeveloper(database.DB, req.ToDeveloperID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者失败: " + err.Error(),
+		})
+		return
+	}
+	if target == nil || !target.Claimed {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "目标开发者不存在或还没有被认领",
+		})
+		return
+	}
+
+	var pending int
+	database.DB.QueryRow(
+		"SELECT COUNT(*) FROM app_transfers WHERE app_id = ? AND status = 'pending'", appID,
+	).Scan(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: "该应用已有待处理的转移申请",
+		})
+		return
+	}
+
+	result, err := database.DB.Exec(
+		`INSERT INTO app_transfers (app_id, from_developer_id, to_developer_id, requested_by, note, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		appID, developerID.Int64, req.ToDeveloperID, userID, strings.TrimSpace(req.Note), formatDBTime(time.Now()),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "申请转移失败: " + err.Error(),
+		})
+		return
+	}
+	transferID, _ := result.LastInsertId()
+
+	audit.SetTarget(c, "app", appID)
+	audit.SetAfter(c, gin.H{"transfer_id": transferID, "from_developer_id": developerID.Int64, "to_developer_id": req.ToDeveloperID})
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已申请转移，等待对方接受",
+		Data: gin.H{
+			"transfer_id": transferID,
+			"status":      "pending",
+		},
+	})
+}
+
+// GetDeveloperTransfers 获取开发者转出和转入的应用转移申请（开发者成员），可以按状态筛选
+func GetDeveloperTransfers(c *gin.Context) {
+	developerID, ok := parseDeveloperID(c)
+	if !ok {
+		return
+	}
+	if developerRole(database.DB, developerID, c.GetInt64("user_id")) == "" {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有开发者的成员可以查看转移申请",
+		})
+		return
+	}
+
+	where := "(t.from_developer_id = ? OR t.to_developer_id = ?)"
+	args := []interface{}{developerID, developerID}
+	if status := c.Query("status"); status != "" {
+		where += " AND t.status = ?"
+		args = append(args, status)
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT t.id, a.package_name, a.name, t.from_developer_id, COALESCE(fd.name, ''),
+			t.to_developer_id, COALESCE(td.name, ''), COALESCE(u.username, ''), COALESCE(t.note, ''),
+			t.status, t.created_at, t.responded_at
+		FROM app_transfers t
+		JOIN apps a ON t.app_id = a.id
+		LEFT JOIN developers fd ON t.from_developer_id = fd.id
+		LEFT JOIN developers td ON t.to_developer_id = td.id
+		LEFT JOIN users u ON t.requested_by = u.id
+		WHERE `+where+`
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT 100`,
+		args...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询转移申请失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	transfers := []models.AppTransfer{}
+	for rows.Next() {
+		var t models.AppTransfer
+		var createdAt time.Time
+		var respondedAt *time.Time
+		if err := rows.Scan(&t.ID, &t.PackageName, &t.AppName, &t.FromDeveloperID, &t.FromDeveloperName,
+			&t.ToDeveloperID, &t.ToDeveloperName, &t.RequestedByName, &t.Note,
+			&t.Status, &createdAt, &respondedAt); err != nil {
+			continue
+		}
+		t.CreatedAt = createdAt.Format("2006-01-02 15:04:05")
+		if respondedAt != nil {
+			t.RespondedAt = respondedAt.Format("2006-01-02 15:04:05")
+		}
+		transfers = append(transfers, t)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取转移申请成功",
+		Data:    transfers,
+	})
+}
+
+// AcceptAppTransfer 接受应用转移（目标开发者的所有者），应用改为属于目标开发者
+func AcceptAppTransfer(c *gin.Context) {
+	transfer, ok := loadAppTransfer(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt64("user_id")
+	if developerRole(database.DB, transfer.ToDeveloperID, userID) != "owner" {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有目标开发者的所有者可以接受转移",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "接受转移失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// 申请之后应用的开发者可能已被管理员修改，这时申请失效
+	result, err := tx.Exec(
+		`UPDATE apps SET developer_id = ?, developer_name = (SELECT name FROM developers WHERE id = ?),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND developer_id = ?`,
+		transfer.ToDeveloperID, transfer.ToDeveloperID, transfer.AppID, transfer.FromDeveloperID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "接受转移失败: " + err.Error(),
+		})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: "应用的开发者已经变化，该转移申请已失效",
+		})
+		return
+	}
+	// 申请可能在此期间被拒绝或撤回，这时回滚应用的修改
+	if err = respondAppTransfer(tx, transfer.ID, "accepted", userID); err == nil {
+		err = tx.Commit()
+	}
+	if err == errTransferNotPending {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "接受转移失败: " + err.Error(),
+		})
+		return
+	}
+
+	audit.SetTarget(c, "app", transfer.AppID)
+	audit.SetBefore(c, gin.H{"package_name": transfer.PackageName, "developer_id": transfer.FromDeveloperID})
+	audit.SetAfter(c, gin.H{"package_name": transfer.PackageName, "developer_id": transfer.ToDeveloperID})
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已接受转移",
+	})
+}
+
+// RejectAppTransfer 拒绝应用转移（目标开发者的所有者）
+func RejectAppTransfer(c *gin.Context) {
+	transfer, ok := loadAppTransfer(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt64("user_id")
+	if developerRole(database.DB, transfer.ToDeveloperID, userID) != "owner" {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有目标开发者的所有者可以拒绝转移",
+		})
+		return
+	}
+	err := respondAppTransfer(database.DB, transfer.ID, "rejected", userID)
+	if err == errTransferNotPending {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "拒绝转移失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已拒绝转移",
+	})
+}
+
+// CancelAppTransfer 撤回应用转移申请（转出开发者的所有者）
+func CancelAppTransfer(c *gin.Context) {
+	transfer, ok := loadAppTransfer(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt64("user_id")
+	if developerRole(database.DB, transfer.FromDeveloperID, userID) != "owner" {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有转出开发者的所有者可以撤回转移",
+		})
+		return
+	}
+	err := respondAppTransfer(database.DB, transfer.ID, "cancelled", userID)
+	if err == errTransferNotPending {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "撤回转移失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已撤回转移申请",
+	})
+}
+
+// respondAppTransfer 把待处理的转移申请设为 status，申请已不是待处理状态时返回 errTransferNotPending
+func respondAppTransfer(db sqlExecer, transferID int64, status string, userID int64) error {
+	result, err := db.Exec(
+		"UPDATE app_transfers SET status = ?, responded_by = ?, responded_at = ? WHERE id = ? AND status = 'pending'",
+		status, userID, formatDBTime(time.Now()), transferID,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errTransferNotPending
+	}
+	return nil
+}
+
+// SetAppDeveloper 直接设置应用所属的开发者（管理员权限），用于关联历史应用或处理纠纷。应用待处理的转移申请会被撤回
+func SetAppDeveloper(c *gin.Context) {
+	packageName := c.Param("package_name")
+	var req models.SetAppDeveloperRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var appID int64
+	var before sql.NullInt64
+	err := database.DB.QueryRow(
+		"SELECT id, developer_id FROM apps WHERE package_name = ?", packageName,
+	).Scan(&appID, &before)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "应用不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询应用失败: " + err.Error(),
+		})
+		return
+	}
+	developer, err := loadDeveloper(database.DB, req.DeveloperID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者失败: " + err.Error(),
+		})
+		return
+	}
+	if developer == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "开发者不存在",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "设置开发者失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE apps SET developer_id = ?, developer_name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		developer.ID, developer.Name, appID,
+	)
+	if err == nil {
+		_, err = tx.Exec(
+			"UPDATE app_transfers SET status = 'cancelled', responded_by = ?, responded_at = ? WHERE app_id = ? AND status = 'pending'",
+			c.GetInt64("user_id"), formatDBTime(time.Now()), appID,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "设置开发者失败: " + err.Error(),
+		})
+		return
+	}
+
+	audit.SetTarget(c, "app", appID)
+	audit.SetBefore(c, gin.H{"package_name": packageName, "developer_id": before.Int64})
+	audit.SetAfter(c, gin.H{"package_name": packageName, "developer_id": developer.ID})
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "设置开发者成功",
+	})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"testing"
+)
+
+func TestAcceptRollsBackWhenTransferNoLongerPending(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice", "password123", "alice@example.com")
+	bob := createTestUser(t, "bob", "password123", "bob@example.com")
+	reviewer := createTestUser(t, "reviewer", "password123", "reviewer@example.com")
+	const pkg = "com.example.transfer"
+
+	taskID := createTestUploadTask(t, alice, pkg, 1, "")
+	if _, err := reviewUploadTask(reviewer, taskID, reviewDecision{accept: 1}); err != nil {
+		t.Fatal(err)
+	}
+	from := createTestDeveloper(t, "Alice Studio", alice, false)
+	to := createTestDeveloper(t, "Bob Studio", bob, false)
+	var appID int64
+	database.DB.QueryRow("SELECT id FROM apps WHERE package_name = ?", pkg).Scan(&appID)
+	database.DB.Exec("UPDATE apps SET developer_id = ? WHERE id = ?", from, appID)
+	result, err := database.DB.Exec(
+		"INSERT INTO app_transfers (app_id, from_developer_id, to_developer_id, requested_by) VALUES (?, ?, ?, ?)",
+		appID, from, to, alice,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transferID, _ := result.LastInsertId()
+
+	// 接受前申请已被撤回
+	if err := respondAppTransfer(database.DB, transferID, "cancelled", alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := respondAppTransfer(database.DB, transferID, "rejected", bob); err != errTransferNotPending {
+		t.Fatalf("重复处理申请 err = %v, 期望 errTransferNotPending", err)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	tx.Exec("UPDATE apps SET developer_id = ? WHERE id = ?", to, appID)
+	if err := respondAppTransfer(tx, transferID, "accepted", bob); err != errTransferNotPending {
+		t.Fatalf("接受已撤回的申请 err = %v, 期望 errTransferNotPending", err)
+	}
+	tx.Rollback()
+
+	var developerID int64
+	var status string
+	database.DB.QueryRow("SELECT developer_id FROM apps WHERE id = ?", appID).Scan(&developerID)
+	database.DB.QueryRow("SELECT status FROM app_transfers WHERE id = ?", transferID).Scan(&status)
+	if developerID != from || status != "cancelled" {
+		t.Fatalf("developer_id = %d status = %s, 期望 %d cancelled", developerID, status, from)
+	}
+}
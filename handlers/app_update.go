@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// updateCandidate 检查更新时查询到的应用版本
+type updateCandidate struct {
+	ID            int64
+	Version       string
+	VersionCode   int
+	Size          int64
+	UpdateContent string
+	DownloadURL   string
+	Channel       string
+	Fingerprint   string
+	SHA256        string
+	IsLatest      bool
+	Withdrawn     bool
+	CreatedAt     time.Time
+}
+
+// loadUpdateCandidates 一次查询多个应用的全部版本，按包名分组，每组按版本代码倒序
+func loadUpdateCandidates(packageNames []string) (map[string][]updateCandidate, error) {
+	result := map[string][]updateCandidate{}
+	if len(packageNames) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(packageNames)), ", ")
+	args := make([]any, len(packageNames))
+	for i, name := range packageNames {
+		args[i] = name
+	}
+	rows, err := database.DB.Query(`
+		SELECT a.package_name, v.id, v.version, v.version_code, v.size, COALESCE(v.update_content, ''), v.download_url,
+			COALESCE(v.channel, a.channel, ''), COALESCE(v.signer_fingerprint, ''), COALESCE(v.file_sha256, ''), v.is_latest,
+			v.withdrawn_at IS NOT NULL, v.created_at
+		FROM app_versions v
+		JOIN apps a ON v.app_id = a.id
+		WHERE a.package_name IN (`+placeholders+`)
+		ORDER BY a.package_name, v.version_code DESC, v.id DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var packageName string
+		var v updateCandidate
+		if err := rows.Scan(&packageName, &v.ID, &v.Version, &v.VersionCode, &v.Size, &v.UpdateContent, &v.DownloadURL,
+			&v.Channel, &v.Fingerprint, &v.SHA256, &v.IsLatest, &v.Withdrawn, &v.CreatedAt); err != nil {
+			continue
+		}
+		result[packageName] = append(result[packageName], v)
+	}
+	return result, rows.Err()
+}
+
+// findUpdate 为已安装的应用选择可更新的版本：渠道相同、签名一致（双方都有指纹时）、未下架，
+// 版本代码高于已安装版本且不高于当前最新版本（回滚后不推送被回滚的版本）。
+// 同时返回应用市场中与已安装版本代码相同的版本，没有时为 nil
+func findUpdate(item models.CheckUpdateItem, versions []updateCandidate) (target, installed *updateCandidate) {
+	var latest *updateCandidate
+	for i := range versions {
+		if versions[i].IsLatest && latest == nil {
+			latest = &versions[i]
+		}
+		if versions[i].VersionCode == item.VersionCode && installed == nil {
+			installed = &versions[i]
+		}
+	}
+	if latest == nil || latest.VersionCode <= item.VersionCode {
+		return nil, installed
+	}
+
+	channel, fingerprint := item.Channel, item.SignerFingerprint
+	if channel == "" {
+		channel = latest.Channel
+		if installed != nil {
+			channel = installed.Channel
+		}
+	}
+	if fingerprint == "" && installed != nil {
+		fingerprint = installed.Fingerprint
+	}
+
+	for i := range versions {
+		v := &versions[i]
+		if v.VersionCode <= item.VersionCode {
+			break
+		}
+		if v.VersionCode > latest.VersionCode || v.Withdrawn || v.Channel != channel {
+			continue
+		}
+		if fingerprint != "" && v.Fingerprint != "" && v.Fingerprint != fingerprint {
+			continue
+		}
+		return v, installed
+	}
+	return nil, installed
+}
+
+// etagMatches 检查 If-None-Match 是否包含当前的 ETag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAppUpdates 批量检查已安装应用的更新。结果相同时 ETag 不变，
+// 客户端带上 If-None-Match 时返回 304，不重复发送结果
+func CheckAppUpdates(c *gin.Context) {
+	var req models.CheckUpdatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	packageNames := make([]string, 0, len(req.Apps))
+	seen := map[string]bool{}
+	for i := range req.Apps {
+		item := &req.Apps[i]
+		if item.SignerFingerprint != "" {
+			fingerprint, ok := normalizeFingerprint(item.SignerFingerprint)
+			if !ok {
+				c.JSON(http.StatusBadRequest, models.Response{
+					Code:    400,
+					Message: fmt.Sprintf("%s 的签名证书指纹格式错误，应为 SHA-256（64位十六进制）", item.PackageName),
+				})
+				return
+			}
+			item.SignerFingerprint = fingerprint
+		}
+		if !seen[item.PackageName] {
+			seen[item.PackageName] = true
+			packageNames = append(packageNames, item.PackageName)
+		}
+	}
+
+	candidates, err := loadUpdateCandidates(packageNames)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "检查更新失败: " + err.Error(),
+		})
+		return
+	}
+	patches, err := readyPatches(packageNames)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "检查更新失败: " + err.Error(),
+		})
+		return
+	}
+
+	updates := []models.AppUpdate{}
+	for _, item := range req.Apps {
+		v, installed := findUpdate(item, candidates[item.PackageName])
+		if v == nil {
+			continue
+		}
+		update := models.AppUpdate{
+			PackageName:          item.PackageName,
+			InstalledVersionCode: item.VersionCode,
+			Version:              v.Version,
+			VersionCode:          v.VersionCode,
+			Channel:              v.Channel,
+			Size:                 v.Size,
+			UpdateContent:        v.UpdateContent,
+			DownloadURL:          v.DownloadURL,
+			SHA256:               v.SHA256,
+			UpdateTime:           v.CreatedAt,
+		}
+		// 补丁只在已安装的文件与应用市场中的版本一致时可用（签名不同说明不是同一个安装包）
+		if installed != nil && (item.SignerFingerprint == "" || installed.Fingerprint == "" ||
+			item.SignerFingerprint == installed.Fingerprint) {
+			if patch, ok := patches[[2]int64{installed.ID, v.ID}]; ok {
+				update.Patch = &patch
+			}
+		}
+		updates = append(updates, update)
+	}
+
+	data := gin.H{"updates": updates}
+	body, _ := json.Marshal(data)
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "检查更新成功",
+		Data:    data,
+	})
+}
@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"TaruApp/audit"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"TaruApp/database"
 	"TaruApp/models"
+	"TaruApp/rbac"
 
 	"github.com/gin-gonic/gin"
 )
@@ -94,17 +100,13 @@ func UploadApp(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	username, _ := c.Get("username")
 
-	// 验证分类是否存在
-	if !validateCategory(req.MainCategory, req.SubCategory) {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Code:    400,
-			Message: "应用分类不存在",
-		})
+	if !validateUploadRequest(c, &req) {
 		return
 	}
 
-	// 将截图数组转为JSON字符串
+	// 将截图数组和提议的标签转为JSON字符串
 	screenshotsJSON, _ := json.Marshal(req.Screenshots)
+	proposedTagsJSON, _ := json.Marshal(req.Tags)
 
 	// 开始事务
 	tx, err := database.DB.Begin()
@@ -117,20 +119,33 @@ func UploadApp(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
+	// 在事务中检查版本冲突，避免审核通过时才发现版本重复
+	warnings, ok := checkUploadConflicts(c, tx, uploadCandidate{
+		userID:            userID.(int64),
+		developerID:       req.DeveloperID,
+		packageName:       req.PackageName,
+		version:           req.Version,
+		versionCode:       req.VersionCode,
+		signerFingerprint: req.SignerFingerprint,
+	})
+	if !ok {
+		return
+	}
+
 	// 插入上传任务
 	result, err := tx.Exec(
 		`INSERT INTO app_upload_tasks (
 			user_id, package_name, name, icon_url, version, version_code, size,
 			channel, main_category, sub_category, screenshots, description,
 			share_desc, update_content, developer_name, ad_level, payment_type,
-			operation_type, download_url, status
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			operation_type, download_url, signer_fingerprint, proposed_tags, developer_id, status
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, NULLIF(?, 0), ?)`,
 		userID, req.PackageName, req.Name, req.IconURL, req.Version,
 		req.VersionCode, req.Size, req.Channel, req.MainCategory,
 		req.SubCategory, string(screenshotsJSON), req.Description,
 		req.ShareDesc, req.UpdateContent, req.DeveloperName,
 		req.AdLevel, req.PaymentType, req.OperationType,
-		req.DownloadURL, "pending",
+		req.DownloadURL, req.SignerFingerprint, string(proposedTagsJSON), req.DeveloperID, "pending",
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
@@ -141,6 +156,13 @@ func UploadApp(c *gin.Context) {
 	}
 
 	taskID, _ := result.LastInsertId()
+	if err = saveUploadSubmission(tx, taskID, 1, req); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "上传失败: " + err.Error(),
+		})
+		return
+	}
 
 	if err = tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
@@ -158,10 +180,67 @@ func UploadApp(c *gin.Context) {
 			"status":      "pending",
 			"uploader":    username.(string),
 			"upload_time": time.Now().Format("2006-01-02 15:04:05"),
+			"warnings":    warnings, // 不影响上传、但会提示审核员的冲突
 		},
 	})
 }
 
+// validateUploadRequest 检查上传内容：分类必须存在且启用，指定的开发者必须是自己所在的开发者，
+// 规范化签名证书指纹和提议的标签。不合法时返回错误响应并返回 false
+func validateUploadRequest(c *gin.Context, req *models.UploadAppRequest) bool {
+	// 验证分类是否存在
+	if !validateCategory(req.MainCategory, req.SubCategory) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "应用分类不存在或已停用",
+		})
+		return false
+	}
+
+	// 指定开发者时必须是该开发者的成员，开发者名称使用资料中的名称
+	if req.DeveloperID != 0 {
+		developer, err := loadDeveloper(database.DB, req.DeveloperID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "查询开发者失败: " + err.Error(),
+			})
+			return false
+		}
+		if developer == nil || developerRole(database.DB, developer.ID, c.GetInt64("user_id")) == "" {
+			c.JSON(http.StatusForbidden, models.Response{
+				Code:    403,
+				Message: "只能以自己所在的开发者身份上传",
+			})
+			return false
+		}
+		req.DeveloperName = developer.Name
+	}
+
+	if req.SignerFingerprint != "" {
+		normalized, ok := normalizeFingerprint(req.SignerFingerprint)
+		if !ok {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "签名证书指纹格式错误，应为 SHA-256（64位十六进制）",
+			})
+			return false
+		}
+		req.SignerFingerprint = normalized
+	}
+
+	tags, errMsg := normalizeTags(req.Tags)
+	if errMsg != "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: errMsg,
+		})
+		return false
+	}
+	req.Tags = tags
+	return true
+}
+
 // GetMyUploadTasks 获取我的上传任务（审核情况）
 func GetMyUploadTasks(c *gin.Context) {
 	userID, _ := c.Get("user_id")
@@ -231,6 +310,10 @@ func GetMyUploadTasks(c *gin.Context) {
 			statusLabel = "被拒绝"
 		} else if task.Status == "approved" {
 			statusLabel = "已通过"
+		} else if task.Status == "changes_requested" {
+			statusLabel = "需要修改"
+		} else if task.Status == "expired" {
+			statusLabel = "已过期"
 		}
 
 		taskData := gin.H{
@@ -244,7 +327,7 @@ func GetMyUploadTasks(c *gin.Context) {
 			"upload_time":  task.CreatedAt.Format("2006-01-02 15:04:05"),
 		}
 
-		if task.RejectReason.Valid && task.Status == "rejected" {
+		if task.RejectReason.Valid && (task.Status == "rejected" || task.Status == "changes_requested") {
 			taskData["reject_reason"] = task.RejectReason.String
 		}
 
@@ -265,16 +348,6 @@ func GetMyUploadTasks(c *gin.Context) {
 
 // GetPendingApps 获取待审核应用列表（需要审核权限）
 func GetPendingApps(c *gin.Context) {
-	// 检查用户权限
-	userLevel, _ := c.Get("level")
-	if userLevel.(int) < 80 {
-		c.JSON(http.StatusForbidden, models.Response{
-			Code:    403,
-			Message: "权限不足，需要审核权限",
-		})
-		return
-	}
-
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
 	if page < 1 {
@@ -285,10 +358,24 @@ func GetPendingApps(c *gin.Context) {
 	}
 	offset := (page - 1) * pageSize
 
+	// 认领状态筛选：mine 为自己认领的任务，unclaimed 为未被认领（或认领已超时）的任务
+	reviewerID := c.GetInt64("user_id")
+	now := formatDBTime(time.Now())
+	where := "t.status = 'pending'"
+	args := []interface{}{}
+	switch c.Query("claim") {
+	case "mine":
+		where += " AND t.claimed_by = ? AND (t.claim_expires_at IS NULL OR t.claim_expires_at > ?)"
+		args = append(args, reviewerID, now)
+	case "unclaimed":
+		where += " AND (t.claimed_by IS NULL OR t.claim_expires_at <= ?)"
+		args = append(args, now)
+	}
+
 	// 查询总数
 	var total int
 	err := database.DB.QueryRow(
-		"SELECT COUNT(*) FROM app_upload_tasks WHERE status = 'pending'",
+		"SELECT COUNT(*) FROM app_upload_tasks t WHERE "+where, args...,
 	).Scan(&total)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
@@ -300,14 +387,16 @@ func GetPendingApps(c *gin.Context) {
 
 	// 查询列表
 	rows, err := database.DB.Query(
-		`SELECT t.id, t.package_name, t.name, t.icon_url, t.version, t.created_at, 
-			t.user_id, u.username
+		`SELECT t.id, t.package_name, t.name, t.icon_url, t.version, t.version_code, t.created_at, 
+			t.user_id, u.username, COALESCE(t.proposed_tags, ''), COALESCE(t.signer_fingerprint, ''), COALESCE(t.developer_id, 0),
+			t.claimed_by, cu.username, t.claim_expires_at, t.assigned_by, COALESCE(t.revision, 1)
 		FROM app_upload_tasks t
 		LEFT JOIN users u ON t.user_id = u.id
-		WHERE t.status = 'pending'
+		LEFT JOIN users cu ON t.claimed_by = cu.id
+		WHERE `+where+`
 		ORDER BY t.created_at ASC
 		LIMIT ? OFFSET ?`,
-		pageSize, offset,
+		append(args, pageSize, offset)...,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
@@ -319,6 +408,7 @@ func GetPendingApps(c *gin.Context) {
 	defer rows.Close()
 
 	tasks := []gin.H{}
+	candidates := []uploadCandidate{}
 	for rows.Next() {
 		var task struct {
 			ID          int64
@@ -326,21 +416,31 @@ func GetPendingApps(c *gin.Context) {
 			Name        string
 			IconURL     string
 			Version     string
+			VersionCode int
 			CreatedAt   time.Time
 			UserID      int64
 			Username    sql.NullString
+			Tags        string
+			Signer      string
+			DeveloperID int64
+			Revision    int
 		}
+		var claim taskClaim
+		var claimedBy, assignedBy sql.NullInt64
+		var claimerName sql.NullString
 		if err := rows.Scan(&task.ID, &task.PackageName, &task.Name, &task.IconURL,
-			&task.Version, &task.CreatedAt, &task.UserID, &task.Username); err != nil {
+			&task.Version, &task.VersionCode, &task.CreatedAt, &task.UserID, &task.Username, &task.Tags, &task.Signer, &task.DeveloperID,
+			&claimedBy, &claimerName, &claim.ExpiresAt, &assignedBy, &task.Revision); err != nil {
 			continue
 		}
+		claim.ClaimedBy, claim.ClaimerName, claim.AssignedBy = claimedBy.Int64, claimerName.String, assignedBy.Int64
 
 		uploaderName := "未知用户"
 		if task.Username.Valid {
 			uploaderName = task.Username.String
 		}
 
-		tasks = append(tasks, gin.H{
+		item := gin.H{
 			"task_id":      task.ID,
 			"package_name": task.PackageName,
 			"name":         task.Name,
@@ -349,8 +449,34 @@ func GetPendingApps(c *gin.Context) {
 			"upload_time":  task.CreatedAt.Format("2006-01-02 15:04:05"),
 			"uploader":     uploaderName,
 			"uploader_id":  task.UserID,
+			"tags":         parseProposedTags(task.Tags),
+			"revision":     task.Revision, // 大于1表示重新提交
+			"claim":        nil,
+		}
+		if claim.active(time.Now()) {
+			item["claim"] = claim.data()
+		}
+		tasks = append(tasks, item)
+		candidates = append(candidates, uploadCandidate{
+			taskID:            task.ID,
+			userID:            task.UserID,
+			developerID:       task.DeveloperID,
+			packageName:       task.PackageName,
+			version:           task.Version,
+			versionCode:       task.VersionCode,
+			signerFingerprint: task.Signer,
 		})
 	}
+	rows.Close()
+
+	// 版本冲突、上传者与此前不同等需要审核员注意的问题
+	for i, candidate := range candidates {
+		warnings, err := detectUploadConflicts(database.DB, candidate)
+		if err != nil {
+			warnings = []models.UploadConflict{}
+		}
+		tasks[i]["warnings"] = warnings
+	}
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
@@ -377,13 +503,17 @@ func GetAppUploadDetail(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("user_id")
-	userLevel, _ := c.Get("level")
 
 	// 查询任务详情
 	var task models.AppUploadTask
 	var uploaderName sql.NullString
 	err = database.DB.QueryRow(
-		`SELECT t.*, u.username
+		`SELECT t.id, t.user_id, t.package_name, t.name, t.icon_url, t.version, t.version_code,
+			t.size, t.channel, t.main_category, t.sub_category, t.screenshots, t.description,
+			t.share_desc, t.update_content, t.developer_name, t.ad_level, t.payment_type,
+			t.operation_type, t.download_url, COALESCE(t.signer_fingerprint, ''),
+			COALESCE(t.proposed_tags, ''), t.status, COALESCE(t.reject_reason, ''),
+			t.reviewer_id, t.review_time, COALESCE(t.revision, 1), COALESCE(t.developer_id, 0), t.created_at, t.updated_at, u.username
 		FROM app_upload_tasks t
 		LEFT JOIN users u ON t.user_id = u.id
 		WHERE t.id = ?`,
@@ -394,9 +524,9 @@ func GetAppUploadDetail(c *gin.Context) {
 		&task.MainCategory, &task.SubCategory, &task.Screenshots,
 		&task.Description, &task.ShareDesc, &task.UpdateContent,
 		&task.DeveloperName, &task.AdLevel, &task.PaymentType,
-		&task.OperationType, &task.DownloadURL, &task.Status,
-		&task.RejectReason, &task.ReviewerID, &task.ReviewTime,
-		&task.CreatedAt, &task.UpdatedAt, &uploaderName,
+		&task.OperationType, &task.DownloadURL, &task.SignerFingerprint,
+		&task.ProposedTags, &task.Status, &task.RejectReason,
+		&task.ReviewerID, &task.ReviewTime, &task.Revision, &task.DeveloperID, &task.CreatedAt, &task.UpdatedAt, &uploaderName,
 	)
 
 	if err == sql.ErrNoRows {
@@ -415,7 +545,8 @@ func GetAppUploadDetail(c *gin.Context) {
 	}
 
 	// 权限检查：只能查看自己的任务，或者有审核权限的用户可以查看所有任务
-	if task.UserID != userID.(int64) && userLevel.(int) < 80 {
+	isReviewer := rbac.Can(userID.(int64), rbac.PermAppReview)
+	if task.UserID != userID.(int64) && !isReviewer {
 		c.JSON(http.StatusForbidden, models.Response{
 			Code:    403,
 			Message: "无权查看此任务",
@@ -450,23 +581,87 @@ func GetAppUploadDetail(c *gin.Context) {
 		"share_desc":     task.ShareDesc,
 		"update_content": task.UpdateContent,
 		"developer_name": task.DeveloperName,
+		"developer_id":   task.DeveloperID,
 		"ad_level":       task.AdLevel,
 		"payment_type":   task.PaymentType,
 		"operation_type": task.OperationType,
 		"download_url":   task.DownloadURL,
+		"tags":           parseProposedTags(task.ProposedTags),
 		"status":         task.Status,
+		"revision":       task.Revision,
 		"uploader_name":  task.UploaderName,
 		"upload_time":    task.CreatedAt.Format("2006-01-02 15:04:05"),
 	}
 
-	if task.Status == "rejected" && task.RejectReason != "" {
+	if (task.Status == "rejected" || task.Status == "changes_requested") && task.RejectReason != "" {
 		responseData["reject_reason"] = task.RejectReason
 	}
 
+	// 提交和审核的时间线，审核员可以看到其中的检查清单和内部备注
+	timeline, err := loadUploadTimeline(task.ID, task.CreatedAt, isReviewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询审核记录失败: " + err.Error(),
+		})
+		return
+	}
+	responseData["timeline"] = timeline
+
+	// 被要求修改时返回最近一次审核的字段意见
+	if task.Status == "changes_requested" {
+		fieldComments := []models.FieldComment{}
+		for i := len(timeline) - 1; i >= 0; i-- {
+			if timeline[i].Type == "reviewed" {
+				if timeline[i].FieldComments != nil {
+					fieldComments = timeline[i].FieldComments
+				}
+				break
+			}
+		}
+		responseData["field_comments"] = fieldComments
+	}
+
 	if task.ReviewTime != nil {
 		responseData["review_time"] = task.ReviewTime.Format("2006-01-02 15:04:05")
 	}
 
+	// 审核员可以看到认领状态、版本冲突警告和审核记录（含检查清单和内部备注）
+	if isReviewer {
+		if task.Status == "pending" || task.Status == "changes_requested" {
+			warnings, err := detectUploadConflicts(database.DB, uploadCandidate{
+				taskID:            task.ID,
+				userID:            task.UserID,
+				developerID:       task.DeveloperID,
+				packageName:       task.PackageName,
+				version:           task.Version,
+				versionCode:       task.VersionCode,
+				signerFingerprint: task.SignerFingerprint,
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.Response{
+					Code:    500,
+					Message: "检查版本冲突失败: " + err.Error(),
+				})
+				return
+			}
+			responseData["warnings"] = warnings
+		}
+		responseData["claim"] = nil
+		if claim, err := loadTaskClaim(task.ID); err == nil && claim.active(time.Now()) {
+			responseData["claim"] = claim.data()
+		}
+		reviews, err := loadReviewRecords(task.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "查询审核记录失败: " + err.Error(),
+			})
+			return
+		}
+		responseData["reviews"] = reviews
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
 		Message: "获取任务详情成功",
@@ -476,16 +671,6 @@ func GetAppUploadDetail(c *gin.Context) {
 
 // ReviewApp 审核应用（需要审核权限）
 func ReviewApp(c *gin.Context) {
-	// 检查用户权限
-	userLevel, _ := c.Get("level")
-	if userLevel.(int) < 80 {
-		c.JSON(http.StatusForbidden, models.Response{
-			Code:    403,
-			Message: "权限不足，需要审核权限",
-		})
-		return
-	}
-
 	var req models.ReviewAppRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.Response{
@@ -504,7 +689,113 @@ func ReviewApp(c *gin.Context) {
 		return
 	}
 
-	reviewerID, _ := c.Get("user_id")
+	decision := reviewDecision{
+		accept:       req.Accept,
+		rejectReason: req.RejectReason,
+		checklist:    req.Checklist,
+		notes:        strings.TrimSpace(req.Notes),
+	}
+	// 要求修改时需要说明或至少一条字段意见
+	if req.Accept == 2 {
+		comments, errMsg := normalizeFieldComments(req.FieldComments)
+		if errMsg == "" && len(comments) == 0 && req.RejectReason == "" {
+			errMsg = "要求修改时必须提供修改说明或字段意见"
+		}
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: errMsg,
+			})
+			return
+		}
+		decision.fieldComments = comments
+	}
+	// 审核员可以调整标签，不传时采用上传者提议的标签
+	if req.Accept == 1 && req.Tags != nil {
+		tags, errMsg := normalizeTags(*req.Tags)
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: errMsg,
+			})
+			return
+		}
+		decision.tags = &tags
+	}
+
+	outcome, err := reviewUploadTask(c.GetInt64("user_id"), req.TaskID, decision)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, errTaskNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, errTaskReviewed):
+			status = http.StatusBadRequest
+		case errors.Is(err, errTaskClaimed), errors.Is(err, errVersionConflict):
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+	audit.SetTarget(c, "app_upload_task", outcome.task.ID)
+	audit.SetBefore(c, gin.H{"status": "pending", "package_name": outcome.task.PackageName, "version": outcome.task.Version})
+
+	message := "应用审核通过"
+	switch req.Accept {
+	case 0:
+		message = "应用审核拒绝"
+	case 2:
+		message = "已要求上传者修改"
+	default:
+		// 新版本上架后为它和上一个版本生成增量更新补丁
+		TriggerPatchJob()
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: message,
+		Data: gin.H{
+			"task_id":     req.TaskID,
+			"status":      outcome.status,
+			"review_time": outcome.reviewTime.Format("2006-01-02 15:04:05"),
+			"tags":        outcome.tags,
+		},
+	})
+}
+
+var (
+	errTaskNotFound = errors.New("任务不存在")
+	errTaskReviewed = errors.New("该任务已经审核过了")
+	errTaskClaimed  = errors.New("任务已被其他审核员认领")
+)
+
+// reviewDecision 一次审核的结论
+type reviewDecision struct {
+	accept        int
+	rejectReason  string                // 拒绝原因或修改说明
+	fieldComments []models.FieldComment // 要求修改时的字段意见
+	tags          *[]string             // 通过时采用的标签（已规范化），nil 表示采用上传者提议的标签
+	checklist     models.ReviewChecklist
+	notes         string
+	batch         bool
+}
+
+// reviewOutcome 审核结果
+type reviewOutcome struct {
+	task       models.AppUploadTask
+	status     string
+	tags       []string // 通过时应用采用的标签
+	reviewTime time.Time
+}
+
+// reviewUploadTask 审核一个待审核的上传任务，任务被其他审核员认领且未超时时返回 errTaskClaimed，
+// 通过时版本已存在或版本代码不大于最新版本时返回 errVersionConflict。
+// 通过时创建或更新应用、发布新版本并给上传者发放奖励；要求修改时任务等待上传者重新提交。
+// 无论结论如何都会写入审核记录并释放认领
+func reviewUploadTask(reviewerID, taskID int64, d reviewDecision) (*reviewOutcome, error) {
 	reviewTime := time.Now()
 
 	// 查询任务信息
@@ -513,203 +804,270 @@ func ReviewApp(c *gin.Context) {
 		`SELECT id, user_id, package_name, name, icon_url, version, version_code, size,
 			channel, main_category, sub_category, screenshots, description, share_desc,
 			update_content, developer_name, ad_level, payment_type, operation_type,
-			download_url, status
+			download_url, COALESCE(signer_fingerprint, ''), COALESCE(proposed_tags, ''), status,
+			COALESCE(revision, 1), COALESCE(developer_id, 0)
 		FROM app_upload_tasks WHERE id = ?`,
-		req.TaskID,
+		taskID,
 	).Scan(
 		&task.ID, &task.UserID, &task.PackageName, &task.Name, &task.IconURL,
 		&task.Version, &task.VersionCode, &task.Size, &task.Channel,
 		&task.MainCategory, &task.SubCategory, &task.Screenshots,
 		&task.Description, &task.ShareDesc, &task.UpdateContent,
 		&task.DeveloperName, &task.AdLevel, &task.PaymentType,
-		&task.OperationType, &task.DownloadURL, &task.Status,
+		&task.OperationType, &task.DownloadURL, &task.SignerFingerprint, &task.ProposedTags, &task.Status,
+		&task.Revision, &task.DeveloperID,
 	)
-
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, models.Response{
-			Code:    404,
-			Message: "任务不存在",
-		})
-		return
+		return nil, errTaskNotFound
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Code:    500,
-			Message: "查询任务失败: " + err.Error(),
-		})
-		return
+		return nil, fmt.Errorf("查询任务失败: %w", err)
 	}
-
-	// 检查任务状态
 	if task.Status != "pending" {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Code:    400,
-			Message: "该任务已经审核过了",
-		})
-		return
+		return nil, errTaskReviewed
+	}
+
+	outcome := &reviewOutcome{task: task, status: "rejected", tags: []string{}, reviewTime: reviewTime}
+	// publishTags 为 nil 时保留应用原有的标签：审核员传入的标签（包括空列表）直接替换，
+	// 否则采用上传者提议的标签，上传者没有提议标签时不修改
+	var publishTags []string
+	switch d.accept {
+	case 1:
+		outcome.status = "approved"
+		if d.tags != nil {
+			outcome.tags = append([]string{}, *d.tags...)
+			publishTags = outcome.tags
+		} else {
+			outcome.tags = parseProposedTags(task.ProposedTags)
+			if len(outcome.tags) > 0 {
+				publishTags = outcome.tags
+			}
+		}
+	case 2:
+		outcome.status = "changes_requested"
 	}
 
 	// 开始事务
 	tx, err := database.DB.Begin()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Code:    500,
-			Message: "审核失败: " + err.Error(),
-		})
-		return
+		return nil, fmt.Errorf("审核失败: %w", err)
 	}
 	defer tx.Rollback()
 
-	if req.Accept == 1 {
-		// 通过审核，需要创建或更新应用信息
-		// 首先检查应用是否存在
-		var appID int64
-		err = tx.QueryRow(
-			"SELECT id FROM apps WHERE package_name = ?",
-			task.PackageName,
-		).Scan(&appID)
-
-		if err == sql.ErrNoRows {
-			// 应用不存在，创建新应用
-			result, err := tx.Exec(
-				`INSERT INTO apps (package_name, name, icon_url, description, tags,
-					main_category, sub_category, channel, share_desc, developer_name,
-					ad_level, payment_type, operation_type, rating, rating_count, 
-					total_coins, download_count) 
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, 0, 0, 0)`,
-				task.PackageName, task.Name, task.IconURL, task.Description,
-				"", task.MainCategory, task.SubCategory, task.Channel,
-				task.ShareDesc, task.DeveloperName, task.AdLevel,
-				task.PaymentType, task.OperationType,
-			)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, models.Response{
-					Code:    500,
-					Message: "创建应用失败: " + err.Error(),
-				})
-				return
-			}
-			appID, _ = result.LastInsertId()
-		} else if err != nil {
-			c.JSON(http.StatusInternalServerError, models.Response{
-				Code:    500,
-				Message: "查询应用失败: " + err.Error(),
-			})
-			return
-		} else {
-			// 应用存在，更新应用信息
-			_, err = tx.Exec(
-				`UPDATE apps SET name = ?, icon_url = ?, description = ?,
-					main_category = ?, sub_category = ?, channel = ?, share_desc = ?,
-					developer_name = ?, ad_level = ?, payment_type = ?, operation_type = ?,
-					updated_at = CURRENT_TIMESTAMP
-				WHERE id = ?`,
-				task.Name, task.IconURL, task.Description,
-				task.MainCategory, task.SubCategory, task.Channel, task.ShareDesc,
-				task.DeveloperName, task.AdLevel, task.PaymentType, task.OperationType, appID,
-			)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, models.Response{
-					Code:    500,
-					Message: "更新应用信息失败: " + err.Error(),
-				})
-				return
-			}
+	// 先更新任务状态并释放认领，同时检查任务仍是待审核状态且没有被其他审核员认领
+	var rejectReason, fieldComments any
+	if d.accept != 1 && d.rejectReason != "" {
+		rejectReason = d.rejectReason
+	}
+	if len(d.fieldComments) > 0 {
+		b, _ := json.Marshal(d.fieldComments)
+		fieldComments = string(b)
+	}
+	result, err := tx.Exec(
+		`UPDATE app_upload_tasks
+		SET status = ?, reject_reason = ?, reviewer_id = ?, review_time = ?, updated_at = ?,
+			claimed_by = NULL, claim_expires_at = NULL, assigned_by = NULL
+		WHERE id = ? AND status = 'pending' AND `+claimAvailableCondition,
+		outcome.status, rejectReason, reviewerID, formatDBTime(reviewTime), formatDBTime(reviewTime),
+		taskID, reviewerID, formatDBTime(reviewTime),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("更新审核状态失败: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		var status string
+		database.DB.QueryRow("SELECT status FROM app_upload_tasks WHERE id = ?", taskID).Scan(&status)
+		if status != "pending" {
+			return nil, errTaskReviewed
 		}
+		return nil, errTaskClaimed
+	}
 
-		// 将之前的最新版本标记为非最新
-		_, err = tx.Exec(
-			"UPDATE app_versions SET is_latest = 0 WHERE app_id = ?",
-			appID,
-		)
+	if d.accept == 1 {
+		// 等待审核期间可能有同一应用的其他任务先通过，发布前再检查一次版本冲突
+		conflicts, err := detectUploadConflicts(tx, uploadCandidate{
+			taskID:      task.ID,
+			userID:      task.UserID,
+			packageName: task.PackageName,
+			version:     task.Version,
+			versionCode: task.VersionCode,
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.Response{
-				Code:    500,
-				Message: "更新版本状态失败: " + err.Error(),
-			})
-			return
+			return nil, fmt.Errorf("检查版本冲突失败: %w", err)
+		}
+		if conflict := firstBlockingConflict(conflicts, reviewBlockingConflicts); conflict != nil {
+			return nil, fmt.Errorf("%w: %s", errVersionConflict, conflict.Message)
+		}
+		if err := publishUploadTask(tx, task, publishTags); err != nil {
+			return nil, err
 		}
+	}
 
-		// 获取上传者用户名
-		var uploaderName string
-		tx.QueryRow("SELECT username FROM users WHERE id = ?", task.UserID).Scan(&uploaderName)
+	_, err = tx.Exec(
+		`INSERT INTO app_review_records (task_id, reviewer_id, decision, ad_level_verified,
+			permissions_reasonable, no_malware_found, notes, reject_reason, field_comments, revision,
+			batch, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		taskID, reviewerID, outcome.status, d.checklist.AdLevelVerified,
+		d.checklist.PermissionsReasonable, d.checklist.NoMalwareFound,
+		d.notes, rejectReason, fieldComments, task.Revision, d.batch, formatDBTime(reviewTime),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("保存审核记录失败: %w", err)
+	}
 
-		// 创建新版本
-		_, err = tx.Exec(
-			`INSERT INTO app_versions (app_id, package_name, version, version_code,
-				size, download_url, update_content, screenshots, uploader_id,
-				uploader_name, is_latest)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`,
-			appID, task.PackageName, task.Version, task.VersionCode,
-			task.Size, task.DownloadURL, task.UpdateContent,
-			task.Screenshots, task.UserID, uploaderName,
-		)
+	// 审核通过后给上传者发放奖励（任务状态更新后再发放，保证应用相关成就计数正确）
+	if d.accept == 1 {
+		_, err = grantReward(tx, task.UserID, rewardActionAppApproved, fmt.Sprintf("upload_task:%d", task.ID))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.Response{
-				Code:    500,
-				Message: "创建版本失败: " + err.Error(),
-			})
-			return
+			return nil, fmt.Errorf("发放审核奖励失败: %w", err)
 		}
+	}
 
-		// 更新任务状态为已通过
-		_, err = tx.Exec(
-			`UPDATE app_upload_tasks 
-			SET status = 'approved', reviewer_id = ?, review_time = ?, updated_at = ?
-			WHERE id = ?`,
-			reviewerID, reviewTime, reviewTime, req.TaskID,
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("审核失败: %w", err)
+	}
+	return outcome, nil
+}
+
+// publishUploadTask 在事务中发布审核通过的上传任务：创建或更新应用信息，把任务的版本设为最新版本。
+// tags 为 nil 时保留应用原有的标签，为空列表时清空标签；应用已关联开发者时保留原来的开发者（只能通过所有权转移修改）
+func publishUploadTask(tx *sql.Tx, task models.AppUploadTask, tags []string) error {
+	developerID, err := publishDeveloperID(tx, task)
+	if err != nil {
+		return fmt.Errorf("关联开发者失败: %w", err)
+	}
+
+	// 首先检查应用是否存在
+	var appID int64
+	err = tx.QueryRow(
+		"SELECT id FROM apps WHERE package_name = ?",
+		task.PackageName,
+	).Scan(&appID)
+
+	if err == sql.ErrNoRows {
+		// 应用不存在，创建新应用
+		result, err := tx.Exec(
+			`INSERT INTO apps (package_name, name, icon_url, description, tags,
+				main_category, sub_category, channel, share_desc, developer_name,
+				ad_level, payment_type, operation_type, developer_id, rating, rating_count, 
+				total_coins, download_count) 
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), 0, 0, 0, 0)`,
+			task.PackageName, task.Name, task.IconURL, task.Description,
+			"", task.MainCategory, task.SubCategory, task.Channel,
+			task.ShareDesc, task.DeveloperName, task.AdLevel,
+			task.PaymentType, task.OperationType, developerID,
 		)
+		if err != nil {
+			return fmt.Errorf("创建应用失败: %w", err)
+		}
+		appID, _ = result.LastInsertId()
+	} else if err != nil {
+		return fmt.Errorf("查询应用失败: %w", err)
 	} else {
-		// 拒绝审核
+		// 应用存在，更新应用信息（已关联开发者的应用使用开发者资料中的名称）
 		_, err = tx.Exec(
-			`UPDATE app_upload_tasks 
-			SET status = 'rejected', reject_reason = ?, reviewer_id = ?, review_time = ?, updated_at = ?
+			`UPDATE apps SET name = ?, icon_url = ?, description = ?,
+				main_category = ?, sub_category = ?, channel = ?, share_desc = ?,
+				developer_id = COALESCE(developer_id, NULLIF(?, 0)),
+				developer_name = COALESCE((SELECT name FROM developers WHERE id = COALESCE(apps.developer_id, NULLIF(?, 0))), ?),
+				ad_level = ?, payment_type = ?, operation_type = ?,
+				updated_at = CURRENT_TIMESTAMP
 			WHERE id = ?`,
-			req.RejectReason, reviewerID, reviewTime, reviewTime, req.TaskID,
+			task.Name, task.IconURL, task.Description,
+			task.MainCategory, task.SubCategory, task.Channel, task.ShareDesc,
+			developerID, developerID, task.DeveloperName,
+			task.AdLevel, task.PaymentType, task.OperationType, appID,
 		)
+		if err != nil {
+			return fmt.Errorf("更新应用信息失败: %w", err)
+		}
+	}
+
+	if tags != nil {
+		if err = setAppTags(tx, appID, tags); err != nil {
+			return fmt.Errorf("更新应用标签失败: %w", err)
+		}
+	}
+
+	// 将之前的最新版本标记为非最新
+	if _, err = tx.Exec("UPDATE app_versions SET is_latest = 0 WHERE app_id = ?", appID); err != nil {
+		return fmt.Errorf("更新版本状态失败: %w", err)
 	}
 
+	// 获取上传者用户名
+	var uploaderName string
+	tx.QueryRow("SELECT username FROM users WHERE id = ?", task.UserID).Scan(&uploaderName)
+
+	// 创建新版本
+	_, err = tx.Exec(
+		`INSERT INTO app_versions (app_id, package_name, version, version_code,
+			size, download_url, update_content, screenshots, channel, signer_fingerprint,
+			uploader_id, uploader_name, is_latest)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, 1)`,
+		appID, task.PackageName, task.Version, task.VersionCode,
+		task.Size, task.DownloadURL, task.UpdateContent,
+		task.Screenshots, task.Channel, task.SignerFingerprint, task.UserID, uploaderName,
+	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Code:    500,
-			Message: "更新审核状态失败: " + err.Error(),
-		})
-		return
+		return fmt.Errorf("创建版本失败: %w", err)
 	}
+	return nil
+}
 
-	if err = tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Code:    500,
-			Message: "审核失败: " + err.Error(),
-		})
-		return
+// publishDeveloperID 审核通过时应用要关联的开发者：上传时指定的开发者；没有指定时使用同名且未被认领的开发者资料
+// （不存在时创建，之后可以由开发者认领），同名资料已被认领时不关联，避免冒用其他开发者的名义
+func publishDeveloperID(tx *sql.Tx, task models.AppUploadTask) (int64, error) {
+	if task.DeveloperID != 0 {
+		return task.DeveloperID, nil
+	}
+	name := strings.TrimSpace(task.DeveloperName)
+	if name == "" {
+		return 0, nil
 	}
 
-	message := "应用审核通过"
-	if req.Accept == 0 {
-		message = "应用审核拒绝"
+	var developerID int64
+	var claimed bool
+	err := tx.QueryRow(
+		"SELECT id, EXISTS (SELECT 1 FROM developer_members WHERE developer_id = developers.id) FROM developers WHERE name = ?", name,
+	).Scan(&developerID, &claimed)
+	if err == sql.ErrNoRows {
+		result, err := tx.Exec("INSERT INTO developers (name) VALUES (?)", name)
+		if err != nil {
+			return 0, err
+		}
+		return result.LastInsertId()
+	}
+	if err != nil {
+		return 0, err
 	}
+	if claimed {
+		return 0, nil
+	}
+	return developerID, nil
+}
 
-	c.JSON(http.StatusOK, models.Response{
-		Code:    200,
-		Message: message,
-		Data: gin.H{
-			"task_id":     req.TaskID,
-			"status":      map[int]string{0: "rejected", 1: "approved"}[req.Accept],
-			"review_time": reviewTime.Format("2006-01-02 15:04:05"),
-		},
-	})
+// normalizeFingerprint 规范化签名证书 SHA-256 指纹：去掉冒号和空格并转为大写
+func normalizeFingerprint(s string) (string, bool) {
+	fingerprint := strings.ToUpper(strings.NewReplacer(":", "", " ", "").Replace(s))
+	if len(fingerprint) != 64 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(fingerprint); err != nil {
+		return "", false
+	}
+	return fingerprint, true
 }
 
-// validateCategory 验证分类是否存在
+// validateCategory 验证分类是否存在且已启用（读取分类缓存）
 func validateCategory(mainCategory, subCategory string) bool {
-	subCategories, exists := appCategories[mainCategory]
-	if !exists {
+	category, err := findEnabledCategory(mainCategory)
+	if err != nil || category == nil {
 		return false
 	}
 
-	for _, sub := range subCategories {
-		if sub == subCategory {
+	for _, sub := range category.SubCategories {
+		if sub.Name == subCategory {
 			return true
 		}
 	}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"fmt"
+	"testing"
+)
+
+// createTestUploadTask 创建待审核的上传任务并返回任务ID
+func createTestUploadTask(t *testing.T, userID int64, packageName string, versionCode int, proposedTags string) int64 {
+	t.Helper()
+	result, err := database.DB.Exec(
+		`INSERT INTO app_upload_tasks (user_id, package_name, name, icon_url, version, version_code, size,
+			channel, main_category, sub_category, screenshots, description, share_desc, update_content,
+			developer_name, ad_level, payment_type, operation_type, download_url, proposed_tags)
+		VALUES (?, ?, 'Test App', 'https://example.com/icon.png', ?, ?, 1024, 'official', '影音', '播放器',
+			'[]', '', '', '', 'Test', 'none', 'free', 'solo', 'https://example.com/app.apk', ?)`,
+		userID, packageName, fmt.Sprintf("1.%d", versionCode), versionCode, proposedTags,
+	)
+	if err != nil {
+		t.Fatalf("创建上传任务失败: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+// appTagNames 查询应用当前的标签
+func appTagNames(t *testing.T, packageName string) []string {
+	t.Helper()
+	rows, err := database.DB.Query(`
+		SELECT tg.name FROM app_tags at
+		JOIN tags tg ON tg.id = at.tag_id
+		JOIN apps a ON a.id = at.app_id
+		WHERE a.package_name = ?
+		ORDER BY tg.name`, packageName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestReviewTagsKeepOrClear(t *testing.T) {
+	setupTestDB(t)
+	uploader := createTestUser(t, "uploader", "password123", "uploader@example.com")
+	reviewer := createTestUser(t, "reviewer", "password123", "reviewer@example.com")
+	const pkg = "com.example.tags"
+
+	// 首次通过时采用上传者提议的标签
+	taskID := createTestUploadTask(t, uploader, pkg, 1, `["视频","播放器"]`)
+	if _, err := reviewUploadTask(reviewer, taskID, reviewDecision{accept: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if tags := appTagNames(t, pkg); len(tags) != 2 {
+		t.Fatalf("标签 = %v, 期望 2 个", tags)
+	}
+
+	// 审核员和上传者都没有提供标签时保留原有标签
+	taskID = createTestUploadTask(t, uploader, pkg, 2, "")
+	if _, err := reviewUploadTask(reviewer, taskID, reviewDecision{accept: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if tags := appTagNames(t, pkg); len(tags) != 2 {
+		t.Fatalf("标签 = %v, 期望保留原有的 2 个", tags)
+	}
+
+	// 审核员传入空列表时清空标签
+	taskID = createTestUploadTask(t, uploader, pkg, 3, `["视频"]`)
+	if _, err := reviewUploadTask(reviewer, taskID, reviewDecision{accept: 1, tags: &[]string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if tags := appTagNames(t, pkg); len(tags) != 0 {
+		t.Fatalf("标签 = %v, 期望已清空", tags)
+	}
+}
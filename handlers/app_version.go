@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"TaruApp/audit"
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/rbac"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// appVersionRef 应用版本的基本信息
+type appVersionRef struct {
+	ID          int64
+	Version     string
+	VersionCode int
+}
+
+// appMaintainerExpr 判断用户是否维护应用的 SQL 表达式（应用表别名为 a，参数依次为两次用户ID）：
+// 应用所属的开发者已被认领（有成员）时只看当前开发者的成员身份，应用转移后原来的上传者不再有管理权限；
+// 没有关联开发者或开发者还没被认领时，看是否上传过该应用的版本
+const appMaintainerExpr = `CASE WHEN EXISTS (SELECT 1 FROM developer_members m WHERE m.developer_id = a.developer_id)
+	THEN EXISTS (SELECT 1 FROM developer_members m WHERE m.developer_id = a.developer_id AND m.user_id = ?)
+	ELSE EXISTS (SELECT 1 FROM app_versions v WHERE v.app_id = a.id AND v.uploader_id = ?) END`
+
+// loadManagedApp 获取应用ID，并检查当前用户是否可以管理该应用（版本、下载统计）：
+// 应用所属开发者的成员（开发者还没被认领时为上传过该应用任意版本的用户），或拥有 app.manage 权限的用户
+func loadManagedApp(c *gin.Context) (int64, bool) {
+	packageName := c.Param("package_name")
+
+	var appID int64
+	err := database.DB.QueryRow("SELECT id FROM apps WHERE package_name = ?", packageName).Scan(&appID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "应用不存在",
+		})
+		return 0, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询应用失败: " + err.Error(),
+		})
+		return 0, false
+	}
+
+	userID := c.GetInt64("user_id")
+	if rbac.Can(userID, rbac.PermAppManage) {
+		return appID, true
+	}
+	var maintainer bool
+	database.DB.QueryRow(
+		"SELECT "+appMaintainerExpr+" FROM apps a WHERE a.id = ?", userID, userID, appID,
+	).Scan(&maintainer)
+	if !maintainer {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有应用的上传者、开发者成员或管理员可以管理该应用",
+		})
+		return 0, false
+	}
+	return appID, true
+}
+
+// latestAppVersion 获取应用当前的最新版本，没有时返回 nil
+func latestAppVersion(db rowQueryer, appID int64) (*appVersionRef, error) {
+	var v appVersionRef
+	err := db.QueryRow(
+		"SELECT id, version, version_code FROM app_versions WHERE app_id = ? AND is_latest = 1 LIMIT 1", appID,
+	).Scan(&v.ID, &v.Version, &v.VersionCode)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// GetAppVersions 获取应用的版本历史（按版本代码倒序，包含已下架的版本）
+func GetAppVersions(c *gin.Context) {
+	packageName := c.Param("package_name")
+
+	var appID int64
+	err := database.DB.QueryRow("SELECT id FROM apps WHERE package_name = ?", packageName).Scan(&appID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "应用不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询应用失败: " + err.Error(),
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT version, version_code, size, COALESCE(update_content, ''), uploader_name, is_latest,
+			COALESCE(download_count, 0), withdrawn_at, COALESCE(withdraw_reason, ''), created_at
+		FROM app_versions
+		WHERE app_id = ?
+		ORDER BY version_code DESC, id DESC
+	`, appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询版本历史失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	versions := []models.AppVersionItem{}
+	for rows.Next() {
+		var v models.AppVersionItem
+		if err := rows.Scan(&v.Version, &v.VersionCode, &v.Size, &v.UpdateContent, &v.UploaderName, &v.IsLatest,
+			&v.DownloadCount, &v.WithdrawnAt, &v.WithdrawReason, &v.CreatedAt); err != nil {
+			continue
+		}
+		v.Withdrawn = v.WithdrawnAt != nil
+		versions = append(versions, v)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取版本历史成功",
+		Data:    versions,
+	})
+}
+
+// RollbackAppVersion 把应用的最新版本切换到指定的版本（通常是更早的版本）
+func RollbackAppVersion(c *gin.Context) {
+	var req models.RollbackAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	appID, ok := loadManagedApp(c)
+	if !ok {
+		return
+	}
+
+	var target appVersionRef
+	var withdrawnAt *time.Time
+	err := database.DB.QueryRow(
+		"SELECT id, version, version_code, withdrawn_at FROM app_versions WHERE app_id = ? AND version = ?",
+		appID, req.Version,
+	).Scan(&target.ID, &target.Version, &target.VersionCode, &withdrawnAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "应用版本不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询版本失败: " + err.Error(),
+		})
+		return
+	}
+	if withdrawnAt != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该版本已下架，不能设为最新版本",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "回滚版本失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := latestAppVersion(tx, appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询最新版本失败: " + err.Error(),
+		})
+		return
+	}
+	if current != nil && current.ID == target.ID {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该版本已经是最新版本",
+		})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE app_versions SET is_latest = 0 WHERE app_id = ?", appID)
+	if err == nil {
+		_, err = tx.Exec("UPDATE app_versions SET is_latest = 1, updated_at = ? WHERE id = ?", formatDBTime(time.Now()), target.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "回滚版本失败: " + err.Error(),
+		})
+		return
+	}
+
+	audit.SetTarget(c, "app", c.Param("package_name"))
+	if current != nil {
+		audit.SetBefore(c, gin.H{"version": current.Version, "version_code": current.VersionCode})
+	}
+	audit.SetAfter(c, gin.H{"version": target.Version, "version_code": target.VersionCode})
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "回滚版本成功",
+		Data: gin.H{
+			"version":      target.Version,
+			"version_code": target.VersionCode,
+		},
+	})
+}
+
+// WithdrawAppVersion 下架有问题的版本。下架最新版本时，自动把未下架的最高版本设为最新版本
+func WithdrawAppVersion(c *gin.Context) {
+	var req models.WithdrawAppVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	appID, ok := loadManagedApp(c)
+	if !ok {
+		return
+	}
+
+	var target appVersionRef
+	var isLatest bool
+	var withdrawnAt *time.Time
+	err := database.DB.QueryRow(
+		"SELECT id, version, version_code, is_latest, withdrawn_at FROM app_versions WHERE app_id = ? AND version = ?",
+		appID, c.Param("version"),
+	).Scan(&target.ID, &target.Version, &target.VersionCode, &isLatest, &withdrawnAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "应用版本不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询版本失败: " + err.Error(),
+		})
+		return
+	}
+	if withdrawnAt != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该版本已经下架",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "下架版本失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	now := formatDBTime(time.Now())
+	_, err = tx.Exec(
+		`UPDATE app_versions SET is_latest = 0, withdrawn_at = ?, withdrawn_by = ?, withdraw_reason = ?, updated_at = ?
+		WHERE id = ?`,
+		now, c.GetInt64("user_id"), req.Reason, now, target.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "下架版本失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 下架的是最新版本时，把未下架的最高版本设为最新版本；没有可用版本时应用不再出现在列表中
+	var latest *appVersionRef
+	if isLatest {
+		var next appVersionRef
+		err = tx.QueryRow(`
+			SELECT id, version, version_code FROM app_versions
+			WHERE app_id = ? AND withdrawn_at IS NULL
+			ORDER BY version_code DESC, id DESC
+			LIMIT 1
+		`, appID).Scan(&next.ID, &next.Version, &next.VersionCode)
+		if err == nil {
+			latest = &next
+			_, err = tx.Exec("UPDATE app_versions SET is_latest = 1 WHERE id = ?", next.ID)
+		} else if err == sql.ErrNoRows {
+			err = nil
+		}
+	} else {
+		latest, err = latestAppVersion(tx, appID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "下架版本失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 下架后原来不相邻的两个版本变为相邻，为它们生成补丁
+	TriggerPatchJob()
+
+	audit.SetTarget(c, "app_version", target.ID)
+	audit.SetBefore(c, gin.H{"package_name": c.Param("package_name"), "version": target.Version, "is_latest": isLatest})
+
+	data := gin.H{"latest_version": nil}
+	if latest != nil {
+		data["latest_version"] = latest.Version
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "下架版本成功",
+		Data:    data,
+	})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// canManageApp 以指定用户身份调用 loadManagedApp
+func canManageApp(userID int64, packageName string) bool {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Params = gin.Params{{Key: "package_name", Value: packageName}}
+	c.Set("user_id", userID)
+	_, ok := loadManagedApp(c)
+	return ok
+}
+
+func TestTransferredAppRevokesPreviousUploader(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice", "password123", "alice@example.com")
+	bob := createTestUser(t, "bob", "password123", "bob@example.com")
+	reviewer := createTestUser(t, "reviewer", "password123", "reviewer@example.com")
+	const pkg = "com.example.transfer"
+
+	taskID := createTestUploadTask(t, alice, pkg, 1, "")
+	if _, err := reviewUploadTask(reviewer, taskID, reviewDecision{accept: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if !canManageApp(alice, pkg) || canManageApp(bob, pkg) {
+		t.Fatal("没有关联开发者的应用应当由上传者管理")
+	}
+
+	// 应用转移到 bob 的开发者后，alice 不再是应用的维护者
+	developerID := createTestDeveloper(t, "Bob Studio", bob, false)
+	database.DB.Exec("UPDATE apps SET developer_id = ? WHERE package_name = ?", developerID, pkg)
+	if canManageApp(alice, pkg) {
+		t.Fatal("应用转移后原上传者不应再能管理应用")
+	}
+	if !canManageApp(bob, pkg) {
+		t.Fatal("开发者成员应当可以管理应用")
+	}
+
+	conflicts, err := detectUploadConflicts(database.DB, uploadCandidate{userID: alice, packageName: pkg, version: "1.2", versionCode: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, c := range conflicts {
+		found = found || c.Code == conflictUploaderMismatch
+	}
+	if !found {
+		t.Fatalf("冲突 = %v, 期望包含 uploader_mismatch", conflictCodes(conflicts))
+	}
+}
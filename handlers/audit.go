@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditExportRows 导出审计日志的最大行数
+const maxAuditExportRows = 100000
+
+// auditLogColumns 查询审计日志的字段列表
+const auditLogColumns = `id, actor_id, COALESCE(actor_name, ''), action, COALESCE(target_type, ''), COALESCE(target_id, ''),
+	before_data, after_data, COALESCE(ip, ''), created_at`
+
+// buildAuditFilter 根据查询参数生成筛选条件：actor_id、action（以 * 结尾时按前缀匹配）、target_type、target_id、from、to
+func buildAuditFilter(c *gin.Context) (string, []any, error) {
+	conditions := []string{}
+	args := []any{}
+
+	if actorID := c.Query("actor_id"); actorID != "" {
+		id, err := strconv.ParseInt(actorID, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("actor_id 无效")
+		}
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, id)
+	}
+	if action := c.Query("action"); action != "" {
+		if prefix, ok := strings.CutSuffix(action, "*"); ok {
+			conditions = append(conditions, "substr(action, 1, ?) = ?")
+			args = append(args, len(prefix), prefix)
+		} else {
+			conditions = append(conditions, "action = ?")
+			args = append(args, action)
+		}
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, targetType)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, targetID)
+	}
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseAuditTime(from)
+		if err != nil {
+			return "", nil, fmt.Errorf("from 格式无效，应为 2006-01-02 或 RFC3339")
+		}
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, formatDBTime(t))
+	}
+	if to := c.Query("to"); to != "" {
+		t, dateOnly, err := parseAuditTime(to)
+		if err != nil {
+			return "", nil, fmt.Errorf("to 格式无效，应为 2006-01-02 或 RFC3339")
+		}
+		// 只有日期时包含当天
+		if dateOnly {
+			conditions = append(conditions, "created_at < ?")
+			args = append(args, formatDBTime(t.AddDate(0, 0, 1)))
+		} else {
+			conditions = append(conditions, "created_at <= ?")
+			args = append(args, formatDBTime(t))
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// parseAuditTime 解析日期（按服务器时区）或 RFC3339 时间
+func parseAuditTime(s string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, false, err
+}
+
+// scanAuditLog 读取一条审计日志
+func scanAuditLog(rows *sql.Rows) (models.AuditLog, error) {
+	var entry models.AuditLog
+	var before, after sql.NullString
+	err := rows.Scan(&entry.ID, &entry.ActorID, &entry.ActorName, &entry.Action, &entry.TargetType, &entry.TargetID,
+		&before, &after, &entry.IP, &entry.CreatedAt)
+	if before.Valid {
+		entry.Before = []byte(before.String)
+	}
+	if after.Valid {
+		entry.After = []byte(after.String)
+	}
+	return entry, err
+}
+
+// GetAuditLogs 查询审计日志（按时间倒序）
+func GetAuditLogs(c *gin.Context) {
+	where, args, err := buildAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+	page, pageSize, offset := parsePageParams(c, 20)
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM audit_logs"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询审计日志失败: " + err.Error(),
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT "+auditLogColumns+" FROM audit_logs"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, pageSize, offset)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询审计日志失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	list := []models.AuditLog{}
+	for rows.Next() {
+		if entry, err := scanAuditLog(rows); err == nil {
+			list = append(list, entry)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取审计日志成功",
+		Data: gin.H{
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+			"list":      list,
+		},
+	})
+}
+
+// ExportAuditLogs 按筛选条件导出审计日志为 CSV
+func ExportAuditLogs(c *gin.Context) {
+	where, args, err := buildAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT "+auditLogColumns+" FROM audit_logs"+where+" ORDER BY id DESC LIMIT ?",
+		append(args, maxAuditExportRows)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "导出审计日志失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("audit_logs_%s.csv", time.Now().Format("20060102_150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// 写入 BOM，方便用 Excel 打开时正确识别中文
+	c.Writer.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "actor_id", "actor_name", "action", "target_type", "target_id", "before", "after", "ip"})
+	for rows.Next() {
+		entry, err := scanAuditLog(rows)
+		if err != nil {
+			continue
+		}
+		w.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.FormatInt(entry.ActorID, 10),
+			entry.ActorName,
+			entry.Action,
+			entry.TargetType,
+			entry.TargetID,
+			string(entry.Before),
+			string(entry.After),
+			entry.IP,
+		})
+	}
+	w.Flush()
+}
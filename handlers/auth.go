@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"TaruApp/config"
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/utils"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sqlExecer 可以执行写操作的对象（*sql.DB 或 *sql.Tx）
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// issueTokenPair 为登录会话签发访问令牌并生成新的刷新令牌
+func issueTokenPair(db sqlExecer, userID int64, username string, level int, sessionID string, twoFactor bool) (models.TokenPair, error) {
+	var pair models.TokenPair
+	var err error
+
+	now := time.Now()
+	pair.ExpiresAt = now.Add(time.Duration(config.AppConfig.AccessTokenTTL) * time.Minute)
+	pair.Token, err = utils.SignAccessToken(utils.AccessClaims{
+		UserID:    userID,
+		Username:  username,
+		Level:     level,
+		SessionID: sessionID,
+		TwoFactor: twoFactor,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: pair.ExpiresAt.Unix(),
+	}, config.AppConfig.TokenSecret)
+	if err != nil {
+		return pair, err
+	}
+
+	if pair.RefreshToken, err = utils.GenerateToken(); err != nil {
+		return pair, err
+	}
+	pair.RefreshExpiresAt = now.AddDate(0, 0, config.AppConfig.RefreshTokenTTL)
+	_, err = db.Exec(
+		"INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at) VALUES (?, ?, ?, ?)",
+		userID, utils.HashToken(pair.RefreshToken), sessionID, formatDBTime(pair.RefreshExpiresAt),
+	)
+	return pair, err
+}
+
+// formatDBTime 格式化为与 CURRENT_TIMESTAMP 一致的 UTC 时间字符串，便于在 SQL 中直接比较
+func formatDBTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// RefreshToken 使用刷新令牌换取新的令牌对（刷新令牌只能使用一次，重复使用视为泄露并吊销整个会话）
+func RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "刷新令牌失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var token models.RefreshToken
+	var user models.User
+	var twoFactor bool
+	err = tx.QueryRow(`
+		SELECT r.id, r.user_id, r.family_id, r.expires_at, r.used_at, r.revoked_at,
+		       u.username, u.level, COALESCE(s.two_factor, 0)
+		FROM refresh_tokens r
+		JOIN users u ON r.user_id = u.id
+		LEFT JOIN sessions s ON r.family_id = s.id
+		WHERE r.token_hash = ?
+	`, utils.HashToken(req.RefreshToken)).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt,
+		&user.Username, &user.Level, &twoFactor,
+	)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Code:    401,
+			Message: "刷新令牌无效",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "刷新令牌失败: " + err.Error(),
+		})
+		return
+	}
+
+	if token.RevokedAt != nil {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Code:    401,
+			Message: "登录会话已失效，请重新登录",
+		})
+		return
+	}
+
+	// 已经轮换过的令牌再次出现，说明令牌可能被盗用，吊销整个会话
+	if token.UsedAt != nil {
+		if err = revokeSession(tx, token.FamilyID); err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "刷新令牌失败: " + err.Error(),
+			})
+			return
+		}
+		log.Printf("检测到刷新令牌重复使用: user_id=%d family_id=%s ip=%s", token.UserID, token.FamilyID, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Code:    401,
+			Message: "刷新令牌已被使用，登录会话已失效，请重新登录",
+		})
+		return
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Code:    401,
+			Message: "刷新令牌已过期，请重新登录",
+		})
+		return
+	}
+
+	if respondIfLoginBlocked(c, token.UserID) {
+		return
+	}
+
+	// 标记旧令牌已使用（并发刷新时只有一个请求能成功）
+	result, err := tx.Exec(
+		"UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL",
+		token.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "刷新令牌失败: " + err.Error(),
+		})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Code:    401,
+			Message: "刷新令牌已被使用",
+		})
+		return
+	}
+
+	// 重新读取用户名、权限等级和两步验证状态，变更在刷新后生效
+	pair, err := issueTokenPair(tx, token.UserID, user.Username, user.Level, token.FamilyID, twoFactor)
+	if err == nil {
+		err = touchSession(tx, c, token.FamilyID, pair.RefreshExpiresAt)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "生成令牌失败: " + err.Error(),
+		})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "刷新令牌失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "刷新令牌成功",
+		Data:    pair,
+	})
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"TaruApp/audit"
+	"TaruApp/config"
 	"TaruApp/database"
 	"TaruApp/models"
+	"TaruApp/rbac"
 	"database/sql"
 	"net/http"
 
@@ -28,7 +31,35 @@ func CreateBoard(c *gin.Context) {
 	var creatorAvatar string
 	database.DB.QueryRow("SELECT COALESCE(avatar, '') FROM users WHERE id = ?", creatorID).Scan(&creatorAvatar)
 
-	result, err := database.DB.Exec(
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "创建板块失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// 开启创建券后，普通用户创建板块需要消耗一张板块创建券（有板块管理权限的用户除外）
+	if config.AppConfig.BoardCreateRequiresTicket && !rbac.Can(creatorID.(int64), rbac.PermBoardManage) {
+		if err = consumeUserItem(tx, creatorID.(int64), shopItemBoardTicket); err != nil {
+			if err == errItemNotOwned {
+				c.JSON(http.StatusForbidden, models.Response{
+					Code:    403,
+					Message: "创建板块需要板块创建券，请先在商城购买",
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "创建板块失败: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	result, err := tx.Exec(
 		"INSERT INTO boards (name, description, avatar_url, creator_id, creator_name, creator_avatar) VALUES (?, ?, ?, ?, ?, ?)",
 		req.Name, req.Description, req.AvatarURL, creatorID, creatorName, creatorAvatar,
 	)
@@ -41,6 +72,14 @@ func CreateBoard(c *gin.Context) {
 	}
 
 	id, _ := result.LastInsertId()
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "创建板块失败: " + err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
 		Message: "创建板块成功",
@@ -165,6 +204,10 @@ func UpdateBoard(c *gin.Context) {
 		return
 	}
 
+	if !checkBoardManageable(c, id, "修改") {
+		return
+	}
+
 	_, err := database.DB.Exec(
 		"UPDATE boards SET name = ?, description = ?, avatar_url = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
 		req.Name, req.Description, req.AvatarURL, id,
@@ -187,6 +230,10 @@ func UpdateBoard(c *gin.Context) {
 func DeleteBoard(c *gin.Context) {
 	id := c.Param("id")
 
+	if !checkBoardManageable(c, id, "删除") {
+		return
+	}
+
 	_, err := database.DB.Exec("DELETE FROM boards WHERE id = ?", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
@@ -234,3 +281,42 @@ func GetBoardStats(c *gin.Context) {
 		},
 	})
 }
+
+// checkBoardManageable 检查当前用户能否修改或删除板块（创建者或有板块管理权限），不能时写入错误响应
+func checkBoardManageable(c *gin.Context, boardID, action string) bool {
+	userID, _ := c.Get("user_id")
+
+	var name, description string
+	var creatorID sql.NullInt64
+	err := database.DB.QueryRow(
+		"SELECT name, COALESCE(description, ''), creator_id FROM boards WHERE id = ?", boardID,
+	).Scan(&name, &description, &creatorID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "板块不存在",
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询板块失败: " + err.Error(),
+		})
+		return false
+	}
+
+	audit.SetBefore(c, gin.H{"name": name, "description": description, "creator_id": creatorID.Int64})
+
+	if creatorID.Valid && creatorID.Int64 == userID.(int64) {
+		return true
+	}
+	if rbac.Can(userID.(int64), rbac.PermBoardManage) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, models.Response{
+		Code:    403,
+		Message: "无权" + action + "此板块",
+	})
+	return false
+}
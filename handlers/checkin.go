@@ -1,9 +1,10 @@
 package handlers
 
 import (
+	"TaruApp/config"
 	"TaruApp/database"
 	"TaruApp/models"
-	"TaruApp/utils"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -33,9 +34,6 @@ func CheckIn(c *gin.Context) {
 		return
 	}
 
-	// 签到奖励
-	rewardCoins := 50
-	rewardExp := 25
 	now := time.Now()
 
 	// 开始事务
@@ -51,8 +49,8 @@ func CheckIn(c *gin.Context) {
 
 	// 记录签到
 	_, err = tx.Exec(
-		"INSERT INTO check_ins (user_id, check_date, check_time, reward) VALUES (?, ?, ?, ?)",
-		userID, today, now, rewardCoins,
+		"INSERT INTO check_ins (user_id, check_date, check_time, reward) VALUES (?, ?, ?, 0)",
+		userID, today, now,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
@@ -62,25 +60,27 @@ func CheckIn(c *gin.Context) {
 		return
 	}
 
-	// 增加用户硬币和经验值
+	// 按奖励规则发放签到奖励（签到记录写入后再发放，保证累计签到成就计数正确）
+	reward, err := grantReward(tx, userID.(int64), rewardActionCheckIn, today)
+	if err != nil {
+		respondCoinTransferError(c, err, "发放签到奖励失败")
+		return
+	}
 	_, err = tx.Exec(
-		"UPDATE users SET coins = coins + ?, exp = exp + ? WHERE id = ?",
-		rewardCoins, rewardExp, userID,
+		"UPDATE check_ins SET reward = ? WHERE user_id = ? AND check_date = ?",
+		reward.Coins, userID, today,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
-			Message: "增加硬币和经验失败: " + err.Error(),
+			Message: "签到失败: " + err.Error(),
 		})
 		return
 	}
 
-	// 获取更新后的用户信息
-	var user models.User
-	err = tx.QueryRow(
-		"SELECT coins, exp FROM users WHERE id = ?",
-		userID,
-	).Scan(&user.Coins, &user.Exp)
+	// 获取更新后的硬币数
+	var totalCoins int
+	err = tx.QueryRow("SELECT coins FROM users WHERE id = ?", userID).Scan(&totalCoins)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
@@ -89,41 +89,139 @@ func CheckIn(c *gin.Context) {
 		return
 	}
 
-	// 计算新的用户等级
-	newUserLevel := utils.CalculateUserLevel(user.Exp)
+	// 提交事务
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "签到失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "签到成功",
+		Data: gin.H{
+			"reward_coins":   reward.Coins,
+			"reward_exp":     reward.Exp,
+			"level_up_coins": reward.LevelUpCoins,
+			"total_coins":    totalCoins,
+			"total_exp":      reward.TotalExp,
+			"user_level":     reward.UserLevel,
+			"new_badges":     reward.NewBadges,
+			"check_time":     now,
+		},
+	})
+}
+
+// MakeupCheckIn 使用补签卡补签（不发放签到奖励，但计入累计签到成就）
+func MakeupCheckIn(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(int64)
+
+	var req models.MakeupCheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	date, err := time.ParseInLocation("2006-01-02", req.Date, now.Location())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "日期格式错误，应为 YYYY-MM-DD",
+		})
+		return
+	}
+	days := config.AppConfig.MakeupCheckInDays
+	if !date.Before(today) || date.Before(today.AddDate(0, 0, -days)) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: fmt.Sprintf("只能补签最近%d天内的日期", days),
+		})
+		return
+	}
+	checkDate := date.Format("2006-01-02")
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "补签失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var count int
+	tx.QueryRow(
+		"SELECT COUNT(*) FROM check_ins WHERE user_id = ? AND check_date = ?",
+		uid, checkDate,
+	).Scan(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该日期已经签到过了",
+		})
+		return
+	}
+
+	// 消耗一张补签卡
+	if err = consumeUserItem(tx, uid, shopItemMakeupCard); err != nil {
+		if err == errItemNotOwned {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "没有可用的补签卡",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "补签失败: " + err.Error(),
+		})
+		return
+	}
 
-	// 更新用户等级
 	_, err = tx.Exec(
-		"UPDATE users SET user_level = ? WHERE id = ?",
-		newUserLevel, userID,
+		"INSERT INTO check_ins (user_id, check_date, check_time, reward) VALUES (?, ?, ?, 0)",
+		uid, checkDate, now,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
-			Message: "更新用户等级失败: " + err.Error(),
+			Message: "补签失败: " + err.Error(),
+		})
+		return
+	}
+
+	newBadges, err := checkAchievements(tx, uid, achievementMetricCheckInCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "补签失败: " + err.Error(),
 		})
 		return
 	}
 
-	// 提交事务
 	if err = tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
-			Message: "签到失败: " + err.Error(),
+			Message: "补签失败: " + err.Error(),
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
-		Message: "签到成功",
+		Message: "补签成功",
 		Data: gin.H{
-			"reward_coins": rewardCoins,
-			"reward_exp":   rewardExp,
-			"total_coins":  user.Coins,
-			"total_exp":    user.Exp,
-			"user_level":   newUserLevel,
-			"check_time":   now,
+			"check_date": checkDate,
+			"new_badges": newBadges,
 		},
 	})
 }
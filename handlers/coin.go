@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// systemAccountID 系统账户ID，作为硬币发放和回收的对手方
+const systemAccountID int64 = 0
+
+// 硬币流水类型
+const (
+	coinTxOpening     = "opening"      // 期初余额
+	coinTxReward      = "reward"       // 规则奖励，ref_type 为奖励动作
+	coinTxLevelUp     = "level_up"     // 升级奖励
+	coinTxCoinPost    = "coin_post"    // 投币帖子
+	coinTxCoinComment = "coin_comment" // 投币评论
+	coinTxCoinApp     = "coin_app"     // 投币应用
+	coinTxShop        = "shop"         // 商城购买
+)
+
+var (
+	errInsufficientCoins        = errors.New("硬币不足")
+	errDuplicateCoinTransaction = errors.New("重复的交易请求")
+)
+
+// coinTransfer 一笔硬币转移
+type coinTransfer struct {
+	FromUserID     int64  // 付款方，systemAccountID 表示系统发放
+	ToUserID       int64  // 收款方，systemAccountID 表示系统回收
+	Amount         int    // 转移数量，必须大于0
+	Type           string // 流水类型
+	RefType        string // 关联对象类型
+	RefID          int64  // 关联对象ID
+	IdempotencyKey string // 幂等键，相同的键只会记账一次
+	Remark         string // 备注
+}
+
+// transferCoins 在事务中执行一笔复式记账的硬币转移
+// 付款方和收款方各写一条流水，两条流水金额相反、交易号相同
+func transferCoins(tx *sql.Tx, t coinTransfer) (string, error) {
+	if t.Amount <= 0 {
+		return "", fmt.Errorf("转移数量必须大于0")
+	}
+	if t.FromUserID == t.ToUserID {
+		return "", fmt.Errorf("付款方和收款方不能相同")
+	}
+
+	if t.IdempotencyKey == "" {
+		key, err := utils.RandomHex(16)
+		if err != nil {
+			return "", err
+		}
+		t.IdempotencyKey = t.Type + ":" + key
+	} else {
+		var count int
+		if err := tx.QueryRow(
+			"SELECT COUNT(*) FROM coin_transactions WHERE idempotency_key = ?",
+			t.IdempotencyKey,
+		).Scan(&count); err != nil {
+			return "", err
+		}
+		if count > 0 {
+			return "", errDuplicateCoinTransaction
+		}
+	}
+
+	txNo, err := utils.RandomHex(12)
+	if err != nil {
+		return "", err
+	}
+
+	// 付款方扣款（系统账户不记余额）
+	fromBalance := 0
+	if t.FromUserID != systemAccountID {
+		result, err := tx.Exec(
+			"UPDATE users SET coins = coins - ? WHERE id = ? AND coins >= ?",
+			t.Amount, t.FromUserID, t.Amount,
+		)
+		if err != nil {
+			return "", err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return "", errInsufficientCoins
+		}
+		if err := tx.QueryRow("SELECT coins FROM users WHERE id = ?", t.FromUserID).Scan(&fromBalance); err != nil {
+			return "", err
+		}
+	}
+
+	// 收款方入账
+	toBalance := 0
+	if t.ToUserID != systemAccountID {
+		result, err := tx.Exec("UPDATE users SET coins = coins + ? WHERE id = ?", t.Amount, t.ToUserID)
+		if err != nil {
+			return "", err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return "", fmt.Errorf("收款用户不存在")
+		}
+		if err := tx.QueryRow("SELECT coins FROM users WHERE id = ?", t.ToUserID).Scan(&toBalance); err != nil {
+			return "", err
+		}
+	}
+
+	// 并发的相同请求可能都通过了上面的检查，写入流水时由唯一约束判定，冲突的请求回滚整个事务
+	insertSQL := `INSERT INTO coin_transactions (tx_no, user_id, counterparty_id, amount, balance_after,
+		type, ref_type, ref_id, idempotency_key, remark) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(idempotency_key, user_id) DO NOTHING`
+	entries := [][]interface{}{
+		{txNo, t.FromUserID, t.ToUserID, -t.Amount, fromBalance, t.Type, t.RefType, t.RefID, t.IdempotencyKey, t.Remark},
+		{txNo, t.ToUserID, t.FromUserID, t.Amount, toBalance, t.Type, t.RefType, t.RefID, t.IdempotencyKey, t.Remark},
+	}
+	for _, args := range entries {
+		result, err := tx.Exec(insertSQL, args...)
+		if err != nil {
+			return "", err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return "", errDuplicateCoinTransaction
+		}
+	}
+
+	return txNo, nil
+}
+
+// coinIdempotencyKey 根据请求头 Idempotency-Key 生成按用户和关联对象隔离的幂等键，
+// 同一个键用于不同对象（如给另一个帖子投币）时视为新的请求
+// 客户端未提供时返回空字符串，由 transferCoins 自动生成
+func coinIdempotencyKey(c *gin.Context, txType string, userID int64, refType string, refID int64) string {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d:%s:%d:%s", txType, userID, refType, refID, key)
+}
+
+// respondCoinTransferError 将硬币转移错误转换为统一响应
+func respondCoinTransferError(c *gin.Context, err error, message string) {
+	switch err {
+	case errInsufficientCoins:
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "硬币不足",
+		})
+	case errDuplicateCoinTransaction:
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: "该请求已处理，请勿重复提交",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: message + ": " + err.Error(),
+		})
+	}
+}
+
+// GetMyCoinHistory 获取我的硬币流水
+func GetMyCoinHistory(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+
+	whereClause := " WHERE t.user_id = ?"
+	args := []interface{}{userID}
+	if txType := c.Query("type"); txType != "" {
+		whereClause += " AND t.type = ?"
+		args = append(args, txType)
+	}
+
+	// 查询总数
+	var total int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM coin_transactions t"+whereClause, args...).Scan(&total)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询硬币流水失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 查询流水列表
+	rows, err := database.DB.Query(`
+		SELECT t.id, t.tx_no, t.user_id, t.counterparty_id, COALESCE(u.username, ''),
+			t.amount, t.balance_after, t.type, COALESCE(t.ref_type, ''), COALESCE(t.ref_id, 0),
+			COALESCE(t.remark, ''), t.created_at
+		FROM coin_transactions t
+		LEFT JOIN users u ON t.counterparty_id = u.id`+whereClause+`
+		ORDER BY t.id DESC
+		LIMIT ? OFFSET ?`,
+		append(args, pageSize, offset)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询硬币流水失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	transactions := []models.CoinTransaction{}
+	for rows.Next() {
+		var item models.CoinTransaction
+		if err := rows.Scan(
+			&item.ID, &item.TxNo, &item.UserID, &item.CounterpartyID, &item.CounterpartyName,
+			&item.Amount, &item.BalanceAfter, &item.Type, &item.RefType, &item.RefID,
+			&item.Remark, &item.CreatedAt,
+		); err != nil {
+			continue
+		}
+		if item.CounterpartyID == systemAccountID {
+			item.CounterpartyName = "系统"
+		}
+		transactions = append(transactions, item)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取硬币流水成功",
+		Data: models.PageData{
+			Total:    total,
+			Page:     page,
+			PageSize: pageSize,
+			List:     transactions,
+		},
+	})
+}
+
+// reconcileCoins 核对每个用户的 users.coins 与流水合计，返回不一致的用户和全账本合计
+// 复式记账下全账本（含系统账户）的合计应恒为0
+func reconcileCoins() ([]models.CoinReconcileItem, int, int, error) {
+	var checkedUsers int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&checkedUsers); err != nil {
+		return nil, 0, 0, err
+	}
+
+	var ledgerSum int
+	if err := database.DB.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM coin_transactions").Scan(&ledgerSum); err != nil {
+		return nil, 0, 0, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT u.id, u.username, u.coins, COALESCE(SUM(t.amount), 0) AS ledger_sum
+		FROM users u
+		LEFT JOIN coin_transactions t ON t.user_id = u.id
+		GROUP BY u.id
+		HAVING u.coins != ledger_sum
+		ORDER BY u.id ASC
+	`)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+
+	mismatches := []models.CoinReconcileItem{}
+	for rows.Next() {
+		var item models.CoinReconcileItem
+		if err := rows.Scan(&item.UserID, &item.Username, &item.Coins, &item.LedgerSum); err != nil {
+			continue
+		}
+		item.Difference = item.Coins - item.LedgerSum
+		mismatches = append(mismatches, item)
+	}
+
+	return mismatches, checkedUsers, ledgerSum, nil
+}
+
+// ReconcileCoins 硬币对账（管理员权限）
+func ReconcileCoins(c *gin.Context) {
+	mismatches, checkedUsers, ledgerSum, err := reconcileCoins()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "对账失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "对账完成",
+		Data: gin.H{
+			"checked_users":   checkedUsers,
+			"mismatch_count":  len(mismatches),
+			"mismatches":      mismatches,
+			"ledger_sum":      ledgerSum,
+			"ledger_balanced": ledgerSum == 0,
+			"checked_at":      time.Now().Format("2006-01-02 15:04:05"),
+		},
+	})
+}
+
+// StartCoinReconcileJob 启动定时对账任务，发现差异时写日志
+func StartCoinReconcileJob(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			mismatches, checkedUsers, ledgerSum, err := reconcileCoins()
+			if err != nil {
+				log.Printf("硬币对账失败: %v", err)
+				continue
+			}
+			if len(mismatches) == 0 && ledgerSum == 0 {
+				log.Printf("硬币对账完成: 共 %d 个用户，无差异", checkedUsers)
+				continue
+			}
+			log.Printf("警告: 硬币对账发现 %d 个用户余额与流水不一致，全账本合计 %d", len(mismatches), ledgerSum)
+			for _, item := range mismatches {
+				log.Printf("  用户 %d(%s): 余额 %d, 流水合计 %d, 差异 %d",
+					item.UserID, item.Username, item.Coins, item.LedgerSum, item.Difference)
+			}
+		}
+	}()
+}
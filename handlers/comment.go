@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"TaruApp/audit"
 	"TaruApp/database"
 	"TaruApp/models"
+	"TaruApp/rbac"
 	"database/sql"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -113,6 +116,17 @@ func CreateComment(c *gin.Context) {
 		return
 	}
 
+	// 按奖励规则发放评论奖励
+	id, _ := result.LastInsertId()
+	reward, err := grantReward(tx, userID.(int64), rewardActionComment, fmt.Sprintf("comment:%d", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "发放评论奖励失败: " + err.Error(),
+		})
+		return
+	}
+
 	// 提交事务
 	if err = tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
@@ -129,14 +143,17 @@ func CreateComment(c *gin.Context) {
 		return
 	}
 
-	id, _ := result.LastInsertId()
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
 		Message: "创建评论成功",
 		Data: gin.H{
-			"id":        id,
-			"floor":     floor,
-			"parent_id": req.ParentID,
+			"id":         id,
+			"floor":      floor,
+			"parent_id":  req.ParentID,
+			"reward_exp": reward.Exp,
+			"total_exp":  reward.TotalExp,
+			"user_level": reward.UserLevel,
+			"new_badges": reward.NewBadges,
 		},
 	})
 }
@@ -254,6 +271,7 @@ func GetComments(c *gin.Context) {
 
 		comments = append(comments, comment)
 	}
+	attachCommentCosmetics(comments)
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
@@ -353,6 +371,7 @@ func GetCommentReplies(c *gin.Context) {
 
 		replies = append(replies, reply)
 	}
+	attachCommentCosmetics(replies)
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
@@ -435,10 +454,11 @@ func DeleteComment(c *gin.Context) {
 	// 获取评论信息，验证是否为作者本人
 	var commentUserID, postID int64
 	var parentID sql.NullInt64
+	var content string
 	err := database.DB.QueryRow(
-		"SELECT user_id, post_id, parent_id FROM comments WHERE id = ?",
+		"SELECT user_id, post_id, parent_id, content FROM comments WHERE id = ?",
 		id,
-	).Scan(&commentUserID, &postID, &parentID)
+	).Scan(&commentUserID, &postID, &parentID, &content)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, models.Response{
 			Code:    404,
@@ -454,8 +474,8 @@ func DeleteComment(c *gin.Context) {
 		return
 	}
 
-	// 验证权限：只有作者本人才能删除
-	if commentUserID != userID.(int64) {
+	// 验证权限：作者本人或有帖子管理权限的用户才能删除
+	if commentUserID != userID.(int64) && !rbac.Can(userID.(int64), rbac.PermPostModerate) {
 		c.JSON(http.StatusForbidden, models.Response{
 			Code:    403,
 			Message: "无权删除此评论，只能删除自己的评论",
@@ -463,6 +483,13 @@ func DeleteComment(c *gin.Context) {
 		return
 	}
 
+	// 只记录管理员删除他人评论的操作
+	if commentUserID == userID.(int64) {
+		audit.Skip(c)
+	} else {
+		audit.SetBefore(c, gin.H{"user_id": commentUserID, "post_id": postID, "content": content})
+	}
+
 	// 开始事务
 	tx, err := database.DB.Begin()
 	if err != nil {
@@ -564,9 +591,27 @@ func LikeComment(c *gin.Context) {
 	id := c.Param("id")
 	userID, _ := c.Get("user_id")
 
+	// 检查评论是否存在，并获取评论作者ID
+	var commentUserID int64
+	err := database.DB.QueryRow("SELECT user_id FROM comments WHERE id = ?", id).Scan(&commentUserID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "评论不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询评论失败: " + err.Error(),
+		})
+		return
+	}
+
 	// 检查是否已点赞
 	var count int
-	err := database.DB.QueryRow(
+	err = database.DB.QueryRow(
 		"SELECT COUNT(*) FROM comment_likes WHERE user_id = ? AND comment_id = ?",
 		userID, id,
 	).Scan(&count)
@@ -642,6 +687,18 @@ func LikeComment(c *gin.Context) {
 			return
 		}
 
+		// 给评论作者发放被点赞奖励（同一用户对同一评论只奖励一次）
+		if commentUserID != userID.(int64) {
+			_, err = grantReward(tx, commentUserID, rewardActionReceivedLike, fmt.Sprintf("comment_like:%s:%d", id, userID))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.Response{
+					Code:    500,
+					Message: "发放点赞奖励失败: " + err.Error(),
+				})
+				return
+			}
+		}
+
 		message = "点赞成功"
 		isLiked = true
 	}
@@ -675,11 +732,19 @@ func CoinComment(c *gin.Context) {
 
 	// 获取投币数量
 	var req struct {
-		Amount int `json:"amount" binding:"required,min=1,max=10"`
+		Amount  int    `json:"amount" binding:"required,min=1,max=10"`
+		Message string `json:"message"` // 打赏留言（可选）
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		req.Amount = 1 // 默认投1个币
 	}
+	if !validTipMessage(req.Message) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: fmt.Sprintf("留言不能超过%d个字符", maxTipMessageLength),
+		})
+		return
+	}
 
 	// 开始事务
 	tx, err := database.DB.Begin()
@@ -729,24 +794,49 @@ func CoinComment(c *gin.Context) {
 		return
 	}
 
-	// 如果不是给自己投币，则进行硬币转移
+	// 如果不是给自己投币，则进行硬币转移（记入硬币流水）
 	if commentUserID != userID.(int64) {
-		// 扣除投币者硬币
-		_, err = tx.Exec("UPDATE users SET coins = coins - ? WHERE id = ?", req.Amount, userID)
+		commentID, _ := strconv.ParseInt(id, 10, 64)
+		txNo, err := transferCoins(tx, coinTransfer{
+			FromUserID:     userID.(int64),
+			ToUserID:       commentUserID,
+			Amount:         req.Amount,
+			Type:           coinTxCoinComment,
+			RefType:        "comment",
+			RefID:          commentID,
+			IdempotencyKey: coinIdempotencyKey(c, coinTxCoinComment, userID.(int64), "comment", commentID),
+			Remark:         "投币评论",
+		})
+		if err != nil {
+			respondCoinTransferError(c, err, "投币失败")
+			return
+		}
+
+		// 记录打赏
+		err = recordTip(tx, models.Tip{
+			TxNo:           txNo,
+			TipperID:       userID.(int64),
+			ReceiverID:     commentUserID,
+			TargetType:     tipTargetComment,
+			TargetID:       commentID,
+			Amount:         req.Amount,
+			ReceiverAmount: req.Amount,
+			Message:        req.Message,
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
-				Message: "扣除硬币失败: " + err.Error(),
+				Message: "记录打赏失败: " + err.Error(),
 			})
 			return
 		}
 
-		// 给评论作者增加硬币
-		_, err = tx.Exec("UPDATE users SET coins = coins + ? WHERE id = ?", req.Amount, commentUserID)
+		// 给评论作者发放被投币奖励
+		_, err = grantReward(tx, commentUserID, rewardActionReceivedCoin, "coin:"+txNo)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
-				Message: "增加作者硬币失败: " + err.Error(),
+				Message: "发放投币奖励失败: " + err.Error(),
 			})
 			return
 		}
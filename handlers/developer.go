@@ -0,0 +1,956 @@
+package handlers
+
+import (
+	"TaruApp/audit"
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/rbac"
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// developerColumns 查询开发者资料的字段（表别名为 d），与 scanDeveloper 对应
+const developerColumns = `d.id, d.name, COALESCE(d.avatar_url, ''), COALESCE(d.website, ''), COALESCE(d.email, ''),
+	COALESCE(d.contact, ''), COALESCE(d.description, ''), d.verified, d.verified_at, d.created_at,
+	EXISTS (SELECT 1 FROM developer_members m WHERE m.developer_id = d.id),
+	(SELECT COUNT(*) FROM apps a WHERE a.developer_id = d.id)`
+
+// rowScanner *sql.Row 和 *sql.Rows 共同的 Scan 方法
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDeveloper 读取按 developerColumns 查询的一行开发者资料
+func scanDeveloper(row rowScanner) (*models.Developer, error) {
+	var d models.Developer
+	var verifiedAt *time.Time
+	var createdAt time.Time
+	if err := row.Scan(&d.ID, &d.Name, &d.AvatarURL, &d.Website, &d.Email, &d.Contact, &d.Description,
+		&d.Verified, &verifiedAt, &createdAt, &d.Claimed, &d.AppCount); err != nil {
+		return nil, err
+	}
+	if verifiedAt != nil {
+		d.VerifiedAt = verifiedAt.Format("2006-01-02 15:04:05")
+	}
+	d.CreatedAt = createdAt.Format("2006-01-02 15:04:05")
+	return &d, nil
+}
+
+// loadDeveloper 查询开发者资料，不存在时返回 nil
+func loadDeveloper(q rowQueryer, id int64) (*models.Developer, error) {
+	d, err := scanDeveloper(q.QueryRow("SELECT "+developerColumns+" FROM developers d WHERE d.id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// developerRole 获取用户在开发者中的角色（owner 或 member），不是成员时返回空字符串
+func developerRole(q rowQueryer, developerID, userID int64) string {
+	var role string
+	q.QueryRow(
+		"SELECT role FROM developer_members WHERE developer_id = ? AND user_id = ?", developerID, userID,
+	).Scan(&role)
+	return role
+}
+
+// parseDeveloperID 解析路径中的开发者ID
+func parseDeveloperID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "无效的开发者ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// loadOwnedDeveloper 获取开发者资料，并检查当前用户是开发者的所有者或拥有 developer.manage 权限
+func loadOwnedDeveloper(c *gin.Context) (*models.Developer, bool) {
+	id, ok := parseDeveloperID(c)
+	if !ok {
+		return nil, false
+	}
+	developer, err := loadDeveloper(database.DB, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者失败: " + err.Error(),
+		})
+		return nil, false
+	}
+	if developer == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "开发者不存在",
+		})
+		return nil, false
+	}
+	userID := c.GetInt64("user_id")
+	if developerRole(database.DB, id, userID) != "owner" && !rbac.Can(userID, rbac.PermDeveloperManage) {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有开发者的所有者可以进行此操作",
+		})
+		return nil, false
+	}
+	return developer, true
+}
+
+// bindDeveloperRequest 绑定并规范化开发者资料请求
+func bindDeveloperRequest(c *gin.Context) (models.SaveDeveloperRequest, bool) {
+	var req models.SaveDeveloperRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return req, false
+	}
+	req.Name = strings.Join(strings.Fields(req.Name), " ")
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "开发者名称不能为空",
+		})
+		return req, false
+	}
+	return req, true
+}
+
+// developerNameTaken 检查开发者名称（不区分大小写）是否已被其他开发者使用
+func developerNameTaken(q rowQueryer, name string, excludeID int64) bool {
+	var count int
+	q.QueryRow("SELECT COUNT(*) FROM developers WHERE name = ? AND id != ?", name, excludeID).Scan(&count)
+	return count > 0
+}
+
+// GetDevelopers 获取开发者列表，可以按名称搜索、只看已认证的开发者
+func GetDevelopers(c *gin.Context) {
+	page, pageSize, offset := parsePageParams(c, 20)
+
+	where := "1 = 1"
+	args := []interface{}{}
+	if keyword := strings.TrimSpace(c.Query("keyword")); keyword != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(keyword)
+		where += ` AND d.name LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escaped+"%")
+	}
+	if c.Query("verified") == "1" {
+		where += " AND d.verified = 1"
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM developers d WHERE "+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者失败: " + err.Error(),
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(
+		"SELECT "+developerColumns+" FROM developers d WHERE "+where+`
+		ORDER BY d.verified DESC, (SELECT COALESCE(SUM(download_count), 0) FROM apps a WHERE a.developer_id = d.id) DESC, d.id
+		LIMIT ? OFFSET ?`,
+		append(args, pageSize, offset)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	developers := []models.Developer{}
+	for rows.Next() {
+		developer, err := scanDeveloper(rows)
+		if err != nil {
+			continue
+		}
+		developers = append(developers, *developer)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取开发者列表成功",
+		Data: models.PageData{
+			Total:    total,
+			Page:     page,
+			PageSize: pageSize,
+			List:     developers,
+		},
+	})
+}
+
+// GetDeveloperDetail 开发者页面：开发者资料、成员、应用汇总数据和应用列表（按下载量排序，分页）
+func GetDeveloperDetail(c *gin.Context) {
+	id, ok := parseDeveloperID(c)
+	if !ok {
+		return
+	}
+	developer, err := loadDeveloper(database.DB, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者失败: " + err.Error(),
+		})
+		return
+	}
+	if developer == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "开发者不存在",
+		})
+		return
+	}
+
+	members, err := loadDeveloperMembers(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者成员失败: " + err.Error(),
+		})
+		return
+	}
+
+	var stats models.DeveloperStats
+	var weightedRating float64
+	err = database.DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(download_count), 0),
+			COALESCE(SUM(rating * rating_count), 0), COALESCE(SUM(rating_count), 0)
+		FROM apps WHERE developer_id = ?
+	`, id).Scan(&stats.AppCount, &stats.TotalDownloads, &weightedRating, &stats.RatingCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者统计失败: " + err.Error(),
+		})
+		return
+	}
+	if stats.RatingCount > 0 {
+		stats.Rating = math.Round(weightedRating/float64(stats.RatingCount)*10) / 10
+	}
+
+	page, pageSize, offset := parsePageParams(c, 20)
+	rows, err := database.DB.Query(`
+		SELECT a.package_name, a.name, COALESCE(a.icon_url, ''), COALESCE(v.version, ''), a.rating, a.rating_count,
+			a.download_count, COALESCE(a.main_category, ''), COALESCE(a.sub_category, '')
+		FROM apps a
+		LEFT JOIN app_versions v ON a.id = v.app_id AND v.is_latest = 1
+		WHERE a.developer_id = ?
+		ORDER BY a.download_count DESC, a.id
+		LIMIT ? OFFSET ?
+	`, id, pageSize, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者应用失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	apps := []models.DeveloperApp{}
+	for rows.Next() {
+		var app models.DeveloperApp
+		if err := rows.Scan(&app.PackageName, &app.Name, &app.IconURL, &app.Version, &app.Rating, &app.RatingCount,
+			&app.DownloadCount, &app.MainCategory, &app.SubCategory); err != nil {
+			continue
+		}
+		apps = append(apps, app)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取开发者信息成功",
+		Data: gin.H{
+			"developer": developer,
+			"members":   members,
+			"stats":     stats,
+			"apps": models.PageData{
+				Total:    stats.AppCount,
+				Page:     page,
+				PageSize: pageSize,
+				List:     apps,
+			},
+		},
+	})
+}
+
+// loadDeveloperMembers 获取开发者成员（所有者在前）
+func loadDeveloperMembers(developerID int64) ([]models.DeveloperMember, error) {
+	rows, err := database.DB.Query(`
+		SELECT m.user_id, COALESCE(u.username, ''), COALESCE(u.avatar, ''), m.role, m.created_at
+		FROM developer_members m
+		LEFT JOIN users u ON m.user_id = u.id
+		WHERE m.developer_id = ?
+		ORDER BY m.role = 'owner' DESC, m.created_at
+	`, developerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.DeveloperMember{}
+	for rows.Next() {
+		var member models.DeveloperMember
+		var joinedAt time.Time
+		if err := rows.Scan(&member.UserID, &member.Username, &member.Avatar, &member.Role, &joinedAt); err != nil {
+			return nil, err
+		}
+		member.JoinedAt = joinedAt.Format("2006-01-02 15:04:05")
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// GetMyDevelopers 获取我所在的开发者（含我的角色）
+func GetMyDevelopers(c *gin.Context) {
+	rows, err := database.DB.Query(
+		"SELECT "+developerColumns+`, m.role
+		FROM developer_members m
+		JOIN developers d ON m.developer_id = d.id
+		WHERE m.user_id = ?
+		ORDER BY m.created_at`,
+		c.GetInt64("user_id"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	developers := []gin.H{}
+	for rows.Next() {
+		var d models.Developer
+		var verifiedAt *time.Time
+		var createdAt time.Time
+		var role string
+		if err := rows.Scan(&d.ID, &d.Name, &d.AvatarURL, &d.Website, &d.Email, &d.Contact, &d.Description,
+			&d.Verified, &verifiedAt, &createdAt, &d.Claimed, &d.AppCount, &role); err != nil {
+			continue
+		}
+		if verifiedAt != nil {
+			d.VerifiedAt = verifiedAt.Format("2006-01-02 15:04:05")
+		}
+		d.CreatedAt = createdAt.Format("2006-01-02 15:04:05")
+		developers = append(developers, gin.H{"developer": d, "role": role})
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取我的开发者成功",
+		Data:    developers,
+	})
+}
+
+// CreateDeveloper 创建开发者资料，创建者成为所有者。新资料未认证，需要申请认领（认证）后才会显示认证标识
+func CreateDeveloper(c *gin.Context) {
+	req, ok := bindDeveloperRequest(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt64("user_id")
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "创建开发者失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	if developerNameTaken(tx, req.Name, 0) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "开发者名称已存在，如果是你的资料请申请认领",
+		})
+		return
+	}
+	result, err := tx.Exec(
+		`INSERT INTO developers (name, avatar_url, website, email, contact, description, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		req.Name, req.AvatarURL, req.Website, req.Email, req.Contact, req.Description, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "创建开发者失败: " + err.Error(),
+		})
+		return
+	}
+	id, _ := result.LastInsertId()
+	if _, err = tx.Exec(
+		"INSERT INTO developer_members (developer_id, user_id, role) VALUES (?, ?, 'owner')", id, userID,
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "创建开发者失败: " + err.Error(),
+		})
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "创建开发者失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "创建开发者成功",
+		Data: gin.H{
+			"id": id,
+		},
+	})
+}
+
+// UpdateDeveloper 修改开发者资料（所有者或拥有 developer.manage 权限），改名时同步关联应用的开发者名称。
+// 已认证的开发者由所有者改名后取消认证，需要重新申请认证，防止借认证标识冒充其他品牌
+func UpdateDeveloper(c *gin.Context) {
+	before, ok := loadOwnedDeveloper(c)
+	if !ok {
+		return
+	}
+	req, ok := bindDeveloperRequest(c)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "修改开发者失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	if developerNameTaken(tx, req.Name, before.ID) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "开发者名称已存在",
+		})
+		return
+	}
+	_, err = tx.Exec(
+		`UPDATE developers SET name = ?, avatar_url = ?, website = ?, email = ?, contact = ?, description = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		req.Name, req.AvatarURL, req.Website, req.Email, req.Contact, req.Description, before.ID,
+	)
+	renamed := req.Name != before.Name
+	if err == nil && renamed {
+		_, err = tx.Exec("UPDATE apps SET developer_name = ? WHERE developer_id = ?", req.Name, before.ID)
+	}
+	unverified := renamed && before.Verified && !rbac.Can(c.GetInt64("user_id"), rbac.PermDeveloperManage)
+	if err == nil && unverified {
+		_, err = tx.Exec(
+			"UPDATE developers SET verified = 0, verified_by = NULL, verified_at = NULL WHERE id = ?", before.ID,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "修改开发者失败: " + err.Error(),
+		})
+		return
+	}
+
+	message := "修改开发者成功"
+	if unverified {
+		message = "修改开发者成功，名称已变更，需要重新申请认证"
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: message,
+		Data: gin.H{
+			"verified": before.Verified && !unverified,
+		},
+	})
+}
+
+// ClaimDeveloper 申请认领开发者资料，管理员审核通过后成为开发者的成员（没有所有者时成为所有者）并认证该开发者。
+// 未认证开发者的所有者也通过认领申请认证
+func ClaimDeveloper(c *gin.Context) {
+	id, ok := parseDeveloperID(c)
+	if !ok {
+		return
+	}
+	var req models.ClaimDeveloperRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	userID := c.GetInt64("user_id")
+
+	developer, err := loadDeveloper(database.DB, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询开发者失败: " + err.Error(),
+		})
+		return
+	}
+	if developer == nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "开发者不存在",
+		})
+		return
+	}
+	if developer.Verified && developerRole(database.DB, id, userID) != "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "你已经是该开发者的成员",
+		})
+		return
+	}
+
+	var pending int
+	database.DB.QueryRow(
+		"SELECT COUNT(*) FROM developer_claims WHERE developer_id = ? AND user_id = ? AND status = 'pending'", id, userID,
+	).Scan(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "你已经提交过认领申请，请等待审核",
+		})
+		return
+	}
+
+	result, err := database.DB.Exec(
+		"INSERT INTO developer_claims (developer_id, user_id, message, created_at) VALUES (?, ?, ?, ?)",
+		id, userID, strings.TrimSpace(req.Message), formatDBTime(time.Now()),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "提交认领申请失败: " + err.Error(),
+		})
+		return
+	}
+	claimID, _ := result.LastInsertId()
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已提交认领申请，等待审核",
+		Data: gin.H{
+			"claim_id": claimID,
+			"status":   "pending",
+		},
+	})
+}
+
+// queryDeveloperClaims 查询开发者认领申请（按申请时间倒序）
+func queryDeveloperClaims(where string, args []interface{}, limit, offset int) ([]models.DeveloperClaim, error) {
+	rows, err := database.DB.Query(`
+		SELECT c.id, c.developer_id, COALESCE(d.name, ''), c.user_id, COALESCE(u.username, ''), c.message, c.status,
+			COALESCE(r.username, ''), COALESCE(c.review_note, ''), c.created_at, c.reviewed_at
+		FROM developer_claims c
+		LEFT JOIN developers d ON c.developer_id = d.id
+		LEFT JOIN users u ON c.user_id = u.id
+		LEFT JOIN users r ON c.reviewer_id = r.id
+		WHERE `+where+`
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := []models.DeveloperClaim{}
+	for rows.Next() {
+		var claim models.DeveloperClaim
+		var createdAt time.Time
+		var reviewedAt *time.Time
+		if err := rows.Scan(&claim.ID, &claim.DeveloperID, &claim.DeveloperName, &claim.UserID, &claim.Username,
+			&claim.Message, &claim.Status, &claim.ReviewerName, &claim.ReviewNote, &createdAt, &reviewedAt); err != nil {
+			return nil, err
+		}
+		claim.CreatedAt = createdAt.Format("2006-01-02 15:04:05")
+		if reviewedAt != nil {
+			claim.ReviewedAt = reviewedAt.Format("2006-01-02 15:04:05")
+		}
+		claims = append(claims, claim)
+	}
+	return claims, rows.Err()
+}
+
+// GetMyDeveloperClaims 获取我的开发者认领申请
+func GetMyDeveloperClaims(c *gin.Context) {
+	claims, err := queryDeveloperClaims("c.user_id = ?", []interface{}{c.GetInt64("user_id")}, 100, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询认领申请失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取认领申请成功",
+		Data:    claims,
+	})
+}
+
+// AdminGetDeveloperClaims 获取开发者认领申请（管理员权限），默认只看待审核的申请
+func AdminGetDeveloperClaims(c *gin.Context) {
+	page, pageSize, offset := parsePageParams(c, 20)
+	status := c.DefaultQuery("status", "pending")
+	where := "c.status = ?"
+	args := []interface{}{status}
+	if status == "all" {
+		where, args = "1 = 1", nil
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM developer_claims c WHERE "+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询认领申请失败: " + err.Error(),
+		})
+		return
+	}
+	claims, err := queryDeveloperClaims(where, args, pageSize, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询认领申请失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取认领申请成功",
+		Data: models.PageData{
+			Total:    total,
+			Page:     page,
+			PageSize: pageSize,
+			List:     claims,
+		},
+	})
+}
+
+// ReviewDeveloperClaim 审核开发者认领申请（管理员权限）。通过时申请人成为开发者的成员
+// （开发者还没有所有者时成为所有者，已是成员时保留原角色），并把开发者标记为已认证
+func ReviewDeveloperClaim(c *gin.Context) {
+	claimID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "无效的申请ID",
+		})
+		return
+	}
+	var req models.ReviewDeveloperClaimRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	reviewerID := c.GetInt64("user_id")
+	now := formatDBTime(time.Now())
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "审核认领申请失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var developerID, userID int64
+	var status string
+	err = tx.QueryRow(
+		"SELECT developer_id, user_id, status FROM developer_claims WHERE id = ?", claimID,
+	).Scan(&developerID, &userID, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "认领申请不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询认领申请失败: " + err.Error(),
+		})
+		return
+	}
+	if status != "pending" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该申请已经审核过了",
+		})
+		return
+	}
+	audit.SetTarget(c, "developer", developerID)
+
+	status = "rejected"
+	if *req.Approve {
+		status = "approved"
+		var owners int
+		tx.QueryRow(
+			"SELECT COUNT(*) FROM developer_members WHERE developer_id = ? AND role = 'owner'", developerID,
+		).Scan(&owners)
+		role := "member"
+		if owners == 0 {
+			role = "owner"
+		}
+		_, err = tx.Exec(
+			"INSERT OR IGNORE INTO developer_members (developer_id, user_id, role, created_at) VALUES (?, ?, ?, ?)",
+			developerID, userID, role, now,
+		)
+		if err == nil {
+			_, err = tx.Exec(
+				`UPDATE developers SET verified = 1, verified_by = ?, verified_at = ?, updated_at = CURRENT_TIMESTAMP
+				WHERE id = ? AND verified = 0`,
+				reviewerID, now, developerID,
+			)
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec(
+			"UPDATE developer_claims SET status = ?, reviewer_id = ?, review_note = ?, reviewed_at = ? WHERE id = ?",
+			status, reviewerID, strings.TrimSpace(req.Note), now, claimID,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "审核认领申请失败: " + err.Error(),
+		})
+		return
+	}
+
+	audit.SetAfter(c, gin.H{"claim_id": claimID, "user_id": userID, "status": status})
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "审核认领申请成功",
+		Data: gin.H{
+			"claim_id": claimID,
+			"status":   status,
+		},
+	})
+}
+
+// VerifyDeveloper 设置或取消开发者的认证（管理员权限）
+func VerifyDeveloper(c *gin.Context) {
+	id, ok := parseDeveloperID(c)
+	if !ok {
+		return
+	}
+	var req models.VerifyDeveloperRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var result sql.Result
+	var err error
+	if *req.Verified {
+		result, err = database.DB.Exec(
+			"UPDATE developers SET verified = 1, verified_by = ?, verified_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			c.GetInt64("user_id"), formatDBTime(time.Now()), id,
+		)
+	} else {
+		result, err = database.DB.Exec(
+			"UPDATE developers SET verified = 0, verified_by = NULL, verified_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id,
+		)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "设置认证失败: " + err.Error(),
+		})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "开发者不存在",
+		})
+		return
+	}
+
+	audit.SetAfter(c, gin.H{"verified": *req.Verified})
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "设置认证成功",
+	})
+}
+
+// AddDeveloperMember 邀请用户成为开发者成员，或修改已有成员的角色（所有者）。
+// 被邀请的用户需要接受邀请后才会成为成员
+func AddDeveloperMember(c *gin.Context) {
+	developer, ok := loadOwnedDeveloper(c)
+	if !ok {
+		return
+	}
+	var req models.AddDeveloperMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.Role == "" {
+		req.Role = "member"
+	}
+
+	var exists int
+	database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", req.UserID).Scan(&exists)
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "用户不存在",
+		})
+		return
+	}
+	// 不能把最后一个所有者降为成员
+	if req.Role == "member" && developerRole(database.DB, developer.ID, req.UserID) == "owner" &&
+		countDeveloperOwners(developer.ID) <= 1 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "开发者至少需要一个所有者",
+		})
+		return
+	}
+
+	// 已是成员时直接修改角色，否则发出邀请，对方接受后才成为成员
+	if developerRole(database.DB, developer.ID, req.UserID) != "" {
+		_, err := database.DB.Exec(
+			"UPDATE developer_members SET role = ? WHERE developer_id = ? AND user_id = ?",
+			req.Role, developer.ID, req.UserID,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "修改成员角色失败: " + err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "修改成员角色成功",
+		})
+		return
+	}
+
+	inviteID, err := inviteDeveloperMember(developer.ID, req.UserID, req.Role, c.GetInt64("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "邀请成员失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已发送邀请，等待对方接受",
+		Data:    gin.H{"invite_id": inviteID},
+	})
+}
+
+// countDeveloperOwners 开发者的所有者人数
+func countDeveloperOwners(developerID int64) int {
+	var owners int
+	database.DB.QueryRow(
+		"SELECT COUNT(*) FROM developer_members WHERE developer_id = ? AND role = 'owner'", developerID,
+	).Scan(&owners)
+	return owners
+}
+
+// RemoveDeveloperMember 移除开发者成员（所有者），成员也可以移除自己退出开发者。不能移除最后一个所有者
+func RemoveDeveloperMember(c *gin.Context) {
+	developerID, ok := parseDeveloperID(c)
+	if !ok {
+		return
+	}
+	memberID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "无效的用户ID",
+		})
+		return
+	}
+	userID := c.GetInt64("user_id")
+	if memberID != userID {
+		if _, ok := loadOwnedDeveloper(c); !ok {
+			return
+		}
+	}
+
+	role := developerRole(database.DB, developerID, memberID)
+	if role == "" {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "该用户不是开发者的成员",
+		})
+		return
+	}
+	if role == "owner" && countDeveloperOwners(developerID) <= 1 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "开发者至少需要一个所有者，请先添加其他所有者",
+		})
+		return
+	}
+
+	if _, err := database.DB.Exec(
+		"DELETE FROM developer_members WHERE developer_id = ? AND user_id = ?", developerID, memberID,
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "移除成员失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "移除成员成功",
+	})
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/rbac"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errInviteNotPending 邀请在处理过程中已被其他请求接受、拒绝或撤回
+var errInviteNotPending = errors.New("该邀请已经处理过了")
+
+// developerInvite 开发者成员邀请的状态
+type developerInvite struct {
+	ID          int64
+	DeveloperID int64
+	UserID      int64
+	Role        string
+	Status      string
+}
+
+// inviteDeveloperMember 邀请用户加入开发者。同一用户已有待处理的邀请时只更新邀请的角色
+func inviteDeveloperMember(developerID, userID int64, role string, invitedBy int64) (int64, error) {
+	var inviteID int64
+	err := database.DB.QueryRow(
+		"SELECT id FROM developer_invites WHERE developer_id = ? AND user_id = ? AND status = 'pending'",
+		developerID, userID,
+	).Scan(&inviteID)
+	if err == nil {
+		_, err = database.DB.Exec(
+			"UPDATE developer_invites SET role = ?, invited_by = ? WHERE id = ?", role, invitedBy, inviteID,
+		)
+		return inviteID, err
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	result, err := database.DB.Exec(
+		"INSERT INTO developer_invites (developer_id, user_id, role, invited_by, created_at) VALUES (?, ?, ?, ?, ?)",
+		developerID, userID, role, invitedBy, formatDBTime(time.Now()),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// loadDeveloperInvite 解析路径中的邀请ID并查询邀请，不存在时返回 404，已处理时返回 400
+func loadDeveloperInvite(c *gin.Context) (*developerInvite, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "无效的邀请ID",
+		})
+		return nil, false
+	}
+	var invite developerInvite
+	err = database.DB.QueryRow(
+		"SELECT id, developer_id, user_id, role, status FROM developer_invites WHERE id = ?", id,
+	).Scan(&invite.ID, &invite.DeveloperID, &invite.UserID, &invite.Role, &invite.Status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "邀请不存在",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询邀请失败: " + err.Error(),
+		})
+		return nil, false
+	}
+	if invite.Status != "pending" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该邀请已经处理过了",
+		})
+		return nil, false
+	}
+	return &invite, true
+}
+
+// queryDeveloperInvites 按条件查询开发者成员邀请
+func queryDeveloperInvites(where string, args []interface{}) ([]models.DeveloperInvite, error) {
+	rows, err := database.DB.Query(`
+		SELECT i.id, i.developer_id, COALESCE(d.name, ''), i.user_id, COALESCE(u.username, ''), i.role,
+			COALESCE(b.username, ''), i.status, i.created_at, i.responded_at
+		FROM developer_invites i
+		LEFT JOIN developers d ON i.developer_id = d.id
+		LEFT JOIN users u ON i.user_id = u.id
+		LEFT JOIN users b ON i.invited_by = b.id
+		WHERE `+where+`
+		ORDER BY i.created_at DESC, i.id DESC
+		LIMIT 100`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []models.DeveloperInvite{}
+	for rows.Next() {
+		var invite models.DeveloperInvite
+		var createdAt time.Time
+		var respondedAt *time.Time
+		if err := rows.Scan(&invite.ID, &invite.DeveloperID, &invite.DeveloperName, &invite.UserID, &invite.Username,
+			&invite.Role, &invite.InvitedByName, &invite.Status, &createdAt, &respondedAt); err != nil {
+			return nil, err
+		}
+		invite.CreatedAt = createdAt.Format("2006-01-02 15:04:05")
+		if respondedAt != nil {
+			invite.RespondedAt = respondedAt.Format("2006-01-02 15:04:05")
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+// GetMyDeveloperInvites 获取我收到的待处理开发者邀请
+func GetMyDeveloperInvites(c *gin.Context) {
+	invites, err := queryDeveloperInvites("i.user_id = ? AND i.status = 'pending'", []interface{}{c.GetInt64("user_id")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询邀请失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取邀请成功",
+		Data:    invites,
+	})
+}
+
+// GetDeveloperInvites 获取开发者发出的成员邀请（所有者），可按 status 过滤
+func GetDeveloperInvites(c *gin.Context) {
+	developer, ok := loadOwnedDeveloper(c)
+	if !ok {
+		return
+	}
+	where := "i.developer_id = ?"
+	args := []interface{}{developer.ID}
+	if status := c.Query("status"); status != "" {
+		where += " AND i.status = ?"
+		args = append(args, status)
+	}
+	invites, err := queryDeveloperInvites(where, args)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询邀请失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取邀请成功",
+		Data:    invites,
+	})
+}
+
+// AcceptDeveloperInvite 接受开发者邀请（被邀请的用户），成为开发者的成员。已是成员时保留原角色
+func AcceptDeveloperInvite(c *gin.Context) {
+	invite, ok := loadDeveloperInvite(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt64("user_id")
+	if invite.UserID != userID {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有被邀请的用户可以接受邀请",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "接受邀请失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// 邀请可能在此期间被撤回，只处理仍为 pending 的邀请
+	err = respondDeveloperInvite(tx, invite.ID, "accepted")
+	if err == errInviteNotPending {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "接受邀请失败: " + err.Error(),
+		})
+		return
+	}
+	_, err = tx.Exec(
+		`INSERT INTO developer_members (developer_id, user_id, role, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(developer_id, user_id) DO NOTHING`,
+		invite.DeveloperID, userID, invite.Role, formatDBTime(time.Now()),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "接受邀请失败: " + err.Error(),
+		})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "接受邀请失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已加入开发者",
+	})
+}
+
+// RejectDeveloperInvite 拒绝开发者邀请（被邀请的用户）
+func RejectDeveloperInvite(c *gin.Context) {
+	invite, ok := loadDeveloperInvite(c)
+	if !ok {
+		return
+	}
+	if invite.UserID != c.GetInt64("user_id") {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有被邀请的用户可以拒绝邀请",
+		})
+		return
+	}
+	err := respondDeveloperInvite(database.DB, invite.ID, "rejected")
+	if err == errInviteNotPending {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "拒绝邀请失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已拒绝邀请",
+	})
+}
+
+// CancelDeveloperInvite 撤回开发者邀请（开发者的所有者或拥有 developer.manage 权限）
+func CancelDeveloperInvite(c *gin.Context) {
+	invite, ok := loadDeveloperInvite(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt64("user_id")
+	if developerRole(database.DB, invite.DeveloperID, userID) != "owner" && !rbac.Can(userID, rbac.PermDeveloperManage) {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有开发者的所有者可以撤回邀请",
+		})
+		return
+	}
+	err := respondDeveloperInvite(database.DB, invite.ID, "cancelled")
+	if err == errInviteNotPending {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "撤回邀请失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已撤回邀请",
+	})
+}
+
+// respondDeveloperInvite 把待处理的邀请设为 status，邀请已不是待处理状态时返回 errInviteNotPending
+func respondDeveloperInvite(db sqlExecer, inviteID int64, status string) error {
+	result, err := db.Exec(
+		"UPDATE developer_invites SET status = ?, responded_at = ? WHERE id = ? AND status = 'pending'",
+		status, formatDBTime(time.Now()), inviteID,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errInviteNotPending
+	}
+	return nil
+}
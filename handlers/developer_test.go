@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createTestDeveloper 创建开发者并把 ownerID 设为所有者，返回开发者ID
+func createTestDeveloper(t *testing.T, name string, ownerID int64, verified bool) int64 {
+	t.Helper()
+	result, err := database.DB.Exec(
+		"INSERT INTO developers (name, verified, verified_by, verified_at, created_by) VALUES (?, ?, ?, CASE WHEN ? THEN CURRENT_TIMESTAMP END, ?)",
+		name, verified, ownerID, verified, ownerID,
+	)
+	if err != nil {
+		t.Fatalf("创建开发者失败: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	if _, err = database.DB.Exec(
+		"INSERT INTO developer_members (developer_id, user_id, role) VALUES (?, ?, 'owner')", id, ownerID,
+	); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// developerParam 开发者ID路由参数
+func developerParam(id int64) gin.Param {
+	return gin.Param{Key: "id", Value: fmt.Sprint(id)}
+}
+
+func TestRenamingVerifiedDeveloperClearsVerification(t *testing.T) {
+	setupTestDB(t)
+	owner := createTestUser(t, "owner", "password123", "owner@example.com")
+	developerID := createTestDeveloper(t, "Acme", owner, true)
+
+	// 不改名时保留认证
+	w := performJSON(UpdateDeveloper, http.MethodPut, owner,
+		models.SaveDeveloperRequest{Name: "Acme", Description: "新的简介"}, developerParam(developerID))
+	assertStatus(t, w, http.StatusOK)
+	developer, _ := loadDeveloper(database.DB, developerID)
+	if !developer.Verified {
+		t.Fatal("没有改名时不应取消认证")
+	}
+
+	w = performJSON(UpdateDeveloper, http.MethodPut, owner,
+		models.SaveDeveloperRequest{Name: "Other Brand"}, developerParam(developerID))
+	assertStatus(t, w, http.StatusOK)
+
+	var verified bool
+	var verifiedBy, verifiedAt *string
+	database.DB.QueryRow(
+		"SELECT verified, verified_by, verified_at FROM developers WHERE id = ?", developerID,
+	).Scan(&verified, &verifiedBy, &verifiedAt)
+	if verified || verifiedBy != nil || verifiedAt != nil {
+		t.Fatalf("改名后仍然是认证状态: verified=%v verified_by=%v verified_at=%v", verified, verifiedBy, verifiedAt)
+	}
+}
+
+func TestAddDeveloperMemberRequiresInviteAcceptance(t *testing.T) {
+	setupTestDB(t)
+	owner := createTestUser(t, "owner", "password123", "owner@example.com")
+	invitee := createTestUser(t, "invitee", "password123", "invitee@example.com")
+	other := createTestUser(t, "other", "password123", "other@example.com")
+	developerID := createTestDeveloper(t, "Acme", owner, false)
+
+	w := performJSON(AddDeveloperMember, http.MethodPost, owner,
+		models.AddDeveloperMemberRequest{UserID: invitee}, developerParam(developerID))
+	assertStatus(t, w, http.StatusOK)
+	if role := developerRole(database.DB, developerID, invitee); role != "" {
+		t.Fatalf("接受邀请前不应成为成员，实际角色 %q", role)
+	}
+
+	var inviteID int64
+	if err := database.DB.QueryRow(
+		"SELECT id FROM developer_invites WHERE developer_id = ? AND user_id = ? AND status = 'pending'",
+		developerID, invitee,
+	).Scan(&inviteID); err != nil {
+		t.Fatalf("没有生成邀请: %v", err)
+	}
+	inviteParam := gin.Param{Key: "id", Value: fmt.Sprint(inviteID)}
+
+	// 只有被邀请的用户可以接受
+	w = performJSON(AcceptDeveloperInvite, http.MethodPost, other, nil, inviteParam)
+	assertStatus(t, w, http.StatusForbidden)
+
+	w = performJSON(AcceptDeveloperInvite, http.MethodPost, invitee, nil, inviteParam)
+	assertStatus(t, w, http.StatusOK)
+	if role := developerRole(database.DB, developerID, invitee); role != "member" {
+		t.Fatalf("接受邀请后应成为成员，实际角色 %q", role)
+	}
+
+	// 已处理的邀请不能再次处理
+	w = performJSON(RejectDeveloperInvite, http.MethodPost, invitee, nil, inviteParam)
+	assertStatus(t, w, http.StatusBadRequest)
+}
+
+func TestRejectedAndCancelledInvitesDoNotAddMember(t *testing.T) {
+	setupTestDB(t)
+	owner := createTestUser(t, "owner", "password123", "owner@example.com")
+	invitee := createTestUser(t, "invitee", "password123", "invitee@example.com")
+	developerID := createTestDeveloper(t, "Acme", owner, false)
+
+	invite := func() gin.Param {
+		t.Helper()
+		id, err := inviteDeveloperMember(developerID, invitee, "member", owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gin.Param{Key: "id", Value: fmt.Sprint(id)}
+	}
+
+	w := performJSON(RejectDeveloperInvite, http.MethodPost, invitee, nil, invite())
+	assertStatus(t, w, http.StatusOK)
+
+	param := invite()
+	// 被邀请的用户不能撤回邀请
+	w = performJSON(CancelDeveloperInvite, http.MethodDelete, invitee, nil, param)
+	assertStatus(t, w, http.StatusForbidden)
+	w = performJSON(CancelDeveloperInvite, http.MethodDelete, owner, nil, param)
+	assertStatus(t, w, http.StatusOK)
+	w = performJSON(AcceptDeveloperInvite, http.MethodPost, invitee, nil, param)
+	assertStatus(t, w, http.StatusBadRequest)
+
+	if role := developerRole(database.DB, developerID, invitee); role != "" {
+		t.Fatalf("拒绝或撤回的邀请不应添加成员，实际角色 %q", role)
+	}
+}
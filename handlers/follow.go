@@ -149,6 +149,7 @@ func GetFollowingList(c *gin.Context) {
 		}
 		users = append(users, user)
 	}
+	attachUserCosmetics(users)
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
@@ -221,6 +222,7 @@ func GetFollowerList(c *gin.Context) {
 		}
 		users = append(users, user)
 	}
+	attachUserCosmetics(users)
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"TaruApp/config"
+	"TaruApp/database"
+	"TaruApp/rbac"
+	"TaruApp/utils"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupTestDB 在临时目录中创建测试数据库和默认配置
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{
+		MaxPageSize:                100,
+		AppCoinSharePercent:        70,
+		VerificationCodeTTL:        15,
+		TokenSecret:                "test-secret",
+		AccessTokenTTL:             15,
+		RefreshTokenTTL:            30,
+		ReviewClaimTimeout:         30,
+		ChangesRequestedExpireDays: 30,
+	}
+	if err := database.Open(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	// 不同测试的数据库中用户ID会重复，清除上一个测试留下的权限缓存
+	rbac.InvalidateAll()
+	t.Cleanup(database.CloseDB)
+}
+
+// createTestUser 创建测试用户并返回用户ID
+func createTestUser(t *testing.T, username, password, email string) int64 {
+	t.Helper()
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := database.DB.Exec(
+		"INSERT INTO users (username, password, email, email_verified) VALUES (?, ?, ?, 1)",
+		username, hashed, email,
+	)
+	if err != nil {
+		t.Fatalf("创建测试用户失败: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+// performJSON 以指定用户身份调用处理函数（userID 为 0 时不设置登录信息），返回响应
+func performJSON(handler gin.HandlerFunc, method string, userID int64, body interface{}, params ...gin.Param) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/", bytes.NewReader(payload))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	if userID != 0 {
+		c.Set("user_id", userID)
+		var username string
+		database.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+		c.Set("username", username)
+	}
+	handler(c)
+	return w
+}
+
+// assertStatus 检查响应状态码
+func assertStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("状态码 = %d, 期望 %d, 响应: %s", w.Code, want, w.Body.String())
+	}
+}
@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/oauth"
+	"TaruApp/utils"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oauthStateTTL 发起第三方登录后完成授权的时限
+const oauthStateTTL = 10 * time.Minute
+
+var errUsernameExhausted = errors.New("无法生成可用的用户名")
+
+// getOAuthProvider 按路由参数获取身份提供方，不存在时写入 404 响应
+func getOAuthProvider(c *gin.Context) (*oauth.Provider, bool) {
+	provider, ok := oauth.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "不支持的登录方式",
+		})
+	}
+	return provider, ok
+}
+
+// createOAuthState 保存 state 和 PKCE code_verifier，返回跳转到身份提供方的授权地址；
+// userID 不为 0 时表示为该用户绑定第三方账号
+func createOAuthState(c *gin.Context, provider *oauth.Provider, userID int64, deviceName string) (string, time.Time, error) {
+	state, err := utils.RandomHex(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	verifier, err := oauth.GenerateCodeVerifier()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	authorizeURL, err := provider.AuthCodeURL(c.Request.Context(), state, oauth.CodeChallenge(verifier))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	linkUserID := sql.NullInt64{Int64: userID, Valid: userID > 0}
+	expiresAt := time.Now().Add(oauthStateTTL)
+	_, err = database.DB.Exec(
+		"INSERT INTO oauth_states (state_hash, provider, code_verifier, user_id, device_name, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		utils.HashToken(state), provider.Name, verifier, linkUserID, deviceName, formatDBTime(expiresAt),
+	)
+	return authorizeURL, expiresAt, err
+}
+
+// sanitizeUsername 只保留字母、数字和下划线
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// uniqueUsername 根据第三方账号信息生成可用的用户名，重名时追加随机数字后缀
+func uniqueUsername(candidates ...string) (string, error) {
+	base := "user"
+	for _, candidate := range candidates {
+		if name := sanitizeUsername(candidate); len(name) >= 3 {
+			base = name
+			break
+		}
+	}
+	if len(base) > 15 {
+		base = base[:15]
+	}
+
+	name := base
+	for i := 0; i < 10; i++ {
+		var count int
+		if err := database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", name).Scan(&count); err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return name, nil
+		}
+		suffix, err := utils.RandomDigits(4)
+		if err != nil {
+			return "", err
+		}
+		name = base + "_" + suffix
+	}
+	return "", errUsernameExhausted
+}
+
+// registerOAuthUser 第三方账号首次登录时自动注册用户，已验证且未被占用的邮箱直接绑定
+func registerOAuthUser(providerName string, identity *oauth.Identity) (int64, error) {
+	emailLocal, _, _ := strings.Cut(identity.Email, "@")
+	username, err := uniqueUsername(identity.Username, identity.Name, emailLocal, providerName+"_user")
+	if err != nil {
+		return 0, err
+	}
+
+	// 自动注册的用户没有可用的密码，可在账号设置中设置密码
+	randomPassword, err := utils.RandomHex(32)
+	if err != nil {
+		return 0, err
+	}
+	hashedPassword, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	email := ""
+	if identity.EmailVerified && !emailTakenByOther(identity.Email, 0) {
+		email = identity.Email
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO users (username, password, email, avatar, level, email_verified, has_password) VALUES (?, ?, ?, ?, 0, ?, 0)",
+		username, hashedPassword, email, identity.AvatarURL, email != "",
+	)
+	if err != nil {
+		return 0, err
+	}
+	userID, _ := result.LastInsertId()
+
+	_, err = tx.Exec(
+		"INSERT INTO user_identities (user_id, provider, subject, email, name, last_login_at) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)",
+		userID, providerName, identity.Subject, identity.Email, identity.Name,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// GetOAuthProviders 获取已启用的第三方登录方式
+func GetOAuthProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取第三方登录方式成功",
+		Data:    oauth.Names(),
+	})
+}
+
+// OAuthAuthorize 发起第三方登录，返回身份提供方的授权地址
+func OAuthAuthorize(c *gin.Context) {
+	provider, ok := getOAuthProvider(c)
+	if !ok {
+		return
+	}
+
+	deviceName := c.Query("device_name")
+	if len([]rune(deviceName)) > 50 {
+		deviceName = string([]rune(deviceName)[:50])
+	}
+
+	authorizeURL, expiresAt, err := createOAuthState(c, provider, 0, deviceName)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, models.Response{
+			Code:    502,
+			Message: "发起第三方登录失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "请跳转到授权地址完成登录",
+		Data: gin.H{
+			"authorize_url": authorizeURL,
+			"expires_at":    expiresAt,
+		},
+	})
+}
+
+// OAuthCallback 身份提供方授权后的回调：校验 state，用授权码和 PKCE code_verifier 换取账号信息，
+// 然后完成登录（首次登录自动注册）或绑定
+func OAuthCallback(c *gin.Context) {
+	provider, ok := getOAuthProvider(c)
+	if !ok {
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		message := c.Query("error_description")
+		if message == "" {
+			message = errCode
+		}
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "第三方授权失败: " + message,
+		})
+		return
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "缺少 state 或 code 参数",
+		})
+		return
+	}
+
+	// state 只能使用一次，并且必须属于同一个身份提供方
+	var stateID int64
+	var verifier, deviceName string
+	var linkUserID sql.NullInt64
+	err := database.DB.QueryRow(`
+		SELECT id, code_verifier, user_id, COALESCE(device_name, '') FROM oauth_states
+		WHERE state_hash = ? AND provider = ? AND used_at IS NULL AND expires_at > ?
+	`, utils.HashToken(state), provider.Name, formatDBTime(time.Now())).Scan(&stateID, &verifier, &linkUserID, &deviceName)
+	if err == nil {
+		var result sql.Result
+		result, err = database.DB.Exec("UPDATE oauth_states SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL", stateID)
+		if err == nil {
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				err = sql.ErrNoRows
+			}
+		}
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "授权请求无效或已过期，请重新发起",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "第三方登录失败: " + err.Error(),
+		})
+		return
+	}
+
+	accessToken, err := provider.Exchange(c.Request.Context(), code, verifier)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, models.Response{
+			Code:    502,
+			Message: "获取第三方授权失败: " + err.Error(),
+		})
+		return
+	}
+	identity, err := provider.FetchIdentity(c.Request.Context(), accessToken)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, models.Response{
+			Code:    502,
+			Message: "获取第三方账号信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	if linkUserID.Valid {
+		linkIdentity(c, provider.Name, linkUserID.Int64, identity)
+		return
+	}
+	loginWithIdentity(c, provider.Name, identity, deviceName)
+}
+
+// linkIdentity 把第三方账号绑定到已有用户
+func linkIdentity(c *gin.Context, providerName string, userID int64, identity *oauth.Identity) {
+	var ownerID int64
+	err := database.DB.QueryRow(
+		"SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?",
+		providerName, identity.Subject,
+	).Scan(&ownerID)
+	if err == nil && ownerID != userID {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: "该第三方账号已绑定其他用户",
+		})
+		return
+	}
+	if err == nil {
+		c.JSON(http.StatusOK, models.Response{
+			Code:    200,
+			Message: "该第三方账号已绑定",
+		})
+		return
+	}
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "绑定失败: " + err.Error(),
+		})
+		return
+	}
+
+	var count int
+	database.DB.QueryRow(
+		"SELECT COUNT(*) FROM user_identities WHERE user_id = ? AND provider = ?", userID, providerName,
+	).Scan(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, models.Response{
+			Code:    409,
+			Message: "已绑定其他 " + providerName + " 账号，请先解绑",
+		})
+		return
+	}
+
+	_, err = database.DB.Exec(
+		"INSERT INTO user_identities (user_id, provider, subject, email, name) VALUES (?, ?, ?, ?, ?)",
+		userID, providerName, identity.Subject, identity.Email, identity.Name,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "绑定失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "绑定成功",
+		Data: models.UserIdentity{
+			Provider:  providerName,
+			Email:     identity.Email,
+			Name:      identity.Name,
+			CreatedAt: time.Now(),
+		},
+	})
+}
+
+// loginWithIdentity 使用第三方账号登录，未绑定的账号自动注册新用户
+func loginWithIdentity(c *gin.Context, providerName string, identity *oauth.Identity, deviceName string) {
+	var userID int64
+	err := database.DB.QueryRow(
+		"SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?",
+		providerName, identity.Subject,
+	).Scan(&userID)
+
+	newUser := false
+	if err == sql.ErrNoRows {
+		userID, err = registerOAuthUser(providerName, identity)
+		newUser = true
+	} else if err == nil {
+		_, err = database.DB.Exec(
+			"UPDATE user_identities SET email = ?, name = ?, last_login_at = CURRENT_TIMESTAMP WHERE provider = ? AND subject = ?",
+			identity.Email, identity.Name, providerName, identity.Subject,
+		)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "第三方登录失败: " + err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	err = database.DB.QueryRow(
+		"SELECT id, username, email, level, avatar, coins, exp, user_level, email_verified, totp_enabled, created_at FROM users WHERE id = ?",
+		userID,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Level, &user.Avatar, &user.Coins, &user.Exp, &user.UserLevel, &user.EmailVerified, &user.TwoFactorEnabled, &user.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "第三方登录失败: " + err.Error(),
+		})
+		return
+	}
+
+	if respondIfLoginBlocked(c, user.ID) {
+		return
+	}
+
+	// 第三方登录同样需要两步验证
+	if user.TwoFactorEnabled {
+		respondLoginChallenge(c, user.ID, deviceName)
+		return
+	}
+
+	pair, err := startSession(database.DB, c, user.ID, user.Username, user.Level, deviceName, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "生成令牌失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "登录成功",
+		Data: gin.H{
+			"token":              pair.Token,
+			"expires_at":         pair.ExpiresAt,
+			"refresh_token":      pair.RefreshToken,
+			"refresh_expires_at": pair.RefreshExpiresAt,
+			"user":               user,
+			"new_user":           newUser,
+		},
+	})
+}
+
+// GetMyIdentities 获取当前用户绑定的第三方账号
+func GetMyIdentities(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	rows, err := database.DB.Query(`
+		SELECT provider, COALESCE(email, ''), COALESCE(name, ''), created_at, last_login_at
+		FROM user_identities WHERE user_id = ?
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询绑定账号失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	identities := []models.UserIdentity{}
+	for rows.Next() {
+		var identity models.UserIdentity
+		if err := rows.Scan(&identity.Provider, &identity.Email, &identity.Name, &identity.CreatedAt, &identity.LastLoginAt); err != nil {
+			continue
+		}
+		identities = append(identities, identity)
+	}
+
+	var hasPassword bool
+	database.DB.QueryRow("SELECT has_password FROM users WHERE id = ?", userID).Scan(&hasPassword)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取绑定账号成功",
+		Data: gin.H{
+			"identities":   identities,
+			"providers":    oauth.Names(),
+			"has_password": hasPassword,
+		},
+	})
+}
+
+// LinkOAuth 发起绑定第三方账号，返回身份提供方的授权地址
+func LinkOAuth(c *gin.Context) {
+	provider, ok := getOAuthProvider(c)
+	if !ok {
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	authorizeURL, expiresAt, err := createOAuthState(c, provider, userID.(int64), "")
+	if err != nil {
+		c.JSON(http.StatusBadGateway, models.Response{
+			Code:    502,
+			Message: "发起绑定失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "请跳转到授权地址完成绑定",
+		Data: gin.H{
+			"authorize_url": authorizeURL,
+			"expires_at":    expiresAt,
+		},
+	})
+}
+
+// UnlinkOAuth 解绑第三方账号，不能解绑最后一种登录方式
+func UnlinkOAuth(c *gin.Context) {
+	providerName := c.Param("provider")
+	userID, _ := c.Get("user_id")
+
+	var hasPassword bool
+	var linked, total int
+	err := database.DB.QueryRow(`
+		SELECT has_password,
+			(SELECT COUNT(*) FROM user_identities WHERE user_id = users.id AND provider = ?),
+			(SELECT COUNT(*) FROM user_identities WHERE user_id = users.id)
+		FROM users WHERE id = ?
+	`, providerName, userID).Scan(&hasPassword, &linked, &total)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "解绑失败: " + err.Error(),
+		})
+		return
+	}
+	if linked == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "未绑定该第三方账号",
+		})
+		return
+	}
+	if !hasPassword && total <= 1 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "这是账号唯一的登录方式，请先设置密码再解绑",
+		})
+		return
+	}
+
+	_, err = database.DB.Exec("DELETE FROM user_identities WHERE user_id = ? AND provider = ?", userID, providerName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "解绑失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "解绑成功",
+	})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/oauth"
+	"TaruApp/oauth/oauthtest"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupMockIdP 启动模拟身份提供方并注册为名为 mock 的登录方式
+func setupMockIdP(t *testing.T, identity oauth.Identity) *oauthtest.MockIdP {
+	t.Helper()
+	idp := oauthtest.NewMockIdP(identity)
+	srv := httptest.NewServer(idp)
+	t.Cleanup(srv.Close)
+	oauth.Register(&oauth.Provider{
+		Name:        "mock",
+		Kind:        oauth.KindOIDC,
+		ClientID:    "client-id",
+		RedirectURL: "http://localhost/api/auth/oauth/mock/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+		Issuer:      srv.URL,
+	})
+	return idp
+}
+
+// startMockLogin 调用发起登录接口并访问授权地址，返回回调地址中的查询参数
+func startMockLogin(t *testing.T) url.Values {
+	t.Helper()
+	w := performJSON(OAuthAuthorize, http.MethodGet, 0, nil, gin.Param{Key: "provider", Value: "mock"})
+	assertStatus(t, w, http.StatusOK)
+	var resp struct {
+		Data struct {
+			AuthorizeURL string `json:"authorize_url"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	idpResp, err := client.Get(resp.Data.AuthorizeURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idpResp.Body.Close()
+	location, err := url.Parse(idpResp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query()
+}
+
+// performCallback 调用第三方授权回调接口
+func performCallback(query url.Values) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/auth/oauth/mock/callback?"+query.Encode(), nil)
+	c.Params = gin.Params{{Key: "provider", Value: "mock"}}
+	OAuthCallback(c)
+	return w
+}
+
+func TestOAuthLoginRegistersAndLogsIn(t *testing.T) {
+	setupTestDB(t)
+	setupMockIdP(t, oauth.Identity{
+		Subject:       "subject-1",
+		Username:      "octocat",
+		Email:         "octocat@example.com",
+		EmailVerified: true,
+	})
+
+	var resp struct {
+		Data struct {
+			Token   string `json:"token"`
+			NewUser bool   `json:"new_user"`
+		} `json:"data"`
+	}
+
+	query := startMockLogin(t)
+	w := performCallback(query)
+	assertStatus(t, w, http.StatusOK)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Data.Token == "" || !resp.Data.NewUser {
+		t.Fatalf("首次登录响应异常: %s", w.Body.String())
+	}
+
+	var username string
+	var hasPassword, emailVerified bool
+	database.DB.QueryRow(
+		"SELECT u.username, u.has_password, u.email_verified FROM users u JOIN user_identities i ON i.user_id = u.id WHERE i.provider = 'mock' AND i.subject = 'subject-1'",
+	).Scan(&username, &hasPassword, &emailVerified)
+	if username != "octocat" || hasPassword || !emailVerified {
+		t.Fatalf("自动注册的用户异常: username=%s has_password=%v email_verified=%v", username, hasPassword, emailVerified)
+	}
+
+	// state 只能使用一次
+	assertStatus(t, performCallback(query), http.StatusBadRequest)
+
+	// 再次登录使用同一个账号
+	w = performCallback(startMockLogin(t))
+	assertStatus(t, w, http.StatusOK)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Data.NewUser {
+		t.Fatal("再次登录不应注册新用户")
+	}
+}
+
+func TestOAuthCallbackRejectsUnknownState(t *testing.T) {
+	setupTestDB(t)
+	setupMockIdP(t, oauth.Identity{Subject: "subject-1"})
+
+	query := startMockLogin(t)
+	query.Set("state", "forged-state")
+	assertStatus(t, performCallback(query), http.StatusBadRequest)
+}
@@ -1,9 +1,10 @@
 package handlers
 
 import (
+	"TaruApp/audit"
 	"TaruApp/database"
 	"TaruApp/models"
-	"TaruApp/utils"
+	"TaruApp/rbac"
 	"database/sql"
 	"fmt"
 	"net/http"
@@ -74,47 +75,18 @@ func CreatePost(c *gin.Context) {
 		return
 	}
 
-	// 增加用户经验值（发帖奖励5经验）
-	rewardExp := 5
-	_, err = tx.Exec(
-		"UPDATE users SET exp = exp + ? WHERE id = ?",
-		rewardExp, userID,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Code:    500,
-			Message: "增加经验失败: " + err.Error(),
-		})
-		return
-	}
-	
-	// 获取更新后的经验值
-	var exp int
-	err = tx.QueryRow("SELECT exp FROM users WHERE id = ?", userID).Scan(&exp)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Code:    500,
-			Message: "查询经验值失败: " + err.Error(),
-		})
-		return
-	}
-	
-	// 计算新的用户等级
-	newUserLevel := utils.CalculateUserLevel(exp)
-	
-	// 更新用户等级
-	_, err = tx.Exec(
-		"UPDATE users SET user_level = ? WHERE id = ?",
-		newUserLevel, userID,
-	)
+	id, _ := result.LastInsertId()
+
+	// 按奖励规则发放发帖奖励
+	reward, err := grantReward(tx, userID.(int64), rewardActionPost, fmt.Sprintf("post:%d", id))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
-			Message: "更新用户等级失败: " + err.Error(),
+			Message: "发放发帖奖励失败: " + err.Error(),
 		})
 		return
 	}
-	
+
 	// 提交事务
 	if err = tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
@@ -124,16 +96,17 @@ func CreatePost(c *gin.Context) {
 		return
 	}
 
-	id, _ := result.LastInsertId()
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
 		Message: "创建帖子成功",
 		Data: gin.H{
-			"id":         id,
-			"board_id":   req.BoardID,
-			"reward_exp": rewardExp,
-			"total_exp":  exp,
-			"user_level": newUserLevel,
+			"id":           id,
+			"board_id":     req.BoardID,
+			"reward_exp":   reward.Exp,
+			"reward_coins": reward.Coins,
+			"total_exp":    reward.TotalExp,
+			"user_level":   reward.UserLevel,
+			"new_badges":   reward.NewBadges,
 		},
 	})
 }
@@ -166,7 +139,7 @@ func GetPosts(c *gin.Context) {
 	}
 
 	// 构建查询语句
-	baseQuery := "SELECT id, board_id, user_id, title, content, type, publisher, publish_time, coins, favorites, likes, image_url, attachment_url, attachment_type, comment_count, view_count, last_reply_time, created_at, updated_at FROM posts"
+	baseQuery := "SELECT id, board_id, user_id, title, content, type, publisher, publish_time, coins, favorites, likes, image_url, attachment_url, attachment_type, comment_count, view_count, is_featured, last_reply_time, created_at, updated_at FROM posts"
 	countQuery := "SELECT COUNT(*) FROM posts"
 	whereClause := " WHERE board_id = ?"
 	orderClause := ""
@@ -174,6 +147,11 @@ func GetPosts(c *gin.Context) {
 	// 板块筛选（现在总是有board_id）
 	args := []interface{}{query.BoardID}
 
+	// 精华帖筛选
+	if query.Featured {
+		whereClause += " AND is_featured = 1"
+	}
+
 	// 排序逻辑
 	switch query.Sort {
 	case "latest":
@@ -220,7 +198,7 @@ func GetPosts(c *gin.Context) {
 		err := rows.Scan(
 			&post.ID, &post.BoardID, &post.UserID, &post.Title, &post.Content, &post.Type, &post.Publisher,
 			&post.PublishTime, &post.Coins, &post.Favorites, &post.Likes,
-			&imageURL, &attachmentURL, &attachmentType, &post.CommentCount, &post.ViewCount, &post.LastReplyTime,
+			&imageURL, &attachmentURL, &attachmentType, &post.CommentCount, &post.ViewCount, &post.IsFeatured, &post.LastReplyTime,
 			&post.CreatedAt, &post.UpdatedAt,
 		)
 		if err != nil {
@@ -237,6 +215,7 @@ func GetPosts(c *gin.Context) {
 		}
 		posts = append(posts, post)
 	}
+	attachPostCosmetics(posts)
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
@@ -270,13 +249,13 @@ func GetPostDetail(c *gin.Context) {
 	var imageURL, attachmentURL, attachmentType sql.NullString
 	err := database.DB.QueryRow(
 		`SELECT id, board_id, user_id, title, content, type, publisher, publish_time, coins, favorites, likes, 
-		image_url, attachment_url, attachment_type, comment_count, view_count, last_reply_time, created_at, updated_at 
+		image_url, attachment_url, attachment_type, comment_count, view_count, is_featured, last_reply_time, created_at, updated_at 
 		FROM posts WHERE id = ?`,
 		id,
 	).Scan(
 		&post.ID, &post.BoardID, &post.UserID, &post.Title, &post.Content, &post.Type, &post.Publisher,
 		&post.PublishTime, &post.Coins, &post.Favorites, &post.Likes,
-		&imageURL, &attachmentURL, &attachmentType, &post.CommentCount, &post.ViewCount, &post.LastReplyTime,
+		&imageURL, &attachmentURL, &attachmentType, &post.CommentCount, &post.ViewCount, &post.IsFeatured, &post.LastReplyTime,
 		&post.CreatedAt, &post.UpdatedAt,
 	)
 
@@ -304,6 +283,7 @@ func GetPostDetail(c *gin.Context) {
 	if attachmentType.Valid {
 		post.AttachmentType = attachmentType.String
 	}
+	post.Cosmetics = loadUserCosmetics([]int64{post.UserID})[post.UserID]
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
@@ -389,8 +369,9 @@ func DeletePost(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	// 检查帖子是否存在，并验证是否为作者本人
-	var postUserID int64
-	err := database.DB.QueryRow("SELECT user_id FROM posts WHERE id = ?", id).Scan(&postUserID)
+	var postUserID, boardID int64
+	var title string
+	err := database.DB.QueryRow("SELECT user_id, board_id, title FROM posts WHERE id = ?", id).Scan(&postUserID, &boardID, &title)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, models.Response{
 			Code:    404,
@@ -406,8 +387,8 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 
-	// 验证权限：只有作者本人才能删除
-	if postUserID != userID.(int64) {
+	// 验证权限：作者本人或有帖子管理权限的用户才能删除
+	if postUserID != userID.(int64) && !rbac.Can(userID.(int64), rbac.PermPostModerate) {
 		c.JSON(http.StatusForbidden, models.Response{
 			Code:    403,
 			Message: "无权删除此帖子，只能删除自己的帖子",
@@ -415,6 +396,13 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 
+	// 只记录管理员删除他人帖子的操作
+	if postUserID == userID.(int64) {
+		audit.Skip(c)
+	} else {
+		audit.SetBefore(c, gin.H{"user_id": postUserID, "board_id": boardID, "title": title})
+	}
+
 	// 开始事务
 	tx, err := database.DB.Begin()
 	if err != nil {
@@ -507,9 +495,27 @@ func LikePost(c *gin.Context) {
 	id := c.Param("id")
 	userID, _ := c.Get("user_id")
 
+	// 检查帖子是否存在，并获取帖子作者ID
+	var postUserID int64
+	err := database.DB.QueryRow("SELECT user_id FROM posts WHERE id = ?", id).Scan(&postUserID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "帖子不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询帖子失败: " + err.Error(),
+		})
+		return
+	}
+
 	// 检查是否已点赞
 	var count int
-	err := database.DB.QueryRow(
+	err = database.DB.QueryRow(
 		"SELECT COUNT(*) FROM post_likes WHERE user_id = ? AND post_id = ?",
 		userID, id,
 	).Scan(&count)
@@ -585,6 +591,18 @@ func LikePost(c *gin.Context) {
 			return
 		}
 
+		// 给帖子作者发放被点赞奖励（同一用户对同一帖子只奖励一次）
+		if postUserID != userID.(int64) {
+			_, err = grantReward(tx, postUserID, rewardActionReceivedLike, fmt.Sprintf("post_like:%s:%d", id, userID))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.Response{
+					Code:    500,
+					Message: "发放点赞奖励失败: " + err.Error(),
+				})
+				return
+			}
+		}
+
 		message = "点赞成功"
 		isLiked = true
 	}
@@ -701,11 +719,19 @@ func CoinPost(c *gin.Context) {
 
 	// 可以从请求体中获取投币数量
 	var req struct {
-		Amount int `json:"amount" binding:"required,min=1,max=10"`
+		Amount  int    `json:"amount" binding:"required,min=1,max=10"`
+		Message string `json:"message"` // 打赏留言（可选）
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		req.Amount = 1 // 默认投1个币
 	}
+	if !validTipMessage(req.Message) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: fmt.Sprintf("留言不能超过%d个字符", maxTipMessageLength),
+		})
+		return
+	}
 
 	// 开始事务
 	tx, err := database.DB.Begin()
@@ -755,24 +781,49 @@ func CoinPost(c *gin.Context) {
 		return
 	}
 
-	// 如果不是给自己投币，则进行硬币转移
+	// 如果不是给自己投币，则进行硬币转移（记入硬币流水）
 	if postUserID != userID.(int64) {
-		// 扣除投币者硬币
-		_, err = tx.Exec("UPDATE users SET coins = coins - ? WHERE id = ?", req.Amount, userID)
+		postID, _ := strconv.ParseInt(id, 10, 64)
+		txNo, err := transferCoins(tx, coinTransfer{
+			FromUserID:     userID.(int64),
+			ToUserID:       postUserID,
+			Amount:         req.Amount,
+			Type:           coinTxCoinPost,
+			RefType:        "post",
+			RefID:          postID,
+			IdempotencyKey: coinIdempotencyKey(c, coinTxCoinPost, userID.(int64), "post", postID),
+			Remark:         "投币帖子",
+		})
+		if err != nil {
+			respondCoinTransferError(c, err, "投币失败")
+			return
+		}
+
+		// 记录打赏
+		err = recordTip(tx, models.Tip{
+			TxNo:           txNo,
+			TipperID:       userID.(int64),
+			ReceiverID:     postUserID,
+			TargetType:     tipTargetPost,
+			TargetID:       postID,
+			Amount:         req.Amount,
+			ReceiverAmount: req.Amount,
+			Message:        req.Message,
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
-				Message: "扣除硬币失败: " + err.Error(),
+				Message: "记录打赏失败: " + err.Error(),
 			})
 			return
 		}
 
-		// 给帖子作者增加硬币
-		_, err = tx.Exec("UPDATE users SET coins = coins + ? WHERE id = ?", req.Amount, postUserID)
+		// 给帖子作者发放被投币奖励
+		_, err = grantReward(tx, postUserID, rewardActionReceivedCoin, "coin:"+txNo)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.Response{
 				Code:    500,
-				Message: "增加作者硬币失败: " + err.Error(),
+				Message: "发放投币奖励失败: " + err.Error(),
 			})
 			return
 		}
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"TaruApp/audit"
+	"TaruApp/database"
+	"TaruApp/middleware"
+	"TaruApp/models"
+	"TaruApp/rbac"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoadUserRestrictions 启动时加载受限账号，认证中间件据此拦截被暂停和封禁的用户
+func LoadUserRestrictions() error {
+	rows, err := database.DB.Query(`
+		SELECT id, status, status_until, COALESCE(status_reason, ''), COALESCE(status_by, 0), status_at
+		FROM users
+		WHERE status IS NOT NULL AND status != ? AND (status_until IS NULL OR status_until > ?)
+	`, models.UserStatusActive, formatDBTime(time.Now()))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		var restriction models.UserRestriction
+		if err := rows.Scan(&userID, &restriction.Status, &restriction.Until, &restriction.Reason, &restriction.OperatorID, &restriction.CreatedAt); err == nil {
+			middleware.SetUserRestriction(userID, restriction)
+		}
+	}
+	return rows.Err()
+}
+
+// respondIfLoginBlocked 账号被暂停或封禁时返回 403（登录、刷新令牌等不经过认证中间件的接口使用）
+func respondIfLoginBlocked(c *gin.Context, userID int64) bool {
+	restriction, ok := middleware.ActiveRestriction(userID)
+	if !ok || !middleware.IsLoginBlocked(restriction) {
+		return false
+	}
+	middleware.AbortRestricted(c, restriction)
+	return true
+}
+
+// parseRestrictionTarget 解析目标用户ID，检查用户存在、不是自己，且操作者拥有目标用户的全部权限
+func parseRestrictionTarget(c *gin.Context) (int64, bool) {
+	targetID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "用户ID无效",
+		})
+		return 0, false
+	}
+
+	var count int
+	database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", targetID).Scan(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "用户不存在",
+		})
+		return 0, false
+	}
+
+	if targetID == c.GetInt64("user_id") {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "不能修改自己的账号状态",
+		})
+		return 0, false
+	}
+
+	// 不能限制权限比自己多的用户（如版主不能封禁管理员）
+	owned, err := rbac.UserPermissions(targetID)
+	if err == nil {
+		permissions := make([]string, 0, len(owned))
+		for perm := range owned {
+			permissions = append(permissions, perm)
+		}
+		err = checkGrantable(c, permissions)
+	}
+	if err == errGrantForbidden {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "不能限制权限比自己多的用户",
+		})
+		return 0, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询权限失败: " + err.Error(),
+		})
+		return 0, false
+	}
+	return targetID, true
+}
+
+// setUserStatus 修改账号状态并记录变更
+func setUserStatus(userID int64, restriction models.UserRestriction) error {
+	var until any
+	if restriction.Until != nil {
+		until = formatDBTime(*restriction.Until)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE users SET status = ?, status_until = ?, status_reason = ?, status_by = ?, status_at = ? WHERE id = ?",
+		restriction.Status, until, restriction.Reason, restriction.OperatorID, formatDBTime(restriction.CreatedAt), userID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO user_restrictions (user_id, status, until, reason, operator_id, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, restriction.Status, until, restriction.Reason, restriction.OperatorID, formatDBTime(restriction.CreatedAt),
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	middleware.SetUserRestriction(userID, restriction)
+	return nil
+}
+
+// RestrictUser 禁言、暂停或封禁用户
+func RestrictUser(c *gin.Context) {
+	var req models.RestrictUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.Duration == 0 && req.Status != models.UserStatusBanned {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "禁言和暂停必须设置时长",
+		})
+		return
+	}
+
+	targetID, ok := parseRestrictionTarget(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	restriction := models.UserRestriction{
+		Status:     req.Status,
+		Reason:     req.Reason,
+		OperatorID: c.GetInt64("user_id"),
+		CreatedAt:  now,
+	}
+	if req.Duration > 0 {
+		until := now.Add(time.Duration(req.Duration) * time.Minute)
+		restriction.Until = &until
+	}
+
+	if current, ok := middleware.ActiveRestriction(targetID); ok {
+		audit.SetBefore(c, current)
+	}
+	audit.SetAfter(c, restriction)
+	if err := setUserStatus(targetID, restriction); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "修改账号状态失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "修改账号状态成功",
+		Data:    restriction,
+	})
+}
+
+// LiftUserRestriction 解除账号限制
+func LiftUserRestriction(c *gin.Context) {
+	var req models.LiftRestrictionRequest
+	// 请求体可以为空
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "请求参数错误: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	targetID, ok := parseRestrictionTarget(c)
+	if !ok {
+		return
+	}
+
+	current, restricted := middleware.ActiveRestriction(targetID)
+	if !restricted {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该账号当前没有限制",
+		})
+		return
+	}
+
+	restriction := models.UserRestriction{
+		Status:     models.UserStatusActive,
+		Reason:     req.Reason,
+		OperatorID: c.GetInt64("user_id"),
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	audit.SetBefore(c, current)
+	audit.SetAfter(c, restriction)
+	if err := setUserStatus(targetID, restriction); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "解除账号限制失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "解除账号限制成功",
+	})
+}
+
+// GetUserRestrictions 获取用户当前的限制状态和变更记录
+func GetUserRestrictions(c *gin.Context) {
+	targetID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "用户ID无效",
+		})
+		return
+	}
+
+	var count int
+	database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", targetID).Scan(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "用户不存在",
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT r.id, r.user_id, r.status, r.until, COALESCE(r.reason, ''), r.operator_id, COALESCE(u.username, ''), r.created_at
+		FROM user_restrictions r
+		LEFT JOIN users u ON r.operator_id = u.id
+		WHERE r.user_id = ?
+		ORDER BY r.created_at DESC, r.id DESC
+	`, targetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询账号限制记录失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	records := []models.UserRestrictionRecord{}
+	for rows.Next() {
+		var record models.UserRestrictionRecord
+		if err := rows.Scan(&record.ID, &record.UserID, &record.Status, &record.Until, &record.Reason,
+			&record.OperatorID, &record.OperatorName, &record.CreatedAt); err == nil {
+			records = append(records, record)
+		}
+	}
+
+	var current *models.UserRestriction
+	if restriction, ok := middleware.ActiveRestriction(targetID); ok {
+		current = &restriction
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取账号限制记录成功",
+		Data: gin.H{
+			"current": current,
+			"history": records,
+		},
+	})
+}
+
+// GetRestrictedUsers 获取当前受限的用户列表
+func GetRestrictedUsers(c *gin.Context) {
+	page, pageSize, offset := parsePageParams(c, 20)
+	status := c.Query("status")
+
+	where := "u.status IS NOT NULL AND u.status != ? AND (u.status_until IS NULL OR u.status_until > ?)"
+	args := []any{models.UserStatusActive, formatDBTime(time.Now())}
+	if status != "" {
+		where += " AND u.status = ?"
+		args = append(args, status)
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM users u WHERE "+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询受限用户失败: " + err.Error(),
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT u.id, u.username, u.status, u.status_until, COALESCE(u.status_reason, ''), COALESCE(u.status_by, 0), COALESCE(o.username, ''), u.status_at
+		FROM users u
+		LEFT JOIN users o ON u.status_by = o.id
+		WHERE `+where+`
+		ORDER BY u.status_at DESC, u.id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, pageSize, offset)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询受限用户失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	list := []gin.H{}
+	for rows.Next() {
+		var userID int64
+		var username, operatorName string
+		var restriction models.UserRestriction
+		if err := rows.Scan(&userID, &username, &restriction.Status, &restriction.Until, &restriction.Reason,
+			&restriction.OperatorID, &operatorName, &restriction.CreatedAt); err != nil {
+			continue
+		}
+		list = append(list, gin.H{
+			"user_id":       userID,
+			"username":      username,
+			"restriction":   restriction,
+			"operator_name": operatorName,
+		})
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取受限用户成功",
+		Data: gin.H{
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+			"list":      list,
+		},
+	})
+}
@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"TaruApp/config"
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 奖励动作
+const (
+	rewardActionPost         = "post"          // 发帖
+	rewardActionComment      = "comment"       // 评论
+	rewardActionReceivedLike = "received_like" // 内容被点赞
+	rewardActionReceivedCoin = "received_coin" // 内容被投币
+	rewardActionCheckIn      = "checkin"       // 每日签到
+	rewardActionAppApproved  = "app_approved"  // 上传的应用审核通过
+)
+
+// rewardActions 所有奖励动作（按展示顺序）
+var rewardActions = []string{
+	rewardActionCheckIn,
+	rewardActionPost,
+	rewardActionComment,
+	rewardActionReceivedLike,
+	rewardActionReceivedCoin,
+	rewardActionAppApproved,
+}
+
+// rewardRule 单个动作的奖励规则
+type rewardRule struct {
+	Name     string `json:"name"`
+	Exp      int    `json:"exp"`
+	Coins    int    `json:"coins"`
+	DailyCap int    `json:"daily_cap"` // 每日最多奖励次数，0 表示不限
+}
+
+// levelUpRule 升级奖励规则，升到指定等级时发放
+type levelUpRule struct {
+	Level int `json:"level"`
+	Coins int `json:"coins"`
+}
+
+// rewardRuleSet 奖励规则集合
+type rewardRuleSet struct {
+	Actions map[string]rewardRule `json:"actions"`
+	LevelUp []levelUpRule         `json:"level_up"`
+}
+
+var (
+	rewardRulesMu     sync.RWMutex
+	rewardRules       = defaultRewardRules()
+	rewardRulesSource = "default"
+)
+
+// defaultRewardRules 内置默认奖励规则
+func defaultRewardRules() *rewardRuleSet {
+	return &rewardRuleSet{
+		Actions: map[string]rewardRule{
+			rewardActionCheckIn:      {Name: "每日签到", Exp: 25, Coins: 50, DailyCap: 1},
+			rewardActionPost:         {Name: "发布帖子", Exp: 5, DailyCap: 10},
+			rewardActionComment:      {Name: "发表评论", Exp: 2, DailyCap: 20},
+			rewardActionReceivedLike: {Name: "内容被点赞", Exp: 1, DailyCap: 50},
+			rewardActionReceivedCoin: {Name: "内容被投币", Exp: 2, DailyCap: 50},
+			rewardActionAppApproved:  {Name: "应用审核通过", Exp: 50, Coins: 20},
+		},
+		LevelUp: []levelUpRule{
+			{Level: 2, Coins: 20},
+			{Level: 3, Coins: 50},
+			{Level: 4, Coins: 100},
+			{Level: 5, Coins: 200},
+		},
+	}
+}
+
+// currentRewardRules 获取当前生效的奖励规则（返回值只读）
+func currentRewardRules() *rewardRuleSet {
+	rewardRulesMu.RLock()
+	defer rewardRulesMu.RUnlock()
+	return rewardRules
+}
+
+// readRewardRules 读取奖励规则文件，文件中的动作覆盖默认规则，未出现的动作沿用默认规则
+func readRewardRules(path string) (*rewardRuleSet, string, error) {
+	rules := defaultRewardRules()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return rules, "default", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	var fileRules rewardRuleSet
+	if err := json.Unmarshal(data, &fileRules); err != nil {
+		return nil, "", fmt.Errorf("解析奖励规则文件失败: %v", err)
+	}
+
+	for action, rule := range fileRules.Actions {
+		if !utils.Contains(rewardActions, action) {
+			return nil, "", fmt.Errorf("未知的奖励动作: %s", action)
+		}
+		if rule.Exp < 0 || rule.Coins < 0 || rule.DailyCap < 0 {
+			return nil, "", fmt.Errorf("奖励动作 %s 的数值不能为负数", action)
+		}
+		if rule.Name == "" {
+			rule.Name = rules.Actions[action].Name
+		}
+		rules.Actions[action] = rule
+	}
+
+	if fileRules.LevelUp != nil {
+		for _, rule := range fileRules.LevelUp {
+			if rule.Level < 2 || rule.Coins < 0 {
+				return nil, "", fmt.Errorf("升级奖励配置错误: 等级必须大于1且硬币不能为负数")
+			}
+		}
+		rules.LevelUp = fileRules.LevelUp
+	}
+	sort.Slice(rules.LevelUp, func(i, j int) bool {
+		return rules.LevelUp[i].Level < rules.LevelUp[j].Level
+	})
+
+	return rules, path, nil
+}
+
+// LoadRewardRules 从配置文件加载奖励规则，加载失败时保留当前规则
+func LoadRewardRules(path string) error {
+	rules, source, err := readRewardRules(path)
+	if err != nil {
+		return err
+	}
+
+	rewardRulesMu.Lock()
+	rewardRules = rules
+	rewardRulesSource = source
+	rewardRulesMu.Unlock()
+
+	if source == "default" {
+		log.Printf("奖励规则文件 %s 不存在，使用内置默认规则", path)
+	} else {
+		log.Printf("✓ 已加载奖励规则: %s", path)
+	}
+	return nil
+}
+
+// rewardResult 一次奖励的发放结果
+type rewardResult struct {
+	Exp          int  // 本次获得的经验
+	Coins        int  // 本次获得的硬币
+	Capped       bool // 是否因达到每日上限而未发放
+	TotalExp     int  // 发放后的总经验
+	UserLevel    int  // 发放后的用户等级
+	LeveledUp    bool // 是否升级
+	LevelUpCoins int  // 升级奖励的硬币
+
+	NewBadges []models.UserBadge // 本次新获得的徽章
+}
+
+// grantReward 在事务中按规则给用户发放某个动作的奖励，重新计算用户等级并检查相关成就
+// refKey 标识触发奖励的对象，同一用户同一动作同一 refKey 只奖励一次（防止反复点赞/取消刷奖励）
+func grantReward(tx *sql.Tx, userID int64, action, refKey string) (rewardResult, error) {
+	var result rewardResult
+	rules := currentRewardRules()
+
+	rule := rules.Actions[action]
+	if rule.Exp > 0 || rule.Coins > 0 {
+		if err := applyRewardRule(tx, userID, action, refKey, rule, &result); err != nil {
+			return result, err
+		}
+	}
+
+	if err := refreshUserLevel(tx, userID, rules, &result); err != nil {
+		return result, err
+	}
+
+	// 检查与该动作相关的成就
+	metrics := append([]string{}, rewardActionMetrics[action]...)
+	if result.LeveledUp {
+		metrics = append(metrics, achievementMetricUserLevel)
+	}
+	badges, err := checkAchievements(tx, userID, metrics...)
+	if err != nil {
+		return result, err
+	}
+	result.NewBadges = badges
+	return result, nil
+}
+
+// applyRewardRule 检查去重和每日上限后记录奖励并发放经验、硬币
+func applyRewardRule(tx *sql.Tx, userID int64, action, refKey string, rule rewardRule, result *rewardResult) error {
+	today := time.Now().Format("2006-01-02")
+
+	var count int
+	if err := tx.QueryRow(
+		"SELECT COUNT(*) FROM reward_logs WHERE user_id = ? AND action = ? AND ref_key = ?",
+		userID, action, refKey,
+	).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if rule.DailyCap > 0 {
+		if err := tx.QueryRow(
+			"SELECT COUNT(*) FROM reward_logs WHERE user_id = ? AND action = ? AND reward_date = ?",
+			userID, action, today,
+		).Scan(&count); err != nil {
+			return err
+		}
+		if count >= rule.DailyCap {
+			result.Capped = true
+			return nil
+		}
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO reward_logs (user_id, action, ref_key, exp, coins, reward_date) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, action, refKey, rule.Exp, rule.Coins, today,
+	)
+	if err != nil {
+		return err
+	}
+	logID, _ := res.LastInsertId()
+
+	if rule.Exp > 0 {
+		if _, err := tx.Exec("UPDATE users SET exp = exp + ? WHERE id = ?", rule.Exp, userID); err != nil {
+			return err
+		}
+	}
+
+	if rule.Coins > 0 {
+		_, err := transferCoins(tx, coinTransfer{
+			FromUserID:     systemAccountID,
+			ToUserID:       userID,
+			Amount:         rule.Coins,
+			Type:           coinTxReward,
+			RefType:        action,
+			RefID:          logID,
+			IdempotencyKey: fmt.Sprintf("%s:%d:%s:%s", coinTxReward, userID, action, refKey),
+			Remark:         rule.Name + "奖励",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	result.Exp = rule.Exp
+	result.Coins = rule.Coins
+	return nil
+}
+
+// refreshUserLevel 根据经验重新计算用户等级，升级时发放升级奖励
+func refreshUserLevel(tx *sql.Tx, userID int64, rules *rewardRuleSet, result *rewardResult) error {
+	var exp, oldLevel int
+	if err := tx.QueryRow("SELECT exp, user_level FROM users WHERE id = ?", userID).Scan(&exp, &oldLevel); err != nil {
+		return err
+	}
+
+	newLevel := utils.CalculateUserLevel(exp)
+	result.TotalExp = exp
+	result.UserLevel = newLevel
+	if newLevel == oldLevel {
+		return nil
+	}
+
+	if _, err := tx.Exec("UPDATE users SET user_level = ? WHERE id = ?", newLevel, userID); err != nil {
+		return err
+	}
+	if newLevel < oldLevel {
+		return nil
+	}
+
+	result.LeveledUp = true
+	for _, rule := range rules.LevelUp {
+		if rule.Level <= oldLevel || rule.Level > newLevel || rule.Coins == 0 {
+			continue
+		}
+		// 每个等级的升级奖励只发放一次
+		_, err := transferCoins(tx, coinTransfer{
+			FromUserID:     systemAccountID,
+			ToUserID:       userID,
+			Amount:         rule.Coins,
+			Type:           coinTxLevelUp,
+			RefType:        "level",
+			RefID:          int64(rule.Level),
+			IdempotencyKey: fmt.Sprintf("%s:%d:%d", coinTxLevelUp, userID, rule.Level),
+			Remark:         fmt.Sprintf("升级到 Lv%d 奖励", rule.Level),
+		})
+		if err == errDuplicateCoinTransaction {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		result.LevelUpCoins += rule.Coins
+	}
+	return nil
+}
+
+// GetRewardRules 获取当前奖励规则
+func GetRewardRules(c *gin.Context) {
+	rules := currentRewardRules()
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取奖励规则成功",
+		Data: gin.H{
+			"actions":  rewardProgressList(rules, nil),
+			"level_up": rules.LevelUp,
+		},
+	})
+}
+
+// GetTodayRewards 获取今日各动作的奖励进度
+func GetTodayRewards(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	today := time.Now().Format("2006-01-02")
+
+	rows, err := database.DB.Query(`
+		SELECT action, COUNT(*), COALESCE(SUM(exp), 0), COALESCE(SUM(coins), 0)
+		FROM reward_logs
+		WHERE user_id = ? AND reward_date = ?
+		GROUP BY action
+	`, userID, today)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询今日奖励失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	earned := make(map[string]models.RewardProgressItem)
+	for rows.Next() {
+		var action string
+		var item models.RewardProgressItem
+		if err := rows.Scan(&action, &item.Count, &item.EarnedExp, &item.EarnedCoins); err != nil {
+			continue
+		}
+		earned[action] = item
+	}
+
+	var exp, userLevel int
+	err = database.DB.QueryRow("SELECT exp, user_level FROM users WHERE id = ?", userID).Scan(&exp, &userLevel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询用户信息失败: " + err.Error(),
+		})
+		return
+	}
+	currentLevelExp, nextLevelExp, progress := utils.GetExpProgress(exp, userLevel)
+
+	items := rewardProgressList(currentRewardRules(), earned)
+	totalExp, totalCoins := 0, 0
+	for _, item := range items {
+		totalExp += item.EarnedExp
+		totalCoins += item.EarnedCoins
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取今日奖励成功",
+		Data: gin.H{
+			"date":              today,
+			"actions":           items,
+			"today_exp":         totalExp,
+			"today_coins":       totalCoins,
+			"exp":               exp,
+			"user_level":        userLevel,
+			"current_level_exp": currentLevelExp,
+			"next_level_exp":    nextLevelExp,
+			"progress":          progress,
+		},
+	})
+}
+
+// rewardProgressList 按展示顺序生成各动作的规则和进度
+func rewardProgressList(rules *rewardRuleSet, earned map[string]models.RewardProgressItem) []models.RewardProgressItem {
+	items := make([]models.RewardProgressItem, 0, len(rewardActions))
+	for _, action := range rewardActions {
+		rule := rules.Actions[action]
+		item := earned[action]
+		item.Action = action
+		item.Name = rule.Name
+		item.Exp = rule.Exp
+		item.Coins = rule.Coins
+		item.DailyCap = rule.DailyCap
+		item.Remaining = -1
+		if rule.DailyCap > 0 {
+			item.Remaining = rule.DailyCap - item.Count
+			if item.Remaining < 0 {
+				item.Remaining = 0
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// ReloadRewardRules 重新加载奖励规则文件（管理员权限）
+func ReloadRewardRules(c *gin.Context) {
+	if err := LoadRewardRules(config.AppConfig.RewardRulesPath); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "加载奖励规则失败: " + err.Error(),
+		})
+		return
+	}
+
+	rewardRulesMu.RLock()
+	source := rewardRulesSource
+	rewardRulesMu.RUnlock()
+
+	rules := currentRewardRules()
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "奖励规则已重新加载",
+		Data: gin.H{
+			"source":   source,
+			"actions":  rewardProgressList(rules, nil),
+			"level_up": rules.LevelUp,
+		},
+	})
+}
@@ -0,0 +1,653 @@
+package handlers
+
+import (
+	"TaruApp/audit"
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/rbac"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// legacyAdminLevel 管理员角色对应的 users.level 值（兼容仍然读取 level 字段的客户端）
+const legacyAdminLevel = 50
+
+var (
+	errRoleNotFound   = errors.New("角色不存在")
+	errLastAdmin      = errors.New("至少需要保留一名管理员")
+	errGrantForbidden = errors.New("不能授予自己没有的权限")
+)
+
+// validRoleName 角色标识只能包含小写字母、数字、下划线和连字符
+func validRoleName(name string) bool {
+	for _, r := range name {
+		if !(r == '_' || r == '-' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z')) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// normalizePermissions 校验并去重权限列表
+func normalizePermissions(permissions []string) ([]string, error) {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, perm := range permissions {
+		if !rbac.IsValidPermission(perm) {
+			return nil, errors.New("未知的权限: " + perm)
+		}
+		if !seen[perm] {
+			seen[perm] = true
+			result = append(result, perm)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// canGrantPermissions 检查操作者是否拥有全部指定权限，避免通过角色提升自己的权限
+func canGrantPermissions(operatorID int64, permissions []string) (bool, error) {
+	owned, err := rbac.UserPermissions(operatorID)
+	if err != nil {
+		return false, err
+	}
+	if owned[rbac.PermAll] {
+		return true, nil
+	}
+	for _, perm := range permissions {
+		if perm == rbac.PermAll || !owned[perm] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// loadRolePermissions 查询角色的权限列表
+func loadRolePermissions(roleID int64) ([]string, error) {
+	rows, err := database.DB.Query("SELECT permission FROM role_permissions WHERE role_id = ? ORDER BY permission", roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var perm string
+		if err := rows.Scan(&perm); err == nil {
+			permissions = append(permissions, perm)
+		}
+	}
+	return permissions, rows.Err()
+}
+
+// loadRole 查询角色
+func loadRole(roleID int64) (*models.Role, error) {
+	var role models.Role
+	err := database.DB.QueryRow(
+		"SELECT id, name, display_name, COALESCE(description, ''), is_system, created_at FROM roles WHERE id = ?", roleID,
+	).Scan(&role.ID, &role.Name, &role.DisplayName, &role.Description, &role.IsSystem, &role.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	role.Permissions, err = loadRolePermissions(roleID)
+	return &role, err
+}
+
+// grantUserRole 为用户分配角色，管理员角色同时同步 users.level
+func grantUserRole(userID int64, role *models.Role, grantedBy int64) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"INSERT OR IGNORE INTO user_roles (user_id, role_id, granted_by) VALUES (?, ?, ?)",
+		userID, role.ID, grantedBy,
+	)
+	if err != nil {
+		return err
+	}
+	if role.Name == rbac.RoleAdmin {
+		_, err = tx.Exec(
+			"UPDATE users SET level = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND level < ?",
+			legacyAdminLevel, userID, legacyAdminLevel,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	rbac.Invalidate(userID)
+	return nil
+}
+
+// revokeUserRole 移除用户的角色，不能移除最后一名管理员
+func revokeUserRole(userID int64, role *models.Role) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if role.Name == rbac.RoleAdmin {
+		var admins int
+		err = tx.QueryRow(
+			"SELECT COUNT(*) FROM user_roles WHERE role_id = ? AND user_id != ?", role.ID, userID,
+		).Scan(&admins)
+		if err != nil {
+			return err
+		}
+		if admins == 0 {
+			return errLastAdmin
+		}
+		_, err = tx.Exec("UPDATE users SET level = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND level >= ?", userID, legacyAdminLevel)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userID, role.ID); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	rbac.Invalidate(userID)
+	return nil
+}
+
+// loadRoleByName 按名称查询角色
+func loadRoleByName(name string) (*models.Role, error) {
+	var roleID int64
+	err := database.DB.QueryRow("SELECT id FROM roles WHERE name = ?", name).Scan(&roleID)
+	if err == sql.ErrNoRows {
+		return nil, errRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loadRole(roleID)
+}
+
+// respondRoleError 根据角色相关错误写入响应
+func respondRoleError(c *gin.Context, err error, message string) {
+	switch err {
+	case errRoleNotFound:
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+	case errLastAdmin:
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+	case errGrantForbidden:
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: message + ": " + err.Error(),
+		})
+	}
+}
+
+// checkGrantable 检查当前用户能否授予这些权限，不能时返回 errGrantForbidden
+func checkGrantable(c *gin.Context, permissions []string) error {
+	operatorID, _ := c.Get("user_id")
+	ok, err := canGrantPermissions(operatorID.(int64), permissions)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errGrantForbidden
+	}
+	return nil
+}
+
+// GetPermissions 获取所有可分配的权限
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取权限列表成功",
+		Data:    rbac.Permissions,
+	})
+}
+
+// GetRoles 获取角色列表
+func GetRoles(c *gin.Context) {
+	rows, err := database.DB.Query(`
+		SELECT r.id, r.name, r.display_name, COALESCE(r.description, ''), r.is_system, r.created_at,
+			(SELECT COUNT(*) FROM user_roles ur WHERE ur.role_id = r.id)
+		FROM roles r
+		ORDER BY r.is_system DESC, r.id
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询角色失败: " + err.Error(),
+		})
+		return
+	}
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.DisplayName, &role.Description, &role.IsSystem, &role.CreatedAt, &role.UserCount); err != nil {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	rows.Close()
+
+	for i := range roles {
+		roles[i].Permissions, _ = loadRolePermissions(roles[i].ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取角色列表成功",
+		Data:    roles,
+	})
+}
+
+// CreateRole 创建角色
+func CreateRole(c *gin.Context) {
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if !validRoleName(req.Name) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "角色标识只能包含小写字母、数字、下划线和连字符",
+		})
+		return
+	}
+	permissions, err := normalizePermissions(req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err = checkGrantable(c, permissions); err != nil {
+		respondRoleError(c, err, "创建角色失败")
+		return
+	}
+
+	var count int
+	database.DB.QueryRow("SELECT COUNT(*) FROM roles WHERE name = ?", req.Name).Scan(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "角色标识已存在",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondRoleError(c, err, "创建角色失败")
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO roles (name, display_name, description) VALUES (?, ?, ?)",
+		req.Name, req.DisplayName, req.Description,
+	)
+	if err != nil {
+		respondRoleError(c, err, "创建角色失败")
+		return
+	}
+	roleID, _ := result.LastInsertId()
+	for _, perm := range permissions {
+		if _, err = tx.Exec("INSERT INTO role_permissions (role_id, permission) VALUES (?, ?)", roleID, perm); err != nil {
+			respondRoleError(c, err, "创建角色失败")
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		respondRoleError(c, err, "创建角色失败")
+		return
+	}
+
+	audit.SetTarget(c, "role", roleID)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "创建角色成功",
+		Data: gin.H{
+			"id": roleID,
+		},
+	})
+}
+
+// UpdateRole 更新角色的名称、说明和权限（管理员角色的权限不能修改）
+func UpdateRole(c *gin.Context) {
+	roleID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "角色ID无效",
+		})
+		return
+	}
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	role, err := loadRole(roleID)
+	if err != nil {
+		respondRoleError(c, err, "更新角色失败")
+		return
+	}
+	audit.SetBefore(c, role)
+
+	permissions := role.Permissions
+	if role.Name != rbac.RoleAdmin {
+		if permissions, err = normalizePermissions(req.Permissions); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: err.Error(),
+			})
+			return
+		}
+		if err = checkGrantable(c, permissions); err != nil {
+			respondRoleError(c, err, "更新角色失败")
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondRoleError(c, err, "更新角色失败")
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE roles SET display_name = ?, description = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		req.DisplayName, req.Description, roleID,
+	)
+	if err != nil {
+		respondRoleError(c, err, "更新角色失败")
+		return
+	}
+	if role.Name != rbac.RoleAdmin {
+		if _, err = tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", roleID); err != nil {
+			respondRoleError(c, err, "更新角色失败")
+			return
+		}
+		for _, perm := range permissions {
+			if _, err = tx.Exec("INSERT INTO role_permissions (role_id, permission) VALUES (?, ?)", roleID, perm); err != nil {
+				respondRoleError(c, err, "更新角色失败")
+				return
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		respondRoleError(c, err, "更新角色失败")
+		return
+	}
+	rbac.InvalidateAll()
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "更新角色成功",
+	})
+}
+
+// DeleteRole 删除角色（系统角色不能删除），同时移除所有用户的该角色
+func DeleteRole(c *gin.Context) {
+	roleID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "角色ID无效",
+		})
+		return
+	}
+
+	role, err := loadRole(roleID)
+	if err != nil {
+		respondRoleError(c, err, "删除角色失败")
+		return
+	}
+	audit.SetBefore(c, role)
+	if role.IsSystem {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "系统角色不能删除",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondRoleError(c, err, "删除角色失败")
+		return
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM user_roles WHERE role_id = ?",
+		"DELETE FROM role_permissions WHERE role_id = ?",
+		"DELETE FROM roles WHERE id = ?",
+	} {
+		if _, err = tx.Exec(query, roleID); err != nil {
+			respondRoleError(c, err, "删除角色失败")
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		respondRoleError(c, err, "删除角色失败")
+		return
+	}
+	rbac.InvalidateAll()
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "删除角色成功",
+	})
+}
+
+// GetUserRoles 获取用户的角色
+func GetUserRoles(c *gin.Context) {
+	userID := c.Param("id")
+
+	rows, err := database.DB.Query(`
+		SELECT r.id, r.name, r.display_name, COALESCE(r.description, ''), r.is_system, ur.created_at
+		FROM user_roles ur
+		JOIN roles r ON ur.role_id = r.id
+		WHERE ur.user_id = ?
+		ORDER BY r.id
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询用户角色失败: " + err.Error(),
+		})
+		return
+	}
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.DisplayName, &role.Description, &role.IsSystem, &role.CreatedAt); err != nil {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	rows.Close()
+
+	for i := range roles {
+		roles[i].Permissions, _ = loadRolePermissions(roles[i].ID)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取用户角色成功",
+		Data:    roles,
+	})
+}
+
+// AssignUserRole 为用户分配角色（只能分配自己拥有全部权限的角色）
+func AssignUserRole(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "用户ID无效",
+		})
+		return
+	}
+	var req models.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var count int
+	database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", userID).Scan(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "用户不存在",
+		})
+		return
+	}
+
+	role, err := loadRole(req.RoleID)
+	if err == nil {
+		err = checkGrantable(c, role.Permissions)
+	}
+	if err == nil {
+		operatorID, _ := c.Get("user_id")
+		err = grantUserRole(userID, role, operatorID.(int64))
+	}
+	if err != nil {
+		respondRoleError(c, err, "分配角色失败")
+		return
+	}
+	audit.SetAfter(c, gin.H{"role_id": role.ID, "role": role.Name})
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "分配角色成功",
+	})
+}
+
+// RemoveUserRole 移除用户的角色
+func RemoveUserRole(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "用户ID无效",
+		})
+		return
+	}
+	roleID, err := strconv.ParseInt(c.Param("role_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "角色ID无效",
+		})
+		return
+	}
+
+	role, err := loadRole(roleID)
+	if err == nil {
+		err = checkGrantable(c, role.Permissions)
+	}
+	if err == nil {
+		err = revokeUserRole(userID, role)
+	}
+	if err != nil {
+		respondRoleError(c, err, "移除角色失败")
+		return
+	}
+	audit.SetBefore(c, gin.H{"role_id": role.ID, "role": role.Name})
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "移除角色成功",
+	})
+}
+
+// GetMyPermissions 获取当前用户的角色和权限
+func GetMyPermissions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	rows, err := database.DB.Query(`
+		SELECT r.name FROM user_roles ur JOIN roles r ON ur.role_id = r.id
+		WHERE ur.user_id = ? ORDER BY r.id
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询角色失败: " + err.Error(),
+		})
+		return
+	}
+	roles := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			roles = append(roles, name)
+		}
+	}
+	rows.Close()
+
+	owned, err := rbac.UserPermissions(userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询权限失败: " + err.Error(),
+		})
+		return
+	}
+	// 拥有全部权限时展开为具体的权限列表，方便客户端判断
+	permissions := []string{}
+	for _, p := range rbac.Permissions {
+		if owned[rbac.PermAll] || owned[p.Name] {
+			permissions = append(permissions, p.Name)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取权限成功",
+		Data: gin.H{
+			"roles":       roles,
+			"permissions": permissions,
+		},
+	})
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"TaruApp/config"
+	"TaruApp/database"
+	"TaruApp/middleware"
+	"TaruApp/models"
+	"TaruApp/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// revokedSessionRetention 已吊销的会话保留多久后被清理
+const revokedSessionRetention = 24 * time.Hour
+
+// startSession 创建新的登录会话并签发第一对令牌，twoFactor 表示本次登录是否通过了两步验证
+func startSession(db sqlExecer, c *gin.Context, userID int64, username string, level int, deviceName string, twoFactor bool) (models.TokenPair, error) {
+	sessionID, err := utils.RandomHex(16)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	pair, err := issueTokenPair(db, userID, username, level, sessionID, twoFactor)
+	if err != nil {
+		return pair, err
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO sessions (id, user_id, device_name, user_agent, ip, expires_at, two_factor) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		sessionID, userID, deviceName, c.Request.UserAgent(), c.ClientIP(), formatDBTime(pair.RefreshExpiresAt), twoFactor,
+	)
+	return pair, err
+}
+
+// touchSession 刷新令牌时更新会话的活跃时间、来源和过期时间
+func touchSession(db sqlExecer, c *gin.Context, sessionID string, expiresAt time.Time) error {
+	_, err := db.Exec(
+		`UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP, user_agent = ?, ip = ?, expires_at = ?
+		WHERE id = ?`,
+		c.Request.UserAgent(), c.ClientIP(), formatDBTime(expiresAt), sessionID,
+	)
+	return err
+}
+
+// revokeSession 吊销登录会话：作废其刷新令牌，并让已签发的访问令牌立即失效
+func revokeSession(db sqlExecer, sessionID string) error {
+	_, err := db.Exec(
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL",
+		sessionID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(
+		"UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = ? AND revoked_at IS NULL",
+		sessionID,
+	)
+	if err != nil {
+		return err
+	}
+
+	middleware.RevokeSession(sessionID)
+	return nil
+}
+
+// revokeUserSessions 吊销用户的所有登录会话（exceptSessionID 不为空时保留该会话），返回吊销的会话数
+func revokeUserSessions(userID int64, exceptSessionID string) (int, error) {
+	rows, err := database.DB.Query(
+		"SELECT id FROM sessions WHERE user_id = ? AND id != ? AND revoked_at IS NULL",
+		userID, exceptSessionID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var sessionIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			sessionIDs = append(sessionIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range sessionIDs {
+		if err := revokeSession(database.DB, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(sessionIDs), nil
+}
+
+// LoadRevokedSessions 启动时恢复最近被吊销的会话，避免重启后其访问令牌重新生效
+func LoadRevokedSessions() error {
+	since := time.Now().Add(-time.Duration(config.AppConfig.AccessTokenTTL) * time.Minute)
+	rows, err := database.DB.Query(
+		"SELECT id FROM sessions WHERE revoked_at IS NOT NULL AND revoked_at > ?",
+		formatDBTime(since),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			middleware.RevokeSession(id)
+		}
+	}
+	return rows.Err()
+}
+
+// cleanupSessions 清理过期的会话和刷新令牌、吊销超过保留期的会话，以及过期的登录挑战和第三方授权请求
+func cleanupSessions() (int64, error) {
+	now := formatDBTime(time.Now())
+	revokedBefore := formatDBTime(time.Now().Add(-revokedSessionRetention))
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM refresh_tokens
+		WHERE expires_at <= ?
+		   OR family_id IN (SELECT id FROM sessions WHERE expires_at <= ? OR revoked_at <= ?)
+	`, now, now, revokedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("DELETE FROM sessions WHERE expires_at <= ? OR revoked_at <= ?", now, revokedBefore)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec("DELETE FROM login_challenges WHERE expires_at <= ?", now); err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec("DELETE FROM oauth_states WHERE expires_at <= ?", now); err != nil {
+		return 0, err
+	}
+	deleted, _ := result.RowsAffected()
+	return deleted, tx.Commit()
+}
+
+// StartSessionCleanupJob 启动定时清理过期会话的后台任务
+func StartSessionCleanupJob(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			deleted, err := cleanupSessions()
+			if err != nil {
+				log.Printf("清理过期会话失败: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("清理过期会话完成: 删除 %d 个会话", deleted)
+			}
+		}
+	}()
+}
+
+// GetSessions 获取当前用户的登录设备列表
+func GetSessions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	currentSessionID, _ := c.Get("session_id")
+
+	rows, err := database.DB.Query(`
+		SELECT id, COALESCE(device_name, ''), COALESCE(user_agent, ''), COALESCE(ip, ''),
+			created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_seen_at DESC
+	`, userID, formatDBTime(time.Now()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询登录设备失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(
+			&session.ID, &session.DeviceName, &session.UserAgent, &session.IP,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt,
+		); err != nil {
+			continue
+		}
+		session.IsCurrent = session.ID == currentSessionID
+		sessions = append(sessions, session)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取登录设备成功",
+		Data:    sessions,
+	})
+}
+
+// RevokeSession 注销指定的登录设备
+func RevokeSession(c *gin.Context) {
+	sessionID := c.Param("id")
+	userID, _ := c.Get("user_id")
+
+	var count int
+	database.DB.QueryRow(
+		"SELECT COUNT(*) FROM sessions WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		sessionID, userID,
+	).Scan(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "登录会话不存在或已失效",
+		})
+		return
+	}
+
+	if err := revokeSession(database.DB, sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "注销登录设备失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "注销登录设备成功",
+	})
+}
+
+// RevokeOtherSessions 注销除当前设备以外的所有登录设备
+func RevokeOtherSessions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	currentSessionID, _ := c.Get("session_id")
+
+	revoked, err := revokeUserSessions(userID.(int64), currentSessionID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "注销其他设备失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: fmt.Sprintf("已注销 %d 个其他设备", revoked),
+		Data: gin.H{
+			"revoked": revoked,
+		},
+	})
+}
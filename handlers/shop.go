@@ -0,0 +1,693 @@
+package handlers
+
+import (
+	"TaruApp/audit"
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 商品类型
+const (
+	shopItemAvatarFrame       = "avatar_frame"       // 头像框
+	shopItemNameColor         = "name_color"         // 昵称颜色
+	shopItemProfileBackground = "profile_background" // 个人主页背景
+	shopItemMakeupCard        = "makeup_card"        // 补签卡
+	shopItemBoardTicket       = "board_ticket"       // 板块创建券
+)
+
+// cosmeticItemTypes 可装备的装扮类型，每种类型同时只能装备一个
+var cosmeticItemTypes = []string{shopItemAvatarFrame, shopItemNameColor, shopItemProfileBackground}
+
+var errItemNotOwned = errors.New("没有可用的道具")
+
+// shopItemColumns 查询商品的字段列表
+const shopItemColumns = `id, name, COALESCE(description, ''), type, COALESCE(value, ''), COALESCE(icon_url, ''),
+	price, stock, sold_count, per_user_limit, is_active, created_at, updated_at`
+
+// scanShopItem 扫描一行商品数据
+func scanShopItem(scanner interface{ Scan(...interface{}) error }, item *models.ShopItem) error {
+	return scanner.Scan(
+		&item.ID, &item.Name, &item.Description, &item.Type, &item.Value, &item.IconURL,
+		&item.Price, &item.Stock, &item.SoldCount, &item.PerUserLimit, &item.IsActive,
+		&item.CreatedAt, &item.UpdatedAt,
+	)
+}
+
+// loadUserCosmetics 批量查询用户已装备的装扮，没有装备任何装扮的用户不在结果中
+func loadUserCosmetics(userIDs []int64) map[int64]*models.UserCosmetics {
+	result := make(map[int64]*models.UserCosmetics)
+	if len(userIDs) == 0 {
+		return result
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(userIDs)), ", ")
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT ui.user_id, si.type, COALESCE(si.value, '')
+		FROM user_items ui
+		JOIN shop_items si ON ui.item_id = si.id
+		WHERE ui.is_equipped = 1 AND ui.user_id IN (`+placeholders+`)`,
+		args...,
+	)
+	if err != nil {
+		return result
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int64
+		var itemType, value string
+		if err := rows.Scan(&userID, &itemType, &value); err != nil {
+			continue
+		}
+		cosmetics, ok := result[userID]
+		if !ok {
+			cosmetics = &models.UserCosmetics{}
+			result[userID] = cosmetics
+		}
+		switch itemType {
+		case shopItemAvatarFrame:
+			cosmetics.AvatarFrame = value
+		case shopItemNameColor:
+			cosmetics.NameColor = value
+		case shopItemProfileBackground:
+			cosmetics.ProfileBackground = value
+		}
+	}
+	return result
+}
+
+// attachUserCosmetics 为用户列表填充已装备的装扮
+func attachUserCosmetics(users []models.User) {
+	ids := make([]int64, len(users))
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+	cosmetics := loadUserCosmetics(ids)
+	for i := range users {
+		users[i].Cosmetics = cosmetics[users[i].ID]
+	}
+}
+
+// attachPostCosmetics 为帖子列表填充发布者已装备的装扮
+func attachPostCosmetics(posts []models.Post) {
+	ids := make([]int64, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].UserID
+	}
+	cosmetics := loadUserCosmetics(ids)
+	for i := range posts {
+		posts[i].Cosmetics = cosmetics[posts[i].UserID]
+	}
+}
+
+// attachCommentCosmetics 为评论列表填充评论者已装备的装扮
+func attachCommentCosmetics(comments []models.Comment) {
+	ids := make([]int64, len(comments))
+	for i := range comments {
+		ids[i] = comments[i].UserID
+	}
+	cosmetics := loadUserCosmetics(ids)
+	for i := range comments {
+		comments[i].Cosmetics = cosmetics[comments[i].UserID]
+	}
+}
+
+// consumeUserItem 在事务中消耗用户一个指定类型的道具
+func consumeUserItem(tx *sql.Tx, userID int64, itemType string) error {
+	var userItemID int64
+	err := tx.QueryRow(`
+		SELECT ui.id FROM user_items ui
+		JOIN shop_items si ON ui.item_id = si.id
+		WHERE ui.user_id = ? AND si.type = ? AND ui.quantity > 0
+		ORDER BY ui.acquired_at ASC LIMIT 1
+	`, userID, itemType).Scan(&userItemID)
+	if err == sql.ErrNoRows {
+		return errItemNotOwned
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE user_items SET quantity = quantity - 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND quantity > 0",
+		userItemID,
+	)
+	return err
+}
+
+// GetShopItems 获取上架中的商品列表
+func GetShopItems(c *gin.Context) {
+	query := "SELECT " + shopItemColumns + " FROM shop_items WHERE is_active = 1"
+	var args []interface{}
+	if itemType := c.Query("type"); itemType != "" {
+		query += " AND type = ?"
+		args = append(args, itemType)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询商品失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.ShopItem{}
+	for rows.Next() {
+		var item models.ShopItem
+		if err := scanShopItem(rows, &item); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取商品列表成功",
+		Data:    items,
+	})
+}
+
+// BuyShopItem 购买商品
+func BuyShopItem(c *gin.Context) {
+	itemID := c.Param("id")
+	userID, _ := c.Get("user_id")
+	uid := userID.(int64)
+
+	var req models.BuyShopItemRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "请求参数错误: " + err.Error(),
+			})
+			return
+		}
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 || req.Quantity > 99 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "购买数量必须在1-99之间",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "购买失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var item models.ShopItem
+	err = scanShopItem(tx.QueryRow("SELECT "+shopItemColumns+" FROM shop_items WHERE id = ?", itemID), &item)
+	if err == sql.ErrNoRows || (err == nil && !item.IsActive) {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "商品不存在或已下架",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询商品失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 装扮只能拥有一个
+	if utils.Contains(cosmeticItemTypes, item.Type) {
+		if req.Quantity != 1 {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "装扮每次只能购买1个",
+			})
+			return
+		}
+		var owned int
+		tx.QueryRow(
+			"SELECT COUNT(*) FROM user_items WHERE user_id = ? AND item_id = ? AND quantity > 0",
+			uid, item.ID,
+		).Scan(&owned)
+		if owned > 0 {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "已拥有该装扮",
+			})
+			return
+		}
+	}
+
+	// 检查每人限购
+	if item.PerUserLimit > 0 {
+		var bought int
+		err = tx.QueryRow(
+			"SELECT COALESCE(SUM(quantity), 0) FROM shop_purchases WHERE user_id = ? AND item_id = ?",
+			uid, item.ID,
+		).Scan(&bought)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "查询购买记录失败: " + err.Error(),
+			})
+			return
+		}
+		if bought+req.Quantity > item.PerUserLimit {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: fmt.Sprintf("超过每人限购数量，每人限购%d个，已购买%d个", item.PerUserLimit, bought),
+			})
+			return
+		}
+	}
+
+	// 扣减库存（-1 表示不限库存）
+	result, err := tx.Exec(`
+		UPDATE shop_items
+		SET stock = CASE WHEN stock < 0 THEN stock ELSE stock - ? END,
+			sold_count = sold_count + ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND (stock < 0 OR stock >= ?)
+	`, req.Quantity, req.Quantity, item.ID, req.Quantity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "购买失败: " + err.Error(),
+		})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "库存不足",
+		})
+		return
+	}
+
+	// 支付硬币（由系统回收，记入硬币流水）
+	totalPrice := item.Price * req.Quantity
+	var txNo string
+	if totalPrice > 0 {
+		txNo, err = transferCoins(tx, coinTransfer{
+			FromUserID:     uid,
+			ToUserID:       systemAccountID,
+			Amount:         totalPrice,
+			Type:           coinTxShop,
+			RefType:        "shop_item",
+			RefID:          item.ID,
+			IdempotencyKey: coinIdempotencyKey(c, coinTxShop, uid, "shop_item", item.ID),
+			Remark:         "购买 " + item.Name,
+		})
+		if err != nil {
+			respondCoinTransferError(c, err, "购买失败")
+			return
+		}
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO shop_purchases (user_id, item_id, quantity, total_price, tx_no) VALUES (?, ?, ?, ?, ?)",
+		uid, item.ID, req.Quantity, totalPrice, txNo,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "记录购买失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 放入背包
+	_, err = tx.Exec(`
+		INSERT INTO user_items (user_id, item_id, quantity) VALUES (?, ?, ?)
+		ON CONFLICT(user_id, item_id) DO UPDATE SET quantity = quantity + excluded.quantity, updated_at = CURRENT_TIMESTAMP
+	`, uid, item.ID, req.Quantity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "放入背包失败: " + err.Error(),
+		})
+		return
+	}
+
+	var userCoins, owned int
+	tx.QueryRow("SELECT coins FROM users WHERE id = ?", uid).Scan(&userCoins)
+	tx.QueryRow("SELECT quantity FROM user_items WHERE user_id = ? AND item_id = ?", uid, item.ID).Scan(&owned)
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "购买失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "购买成功",
+		Data: gin.H{
+			"item_id":     item.ID,
+			"quantity":    req.Quantity,
+			"total_price": totalPrice,
+			"owned":       owned,
+			"user_coins":  userCoins,
+		},
+	})
+}
+
+// GetMyInventory 获取我的背包
+func GetMyInventory(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	query := `
+		SELECT ui.id, ui.item_id, si.name, si.type, COALESCE(si.value, ''), COALESCE(si.icon_url, ''),
+			ui.quantity, ui.is_equipped, ui.acquired_at
+		FROM user_items ui
+		JOIN shop_items si ON ui.item_id = si.id
+		WHERE ui.user_id = ? AND ui.quantity > 0`
+	args := []interface{}{userID}
+	if itemType := c.Query("type"); itemType != "" {
+		query += " AND si.type = ?"
+		args = append(args, itemType)
+	}
+	query += " ORDER BY ui.acquired_at DESC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询背包失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.UserItem{}
+	for rows.Next() {
+		var item models.UserItem
+		if err := rows.Scan(
+			&item.ID, &item.ItemID, &item.Name, &item.Type, &item.Value, &item.IconURL,
+			&item.Quantity, &item.IsEquipped, &item.AcquiredAt,
+		); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取背包成功",
+		Data:    items,
+	})
+}
+
+// EquipItem 装备装扮（同类型的其他装扮会被卸下）
+func EquipItem(c *gin.Context) {
+	setItemEquipped(c, true)
+}
+
+// UnequipItem 卸下装扮
+func UnequipItem(c *gin.Context) {
+	setItemEquipped(c, false)
+}
+
+// setItemEquipped 装备或卸下背包中的装扮
+func setItemEquipped(c *gin.Context, equip bool) {
+	itemID := c.Param("item_id")
+	userID, _ := c.Get("user_id")
+
+	var itemType string
+	err := database.DB.QueryRow(`
+		SELECT si.type FROM user_items ui
+		JOIN shop_items si ON ui.item_id = si.id
+		WHERE ui.user_id = ? AND ui.item_id = ? AND ui.quantity > 0
+	`, userID, itemID).Scan(&itemType)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "背包中没有该物品",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询背包失败: " + err.Error(),
+		})
+		return
+	}
+	if !utils.Contains(cosmeticItemTypes, itemType) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "该物品不是装扮，无法装备",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "操作失败: " + err.Error(),
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	if equip {
+		// 卸下同类型的其他装扮
+		_, err = tx.Exec(`
+			UPDATE user_items SET is_equipped = 0, updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND is_equipped = 1 AND item_id IN (SELECT id FROM shop_items WHERE type = ?)
+		`, userID, itemType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: "装备失败: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE user_items SET is_equipped = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ? AND item_id = ?",
+		equip, userID, itemID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "操作失败: " + err.Error(),
+		})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "操作失败: " + err.Error(),
+		})
+		return
+	}
+
+	message := "装备成功"
+	if !equip {
+		message = "卸下成功"
+	}
+	uid := userID.(int64)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: message,
+		Data: gin.H{
+			"cosmetics": loadUserCosmetics([]int64{uid})[uid],
+		},
+	})
+}
+
+// AdminGetShopItems 获取全部商品，包括已下架的（管理员权限）
+func AdminGetShopItems(c *gin.Context) {
+	rows, err := database.DB.Query("SELECT " + shopItemColumns + " FROM shop_items ORDER BY id DESC")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询商品失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.ShopItem{}
+	for rows.Next() {
+		var item models.ShopItem
+		if err := scanShopItem(rows, &item); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取商品列表成功",
+		Data:    items,
+	})
+}
+
+// bindShopItemRequest 解析并校验商品请求
+func bindShopItemRequest(c *gin.Context) (models.SaveShopItemRequest, bool) {
+	var req models.SaveShopItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return req, false
+	}
+	if utils.Contains(cosmeticItemTypes, req.Type) && req.Value == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "装扮类商品必须设置 value",
+		})
+		return req, false
+	}
+	if req.IsActive == nil {
+		active := true
+		req.IsActive = &active
+	}
+	return req, true
+}
+
+// CreateShopItem 创建商品（管理员权限）
+func CreateShopItem(c *gin.Context) {
+	req, ok := bindShopItemRequest(c)
+	if !ok {
+		return
+	}
+
+	result, err := database.DB.Exec(
+		`INSERT INTO shop_items (name, description, type, value, icon_url, price, stock, per_user_limit, is_active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		req.Name, req.Description, req.Type, req.Value, req.IconURL,
+		req.Price, req.Stock, req.PerUserLimit, *req.IsActive,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "创建商品失败: " + err.Error(),
+		})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	audit.SetTarget(c, "shop_item", id)
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "创建商品成功",
+		Data: gin.H{
+			"id": id,
+		},
+	})
+}
+
+// UpdateShopItem 更新商品（管理员权限）
+func UpdateShopItem(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "无效的商品ID",
+		})
+		return
+	}
+
+	req, ok := bindShopItemRequest(c)
+	if !ok {
+		return
+	}
+
+	var before models.ShopItem
+	if scanShopItem(database.DB.QueryRow("SELECT "+shopItemColumns+" FROM shop_items WHERE id = ?", id), &before) == nil {
+		audit.SetBefore(c, before)
+	}
+
+	result, err := database.DB.Exec(
+		`UPDATE shop_items SET name = ?, description = ?, type = ?, value = ?, icon_url = ?,
+			price = ?, stock = ?, per_user_limit = ?, is_active = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		req.Name, req.Description, req.Type, req.Value, req.IconURL,
+		req.Price, req.Stock, req.PerUserLimit, *req.IsActive, id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "更新商品失败: " + err.Error(),
+		})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "商品不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "更新商品成功",
+	})
+}
+
+// DeleteShopItem 下架商品（管理员权限，已购买的物品仍保留在用户背包中）
+func DeleteShopItem(c *gin.Context) {
+	id := c.Param("id")
+
+	var before models.ShopItem
+	if scanShopItem(database.DB.QueryRow("SELECT "+shopItemColumns+" FROM shop_items WHERE id = ?", id), &before) == nil {
+		audit.SetBefore(c, before)
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE shop_items SET is_active = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "下架商品失败: " + err.Error(),
+		})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "商品不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "下架商品成功",
+	})
+}
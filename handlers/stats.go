@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxStatsDays 运营统计最多查询的天数
+const maxStatsDays = 366
+
+// statsRange 运营统计的时间范围（服务器时区）
+type statsRange struct {
+	from   time.Time // 开始日期 0 点
+	to     time.Time // 结束日期的下一天 0 点（不包含）
+	bucket string
+}
+
+// timeArgs 返回 UTC 时间字段的查询范围 [from, to)
+func (r statsRange) timeArgs() []any {
+	return []any{formatDBTime(r.from), formatDBTime(r.to)}
+}
+
+// dateArgs 返回日期字符串字段（如 check_date）的查询范围 [from, to]
+func (r statsRange) dateArgs() []any {
+	return []any{r.from.Format("2006-01-02"), r.to.AddDate(0, 0, -1).Format("2006-01-02")}
+}
+
+// bucketExpr 生成按统计粒度分组的 SQL 表达式，结果为时间段第一天的日期字符串。
+// UTC 时间字段先换算为服务器时区的日期
+func (r statsRange) bucketExpr(column string, utc bool) string {
+	day := column
+	if utc {
+		_, offset := r.from.Zone()
+		day = fmt.Sprintf("date(%s, '%+d seconds')", column, offset)
+	}
+	switch r.bucket {
+	case "week":
+		return fmt.Sprintf("date(%s, 'weekday 0', '-6 days')", day)
+	case "month":
+		return fmt.Sprintf("strftime('%%Y-%%m-01', %s)", day)
+	}
+	return day
+}
+
+// bucketStart 返回时间所在时间段的第一天（周从周一开始）
+func (r statsRange) bucketStart(t time.Time) time.Time {
+	switch r.bucket {
+	case "week":
+		return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+// nextBucket 返回下一个时间段的第一天
+func (r statsRange) nextBucket(t time.Time) time.Time {
+	switch r.bucket {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// parseStatsRange 解析统计范围，默认统计最近30天
+func parseStatsRange(query models.AdminStatsQuery) (statsRange, error) {
+	r := statsRange{bucket: query.Bucket}
+	if r.bucket == "" {
+		r.bucket = "day"
+	}
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if query.To != "" {
+		t, err := time.ParseInLocation("2006-01-02", query.To, time.Local)
+		if err != nil {
+			return r, fmt.Errorf("to 格式无效，应为 2006-01-02")
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -29)
+	if query.From != "" {
+		t, err := time.ParseInLocation("2006-01-02", query.From, time.Local)
+		if err != nil {
+			return r, fmt.Errorf("from 格式无效，应为 2006-01-02")
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		return r, fmt.Errorf("开始日期不能晚于结束日期")
+	}
+	if to.Sub(from) >= maxStatsDays*24*time.Hour {
+		return r, fmt.Errorf("统计范围不能超过%d天", maxStatsDays)
+	}
+	r.from, r.to = from, to.AddDate(0, 0, 1)
+	return r, nil
+}
+
+// statsMetric 一项按时间统计的指标
+type statsMetric struct {
+	table  string
+	column string // 时间字段
+	utc    bool   // 时间字段为 UTC 时间，否则为服务器时区的日期字符串
+	count  string // 计数表达式
+	where  string // 额外筛选条件
+	field  func(*models.AdminStatsPoint) *int
+}
+
+var statsMetrics = []statsMetric{
+	{"users", "created_at", true, "COUNT(*)", "", func(p *models.AdminStatsPoint) *int { return &p.NewUsers }},
+	{"user_daily_activity", "day", false, "COUNT(DISTINCT user_id)", "", func(p *models.AdminStatsPoint) *int { return &p.ActiveUsers }},
+	{"posts", "created_at", true, "COUNT(*)", "", func(p *models.AdminStatsPoint) *int { return &p.Posts }},
+	{"comments", "created_at", true, "COUNT(*)", "", func(p *models.AdminStatsPoint) *int { return &p.Comments }},
+	{"check_ins", "check_date", false, "COUNT(*)", "", func(p *models.AdminStatsPoint) *int { return &p.CheckIns }},
+	{"app_upload_tasks", "created_at", true, "COUNT(*)", "", func(p *models.AdminStatsPoint) *int { return &p.Uploads }},
+	{"app_upload_tasks", "review_time", true, "COUNT(*)", "status = 'approved'", func(p *models.AdminStatsPoint) *int { return &p.Approvals }},
+	{"app_download_daily", "day", false, "COALESCE(SUM(downloads), 0)", "", func(p *models.AdminStatsPoint) *int { return &p.Downloads }},
+}
+
+// queryStatsSeries 查询各项指标的时间序列和合计，没有数据的时间段补0
+func queryStatsSeries(r statsRange) ([]models.AdminStatsPoint, models.AdminStatsPoint, error) {
+	series := []models.AdminStatsPoint{}
+	index := map[string]int{}
+	for t := r.bucketStart(r.from); t.Before(r.to); t = r.nextBucket(t) {
+		date := t.Format("2006-01-02")
+		index[date] = len(series)
+		series = append(series, models.AdminStatsPoint{Date: date})
+	}
+
+	totals := models.AdminStatsPoint{}
+	for _, m := range statsMetrics {
+		where := m.column + " >= ? AND " + m.column + " < ?"
+		args := r.timeArgs()
+		if !m.utc {
+			where = m.column + " >= ? AND " + m.column + " <= ?"
+			args = r.dateArgs()
+		}
+		if m.where != "" {
+			where += " AND " + m.where
+		}
+
+		rows, err := database.DB.Query(
+			"SELECT "+r.bucketExpr(m.column, m.utc)+", "+m.count+" FROM "+m.table+" WHERE "+where+" GROUP BY 1",
+			args...,
+		)
+		if err != nil {
+			return nil, totals, err
+		}
+		for rows.Next() {
+			var date string
+			var count int
+			if err := rows.Scan(&date, &count); err != nil {
+				continue
+			}
+			if i, ok := index[date]; ok {
+				*m.field(&series[i]) = count
+			}
+		}
+		rows.Close()
+
+		if err := database.DB.QueryRow(
+			"SELECT "+m.count+" FROM "+m.table+" WHERE "+where, args...,
+		).Scan(m.field(&totals)); err != nil {
+			return nil, totals, err
+		}
+	}
+	return series, totals, nil
+}
+
+// queryTopBoards 统计范围内发帖和评论最多的板块
+func queryTopBoards(r statsRange, limit int) ([]models.BoardRank, error) {
+	args := append(r.timeArgs(), r.timeArgs()...)
+	rows, err := database.DB.Query(`
+		SELECT b.id, b.name, COALESCE(p.cnt, 0), COALESCE(c.cnt, 0)
+		FROM boards b
+		LEFT JOIN (
+			SELECT board_id, COUNT(*) AS cnt FROM posts
+			WHERE created_at >= ? AND created_at < ?
+			GROUP BY board_id
+		) p ON p.board_id = b.id
+		LEFT JOIN (
+			SELECT posts.board_id, COUNT(*) AS cnt FROM comments
+			JOIN posts ON comments.post_id = posts.id
+			WHERE comments.created_at >= ? AND comments.created_at < ?
+			GROUP BY posts.board_id
+		) c ON c.board_id = b.id
+		WHERE p.cnt > 0 OR c.cnt > 0
+		ORDER BY COALESCE(p.cnt, 0) + COALESCE(c.cnt, 0) DESC, b.id
+		LIMIT ?
+	`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.BoardRank{}
+	for rows.Next() {
+		var rank models.BoardRank
+		if err := rows.Scan(&rank.BoardID, &rank.Name, &rank.Posts, &rank.Comments); err == nil {
+			list = append(list, rank)
+		}
+	}
+	return list, rows.Err()
+}
+
+// queryTopApps 统计范围内下载最多的应用（按每日汇总的去重下载数）
+func queryTopApps(r statsRange, limit int) ([]models.AppRank, error) {
+	rows, err := database.DB.Query(`
+		SELECT a.id, a.package_name, a.name, SUM(d.downloads) AS cnt
+		FROM app_download_daily d
+		JOIN apps a ON d.app_id = a.id
+		WHERE d.day >= ? AND d.day <= ?
+		GROUP BY a.id
+		HAVING cnt > 0
+		ORDER BY cnt DESC, a.id
+		LIMIT ?
+	`, append(r.dateArgs(), limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.AppRank{}
+	for rows.Next() {
+		var rank models.AppRank
+		if err := rows.Scan(&rank.AppID, &rank.PackageName, &rank.Name, &rank.Downloads); err == nil {
+			list = append(list, rank)
+		}
+	}
+	return list, rows.Err()
+}
+
+// queryReviewQueue 统计待审核任务的等待时长和统计范围内的审核耗时
+func queryReviewQueue(r statsRange) (models.ReviewQueueStats, error) {
+	var stats models.ReviewQueueStats
+	now := time.Now()
+
+	rows, err := database.DB.Query("SELECT created_at FROM app_upload_tasks WHERE status = 'pending'")
+	if err != nil {
+		return stats, err
+	}
+	pending := []int64{}
+	for rows.Next() {
+		var createdAt time.Time
+		if err := rows.Scan(&createdAt); err == nil {
+			pending = append(pending, int64(now.Sub(createdAt).Seconds()))
+		}
+	}
+	rows.Close()
+	stats.PendingAge = durationPercentiles(pending)
+
+	rows, err = database.DB.Query(`
+		SELECT created_at, review_time FROM app_upload_tasks
+		WHERE review_time >= ? AND review_time < ?
+	`, r.timeArgs()...)
+	if err != nil {
+		return stats, err
+	}
+	reviewed := []int64{}
+	for rows.Next() {
+		var createdAt, reviewTime time.Time
+		if err := rows.Scan(&createdAt, &reviewTime); err == nil {
+			reviewed = append(reviewed, int64(reviewTime.Sub(createdAt).Seconds()))
+		}
+	}
+	rows.Close()
+	stats.ReviewDuration = durationPercentiles(reviewed)
+	return stats, nil
+}
+
+// durationPercentiles 计算时长分布（最近秩法）
+func durationPercentiles(values []int64) models.DurationPercentiles {
+	result := models.DurationPercentiles{Count: len(values)}
+	if len(values) == 0 {
+		return result
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	percentile := func(p int) int64 {
+		rank := (p*len(values) + 99) / 100
+		if rank < 1 {
+			rank = 1
+		}
+		return values[rank-1]
+	}
+	result.P50 = percentile(50)
+	result.P90 = percentile(90)
+	result.P99 = percentile(99)
+	result.Max = values[len(values)-1]
+	return result
+}
+
+// GetAdminStats 获取运营统计：新增用户、日活、发帖、评论、签到、上传、审核通过和下载的时间序列，
+// 以及板块和应用排行、审核队列时长分布
+func GetAdminStats(c *gin.Context) {
+	var query models.AdminStatsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	r, err := parseStatsRange(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+	limit := query.Limit
+	if limit == 0 {
+		limit = 10
+	}
+
+	stats := models.AdminStats{
+		From:   r.from.Format("2006-01-02"),
+		To:     r.to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Bucket: r.bucket,
+	}
+	if stats.Series, stats.Totals, err = queryStatsSeries(r); err == nil {
+		if stats.TopBoards, err = queryTopBoards(r, limit); err == nil {
+			if stats.TopApps, err = queryTopApps(r, limit); err == nil {
+				stats.ReviewQueue, err = queryReviewQueue(r)
+			}
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询统计数据失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取运营统计成功",
+		Data:    stats,
+	})
+}
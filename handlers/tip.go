@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/utils"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTipMessageLength 打赏留言最大长度
+const maxTipMessageLength = 100
+
+// 打赏对象类型
+const (
+	tipTargetPost    = "post"
+	tipTargetComment = "comment"
+	tipTargetApp     = "app"
+)
+
+// validTipMessage 检查打赏留言长度
+func validTipMessage(message string) bool {
+	return utils.ValidateString(message, 0, maxTipMessageLength)
+}
+
+// recordTip 在事务中写入打赏记录
+func recordTip(tx *sql.Tx, tip models.Tip) error {
+	_, err := tx.Exec(
+		`INSERT INTO tips (tx_no, tipper_id, receiver_id, target_type, target_id, amount, receiver_amount, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		tip.TxNo, tip.TipperID, tip.ReceiverID, tip.TargetType, tip.TargetID,
+		tip.Amount, tip.ReceiverAmount, tip.Message,
+	)
+	return err
+}
+
+// parsePageParams 解析分页参数
+func parsePageParams(c *gin.Context, defaultPageSize int) (page, pageSize, offset int) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = defaultPageSize
+	}
+	return page, pageSize, (page - 1) * pageSize
+}
+
+// respondTips 返回某个对象的打赏记录（按时间倒序，含留言）
+func respondTips(c *gin.Context, targetType string, targetID int64) {
+	page, pageSize, offset := parsePageParams(c, 20)
+
+	var total int
+	err := database.DB.QueryRow(
+		"SELECT COUNT(*) FROM tips WHERE target_type = ? AND target_id = ?",
+		targetType, targetID,
+	).Scan(&total)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询打赏记录失败: " + err.Error(),
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT t.id, t.tx_no, t.tipper_id, COALESCE(u.username, ''), COALESCE(u.avatar, ''),
+			t.receiver_id, t.target_type, t.target_id, t.amount, t.receiver_amount,
+			COALESCE(t.message, ''), t.created_at
+		FROM tips t
+		LEFT JOIN users u ON t.tipper_id = u.id
+		WHERE t.target_type = ? AND t.target_id = ?
+		ORDER BY t.id DESC
+		LIMIT ? OFFSET ?
+	`, targetType, targetID, pageSize, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询打赏记录失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	tips := []models.Tip{}
+	for rows.Next() {
+		var tip models.Tip
+		if err := rows.Scan(
+			&tip.ID, &tip.TxNo, &tip.TipperID, &tip.TipperName, &tip.TipperAvatar,
+			&tip.ReceiverID, &tip.TargetType, &tip.TargetID, &tip.Amount, &tip.ReceiverAmount,
+			&tip.Message, &tip.CreatedAt,
+		); err != nil {
+			continue
+		}
+		tips = append(tips, tip)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取打赏记录成功",
+		Data: models.PageData{
+			Total:    total,
+			Page:     page,
+			PageSize: pageSize,
+			List:     tips,
+		},
+	})
+}
+
+// respondTipperRank 返回某个对象的打赏榜（按累计打赏硬币数排序）
+func respondTipperRank(c *gin.Context, targetType string, targetID int64) {
+	page, pageSize, offset := parsePageParams(c, 20)
+
+	var total int
+	err := database.DB.QueryRow(
+		"SELECT COUNT(DISTINCT tipper_id) FROM tips WHERE target_type = ? AND target_id = ?",
+		targetType, targetID,
+	).Scan(&total)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询打赏榜失败: " + err.Error(),
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT t.tipper_id, COALESCE(u.username, ''), COALESCE(u.avatar, ''),
+			SUM(t.amount) AS total_coins, COUNT(*), MAX(t.created_at),
+			COALESCE((
+				SELECT t2.message FROM tips t2
+				WHERE t2.target_type = t.target_type AND t2.target_id = t.target_id
+					AND t2.tipper_id = t.tipper_id AND t2.message != ''
+				ORDER BY t2.id DESC LIMIT 1
+			), '')
+		FROM tips t
+		LEFT JOIN users u ON t.tipper_id = u.id
+		WHERE t.target_type = ? AND t.target_id = ?
+		GROUP BY t.tipper_id
+		ORDER BY total_coins DESC, MIN(t.id) ASC
+		LIMIT ? OFFSET ?
+	`, targetType, targetID, pageSize, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询打赏榜失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	rankList := []models.TipperRankItem{}
+	rank := offset + 1
+	for rows.Next() {
+		var item models.TipperRankItem
+		if err := rows.Scan(
+			&item.UserID, &item.Username, &item.Avatar,
+			&item.TotalCoins, &item.TipCount, &item.LastTipAt, &item.LastMessage,
+		); err != nil {
+			continue
+		}
+		item.Rank = rank
+		rankList = append(rankList, item)
+		rank++
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取打赏榜成功",
+		Data: models.PageData{
+			Total:    total,
+			Page:     page,
+			PageSize: pageSize,
+			List:     rankList,
+		},
+	})
+}
+
+// postIDParam 解析帖子ID并确认帖子存在，失败时已写入响应
+func postIDParam(c *gin.Context) (int64, bool) {
+	postID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	var count int
+	if err == nil {
+		database.DB.QueryRow("SELECT COUNT(*) FROM posts WHERE id = ?", postID).Scan(&count)
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "帖子不存在",
+		})
+		return 0, false
+	}
+	return postID, true
+}
+
+// appIDParam 根据包名查询应用ID，失败时已写入响应
+func appIDParam(c *gin.Context) (int64, bool) {
+	var appID int64
+	err := database.DB.QueryRow("SELECT id FROM apps WHERE package_name = ?", c.Param("package_name")).Scan(&appID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "应用不存在",
+		})
+		return 0, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询应用失败: " + err.Error(),
+		})
+		return 0, false
+	}
+	return appID, true
+}
+
+// GetPostTips 获取帖子的打赏记录
+func GetPostTips(c *gin.Context) {
+	if postID, ok := postIDParam(c); ok {
+		respondTips(c, tipTargetPost, postID)
+	}
+}
+
+// GetPostTippers 获取帖子的打赏榜
+func GetPostTippers(c *gin.Context) {
+	if postID, ok := postIDParam(c); ok {
+		respondTipperRank(c, tipTargetPost, postID)
+	}
+}
+
+// GetAppTips 获取应用的打赏记录
+func GetAppTips(c *gin.Context) {
+	if appID, ok := appIDParam(c); ok {
+		respondTips(c, tipTargetApp, appID)
+	}
+}
+
+// GetAppTippers 获取应用的打赏榜
+func GetAppTippers(c *gin.Context) {
+	if appID, ok := appIDParam(c); ok {
+		respondTipperRank(c, tipTargetApp, appID)
+	}
+}
+
+// GetCreatorRank 获取创作者收益排行榜（按本周或本月获得的打赏硬币数排序）
+func GetCreatorRank(c *gin.Context) {
+	period := c.DefaultQuery("period", "week")
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var start time.Time
+	switch period {
+	case "week":
+		// 以周一为一周的开始
+		weekday := int(today.Weekday())
+		if weekday == 0 {
+			weekday = 7
+		}
+		start = today.AddDate(0, 0, 1-weekday)
+	case "month":
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	default:
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "period 只能是 'week' 或 'month'",
+		})
+		return
+	}
+
+	page, pageSize, offset := parsePageParams(c, 50)
+	// tips.created_at 由 CURRENT_TIMESTAMP 写入，为 UTC 时间
+	startStr := start.UTC().Format("2006-01-02 15:04:05")
+
+	var total int
+	err := database.DB.QueryRow(
+		"SELECT COUNT(DISTINCT receiver_id) FROM tips WHERE receiver_id != 0 AND receiver_amount > 0 AND created_at >= ?",
+		startStr,
+	).Scan(&total)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询排行榜失败: " + err.Error(),
+		})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT t.receiver_id, COALESCE(u.username, ''), COALESCE(u.avatar, ''),
+			SUM(t.receiver_amount) AS total_coins, COUNT(*), COUNT(DISTINCT t.tipper_id)
+		FROM tips t
+		LEFT JOIN users u ON t.receiver_id = u.id
+		WHERE t.receiver_id != 0 AND t.receiver_amount > 0 AND t.created_at >= ?
+		GROUP BY t.receiver_id
+		ORDER BY total_coins DESC, t.receiver_id ASC
+		LIMIT ? OFFSET ?
+	`, startStr, pageSize, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询排行榜失败: " + err.Error(),
+		})
+		return
+	}
+	defer rows.Close()
+
+	rankList := []models.CreatorRankItem{}
+	rank := offset + 1
+	for rows.Next() {
+		var item models.CreatorRankItem
+		if err := rows.Scan(
+			&item.UserID, &item.Username, &item.Avatar,
+			&item.TotalCoins, &item.TipCount, &item.TipperCount,
+		); err != nil {
+			continue
+		}
+		item.Rank = rank
+		rankList = append(rankList, item)
+		rank++
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取创作者排行榜成功",
+		Data: gin.H{
+			"period":     period,
+			"start_time": start.Format("2006-01-02 15:04:05"),
+			"total":      total,
+			"page":       page,
+			"page_size":  pageSize,
+			"list":       rankList,
+		},
+	})
+}
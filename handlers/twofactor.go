@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"TaruApp/config"
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/utils"
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	loginChallengeTTL = 5 * time.Minute // 两步验证登录挑战的有效期
+	recoveryCodeCount = 10              // 每次生成的恢复码数量
+)
+
+// normalizeRecoveryCode 统一恢复码格式（忽略大小写、空格和连字符）
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// generateRecoveryCodes 生成新的恢复码并作废旧的恢复码，数据库中只保存哈希值
+func generateRecoveryCodes(tx *sql.Tx, userID int64) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := utils.RandomHex(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		_, err = tx.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, utils.HashToken(normalizeRecoveryCode(code)),
+		)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// verifySecondFactor 在事务中校验 TOTP 验证码（allowRecovery 为 true 时也接受恢复码），
+// 已使用过的时间步和恢复码不能再次使用
+func verifySecondFactor(tx *sql.Tx, userID int64, code string, allowRecovery bool) error {
+	code = strings.TrimSpace(code)
+
+	var secret string
+	var lastStep int64
+	err := tx.QueryRow(
+		"SELECT COALESCE(totp_secret, ''), totp_last_step FROM users WHERE id = ?", userID,
+	).Scan(&secret, &lastStep)
+	if err != nil {
+		return err
+	}
+
+	if step, ok := utils.VerifyTOTP(secret, code, time.Now()); ok {
+		if step <= lastStep {
+			return errCodeInvalid
+		}
+		_, err = tx.Exec("UPDATE users SET totp_last_step = ? WHERE id = ?", step, userID)
+		return err
+	}
+
+	if !allowRecovery {
+		return errCodeInvalid
+	}
+	result, err := tx.Exec(
+		"UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		userID, utils.HashToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errCodeInvalid
+	}
+	return nil
+}
+
+// respondLoginChallenge 密码校验通过但开启了两步验证时，返回短期有效的登录挑战令牌
+func respondLoginChallenge(c *gin.Context, userID int64, deviceName string) {
+	challenge, err := utils.RandomHex(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "登录失败: " + err.Error(),
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(loginChallengeTTL)
+	_, err = database.DB.Exec(
+		"INSERT INTO login_challenges (user_id, challenge_hash, device_name, expires_at) VALUES (?, ?, ?, ?)",
+		userID, utils.HashToken(challenge), deviceName, formatDBTime(expiresAt),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "登录失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "请输入两步验证码",
+		Data: gin.H{
+			"two_factor_required": true,
+			"challenge":           challenge,
+			"expires_at":          expiresAt,
+		},
+	})
+}
+
+// LoginTwoFactor 提交两步验证码（或恢复码）完成登录
+func LoginTwoFactor(c *gin.Context) {
+	var req models.LoginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var challengeID, userID int64
+	var deviceName string
+	err := database.DB.QueryRow(`
+		SELECT id, user_id, COALESCE(device_name, '') FROM login_challenges
+		WHERE challenge_hash = ? AND used_at IS NULL AND expires_at > ? AND attempts < ?
+	`, utils.HashToken(req.Challenge), formatDBTime(time.Now()), maxCodeAttempts).Scan(&challengeID, &userID, &deviceName)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Code:    401,
+			Message: "登录验证已过期，请重新登录",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "登录失败: " + err.Error(),
+		})
+		return
+	}
+
+	// 先记录尝试次数，错误次数过多的挑战作废，需重新输入密码
+	database.DB.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE id = ?", challengeID)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondCodeError(c, err, "登录失败")
+		return
+	}
+	defer tx.Rollback()
+
+	if err = verifySecondFactor(tx, userID, req.Code, true); err != nil {
+		respondCodeError(c, err, "登录失败")
+		return
+	}
+
+	result, err := tx.Exec("UPDATE login_challenges SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL", challengeID)
+	if err != nil {
+		respondCodeError(c, err, "登录失败")
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusUnauthorized, models.Response{
+			Code:    401,
+			Message: "登录验证已过期，请重新登录",
+		})
+		return
+	}
+
+	var user models.User
+	err = tx.QueryRow(
+		"SELECT id, username, email, level, avatar, coins, exp, user_level, email_verified, totp_enabled, created_at FROM users WHERE id = ?",
+		userID,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Level, &user.Avatar, &user.Coins, &user.Exp, &user.UserLevel, &user.EmailVerified, &user.TwoFactorEnabled, &user.CreatedAt)
+	if err != nil {
+		respondCodeError(c, err, "登录失败")
+		return
+	}
+	if respondIfLoginBlocked(c, user.ID) {
+		return
+	}
+
+	pair, err := startSession(tx, c, user.ID, user.Username, user.Level, deviceName, true)
+	if err != nil {
+		respondCodeError(c, err, "生成令牌失败")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		respondCodeError(c, err, "登录失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "登录成功",
+		Data: gin.H{
+			"token":              pair.Token,
+			"expires_at":         pair.ExpiresAt,
+			"refresh_token":      pair.RefreshToken,
+			"refresh_expires_at": pair.RefreshExpiresAt,
+			"user":               user,
+		},
+	})
+}
+
+// GetTwoFactorStatus 获取当前用户的两步验证状态
+func GetTwoFactorStatus(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var enabled bool
+	var remaining int
+	err := database.DB.QueryRow(`
+		SELECT totp_enabled,
+			(SELECT COUNT(*) FROM recovery_codes WHERE user_id = users.id AND used_at IS NULL)
+		FROM users WHERE id = ?
+	`, userID).Scan(&enabled, &remaining)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询两步验证状态失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "获取两步验证状态成功",
+		Data: gin.H{
+			"enabled":                  enabled,
+			"recovery_codes_remaining": remaining,
+			"session_verified":         c.GetBool("two_factor"),
+		},
+	})
+}
+
+// SetupTwoFactor 生成新的 TOTP 密钥，校验验证码开启前不会生效。
+// 需要当前密码，防止访问令牌泄露后被绑定攻击者的验证器
+func SetupTwoFactor(c *gin.Context) {
+	var req models.SetupTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	username, _ := c.Get("username")
+	uid := userID.(int64)
+
+	var enabled bool
+	database.DB.QueryRow("SELECT totp_enabled FROM users WHERE id = ?", uid).Scan(&enabled)
+	if enabled {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "已开启两步验证，如需更换密钥请先关闭",
+		})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "生成密钥失败: " + err.Error(),
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondCodeError(c, err, "保存密钥失败")
+		return
+	}
+	defer tx.Rollback()
+
+	// 尚未开启两步验证，只能用密码确认身份
+	if err = verifyCurrentCredential(tx, uid, req.Password, ""); err != nil {
+		respondCodeError(c, err, "保存密钥失败")
+		return
+	}
+	_, err = tx.Exec(
+		"UPDATE users SET totp_secret = ?, totp_enabled = 0, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		secret, uid,
+	)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		respondCodeError(c, err, "保存密钥失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "请使用验证器应用扫描二维码，并提交验证码完成开启",
+		Data: gin.H{
+			"secret":      secret,
+			"otpauth_uri": utils.TOTPURI(config.AppConfig.TOTPIssuer, username.(string), secret),
+		},
+	})
+}
+
+// EnableTwoFactor 校验验证器应用生成的验证码并开启两步验证，返回一次性恢复码
+func EnableTwoFactor(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	sessionID, _ := c.Get("session_id")
+	uid := userID.(int64)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondCodeError(c, err, "开启两步验证失败")
+		return
+	}
+	defer tx.Rollback()
+
+	var secret string
+	var enabled bool
+	err = tx.QueryRow(
+		"SELECT COALESCE(totp_secret, ''), totp_enabled FROM users WHERE id = ?", uid,
+	).Scan(&secret, &enabled)
+	if err != nil {
+		respondCodeError(c, err, "开启两步验证失败")
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "已开启两步验证",
+		})
+		return
+	}
+	if secret == "" {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请先生成两步验证密钥",
+		})
+		return
+	}
+
+	if err = verifySecondFactor(tx, uid, req.Code, false); err != nil {
+		respondCodeError(c, err, "开启两步验证失败")
+		return
+	}
+	if _, err = tx.Exec("UPDATE users SET totp_enabled = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?", uid); err != nil {
+		respondCodeError(c, err, "开启两步验证失败")
+		return
+	}
+	codes, err := generateRecoveryCodes(tx, uid)
+	if err != nil {
+		respondCodeError(c, err, "生成恢复码失败")
+		return
+	}
+	// 当前会话已完成验证，刷新令牌后即可访问要求两步验证的接口
+	if _, err = tx.Exec("UPDATE sessions SET two_factor = 1 WHERE id = ?", sessionID); err != nil {
+		respondCodeError(c, err, "开启两步验证失败")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		respondCodeError(c, err, "开启两步验证失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "开启两步验证成功，请妥善保存恢复码，每个恢复码只能使用一次",
+		Data: gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableTwoFactor 关闭两步验证（需要验证码或恢复码，设置了密码的账号还需要密码）
+func DisableTwoFactor(c *gin.Context) {
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(int64)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondCodeError(c, err, "关闭两步验证失败")
+		return
+	}
+	defer tx.Rollback()
+
+	var storedPassword string
+	var hasPassword, enabled bool
+	err = tx.QueryRow(
+		"SELECT password, has_password, totp_enabled FROM users WHERE id = ?", uid,
+	).Scan(&storedPassword, &hasPassword, &enabled)
+	if err != nil {
+		respondCodeError(c, err, "关闭两步验证失败")
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "未开启两步验证",
+		})
+		return
+	}
+	// 第三方登录创建、尚未设置密码的账号只校验验证码或恢复码
+	if hasPassword && utils.VerifyPassword(storedPassword, req.Password) != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "密码错误",
+		})
+		return
+	}
+	if err = verifySecondFactor(tx, uid, req.Code, true); err != nil {
+		respondCodeError(c, err, "关闭两步验证失败")
+		return
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET totp_secret = NULL, totp_enabled = 0, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		uid,
+	)
+	if err != nil {
+		respondCodeError(c, err, "关闭两步验证失败")
+		return
+	}
+	if _, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", uid); err != nil {
+		respondCodeError(c, err, "关闭两步验证失败")
+		return
+	}
+	if _, err = tx.Exec("UPDATE sessions SET two_factor = 0 WHERE user_id = ?", uid); err != nil {
+		respondCodeError(c, err, "关闭两步验证失败")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		respondCodeError(c, err, "关闭两步验证失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已关闭两步验证",
+	})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码（需要验证器应用中的验证码），旧的恢复码全部作废
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	uid := userID.(int64)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		respondCodeError(c, err, "生成恢复码失败")
+		return
+	}
+	defer tx.Rollback()
+
+	var enabled bool
+	if err = tx.QueryRow("SELECT totp_enabled FROM users WHERE id = ?", uid).Scan(&enabled); err != nil {
+		respondCodeError(c, err, "生成恢复码失败")
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "未开启两步验证",
+		})
+		return
+	}
+	if err = verifySecondFactor(tx, uid, req.Code, false); err != nil {
+		respondCodeError(c, err, "生成恢复码失败")
+		return
+	}
+	codes, err := generateRecoveryCodes(tx, uid)
+	if err != nil {
+		respondCodeError(c, err, "生成恢复码失败")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		respondCodeError(c, err, "生成恢复码失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "已重新生成恢复码，旧的恢复码已失效",
+		Data: gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"TaruApp/database"
+	"TaruApp/models"
+	"TaruApp/utils"
+	"net/http"
+	"testing"
+)
+
+// enableTestTwoFactor 为用户开启两步验证并返回恢复码
+func enableTestTwoFactor(t *testing.T, userID int64) []string {
+	t.Helper()
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := database.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("UPDATE users SET totp_secret = ?, totp_enabled = 1 WHERE id = ?", secret, userID); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := generateRecoveryCodes(tx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return codes
+}
+
+func TestDisableTwoFactorWithoutPassword(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "erin", "", "erin@example.com")
+	database.DB.Exec("UPDATE users SET has_password = 0 WHERE id = ?", uid)
+	codes := enableTestTwoFactor(t, uid)
+
+	w := performJSON(DisableTwoFactor, http.MethodPost, uid, models.DisableTwoFactorRequest{Code: "wrong-code"})
+	assertStatus(t, w, http.StatusBadRequest)
+
+	w = performJSON(DisableTwoFactor, http.MethodPost, uid, models.DisableTwoFactorRequest{Code: codes[0]})
+	assertStatus(t, w, http.StatusOK)
+
+	var enabled bool
+	database.DB.QueryRow("SELECT totp_enabled FROM users WHERE id = ?", uid).Scan(&enabled)
+	if enabled {
+		t.Fatal("两步验证未关闭")
+	}
+}
+
+func TestDisableTwoFactorRequiresPassword(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "frank", "current-password", "frank@example.com")
+	codes := enableTestTwoFactor(t, uid)
+
+	w := performJSON(DisableTwoFactor, http.MethodPost, uid, models.DisableTwoFactorRequest{Code: codes[0]})
+	assertStatus(t, w, http.StatusBadRequest)
+
+	w = performJSON(DisableTwoFactor, http.MethodPost, uid, models.DisableTwoFactorRequest{Password: "current-password", Code: codes[0]})
+	assertStatus(t, w, http.StatusOK)
+}
+
+func TestSetupTwoFactorRequiresCurrentPassword(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "judy", "current-password", "judy@example.com")
+
+	w := performJSON(SetupTwoFactor, http.MethodPost, uid, models.SetupTwoFactorRequest{})
+	assertStatus(t, w, http.StatusBadRequest)
+	w = performJSON(SetupTwoFactor, http.MethodPost, uid, models.SetupTwoFactorRequest{Password: "wrong-password"})
+	assertStatus(t, w, http.StatusBadRequest)
+
+	var secret string
+	database.DB.QueryRow("SELECT COALESCE(totp_secret, '') FROM users WHERE id = ?", uid).Scan(&secret)
+	if secret != "" {
+		t.Fatal("密码错误时不应生成密钥")
+	}
+
+	w = performJSON(SetupTwoFactor, http.MethodPost, uid, models.SetupTwoFactorRequest{Password: "current-password"})
+	assertStatus(t, w, http.StatusOK)
+}
+
+func TestSetupTwoFactorWithoutPasswordIsRejected(t *testing.T) {
+	setupTestDB(t)
+	uid := createTestUser(t, "kate", "", "kate@example.com")
+	database.DB.Exec("UPDATE users SET has_password = 0 WHERE id = ?", uid)
+
+	w := performJSON(SetupTwoFactor, http.MethodPost, uid, models.SetupTwoFactorRequest{})
+	assertStatus(t, w, http.StatusBadRequest)
+}
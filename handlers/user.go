@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"TaruApp/audit"
 	"TaruApp/database"
+	"TaruApp/middleware"
 	"TaruApp/models"
+	"TaruApp/ratelimit"
+	"TaruApp/rbac"
 	"TaruApp/utils"
 	"database/sql"
+	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -83,12 +87,24 @@ func Register(c *gin.Context) {
 	}
 
 	userID, _ := result.LastInsertId()
+
+	// 填写了邮箱时发送验证码，发送失败不影响注册，可稍后重新发送
+	verificationSent := false
+	if req.Email != "" {
+		if err := sendEmailVerification(userID, req.Username, req.Email); err != nil {
+			log.Printf("发送邮箱验证码失败: user_id=%d err=%v", userID, err)
+		} else {
+			verificationSent = true
+		}
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
 		Message: "注册成功",
 		Data: gin.H{
-			"user_id":  userID,
-			"username": req.Username,
+			"user_id":           userID,
+			"username":          req.Username,
+			"verification_sent": verificationSent,
 		},
 	})
 }
@@ -104,19 +120,23 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// 同一用户名和 IP 连续登录失败次数过多时暂时锁定
+	lockKey := req.Username + "|" + c.ClientIP()
+	if wait := ratelimit.LoginLockedFor(lockKey); wait > 0 {
+		middleware.AbortTooManyRequests(c, wait, "登录失败次数过多")
+		return
+	}
+
 	// 验证用户 - 先根据用户名查询用户信息
 	var user models.User
 	var storedPassword string
 	err := database.DB.QueryRow(
-		"SELECT id, username, password, email, level, avatar, coins, exp, user_level, created_at FROM users WHERE username = ?",
+		"SELECT id, username, password, email, level, avatar, coins, exp, user_level, email_verified, totp_enabled, created_at FROM users WHERE username = ?",
 		req.Username,
-	).Scan(&user.ID, &user.Username, &storedPassword, &user.Email, &user.Level, &user.Avatar, &user.Coins, &user.Exp, &user.UserLevel, &user.CreatedAt)
+	).Scan(&user.ID, &user.Username, &storedPassword, &user.Email, &user.Level, &user.Avatar, &user.Coins, &user.Exp, &user.UserLevel, &user.EmailVerified, &user.TwoFactorEnabled, &user.CreatedAt)
 
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusUnauthorized, models.Response{
-			Code:    401,
-			Message: "用户名或密码错误",
-		})
+		respondLoginFailure(c, lockKey)
 		return
 	}
 	if err != nil {
@@ -130,43 +150,29 @@ func Login(c *gin.Context) {
 	// 验证密码
 	err = utils.VerifyPassword(storedPassword, req.Password)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.Response{
-			Code:    401,
-			Message: "用户名或密码错误",
-		})
+		respondLoginFailure(c, lockKey)
 		return
 	}
 
-	// 生成token
-	rawToken, err := utils.GenerateToken()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Code:    500,
-			Message: "生成令牌失败: " + err.Error(),
-		})
+	ratelimit.ResetLoginFailures(lockKey)
+
+	// 密码正确后才提示账号被暂停或封禁，避免泄露账号状态
+	if respondIfLoginBlocked(c, user.ID) {
 		return
 	}
 
-	// RC4加密token
-	encryptedToken, err := utils.RC4Encrypt(rawToken)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.Response{
-			Code:    500,
-			Message: "加密令牌失败: " + err.Error(),
-		})
+	// 开启了两步验证时先返回挑战令牌，提交验证码后才签发令牌
+	if user.TwoFactorEnabled {
+		respondLoginChallenge(c, user.ID, req.DeviceName)
 		return
 	}
 
-	// 保存token到数据库（有效期30天）
-	expiresAt := time.Now().Add(30 * 24 * time.Hour)
-	_, err = database.DB.Exec(
-		"INSERT INTO tokens (user_id, token, expires_at) VALUES (?, ?, ?)",
-		user.ID, encryptedToken, expiresAt,
-	)
+	// 签发访问令牌和刷新令牌
+	pair, err := startSession(database.DB, c, user.ID, user.Username, user.Level, req.DeviceName, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
-			Message: "保存令牌失败: " + err.Error(),
+			Message: "生成令牌失败: " + err.Error(),
 		})
 		return
 	}
@@ -175,13 +181,27 @@ func Login(c *gin.Context) {
 		Code:    200,
 		Message: "登录成功",
 		Data: gin.H{
-			"token":      encryptedToken,
-			"user":       user,
-			"expires_at": expiresAt,
+			"token":              pair.Token,
+			"expires_at":         pair.ExpiresAt,
+			"refresh_token":      pair.RefreshToken,
+			"refresh_expires_at": pair.RefreshExpiresAt,
+			"user":               user,
 		},
 	})
 }
 
+// respondLoginFailure 记录登录失败，失败次数达到上限时返回 429
+func respondLoginFailure(c *gin.Context, lockKey string) {
+	if lockout := ratelimit.RecordLoginFailure(lockKey); lockout > 0 {
+		middleware.AbortTooManyRequests(c, lockout, "登录失败次数过多")
+		return
+	}
+	c.JSON(http.StatusUnauthorized, models.Response{
+		Code:    401,
+		Message: "用户名或密码错误",
+	})
+}
+
 // GetUserInfo 获取用户信息
 func GetUserInfo(c *gin.Context) {
 	userID := c.Param("id")
@@ -207,6 +227,9 @@ func GetUserInfo(c *gin.Context) {
 		return
 	}
 
+	// 获取用户已装备的装扮
+	user.Cosmetics = loadUserCosmetics([]int64{user.ID})[user.ID]
+
 	// 获取用户标签
 	rows, err := database.DB.Query(
 		"SELECT id, user_id, tag_name, tag_color, created_at FROM user_tags WHERE user_id = ?",
@@ -260,6 +283,9 @@ func GetUserDetail(c *gin.Context) {
 		return
 	}
 
+	// 获取用户已装备的装扮
+	user.Cosmetics = loadUserCosmetics([]int64{user.ID})[user.ID]
+
 	// 获取关注数
 	var followingCount int
 	database.DB.QueryRow("SELECT COUNT(*) FROM follows WHERE user_id = ?", userID).Scan(&followingCount)
@@ -379,6 +405,15 @@ func GetUserDetail(c *gin.Context) {
 		}
 	}
 
+	attachPostCosmetics(posts)
+	attachPostCosmetics(favorites)
+
+	// 获取用户在个人主页展示的徽章
+	badges, err := getUserBadges(userID, true)
+	if err != nil {
+		badges = []models.UserBadge{}
+	}
+
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
 		Message: "获取用户详情成功",
@@ -392,22 +427,41 @@ func GetUserDetail(c *gin.Context) {
 			"folders":         folders,
 			"posts":           posts,
 			"favorites":       favorites,
+			"badges":          badges,
 		},
 	})
 }
 
 // GetCurrentUser 获取当前登录用户信息
 func GetCurrentUser(c *gin.Context) {
-	user, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, models.Response{
-			Code:    401,
-			Message: "未授权访问",
+	userID, _ := c.Get("user_id")
+
+	// 访问令牌只携带身份信息，硬币、经验等实时数据从数据库读取
+	var currentUser models.User
+	err := database.DB.QueryRow(
+		"SELECT id, username, email, level, avatar, coins, exp, user_level, email_verified, totp_enabled, created_at, updated_at FROM users WHERE id = ?",
+		userID,
+	).Scan(&currentUser.ID, &currentUser.Username, &currentUser.Email, &currentUser.Level, &currentUser.Avatar,
+		&currentUser.Coins, &currentUser.Exp, &currentUser.UserLevel, &currentUser.EmailVerified, &currentUser.TwoFactorEnabled,
+		&currentUser.CreatedAt, &currentUser.UpdatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "用户不存在",
 		})
 		return
 	}
-
-	currentUser := user.(models.User)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "查询用户失败: " + err.Error(),
+		})
+		return
+	}
+	currentUser.Cosmetics = loadUserCosmetics([]int64{currentUser.ID})[currentUser.ID]
+	if restriction, ok := middleware.ActiveRestriction(currentUser.ID); ok {
+		currentUser.Restriction = &restriction
+	}
 
 	// 获取用户标签
 	rows, err := database.DB.Query(
@@ -436,7 +490,7 @@ func GetCurrentUser(c *gin.Context) {
 	})
 }
 
-// SetUserLevel 设置用户等级（管理员权限）
+// SetUserLevel 设置用户等级（分配或移除管理员角色）
 func SetUserLevel(c *gin.Context) {
 	userID := c.Param("id")
 	var req models.SetUserLevelRequest
@@ -449,7 +503,7 @@ func SetUserLevel(c *gin.Context) {
 	}
 
 	// 验证等级值
-	if req.Level != 0 && req.Level != 50 {
+	if req.Level != 0 && req.Level != legacyAdminLevel {
 		c.JSON(http.StatusBadRequest, models.Response{
 			Code:    400,
 			Message: "等级值无效，只能设置为0(普通用户)或50(管理员)",
@@ -457,18 +511,49 @@ func SetUserLevel(c *gin.Context) {
 		return
 	}
 
-	// 更新用户等级
-	_, err := database.DB.Exec(
-		"UPDATE users SET level = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		req.Level, userID,
-	)
+	targetID, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "用户ID无效",
+		})
+		return
+	}
+	var oldLevel int
+	err = database.DB.QueryRow("SELECT level FROM users WHERE id = ?", targetID).Scan(&oldLevel)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "用户不存在",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
-			Message: "设置用户等级失败: " + err.Error(),
+			Message: "查询用户失败: " + err.Error(),
 		})
 		return
 	}
+	audit.SetBefore(c, gin.H{"level": oldLevel})
+
+	// 等级由管理员角色决定：设置为管理员即分配管理员角色，设置为普通用户即移除管理员角色
+	role, err := loadRoleByName(rbac.RoleAdmin)
+	if err == nil {
+		err = checkGrantable(c, role.Permissions)
+	}
+	if err == nil {
+		if req.Level == legacyAdminLevel {
+			operatorID, _ := c.Get("user_id")
+			err = grantUserRole(targetID, role, operatorID.(int64))
+		} else {
+			err = revokeUserRole(targetID, role)
+		}
+	}
+	if err != nil {
+		respondRoleError(c, err, "设置用户等级失败")
+		return
+	}
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
@@ -476,19 +561,11 @@ func SetUserLevel(c *gin.Context) {
 	})
 }
 
-// Logout 退出登录
+// Logout 退出登录（吊销当前会话）
 func Logout(c *gin.Context) {
-	token := c.GetHeader("Token")
-	if token == "" {
-		c.JSON(http.StatusBadRequest, models.Response{
-			Code:    400,
-			Message: "未提供令牌",
-		})
-		return
-	}
+	sessionID, _ := c.Get("session_id")
 
-	// 删除token
-	_, err := database.DB.Exec("DELETE FROM tokens WHERE token = ?", token)
+	err := revokeSession(database.DB, sessionID.(string))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
@@ -539,6 +616,7 @@ func CreateUserTag(c *gin.Context) {
 	}
 
 	tagID, _ := result.LastInsertId()
+	audit.SetTarget(c, "user_tag", tagID)
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
 		Message: "创建标签成功",
@@ -552,7 +630,28 @@ func CreateUserTag(c *gin.Context) {
 func DeleteUserTag(c *gin.Context) {
 	tagID := c.Param("id")
 
-	_, err := database.DB.Exec("DELETE FROM user_tags WHERE id = ?", tagID)
+	var tag models.UserTag
+	err := database.DB.QueryRow(
+		"SELECT id, user_id, tag_name, tag_color, created_at FROM user_tags WHERE id = ?",
+		tagID,
+	).Scan(&tag.ID, &tag.UserID, &tag.TagName, &tag.TagColor, &tag.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "标签不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "删除标签失败: " + err.Error(),
+		})
+		return
+	}
+	audit.SetBefore(c, tag)
+
+	_, err = database.DB.Exec("DELETE FROM user_tags WHERE id = ?", tagID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
@@ -653,6 +752,7 @@ func GetAllUsers(c *gin.Context) {
 		}
 		users = append(users, user)
 	}
+	attachUserCosmetics(users)
 
 	c.JSON(http.StatusOK, models.Response{
 		Code:    200,
@@ -0,0 +1,138 @@
+package mailer
+
+import (
+	"TaruApp/config"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message 一封待发送的邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string // 纯文本正文
+}
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer 通过 SMTP 服务器发送邮件
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send 发送邮件
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	// 信封发件人只能是邮箱地址，MailFrom 可以带显示名称
+	sender, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("发件人地址无效: %v", err)
+	}
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+	return smtp.SendMail(addr, auth, sender.Address, []string{msg.To}, buildMessage(m.From, msg))
+}
+
+// FileMailer 把邮件写入本地目录（本地开发和测试用），目录为空时只输出到日志
+type FileMailer struct {
+	Dir  string
+	From string
+
+	mu sync.Mutex
+}
+
+// Send 保存邮件
+func (m *FileMailer) Send(msg Message) error {
+	if m.Dir == "" {
+		log.Printf("[邮件] 收件人: %s 主题: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405.000000000"), sanitizeFileName(msg.To))
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, buildMessage(m.From, msg), 0644); err != nil {
+		return err
+	}
+	log.Printf("[邮件] 已写入 %s", path)
+	return nil
+}
+
+// Default 全局邮件发送器，由 Init 根据配置创建
+var Default Mailer = &FileMailer{}
+
+// Init 根据配置初始化全局邮件发送器
+func Init() {
+	cfg := config.AppConfig
+	switch cfg.MailDriver {
+	case "smtp":
+		Default = &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}
+	case "file":
+		Default = &FileMailer{Dir: cfg.MailFileDir, From: cfg.MailFrom}
+	default:
+		Default = &FileMailer{From: cfg.MailFrom}
+	}
+}
+
+// Send 使用全局邮件发送器发送邮件
+func Send(to, subject, body string) error {
+	return Default.Send(Message{To: to, Subject: subject, Body: body})
+}
+
+// buildMessage 构造 RFC 5322 格式的邮件内容
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: =?UTF-8?B?" + base64.StdEncoding.EncodeToString([]byte(msg.Subject)) + "?=\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return []byte(b.String())
+}
+
+// sanitizeFileName 把邮箱地址转换为安全的文件名
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -4,8 +4,13 @@ import (
 	"TaruApp/config"
 	"TaruApp/database"
 	"TaruApp/handlers"
+	"TaruApp/mailer"
 	"TaruApp/middleware"
+	"TaruApp/oauth"
+	"TaruApp/ratelimit"
+	"TaruApp/rbac"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,15 +19,59 @@ func main() {
 	// 初始化配置
 	config.InitConfig()
 
+	// 初始化邮件发送
+	mailer.Init()
+
+	// 初始化第三方登录
+	oauth.Init()
+
+	// 加载限流规则
+	ratelimit.Init()
+
 	// 初始化数据库
 	if err := database.InitDB(); err != nil {
 		log.Fatal("数据库初始化失败:", err)
 	}
 	defer database.CloseDB()
 
+	// 创建系统角色（首次启动时按原来的等级为管理员和审核员分配角色）
+	if err := rbac.EnsureDefaultRoles(config.AppConfig.AdminUsernames); err != nil {
+		log.Fatal("初始化角色失败:", err)
+	}
+
+	// 加载奖励规则和成就定义
+	if err := handlers.LoadRewardRules(config.AppConfig.RewardRulesPath); err != nil {
+		log.Printf("加载奖励规则失败，使用内置默认规则: %v", err)
+	}
+	if err := handlers.LoadAchievements(config.AppConfig.AchievementsPath); err != nil {
+		log.Printf("加载成就定义失败，使用内置默认成就: %v", err)
+	}
+
+	// 恢复最近吊销的会话，避免重启后其访问令牌重新生效
+	if err := handlers.LoadRevokedSessions(); err != nil {
+		log.Printf("加载已吊销会话失败: %v", err)
+	}
+
+	// 加载被禁言、暂停和封禁的账号
+	if err := handlers.LoadUserRestrictions(); err != nil {
+		log.Fatal("加载账号限制失败:", err)
+	}
+
+	// 启动后台任务
+	handlers.StartCoinReconcileJob(time.Duration(config.AppConfig.CoinReconcileInterval) * time.Minute)
+	handlers.StartSessionCleanupJob(time.Duration(config.AppConfig.SessionCleanupInterval) * time.Minute)
+	handlers.StartPatchJob(time.Duration(config.AppConfig.PatchJobInterval) * time.Minute)
+	handlers.StartDownloadRollupJob(time.Duration(config.AppConfig.DownloadRollupInterval)*time.Minute, config.AppConfig.DownloadRetentionDays)
+	handlers.StartUploadTaskExpiryJob(time.Hour, config.AppConfig.ChangesRequestedExpireDays)
+
 	// 创建 Gin 路由
 	r := gin.Default()
 
+	// 只信任配置的反向代理转发的客户端 IP，避免伪造 X-Forwarded-For 绕过按 IP 限流
+	if err := r.SetTrustedProxies(config.AppConfig.TrustedProxies); err != nil {
+		log.Fatal("TRUSTED_PROXIES 配置无效:", err)
+	}
+
 	// 使用中间件
 	r.Use(middleware.Logger())
 	if config.AppConfig.EnableCORS {
@@ -42,32 +91,78 @@ func main() {
 		// 用户相关（不需要认证）
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", handlers.Register) // 用户注册
-			auth.POST("/login", handlers.Login)       // 用户登录
+			auth.POST("/register", middleware.RateLimit(ratelimit.RuleRegister), handlers.Register)          // 用户注册
+			auth.POST("/login", middleware.RateLimit(ratelimit.RuleLogin), handlers.Login)                   // 用户登录
+			auth.POST("/login/2fa", middleware.RateLimit(ratelimit.RuleAuth), handlers.LoginTwoFactor)       // 提交两步验证码完成登录
+			auth.POST("/refresh", middleware.RateLimit(ratelimit.RuleAuth), handlers.RefreshToken)           // 刷新令牌
+			auth.POST("/password/forgot", middleware.RateLimit(ratelimit.RuleAuth), handlers.ForgotPassword) // 忘记密码，发送重置验证码
+			auth.POST("/password/reset", middleware.RateLimit(ratelimit.RuleAuth), handlers.ResetPassword)   // 使用验证码重置密码
+			auth.GET("/oauth/providers", handlers.GetOAuthProviders)                                         // 获取已启用的第三方登录方式
+			auth.GET("/oauth/:provider/authorize", handlers.OAuthAuthorize)                                  // 发起第三方登录
+			auth.GET("/oauth/:provider/callback", handlers.OAuthCallback)                                    // 第三方授权回调（登录或绑定）
 		}
 
 		// 应用市场路由（不需要认证）
 		apps := api.Group("/apps")
 		{
-			apps.GET("", handlers.GetApps)                              // 获取应用列表
-			apps.GET("/categories", handlers.GetMainCategories)         // 获取所有大分类
-			apps.GET("/subcategories", handlers.GetSubCategories)       // 获取指定大分类下的小分类
-			apps.GET("/category", handlers.GetAppsByCategory)           // 根据分类获取应用列表
-			apps.GET("/channels", handlers.GetAppChannels)              // 获取应用渠道选项
-			apps.GET("/ad-levels", handlers.GetAppAdLevels)             // 获取广告级别选项
-			apps.GET("/payment-types", handlers.GetAppPaymentTypes)     // 获取付费类型选项
-			apps.GET("/operation-types", handlers.GetAppOperationTypes) // 获取运营方式选项
-			apps.GET("/:package_name", handlers.GetAppDetail)           // 获取应用详情
-			apps.POST("/:package_name/download", handlers.DownloadApp)  // 记录下载
+			apps.GET("", handlers.GetApps)                                                                                  // 获取应用列表
+			apps.GET("/categories/tree", handlers.GetCategoryTree)                                                          // 获取分类树（含图标和排序）
+			apps.GET("/categories", handlers.GetMainCategories)                                                             // 获取所有大分类
+			apps.GET("/subcategories", handlers.GetSubCategories)                                                           // 获取指定大分类下的小分类
+			apps.GET("/category", handlers.GetAppsByCategory)                                                               // 根据分类获取应用列表
+			apps.GET("/tags/suggest", handlers.SuggestTags)                                                                 // 标签自动补全
+			apps.GET("/channels", handlers.GetAppChannels)                                                                  // 获取应用渠道选项
+			apps.GET("/ad-levels", handlers.GetAppAdLevels)                                                                 // 获取广告级别选项
+			apps.GET("/payment-types", handlers.GetAppPaymentTypes)                                                         // 获取付费类型选项
+			apps.GET("/operation-types", handlers.GetAppOperationTypes)                                                     // 获取运营方式选项
+			apps.POST("/updates/check", middleware.RateLimit(ratelimit.RuleUpdate), handlers.CheckAppUpdates)               // 批量检查已安装应用的更新
+			apps.GET("/:package_name/patches/:id", middleware.RateLimit(ratelimit.RuleDownload), handlers.DownloadAppPatch) // 下载增量更新补丁
+			apps.GET("/:package_name/similar", handlers.GetSimilarApps)                                                     // 获取相似应用
+			apps.GET("/:package_name/versions", handlers.GetAppVersions)                                                    // 获取应用版本历史
+			apps.GET("/:package_name", handlers.GetAppDetail)                                                               // 获取应用详情
+			apps.POST("/:package_name/download", middleware.RateLimit(ratelimit.RuleDownload), handlers.DownloadApp)        // 记录下载
+			apps.GET("/:package_name/tips", handlers.GetAppTips)                                                            // 获取应用打赏记录
+			apps.GET("/:package_name/tippers", handlers.GetAppTippers)                                                      // 获取应用打赏榜
+		}
+
+		// 开发者路由（不需要认证）
+		developers := api.Group("/developers")
+		{
+			developers.GET("", handlers.GetDevelopers)          // 获取开发者列表
+			developers.GET("/:id", handlers.GetDeveloperDetail) // 获取开发者主页（资料、成员、统计和应用）
 		}
 
 		// 需要认证的路由
 		authorized := api.Group("")
-		authorized.Use(middleware.AuthRequired())
+		authorized.Use(middleware.AuthRequired(), middleware.RateLimitWrites(ratelimit.RuleWrite))
 		{
 			// 当前用户信息
-			authorized.GET("/me", handlers.GetCurrentUser) // 获取当前用户信息
-			authorized.POST("/logout", handlers.Logout)    // 退出登录
+			authorized.GET("/me", handlers.GetCurrentUser)               // 获取当前用户信息
+			authorized.GET("/me/permissions", handlers.GetMyPermissions) // 获取我的角色和权限
+			authorized.POST("/logout", handlers.Logout)                  // 退出登录
+
+			// 账号安全
+			authorized.PUT("/me/password", handlers.ChangePassword)                                                          // 修改密码
+			authorized.PUT("/me/email", handlers.ChangeEmail)                                                                // 修改邮箱
+			authorized.POST("/me/email/send-code", middleware.RateLimit(ratelimit.RuleAuth), handlers.SendEmailVerification) // 发送邮箱验证码
+			authorized.POST("/me/email/verify", handlers.VerifyEmail)                                                        // 验证邮箱
+
+			// 第三方账号绑定
+			authorized.GET("/me/oauth", handlers.GetMyIdentities)           // 获取绑定的第三方账号
+			authorized.POST("/me/oauth/:provider/link", handlers.LinkOAuth) // 发起绑定第三方账号
+			authorized.DELETE("/me/oauth/:provider", handlers.UnlinkOAuth)  // 解绑第三方账号
+
+			// 两步验证
+			authorized.GET("/me/2fa", handlers.GetTwoFactorStatus)                      // 获取两步验证状态
+			authorized.POST("/me/2fa/setup", handlers.SetupTwoFactor)                   // 生成密钥和 otpauth URI
+			authorized.POST("/me/2fa/enable", handlers.EnableTwoFactor)                 // 校验验证码并开启两步验证
+			authorized.POST("/me/2fa/disable", handlers.DisableTwoFactor)               // 关闭两步验证
+			authorized.POST("/me/2fa/recovery-codes", handlers.RegenerateRecoveryCodes) // 重新生成恢复码
+
+			// 登录设备管理
+			authorized.GET("/sessions", handlers.GetSessions)                   // 获取登录设备列表
+			authorized.DELETE("/sessions/others", handlers.RevokeOtherSessions) // 注销其他所有设备
+			authorized.DELETE("/sessions/:id", handlers.RevokeSession)          // 注销指定设备
 
 			// 用户信息（公开）
 			authorized.GET("/users/:id", handlers.GetUserInfo)          // 获取用户信息
@@ -92,20 +187,62 @@ func main() {
 			// 浏览历史
 			authorized.GET("/history", handlers.GetViewHistory) // 获取浏览历史
 
+			// 硬币流水
+			authorized.GET("/coins/history", handlers.GetMyCoinHistory) // 获取我的硬币流水
+
+			// 创作者排行榜
+			authorized.GET("/rank/creators", handlers.GetCreatorRank) // 获取创作者收益排行榜（周榜/月榜）
+
+			// 经验与奖励
+			authorized.GET("/rewards/rules", handlers.GetRewardRules)  // 获取奖励规则
+			authorized.GET("/rewards/today", handlers.GetTodayRewards) // 获取今日奖励进度
+
+			// 成就与徽章
+			authorized.GET("/achievements", handlers.GetMyAchievements)    // 获取我的成就进度
+			authorized.GET("/users/:id/badges", handlers.GetUserBadges)    // 获取用户徽章
+			authorized.PUT("/badges/display", handlers.SetDisplayedBadges) // 设置展示的徽章
+
 			// 应用市场（需要登录的部分）
-			authorized.POST("/apps/:package_name/coin", handlers.CoinApp) // 给应用投币
+			authorized.POST("/apps/:package_name/coin", middleware.PostingAllowed(), handlers.CoinApp) // 给应用投币
 
 			// 应用上传相关
-			authorized.POST("/apps/upload", handlers.UploadApp)                  // 上传应用
-			authorized.GET("/apps/my-uploads", handlers.GetMyUploadTasks)        // 获取我的上传任务
-			authorized.GET("/apps/upload/:task_id", handlers.GetAppUploadDetail) // 获取上传任务详情
+			authorized.POST("/apps/upload", middleware.PostingAllowed(), handlers.UploadApp)                  // 上传应用
+			authorized.GET("/apps/my-uploads", handlers.GetMyUploadTasks)                                     // 获取我的上传任务
+			authorized.GET("/apps/upload/:task_id", handlers.GetAppUploadDetail)                              // 获取上传任务详情
+			authorized.PUT("/apps/upload/:task_id", middleware.PostingAllowed(), handlers.ResubmitUploadTask) // 修改并重新提交被要求修改的上传任务
+
+			// 应用版本管理和下载统计（上传者、开发者成员或拥有 app.manage 权限）
+			authorized.POST("/apps/:package_name/rollback", middleware.Audit("app.rollback", "app"), handlers.RollbackAppVersion)                                   // 回滚应用版本
+			authorized.POST("/apps/:package_name/versions/:version/withdraw", middleware.Audit("app_version.withdraw", "app_version"), handlers.WithdrawAppVersion) // 下架应用版本
+			authorized.GET("/apps/:package_name/download-stats", handlers.GetAppDownloadStats)                                                                      // 获取应用下载统计
+
+			// 开发者与应用所有权
+			authorized.GET("/me/developers", handlers.GetMyDevelopers)                                                               // 获取我所在的开发者
+			authorized.GET("/me/developer-claims", handlers.GetMyDeveloperClaims)                                                    // 获取我的开发者认领申请
+			authorized.GET("/me/developer-invites", handlers.GetMyDeveloperInvites)                                                  // 获取我收到的开发者邀请
+			authorized.POST("/developers", middleware.PostingAllowed(), handlers.CreateDeveloper)                                    // 创建开发者资料
+			authorized.PUT("/developers/:id", middleware.PostingAllowed(), handlers.UpdateDeveloper)                                 // 更新开发者资料（所有者）
+			authorized.POST("/developers/:id/claim", middleware.PostingAllowed(), handlers.ClaimDeveloper)                           // 申请认领开发者资料
+			authorized.POST("/developers/:id/members", handlers.AddDeveloperMember)                                                  // 邀请成员或修改成员角色（所有者）
+			authorized.GET("/developers/:id/invites", handlers.GetDeveloperInvites)                                                  // 获取开发者发出的成员邀请（所有者）
+			authorized.POST("/developers/invites/:id/accept", handlers.AcceptDeveloperInvite)                                        // 接受开发者邀请（被邀请的用户）
+			authorized.POST("/developers/invites/:id/reject", handlers.RejectDeveloperInvite)                                        // 拒绝开发者邀请（被邀请的用户）
+			authorized.DELETE("/developers/invites/:id", handlers.CancelDeveloperInvite)                                             // 撤回开发者邀请（所有者）
+			authorized.DELETE("/developers/:id/members/:user_id", handlers.RemoveDeveloperMember)                                    // 移除开发者成员（所有者或本人）
+			authorized.GET("/developers/:id/transfers", handlers.GetDeveloperTransfers)                                              // 获取开发者的应用转移记录（成员）
+			authorized.POST("/developers/transfers/:id/accept", middleware.Audit("app.transfer", "app"), handlers.AcceptAppTransfer) // 接受应用转移（目标开发者的所有者）
+			authorized.POST("/developers/transfers/:id/reject", handlers.RejectAppTransfer)                                          // 拒绝应用转移（目标开发者的所有者）
+			authorized.DELETE("/developers/transfers/:id", handlers.CancelAppTransfer)                                               // 取消应用转移（原开发者的所有者）
+			authorized.POST("/apps/:package_name/transfer", middleware.Audit("app.transfer_request", "app"), handlers.TransferApp)   // 发起应用转移（所属开发者的所有者）
 
 			// 审核相关（需要审核权限）
 			reviewer := authorized.Group("")
-			reviewer.Use(middleware.ReviewerRequired())
+			reviewer.Use(middleware.RequirePermission(rbac.PermAppReview), middleware.TwoFactorRequired())
 			{
-				reviewer.GET("/apps/pending", handlers.GetPendingApps) // 获取待审核应用
-				reviewer.POST("/apps/review", handlers.ReviewApp)      // 审核应用
+				reviewer.GET("/apps/pending", handlers.GetPendingApps)                                               // 获取待审核应用
+				reviewer.POST("/apps/review", middleware.Audit("app.review", "app_upload_task"), handlers.ReviewApp) // 审核应用
+				reviewer.POST("/apps/upload/:task_id/claim", handlers.ClaimUploadTask)                               // 认领上传任务
+				reviewer.DELETE("/apps/upload/:task_id/claim", handlers.ReleaseUploadTask)                           // 释放认领的上传任务
 			}
 
 			// 关注系统
@@ -124,42 +261,55 @@ func main() {
 				checkIn.GET("/status", handlers.GetCheckInStatus)       // 获取签到状态
 				checkIn.GET("/rank", handlers.GetCheckInRank)           // 获取签到排行榜
 				checkIn.GET("/history/:id", handlers.GetCheckInHistory) // 获取用户签到历史
+				checkIn.POST("/makeup", handlers.MakeupCheckIn)         // 使用补签卡补签
+			}
+
+			// 商城相关
+			shop := authorized.Group("/shop")
+			{
+				shop.GET("/items", handlers.GetShopItems)                      // 获取商品列表
+				shop.POST("/items/:id/buy", handlers.BuyShopItem)              // 购买商品
+				shop.GET("/inventory", handlers.GetMyInventory)                // 获取我的背包
+				shop.POST("/inventory/:item_id/equip", handlers.EquipItem)     // 装备装扮
+				shop.POST("/inventory/:item_id/unequip", handlers.UnequipItem) // 卸下装扮
 			}
 
 			// 板块相关
 			boards := authorized.Group("/boards")
 			{
-				boards.POST("/create", handlers.CreateBoard) // 创建板块
-				boards.GET("/list", handlers.GetAllBoards)   // 获取所有板块
-				boards.GET("/:id", handlers.GetBoardDetail)  // 获取板块详情
-				boards.PUT("/:id", handlers.UpdateBoard)     // 更新板块
-				boards.DELETE("/:id", handlers.DeleteBoard)  // 删除板块
+				boards.POST("/create", middleware.PostingAllowed(), handlers.CreateBoard)                                        // 创建板块
+				boards.GET("/list", handlers.GetAllBoards)                                                                       // 获取所有板块
+				boards.GET("/:id", handlers.GetBoardDetail)                                                                      // 获取板块详情
+				boards.PUT("/:id", middleware.PostingAllowed(), middleware.Audit("board.update", "board"), handlers.UpdateBoard) // 更新板块
+				boards.DELETE("/:id", middleware.Audit("board.delete", "board"), handlers.DeleteBoard)                           // 删除板块
 			}
 
 			// 帖子相关
 			posts := authorized.Group("/posts")
 			{
-				posts.POST("/create", handlers.CreatePost)     // 创建帖子
-				posts.GET("/list", handlers.GetPosts)          // 获取帖子列表（支持板块筛选和排序）
-				posts.GET("/my", handlers.GetMyPosts)          // 获取我的帖子列表
-				posts.GET("/:id", handlers.GetPostDetail)      // 获取帖子详情
-				posts.PUT("/:id", handlers.UpdatePost)         // 更新帖子
-				posts.DELETE("/:id", handlers.DeletePost)      // 删除帖子
-				posts.POST("/:id/like", handlers.LikePost)     // 点赞帖子
-				posts.DELETE("/:id/like", handlers.UnlikePost) // 取消点赞帖子
-				posts.POST("/:id/coin", handlers.CoinPost)     // 投币帖子
+				posts.POST("/create", middleware.PostingAllowed(), middleware.RateLimit(ratelimit.RulePost), handlers.CreatePost) // 创建帖子
+				posts.GET("/list", handlers.GetPosts)                                                                             // 获取帖子列表（支持板块筛选和排序）
+				posts.GET("/my", handlers.GetMyPosts)                                                                             // 获取我的帖子列表
+				posts.GET("/:id", handlers.GetPostDetail)                                                                         // 获取帖子详情
+				posts.PUT("/:id", middleware.PostingAllowed(), handlers.UpdatePost)                                               // 更新帖子
+				posts.DELETE("/:id", middleware.Audit("post.delete", "post"), handlers.DeletePost)                                // 删除帖子
+				posts.POST("/:id/like", handlers.LikePost)                                                                        // 点赞帖子
+				posts.DELETE("/:id/like", handlers.UnlikePost)                                                                    // 取消点赞帖子
+				posts.POST("/:id/coin", middleware.PostingAllowed(), handlers.CoinPost)                                           // 投币帖子
+				posts.GET("/:id/tips", handlers.GetPostTips)                                                                      // 获取帖子打赏记录
+				posts.GET("/:id/tippers", handlers.GetPostTippers)                                                                // 获取帖子打赏榜
 			}
 
 			// 评论相关
 			comments := authorized.Group("/comments")
 			{
-				comments.POST("/create", handlers.CreateComment)         // 创建评论（支持楼中楼回复）
-				comments.GET("/list", handlers.GetComments)              // 获取评论列表（只显示顶级评论）
-				comments.GET("/:id/replies", handlers.GetCommentReplies) // 获取评论的子回复列表
-				comments.PUT("/:id", handlers.UpdateComment)             // 更新评论
-				comments.DELETE("/:id", handlers.DeleteComment)          // 删除评论
-				comments.POST("/:id/like", handlers.LikeComment)         // 点赞评论
-				comments.POST("/:id/coin", handlers.CoinComment)         // 投币评论
+				comments.POST("/create", middleware.PostingAllowed(), middleware.RateLimit(ratelimit.RuleComment), handlers.CreateComment) // 创建评论（支持楼中楼回复）
+				comments.GET("/list", handlers.GetComments)                                                                                // 获取评论列表（只显示顶级评论）
+				comments.GET("/:id/replies", handlers.GetCommentReplies)                                                                   // 获取评论的子回复列表
+				comments.PUT("/:id", middleware.PostingAllowed(), handlers.UpdateComment)                                                  // 更新评论
+				comments.DELETE("/:id", middleware.Audit("comment.delete", "comment"), handlers.DeleteComment)                             // 删除评论
+				comments.POST("/:id/like", handlers.LikeComment)                                                                           // 点赞评论
+				comments.POST("/:id/coin", middleware.PostingAllowed(), handlers.CoinComment)                                              // 投币评论
 			}
 
 			// 统计相关
@@ -170,13 +320,64 @@ func main() {
 			}
 		}
 
-		// 管理员路由
+		// 管理员路由（按权限控制）
 		admin := api.Group("/admin")
-		admin.Use(middleware.AuthRequired(), middleware.AdminRequired())
+		admin.Use(middleware.AuthRequired(), middleware.TwoFactorRequired())
 		{
-			admin.PUT("/users/:id/level", handlers.SetUserLevel)    // 设置用户等级
-			admin.POST("/users/tags", handlers.CreateUserTag)       // 创建用户标签
-			admin.DELETE("/users/tags/:id", handlers.DeleteUserTag) // 删除用户标签
+			perm := middleware.RequirePermission
+			audit := middleware.Audit
+			admin.PUT("/users/:id/level", perm(rbac.PermUserSetLevel), audit("user.set_level", "user"), handlers.SetUserLevel)                          // 设置用户等级
+			admin.POST("/users/tags", perm(rbac.PermUserTag), audit("user_tag.create", "user_tag"), handlers.CreateUserTag)                             // 创建用户标签
+			admin.DELETE("/users/tags/:id", perm(rbac.PermUserTag), audit("user_tag.delete", "user_tag"), handlers.DeleteUserTag)                       // 删除用户标签
+			admin.GET("/users/restricted", perm(rbac.PermUserRestrict), handlers.GetRestrictedUsers)                                                    // 获取受限用户列表
+			admin.GET("/users/:id/restriction", perm(rbac.PermUserRestrict), handlers.GetUserRestrictions)                                              // 获取用户的限制状态和记录
+			admin.POST("/users/:id/restriction", perm(rbac.PermUserRestrict), audit("user.restrict", "user"), handlers.RestrictUser)                    // 禁言、暂停或封禁用户
+			admin.DELETE("/users/:id/restriction", perm(rbac.PermUserRestrict), audit("user.unrestrict", "user"), handlers.LiftUserRestriction)         // 解除账号限制
+			admin.GET("/stats", perm(rbac.PermStatsView), handlers.GetAdminStats)                                                                       // 运营统计
+			admin.GET("/coins/reconcile", perm(rbac.PermCoinReconcile), handlers.ReconcileCoins)                                                        // 硬币对账
+			admin.POST("/rewards/reload", perm(rbac.PermConfigReload), audit("config.reload_rewards", "config"), handlers.ReloadRewardRules)            // 重新加载奖励规则
+			admin.POST("/achievements/reload", perm(rbac.PermConfigReload), audit("config.reload_achievements", "config"), handlers.ReloadAchievements) // 重新加载成就定义
+			admin.PUT("/posts/:id/feature", perm(rbac.PermPostModerate), audit("post.feature", "post"), handlers.FeaturePost)                           // 设置精华帖
+			admin.GET("/shop/items", perm(rbac.PermShopManage), handlers.AdminGetShopItems)                                                             // 获取全部商品
+			admin.POST("/shop/items", perm(rbac.PermShopManage), audit("shop_item.create", "shop_item"), handlers.CreateShopItem)                       // 创建商品
+			admin.PUT("/shop/items/:id", perm(rbac.PermShopManage), audit("shop_item.update", "shop_item"), handlers.UpdateShopItem)                    // 更新商品
+			admin.DELETE("/shop/items/:id", perm(rbac.PermShopManage), audit("shop_item.delete", "shop_item"), handlers.DeleteShopItem)                 // 下架商品
+
+			// 应用审核管理
+			admin.POST("/reviews/assign", perm(rbac.PermAppReviewLead), audit("app_review.assign", "app_upload_task"), handlers.AssignUploadTasks) // 分配审核任务
+			admin.POST("/reviews/batch", perm(rbac.PermAppReviewLead), audit("app_review.batch", "app_upload_task"), handlers.BatchReviewApps)     // 批量审核
+			admin.GET("/reviews/stats", perm(rbac.PermAppReviewLead), handlers.GetReviewStats)                                                     // 审核统计
+
+			// 应用分类管理
+			admin.GET("/categories", perm(rbac.PermCategoryManage), handlers.AdminGetCategories)                                                                   // 获取全部分类（含已停用）
+			admin.POST("/categories", perm(rbac.PermCategoryManage), audit("category.create", "app_category"), handlers.CreateCategory)                            // 创建大分类
+			admin.PUT("/categories/:id", perm(rbac.PermCategoryManage), audit("category.update", "app_category"), handlers.UpdateCategory)                         // 更新大分类（改名时同步应用）
+			admin.DELETE("/categories/:id", perm(rbac.PermCategoryManage), audit("category.delete", "app_category"), handlers.DeleteCategory)                      // 删除未使用的大分类
+			admin.POST("/categories/:id/merge", perm(rbac.PermCategoryManage), audit("category.merge", "app_category"), handlers.MergeCategory)                    // 合并大分类
+			admin.POST("/categories/:id/subcategories", perm(rbac.PermCategoryManage), audit("subcategory.create", "app_subcategory"), handlers.CreateSubCategory) // 创建小分类
+			admin.PUT("/subcategories/:id", perm(rbac.PermCategoryManage), audit("subcategory.update", "app_subcategory"), handlers.UpdateSubCategory)             // 更新小分类（改名时同步应用）
+			admin.DELETE("/subcategories/:id", perm(rbac.PermCategoryManage), audit("subcategory.delete", "app_subcategory"), handlers.DeleteSubCategory)          // 删除未使用的小分类
+			admin.POST("/subcategories/:id/merge", perm(rbac.PermCategoryManage), audit("subcategory.merge", "app_subcategory"), handlers.MergeSubCategory)        // 合并小分类
+
+			// 开发者管理
+			admin.GET("/developers/claims", perm(rbac.PermDeveloperManage), handlers.AdminGetDeveloperClaims)                                                        // 获取开发者认领申请
+			admin.POST("/developers/claims/:id/review", perm(rbac.PermDeveloperManage), audit("developer_claim.review", "developer"), handlers.ReviewDeveloperClaim) // 审核开发者认领申请
+			admin.PUT("/developers/:id/verify", perm(rbac.PermDeveloperManage), audit("developer.verify", "developer"), handlers.VerifyDeveloper)                    // 设置或取消开发者认证
+			admin.PUT("/apps/:package_name/developer", perm(rbac.PermDeveloperManage), audit("app.set_developer", "app"), handlers.SetAppDeveloper)                  // 设置应用所属的开发者
+
+			// 角色与权限
+			admin.GET("/permissions", perm(rbac.PermRoleManage), handlers.GetPermissions)                                                    // 获取可分配的权限
+			admin.GET("/roles", perm(rbac.PermRoleManage), handlers.GetRoles)                                                                // 获取角色列表
+			admin.POST("/roles", perm(rbac.PermRoleManage), audit("role.create", "role"), handlers.CreateRole)                               // 创建角色
+			admin.PUT("/roles/:id", perm(rbac.PermRoleManage), audit("role.update", "role"), handlers.UpdateRole)                            // 更新角色
+			admin.DELETE("/roles/:id", perm(rbac.PermRoleManage), audit("role.delete", "role"), handlers.DeleteRole)                         // 删除角色
+			admin.GET("/users/:id/roles", perm(rbac.PermRoleManage), handlers.GetUserRoles)                                                  // 获取用户的角色
+			admin.POST("/users/:id/roles", perm(rbac.PermRoleManage), audit("user.assign_role", "user"), handlers.AssignUserRole)            // 为用户分配角色
+			admin.DELETE("/users/:id/roles/:role_id", perm(rbac.PermRoleManage), audit("user.remove_role", "user"), handlers.RemoveUserRole) // 移除用户的角色
+
+			// 审计日志
+			admin.GET("/audit-logs", perm(rbac.PermAuditView), handlers.GetAuditLogs)           // 查询审计日志
+			admin.GET("/audit-logs/export", perm(rbac.PermAuditView), handlers.ExportAuditLogs) // 导出审计日志（CSV）
 		}
 	}
 
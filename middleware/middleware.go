@@ -1,9 +1,21 @@
 package middleware
 
 import (
+	"TaruApp/audit"
+	"TaruApp/config"
 	"TaruApp/database"
 	"TaruApp/models"
+	"TaruApp/ratelimit"
+	"TaruApp/rbac"
+	"TaruApp/utils"
+	"bytes"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -51,6 +63,133 @@ func CORS() gin.HandlerFunc {
 	}
 }
 
+// 已吊销会话的访问令牌黑名单（会话ID -> 记录失效时间），记录保留到该会话签发的访问令牌全部过期为止
+var (
+	revokedSessions   = make(map[string]time.Time)
+	revokedSessionsMu sync.RWMutex
+)
+
+// RevokeSession 让会话已签发的访问令牌立即失效
+func RevokeSession(sessionID string) {
+	now := time.Now()
+	revokedSessionsMu.Lock()
+	defer revokedSessionsMu.Unlock()
+
+	// 顺便清理已经没有意义的记录
+	for id, until := range revokedSessions {
+		if now.After(until) {
+			delete(revokedSessions, id)
+		}
+	}
+	revokedSessions[sessionID] = now.Add(time.Duration(config.AppConfig.AccessTokenTTL) * time.Minute)
+}
+
+// isSessionRevoked 检查会话是否已被吊销
+func isSessionRevoked(sessionID string) bool {
+	revokedSessionsMu.RLock()
+	defer revokedSessionsMu.RUnlock()
+	until, ok := revokedSessions[sessionID]
+	return ok && time.Now().Before(until)
+}
+
+// 受限账号（用户ID -> 限制状态），启动时从数据库加载，管理员修改时同步更新，认证时不需要查询数据库
+var (
+	restrictedUsers   = make(map[int64]models.UserRestriction)
+	restrictedUsersMu sync.RWMutex
+)
+
+// SetUserRestriction 更新账号限制状态，状态为 active 时解除限制
+func SetUserRestriction(userID int64, restriction models.UserRestriction) {
+	restrictedUsersMu.Lock()
+	defer restrictedUsersMu.Unlock()
+	if restriction.Status == models.UserStatusActive {
+		delete(restrictedUsers, userID)
+		return
+	}
+	restrictedUsers[userID] = restriction
+}
+
+// ActiveRestriction 获取账号生效中的限制，已到期或没有限制时返回 false
+func ActiveRestriction(userID int64) (models.UserRestriction, bool) {
+	restrictedUsersMu.RLock()
+	defer restrictedUsersMu.RUnlock()
+	restriction, ok := restrictedUsers[userID]
+	if !ok || (restriction.Until != nil && !time.Now().Before(*restriction.Until)) {
+		return models.UserRestriction{}, false
+	}
+	return restriction, true
+}
+
+// 今天已记录活跃的用户，避免每次请求都写数据库（跨天时清空）
+var (
+	activeUsers    = make(map[int64]bool)
+	activeUsersDay string
+	activeUsersMu  sync.Mutex
+)
+
+// recordUserActivity 记录用户当天活跃（用于统计日活），每个用户每天只写一次数据库
+func recordUserActivity(userID int64) {
+	day := time.Now().Format("2006-01-02")
+
+	activeUsersMu.Lock()
+	if activeUsersDay != day {
+		activeUsersDay = day
+		activeUsers = make(map[int64]bool)
+	}
+	seen := activeUsers[userID]
+	activeUsers[userID] = true
+	activeUsersMu.Unlock()
+	if seen {
+		return
+	}
+
+	if _, err := database.DB.Exec(
+		"INSERT OR IGNORE INTO user_daily_activity (user_id, day) VALUES (?, ?)", userID, day,
+	); err != nil {
+		log.Printf("记录用户活跃失败: user_id=%d err=%v", userID, err)
+		activeUsersMu.Lock()
+		delete(activeUsers, userID)
+		activeUsersMu.Unlock()
+	}
+}
+
+// IsLoginBlocked 检查账号是否被暂停或封禁（不能登录和访问需要认证的接口）
+func IsLoginBlocked(restriction models.UserRestriction) bool {
+	return restriction.Status == models.UserStatusSuspended || restriction.Status == models.UserStatusBanned
+}
+
+// RestrictionMessage 生成账号限制的提示信息
+func RestrictionMessage(restriction models.UserRestriction) string {
+	var message string
+	switch restriction.Status {
+	case models.UserStatusMuted:
+		message = "账号已被禁言"
+	case models.UserStatusSuspended:
+		message = "账号已被暂停使用"
+	default:
+		message = "账号已被封禁"
+	}
+	if restriction.Until != nil {
+		message += "，解除时间: " + restriction.Until.Local().Format("2006-01-02 15:04:05")
+	} else {
+		message += "（永久）"
+	}
+	if restriction.Reason != "" {
+		message += "，原因: " + restriction.Reason
+	}
+	return message
+}
+
+// AbortRestricted 返回 403 和账号限制信息
+func AbortRestricted(c *gin.Context, restriction models.UserRestriction) {
+	c.JSON(403, models.Response{
+		Code:    403,
+		Message: RestrictionMessage(restriction),
+		Data:    restriction,
+	})
+	c.Abort()
+}
+
 // AuthRequired Token认证中间件
 func AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -65,21 +204,16 @@ func AuthRequired() gin.HandlerFunc {
 			return
 		}
 
-		// 在数据库中验证token
-		var tokenData models.Token
-		var user models.User
-		err := database.DB.QueryRow(`
-			SELECT t.id, t.user_id, t.token, t.expires_at, t.created_at,
-			       u.id, u.username, u.level, u.avatar, u.coins, u.exp, u.user_level
-			FROM tokens t
-			JOIN users u ON t.user_id = u.id
-			WHERE t.token = ? AND t.expires_at > datetime('now')
-		`, token).Scan(
-			&tokenData.ID, &tokenData.UserID, &tokenData.Token,
-			&tokenData.ExpiresAt, &tokenData.CreatedAt,
-			&user.ID, &user.Username, &user.Level, &user.Avatar, &user.Coins, &user.Exp, &user.UserLevel,
-		)
-
+		// 校验访问令牌签名和有效期（不查询数据库）
+		claims, err := utils.ParseAccessToken(token, config.TokenSecrets())
+		if err == utils.ErrTokenExpired {
+			c.JSON(401, models.Response{
+				Code:    401,
+				Message: "认证令牌已过期，请使用刷新令牌重新获取",
+			})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(401, models.Response{
 				Code:    401,
@@ -88,21 +222,46 @@ func AuthRequired() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if isSessionRevoked(claims.SessionID) {
+			c.JSON(401, models.Response{
+				Code:    401,
+				Message: "登录会话已失效，请重新登录",
+			})
+			c.Abort()
+			return
+		}
+		if restriction, ok := ActiveRestriction(claims.UserID); ok && IsLoginBlocked(restriction) {
+			AbortRestricted(c, restriction)
+			return
+		}
 
 		// 将用户信息存储到上下文中
-		c.Set("user_id", user.ID)
-		c.Set("username", user.Username)
-		c.Set("user_level", user.Level)
-		c.Set("user", user)
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("user_level", claims.Level)
+		c.Set("session_id", claims.SessionID)
+		c.Set("two_factor", claims.TwoFactor)
+		recordUserActivity(claims.UserID)
 
 		c.Next()
 	}
 }
 
-// AdminRequired 管理员权限中间件
-func AdminRequired() gin.HandlerFunc {
+// PostingAllowed 禁止被禁言的用户发布内容（需在 AuthRequired 之后使用）
+func PostingAllowed() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userLevel, exists := c.Get("user_level")
+		if restriction, ok := ActiveRestriction(c.GetInt64("user_id")); ok {
+			AbortRestricted(c, restriction)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission 权限中间件，要求当前用户的角色拥有指定权限（需在 AuthRequired 之后使用）
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
 		if !exists {
 			c.JSON(403, models.Response{
 				Code:    403,
@@ -112,10 +271,19 @@ func AdminRequired() gin.HandlerFunc {
 			return
 		}
 
-		if userLevel.(int) < 50 {
+		ok, err := rbac.HasPermission(userID.(int64), permission)
+		if err != nil {
+			c.JSON(500, models.Response{
+				Code:    500,
+				Message: "查询权限失败: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		if !ok {
 			c.JSON(403, models.Response{
 				Code:    403,
-				Message: "需要管理员权限",
+				Message: "权限不足，需要权限: " + permission,
 			})
 			c.Abort()
 			return
@@ -125,38 +293,105 @@ func AdminRequired() gin.HandlerFunc {
 	}
 }
 
-// ReviewerRequired 审核权限中间件
-func ReviewerRequired() gin.HandlerFunc {
+// TwoFactorRequired 要求当前会话通过两步验证登录（由 ADMIN_REQUIRE_2FA 开启）
+func TwoFactorRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		levelValue, exists := c.Get("level")
-		if !exists {
-			c.JSON(403, models.Response{
-				Code:    403,
-				Message: "未授权访问",
-			})
-			c.Abort()
+		if !config.AppConfig.AdminRequire2FA || c.GetBool("two_factor") {
+			c.Next()
 			return
 		}
 
-		// level >= 80 表示有审核权限
-		if levelValue.(int) < 80 {
-			c.JSON(403, models.Response{
-				Code:    403,
-				Message: "需要审核权限",
-			})
-			c.Abort()
+		c.JSON(403, models.Response{
+			Code:    403,
+			Message: "该操作需要开启两步验证并使用验证码登录",
+		})
+		c.Abort()
+	}
+}
+
+// RateLimit 限流中间件，按规则限制请求频率；登录后按用户限制，未登录按 IP 限制（需要按用户限制时放在 AuthRequired 之后）
+func RateLimit(rule string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if checkRateLimit(c, rule) {
+			c.Next()
+		}
+	}
+}
+
+// RateLimitWrites 只限制写操作（GET、HEAD、OPTIONS 请求不计数）
+func RateLimitWrites(rule string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
 			return
 		}
+		if checkRateLimit(c, rule) {
+			c.Next()
+		}
+	}
+}
 
-		c.Next()
+// checkRateLimit 检查请求是否超出限制，超出时返回 429 并中止请求
+func checkRateLimit(c *gin.Context, rule string) bool {
+	key := "ip:" + c.ClientIP()
+	if userID, exists := c.Get("user_id"); exists {
+		key = fmt.Sprintf("user:%d", userID.(int64))
+	}
+
+	allowed, retryAfter := ratelimit.Allow(rule, key)
+	if allowed {
+		return true
 	}
+	AbortTooManyRequests(c, retryAfter, "请求过于频繁")
+	return false
 }
 
-// RateLimiter 简单的限流中间件
-func RateLimiter() gin.HandlerFunc {
-	// 这里可以实现更复杂的限流逻辑
+// AbortTooManyRequests 返回 429 并设置 Retry-After（秒）
+func AbortTooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, models.Response{
+		Code:    429,
+		Message: fmt.Sprintf("%s，请在 %d 秒后重试", message, seconds),
+	})
+	c.Abort()
+}
+
+// maxAuditBodySize 审计日志记录的请求体大小上限，超过时不记录请求体
+const maxAuditBodySize = 64 << 10
+
+// Audit 审计中间件，请求成功（状态码小于400）后写入审计日志。
+// 操作对象默认为路由参数 id，操作后的数据默认为 JSON 请求体，处理器可以通过 audit.SetTarget、SetBefore、SetAfter 补充
+func Audit(action, targetType string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var body []byte
+		if c.Request.Body != nil && c.ContentType() == "application/json" {
+			data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxAuditBodySize+1))
+			if err == nil {
+				// 把读取的内容放回去，处理器仍然可以正常解析请求体
+				c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), c.Request.Body))
+				if len(data) <= maxAuditBodySize {
+					body = data
+				}
+			}
+		}
+
 		c.Next()
+
+		if c.Writer.Status() >= 400 {
+			return
+		}
+		entry, ok := audit.FromContext(c, action, targetType, body)
+		if !ok {
+			return
+		}
+		if err := audit.Write(entry); err != nil {
+			log.Printf("写入审计日志失败: action=%s err=%v", action, err)
+		}
 	}
 }
 
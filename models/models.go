@@ -1,13 +1,16 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // User 用户模型
 type User struct {
 	ID        int64     `json:"id"`
 	Username  string    `json:"username"`
 	Password  string    `json:"-"`          // 密码不返回给前端
-	Email     string    `json:"email"`      // 邮箱（预留）
+	Email     string    `json:"email"`      // 邮箱
 	Level     int       `json:"level"`      // 用户等级: 0-普通用户, 50-管理员
 	Avatar    string    `json:"avatar"`     // 头像URL
 	Coins     int       `json:"coins"`      // 硬币数量
@@ -15,6 +18,12 @@ type User struct {
 	UserLevel int       `json:"user_level"` // 用户等级 (Lv1, Lv2...)
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	EmailVerified    bool           `json:"email_verified"`      // 邮箱是否已验证
+	TwoFactorEnabled bool           `json:"two_factor_enabled"`  // 是否已开启两步验证
+	Cosmetics        *UserCosmetics `json:"cosmetics,omitempty"` // 已装备的装扮
+
+	Restriction *UserRestriction `json:"restriction,omitempty"` // 生效中的账号限制（只在获取当前用户信息时返回）
 }
 
 // Follow 关注关系模型
@@ -44,28 +53,31 @@ type UserTag struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-// Token 认证令牌模型
-type Token struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	Token     string    `json:"token"`      // RC4加密的token
-	ExpiresAt time.Time `json:"expires_at"` // 过期时间
-	CreatedAt time.Time `json:"created_at"`
+// RefreshToken 刷新令牌模型，同一次登录轮换出的令牌属于同一个令牌族
+type RefreshToken struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	TokenHash string     `json:"-"`          // 令牌的 SHA-256 哈希，原文只返回给客户端一次
+	FamilyID  string     `json:"family_id"`  // 令牌族ID，即所属登录会话的ID
+	ExpiresAt time.Time  `json:"expires_at"` // 过期时间
+	UsedAt    *time.Time `json:"used_at"`    // 被轮换使用的时间
+	RevokedAt *time.Time `json:"revoked_at"` // 被吊销的时间
+	CreatedAt time.Time  `json:"created_at"`
 }
 
 // Board 板块模型
 type Board struct {
-	ID             int64     `json:"id"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description"`
-	AvatarURL      string    `json:"avatar_url"`      // 板块头像URL
-	CreatorID      int64     `json:"creator_id"`      // 创建者用户ID
-	CreatorName    string    `json:"creator_name"`    // 创建者用户名
-	CreatorAvatar  string    `json:"creator_avatar"`  // 创建者头像URL
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	CreatedAtTs    int64     `json:"created_at_ts"`   // 创建时间戳（秒）
-	UpdatedAtTs    int64     `json:"updated_at_ts"`   // 更新时间戳（秒）
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	AvatarURL     string    `json:"avatar_url"`     // 板块头像URL
+	CreatorID     int64     `json:"creator_id"`     // 创建者用户ID
+	CreatorName   string    `json:"creator_name"`   // 创建者用户名
+	CreatorAvatar string    `json:"creator_avatar"` // 创建者头像URL
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	CreatedAtTs   int64     `json:"created_at_ts"` // 创建时间戳（秒）
+	UpdatedAtTs   int64     `json:"updated_at_ts"` // 更新时间戳（秒）
 }
 
 // Post 帖子模型
@@ -86,9 +98,12 @@ type Post struct {
 	AttachmentType string    `json:"attachment_type"` // 附件类型 (apk, zip等)
 	CommentCount   int       `json:"comment_count"`   // 评论数
 	ViewCount      int       `json:"view_count"`      // 浏览数
+	IsFeatured     bool      `json:"is_featured"`     // 是否精华帖
 	LastReplyTime  time.Time `json:"last_reply_time"` // 最后回复时间
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
+
+	Cosmetics *UserCosmetics `json:"cosmetics,omitempty"` // 发布者已装备的装扮
 }
 
 // Comment 评论模型
@@ -110,25 +125,266 @@ type Comment struct {
 	IsMyComment bool      `json:"is_my_comment"` // 是否是当前用户的评论
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	Cosmetics *UserCosmetics `json:"cosmetics,omitempty"` // 评论者已装备的装扮
 }
 
 // CreateUserRequest 创建用户请求
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=20"`
 	Password string `json:"password" binding:"required,min=8"`
-	Email    string `json:"email"` // 预留邮箱字段
+	Email    string `json:"email" binding:"omitempty,email"` // 邮箱（可选），填写后会发送验证码
 	Avatar   string `json:"avatar"`
 }
 
 // LoginRequest 登录请求
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	DeviceName string `json:"device_name" binding:"max=50"` // 设备名称（可选），显示在登录设备列表中
+}
+
+// LoginTwoFactorRequest 两步验证登录请求
+type LoginTwoFactorRequest struct {
+	Challenge string `json:"challenge" binding:"required"` // 登录接口返回的挑战令牌
+	Code      string `json:"code" binding:"required"`      // 验证器应用中的 6 位验证码或恢复码
+}
+
+// SetupTwoFactorRequest 生成两步验证密钥请求
+type SetupTwoFactorRequest struct {
+	Password string `json:"password"` // 当前密码，尚未设置密码的账号需要先通过找回密码设置密码
+}
+
+// TwoFactorCodeRequest 提交两步验证码的请求
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest 关闭两步验证请求
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`                // 尚未设置密码的账号可以不填
+	Code     string `json:"code" binding:"required"` // 6 位验证码或恢复码
+}
+
+// RefreshTokenRequest 刷新令牌请求
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Session 登录会话（一次登录对应一个会话，刷新令牌时延续）
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"` // 设备名称，由客户端登录时提供
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`   // 登录时间
+	LastSeenAt time.Time `json:"last_seen_at"` // 最后活跃时间（登录或刷新令牌时更新）
+	ExpiresAt  time.Time `json:"expires_at"`   // 会话过期时间（即最新刷新令牌的过期时间）
+	IsCurrent  bool      `json:"is_current"`   // 是否为当前请求所在的会话
+}
+
+// UserIdentity 绑定的第三方账号
+type UserIdentity struct {
+	Provider    string     `json:"provider"` // 身份提供方，如 github、google
+	Email       string     `json:"email"`    // 第三方账号的邮箱
+	Name        string     `json:"name"`     // 第三方账号的名称
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"` // 最后一次使用该账号登录的时间
+}
+
+// TokenPair 登录或刷新后下发的令牌对
+type TokenPair struct {
+	Token            string    `json:"token"`              // 访问令牌，放在请求头 Token 中
+	ExpiresAt        time.Time `json:"expires_at"`         // 访问令牌过期时间
+	RefreshToken     string    `json:"refresh_token"`      // 刷新令牌，只能使用一次
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"` // 刷新令牌过期时间
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"` // 第三方登录自动注册、尚未设置密码的账号不填
+	Code        string `json:"code"`         // 尚未设置密码的账号必填：两步验证码或恢复码
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// ForgotPasswordRequest 忘记密码请求
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest 重置密码请求
+type ResetPasswordRequest struct {
+	Email       string `json:"email" binding:"required,email"`
+	Code        string `json:"code" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// VerifyEmailRequest 验证邮箱请求
+type VerifyEmailRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ChangeEmailRequest 修改邮箱请求
+type ChangeEmailRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password"` // 当前密码
+	Code     string `json:"code"`     // 未设置密码的账号填写两步验证码或恢复码
 }
 
 // SetUserLevelRequest 设置用户等级请求
 type SetUserLevelRequest struct {
-	Level int `json:"level" binding:"required"`
+	Level int `json:"level"` // 0-普通用户, 50-管理员
+}
+
+// Role 角色
+type Role struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`         // 角色标识，如 admin、reviewer
+	DisplayName string    `json:"display_name"` // 显示名称
+	Description string    `json:"description"`
+	IsSystem    bool      `json:"is_system"`            // 系统角色不能删除
+	Permissions []string  `json:"permissions"`          // 权限列表，* 表示全部权限
+	UserCount   int       `json:"user_count,omitempty"` // 拥有该角色的用户数
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateRoleRequest 创建角色请求
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,min=2,max=32"`
+	DisplayName string   `json:"display_name" binding:"required,max=50"`
+	Description string   `json:"description" binding:"max=200"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRoleRequest 更新角色请求
+type UpdateRoleRequest struct {
+	DisplayName string   `json:"display_name" binding:"required,max=50"`
+	Description string   `json:"description" binding:"max=200"`
+	Permissions []string `json:"permissions"`
+}
+
+// AssignRoleRequest 为用户分配角色请求
+type AssignRoleRequest struct {
+	RoleID int64 `json:"role_id" binding:"required"`
+}
+
+// 账号状态
+const (
+	UserStatusActive    = "active"    // 正常
+	UserStatusMuted     = "muted"     // 禁言：到期前不能发帖、评论、创建板块和上传应用
+	UserStatusSuspended = "suspended" // 暂停：到期前不能登录和访问需要认证的接口
+	UserStatusBanned    = "banned"    // 封禁：不能登录和访问需要认证的接口，不设到期时间时为永久封禁
+)
+
+// UserRestriction 账号限制状态
+type UserRestriction struct {
+	Status     string     `json:"status"`
+	Until      *time.Time `json:"until"` // 到期时间，为空表示永久
+	Reason     string     `json:"reason"`
+	OperatorID int64      `json:"operator_id"` // 执行操作的管理员
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// UserRestrictionRecord 账号限制变更记录
+type UserRestrictionRecord struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	Status       string     `json:"status"` // 变更后的状态，active 表示解除限制
+	Until        *time.Time `json:"until"`
+	Reason       string     `json:"reason"`
+	OperatorID   int64      `json:"operator_id"`
+	OperatorName string     `json:"operator_name"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RestrictUserRequest 限制账号请求
+type RestrictUserRequest struct {
+	Status   string `json:"status" binding:"required,oneof=muted suspended banned"`
+	Duration int    `json:"duration" binding:"min=0"` // 时长（分钟），禁言和暂停必须大于0，封禁为0时表示永久
+	Reason   string `json:"reason" binding:"required,max=200"`
+}
+
+// LiftRestrictionRequest 解除账号限制请求
+type LiftRestrictionRequest struct {
+	Reason string `json:"reason" binding:"max=200"`
+}
+
+// AuditLog 审计日志
+type AuditLog struct {
+	ID         int64           `json:"id"`
+	ActorID    int64           `json:"actor_id"`
+	ActorName  string          `json:"actor_name"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"` // 操作前的数据，没有时为 null
+	After      json.RawMessage `json:"after"`  // 操作后的数据，没有时为 null
+	IP         string          `json:"ip"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AdminStatsQuery 运营统计查询参数
+type AdminStatsQuery struct {
+	From   string `form:"from"`                                            // 开始日期 2006-01-02，默认为结束日期前29天
+	To     string `form:"to"`                                              // 结束日期 2006-01-02（包含当天），默认为今天
+	Bucket string `form:"bucket" binding:"omitempty,oneof=day week month"` // 统计粒度，默认 day
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=50"`          // 排行榜数量，默认10
+}
+
+// AdminStatsPoint 运营统计时间序列中的一个时间段（按天、周或月）
+type AdminStatsPoint struct {
+	Date        string `json:"date"` // 时间段的第一天
+	NewUsers    int    `json:"new_users"`
+	ActiveUsers int    `json:"active_users"` // 时间段内访问过需要认证接口的用户数（去重）
+	Posts       int    `json:"posts"`
+	Comments    int    `json:"comments"`
+	CheckIns    int    `json:"check_ins"`
+	Uploads     int    `json:"uploads"`   // 新提交的应用上传任务
+	Approvals   int    `json:"approvals"` // 审核通过的上传任务
+	Downloads   int    `json:"downloads"`
+}
+
+// BoardRank 板块活跃度排行
+type BoardRank struct {
+	BoardID  int64  `json:"board_id"`
+	Name     string `json:"name"`
+	Posts    int    `json:"posts"`
+	Comments int    `json:"comments"`
+}
+
+// AppRank 应用下载排行
+type AppRank struct {
+	AppID       int64  `json:"app_id"`
+	PackageName string `json:"package_name"`
+	Name        string `json:"name"`
+	Downloads   int    `json:"downloads"`
+}
+
+// DurationPercentiles 时长分布（单位：秒）
+type DurationPercentiles struct {
+	Count int   `json:"count"`
+	P50   int64 `json:"p50"`
+	P90   int64 `json:"p90"`
+	P99   int64 `json:"p99"`
+	Max   int64 `json:"max"`
+}
+
+// ReviewQueueStats 审核队列统计
+type ReviewQueueStats struct {
+	PendingAge     DurationPercentiles `json:"pending_age"`     // 当前待审核任务已等待的时长
+	ReviewDuration DurationPercentiles `json:"review_duration"` // 统计范围内审核完成的任务从提交到审核的时长
+}
+
+// AdminStats 运营统计
+type AdminStats struct {
+	From        string            `json:"from"`
+	To          string            `json:"to"`
+	Bucket      string            `json:"bucket"`
+	Totals      AdminStatsPoint   `json:"totals"` // 整个统计范围的合计，active_users 为范围内去重后的用户数
+	Series      []AdminStatsPoint `json:"series"`
+	TopBoards   []BoardRank       `json:"top_boards"`
+	TopApps     []AppRank         `json:"top_apps"`
+	ReviewQueue ReviewQueueStats  `json:"review_queue"`
 }
 
 // CreateUserTagRequest 创建用户标签请求
@@ -233,7 +489,7 @@ type UserDetail struct {
 type CreateBoardRequest struct {
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description"`
-	AvatarURL   string `json:"avatar_url"`   // 板块头像URL（可选）
+	AvatarURL   string `json:"avatar_url"` // 板块头像URL（可选）
 }
 
 // CreatePostRequest 创建帖子请求
@@ -256,6 +512,7 @@ type CreateCommentRequest struct {
 type GetPostsQuery struct {
 	BoardID  int64  `form:"board_id"`                                 // 板块ID
 	Sort     string `form:"sort" binding:"oneof=latest reply hot ''"` // 排序方式: latest(最新发布), reply(最近回复), hot(热门)
+	Featured bool   `form:"featured"`                                 // 只看精华帖
 	Page     int    `form:"page"`                                     // 页码
 	PageSize int    `form:"page_size"`                                // 每页数量
 }
@@ -317,6 +574,31 @@ type AppVersion struct {
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
+// AppVersionItem 版本历史中的一个版本
+type AppVersionItem struct {
+	Version        string     `json:"version"`
+	VersionCode    int        `json:"version_code"`
+	Size           int64      `json:"size"`
+	UpdateContent  string     `json:"update_content"` // 更新内容
+	UploaderName   string     `json:"uploader_name"`
+	IsLatest       bool       `json:"is_latest"`
+	DownloadCount  int        `json:"download_count"`            // 该版本的下载次数
+	Withdrawn      bool       `json:"withdrawn"`                 // 是否已下架
+	WithdrawnAt    *time.Time `json:"withdrawn_at,omitempty"`    // 下架时间
+	WithdrawReason string     `json:"withdraw_reason,omitempty"` // 下架原因
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// RollbackAppRequest 回滚应用版本请求
+type RollbackAppRequest struct {
+	Version string `json:"version" binding:"required"` // 设为最新版本的版本号
+}
+
+// WithdrawAppVersionRequest 下架应用版本请求
+type WithdrawAppVersionRequest struct {
+	Reason string `json:"reason" binding:"required,max=200"`
+}
+
 // AppListItem 应用列表项
 type AppListItem struct {
 	PackageName string  `json:"package_name"`
@@ -327,38 +609,56 @@ type AppListItem struct {
 	Rating      float64 `json:"rating"`
 }
 
+// SimilarApp 相似应用
+type SimilarApp struct {
+	AppListItem
+	SharedTags      int  `json:"shared_tags"`       // 共同标签数
+	SameSubCategory bool `json:"same_sub_category"` // 是否属于同一小分类
+}
+
+// TagSuggestion 标签自动补全结果
+type TagSuggestion struct {
+	Name     string `json:"name"`
+	AppCount int    `json:"app_count"` // 使用该标签的应用数
+}
+
 // AppDetail 应用详情
 type AppDetail struct {
-	PackageName   string   `json:"package_name"`
-	Name          string   `json:"name"`
-	IconURL       string   `json:"icon_url"`
-	Version       string   `json:"version"`
-	VersionCode   int      `json:"version_code"`
-	Size          int64    `json:"size"`
-	Rating        float64  `json:"rating"`
-	RatingCount   int      `json:"rating_count"`
-	Description   string   `json:"description"`
-	Screenshots   []string `json:"screenshots"`
-	Tags          []string `json:"tags"`
-	DownloadURL   string   `json:"download_url"`
-	TotalCoins    int      `json:"total_coins"`
-	DownloadCount int      `json:"download_count"`
-	UploaderName  string   `json:"uploader_name"`
-	UpdateContent string   `json:"update_content"`
-	UpdateTime    string   `json:"update_time"`
-	MainCategory  string   `json:"main_category"`  // 大分类
-	SubCategory   string   `json:"sub_category"`   // 小分类
-	Channel       string   `json:"channel"`        // 渠道
-	ShareDesc     string   `json:"share_desc"`     // 分享说明
-	DeveloperName string   `json:"developer_name"` // 开发者名称
-	AdLevel       string   `json:"ad_level"`       // 广告级别
-	PaymentType   string   `json:"payment_type"`   // 付费类型
-	OperationType string   `json:"operation_type"` // 运营方式
+	PackageName          string   `json:"package_name"`
+	Name                 string   `json:"name"`
+	IconURL              string   `json:"icon_url"`
+	Version              string   `json:"version"`
+	VersionCode          int      `json:"version_code"`
+	Size                 int64    `json:"size"`
+	Rating               float64  `json:"rating"`
+	RatingCount          int      `json:"rating_count"`
+	Description          string   `json:"description"`
+	Screenshots          []string `json:"screenshots"`
+	Tags                 []string `json:"tags"`
+	DownloadURL          string   `json:"download_url"`
+	TotalCoins           int      `json:"total_coins"`
+	DownloadCount        int      `json:"download_count"`
+	VersionDownloadCount int      `json:"version_download_count"` // 当前版本的下载次数
+	UploaderName         string   `json:"uploader_name"`
+	UpdateContent        string   `json:"update_content"`
+	UpdateTime           string   `json:"update_time"`
+	MainCategory         string   `json:"main_category"`  // 大分类
+	SubCategory          string   `json:"sub_category"`   // 小分类
+	Channel              string   `json:"channel"`        // 渠道
+	ShareDesc            string   `json:"share_desc"`     // 分享说明
+	DeveloperName        string   `json:"developer_name"` // 开发者名称
+	AdLevel              string   `json:"ad_level"`       // 广告级别
+	PaymentType          string   `json:"payment_type"`   // 付费类型
+	OperationType        string   `json:"operation_type"` // 运营方式
+
+	Developer *DeveloperBrief `json:"developer"` // 关联的开发者资料，没有时为 null
 }
 
 // GetAppsQuery 获取应用列表查询参数
 type GetAppsQuery struct {
-	Category string `form:"category"`  // 分类筛选
+	Category string `form:"category"`  // 按单个标签筛选（旧参数，等同于 tags）
+	Tags     string `form:"tags"`      // 必须全部包含的标签，逗号分隔
+	AnyTags  string `form:"any_tags"`  // 至少包含一个的标签，逗号分隔
 	Sort     string `form:"sort"`      // 排序: rating, download, update
 	Page     int    `form:"page"`      // 页码
 	PageSize int    `form:"page_size"` // 每页数量
@@ -369,12 +669,132 @@ type GetAppDetailQuery struct {
 	Version string `form:"version"` // 版本号（可选，不传则返回最新版本）
 }
 
+// CheckUpdateItem 已安装的应用
+type CheckUpdateItem struct {
+	PackageName       string `json:"package_name" binding:"required"`
+	VersionCode       int    `json:"version_code" binding:"min=0"`
+	SignerFingerprint string `json:"signer_fingerprint"` // 已安装应用的签名证书 SHA-256 指纹（可选）
+	Channel           string `json:"channel"`            // 已安装应用的渠道（可选，不传时按已安装版本的渠道）
+}
+
+// CheckUpdatesRequest 批量检查更新请求
+type CheckUpdatesRequest struct {
+	Apps []CheckUpdateItem `json:"apps" binding:"required,max=500,dive"`
+}
+
+// AppUpdate 可更新的应用
+type AppUpdate struct {
+	PackageName          string    `json:"package_name"`
+	InstalledVersionCode int       `json:"installed_version_code"`
+	Version              string    `json:"version"`
+	VersionCode          int       `json:"version_code"`
+	Channel              string    `json:"channel"`
+	Size                 int64     `json:"size"`
+	UpdateContent        string    `json:"update_content"`
+	DownloadURL          string    `json:"download_url"`
+	SHA256               string    `json:"sha256,omitempty"` // 完整安装包的 SHA-256（生成过补丁的版本才有）
+	UpdateTime           time.Time `json:"update_time"`
+	Patch                *AppPatch `json:"patch,omitempty"` // 从已安装版本升级的增量补丁，没有时使用完整下载
+}
+
+// AppPatch 增量更新补丁
+type AppPatch struct {
+	FromVersionCode int    `json:"from_version_code"`
+	Size            int64  `json:"size"`
+	SHA256          string `json:"sha256"`        // 补丁文件的 SHA-256
+	TargetSize      int64  `json:"target_size"`   // 应用补丁后安装包的大小
+	TargetSHA256    string `json:"target_sha256"` // 应用补丁后安装包的 SHA-256，校验不通过时应改用完整下载
+	DownloadURL     string `json:"download_url"`
+}
+
+// DownloadAppQuery 记录下载查询参数
+type DownloadAppQuery struct {
+	Version  string `form:"version"`                     // 下载的版本号（可选，不传则记为最新版本）
+	ClientID string `form:"client_id" binding:"max=128"` // 客户端安装标识（可选），用于下载去重，不传时使用 User-Agent
+}
+
+// AppDownloadStatsQuery 应用下载统计查询参数
+type AppDownloadStatsQuery struct {
+	From   string `form:"from"`                                            // 开始日期 2006-01-02，默认为结束日期前29天
+	To     string `form:"to"`                                              // 结束日期 2006-01-02（包含当天），默认为今天
+	Bucket string `form:"bucket" binding:"omitempty,oneof=day week month"` // 统计粒度，默认 day
+}
+
+// DownloadStatsPoint 下载统计时间序列中的一个时间段，也用于合计和按版本、渠道的分组
+type DownloadStatsPoint struct {
+	Date      string `json:"date,omitempty"` // 时间段的第一天
+	Downloads int    `json:"downloads"`      // 去重后的下载数（同一客户端同一版本每天只算一次）
+	Requests  int    `json:"requests"`       // 下载请求数（包括重复下载）
+}
+
+// VersionDownloadStats 某个版本的下载统计
+type VersionDownloadStats struct {
+	Version     string `json:"version"`
+	VersionCode int    `json:"version_code"`
+	Channel     string `json:"channel"`
+	Downloads   int    `json:"downloads"`
+	Requests    int    `json:"requests"`
+}
+
+// ChannelDownloadStats 某个渠道的下载统计
+type ChannelDownloadStats struct {
+	Channel   string `json:"channel"`
+	Downloads int    `json:"downloads"`
+	Requests  int    `json:"requests"`
+}
+
+// AppDownloadStats 应用的下载统计（来自每日汇总，有汇总间隔的延迟）
+type AppDownloadStats struct {
+	PackageName   string                 `json:"package_name"`
+	From          string                 `json:"from"`
+	To            string                 `json:"to"`
+	Bucket        string                 `json:"bucket"`
+	DownloadCount int                    `json:"download_count"` // 应用公开的累计下载数
+	Totals        DownloadStatsPoint     `json:"totals"`
+	Series        []DownloadStatsPoint   `json:"series"`
+	Versions      []VersionDownloadStats `json:"versions"` // 统计范围内有下载的版本，按版本代码倒序
+	Channels      []ChannelDownloadStats `json:"channels"`
+}
+
 // AppCategory 应用分类
 type AppCategory struct {
 	MainCategory  string   `json:"main_category"`  // 大分类
 	SubCategories []string `json:"sub_categories"` // 小分类列表
 }
 
+// AppMainCategory 应用大分类（包含小分类）
+type AppMainCategory struct {
+	ID            int64            `json:"id"`
+	Name          string           `json:"name"`
+	IconURL       string           `json:"icon_url"`
+	SortOrder     int              `json:"sort_order"`
+	Enabled       bool             `json:"enabled"`
+	SubCategories []AppSubCategory `json:"sub_categories"`
+}
+
+// AppSubCategory 应用小分类
+type AppSubCategory struct {
+	ID         int64  `json:"id"`
+	CategoryID int64  `json:"category_id"`
+	Name       string `json:"name"`
+	IconURL    string `json:"icon_url"`
+	SortOrder  int    `json:"sort_order"`
+	Enabled    bool   `json:"enabled"`
+}
+
+// SaveAppCategoryRequest 创建/更新应用分类请求（大分类和小分类共用），修改名称时同步更新已有应用和上传任务
+type SaveAppCategoryRequest struct {
+	Name      string `json:"name" binding:"required,max=30"`
+	IconURL   string `json:"icon_url"`
+	SortOrder int    `json:"sort_order"` // 越小越靠前
+	Enabled   *bool  `json:"enabled"`    // 不传时默认启用
+}
+
+// MergeAppCategoryRequest 合并应用分类请求
+type MergeAppCategoryRequest struct {
+	TargetID int64 `json:"target_id" binding:"required"` // 合并到的分类ID（大分类合并到大分类，小分类合并到小分类）
+}
+
 // GetAppsByCategoryQuery 根据分类获取应用列表查询参数
 type GetAppsByCategoryQuery struct {
 	MainCategory string `form:"main_category" binding:"required"` // 大分类
@@ -386,62 +806,315 @@ type GetAppsByCategoryQuery struct {
 
 // AppUploadTask 应用上传任务
 type AppUploadTask struct {
-	ID            int64      `json:"id"`
-	UserID        int64      `json:"user_id"`
-	PackageName   string     `json:"package_name"`
-	Name          string     `json:"name"`
-	IconURL       string     `json:"icon_url"`
-	Version       string     `json:"version"`
-	VersionCode   int        `json:"version_code"`
-	Size          int64      `json:"size"`
-	Channel       string     `json:"channel"` // 官方版、国际版、测试版、定制版
-	MainCategory  string     `json:"main_category"`
-	SubCategory   string     `json:"sub_category"`
-	Screenshots   string     `json:"screenshots"` // JSON数组
-	Description   string     `json:"description"`
-	ShareDesc     string     `json:"share_desc"` // 分享说明
-	UpdateContent string     `json:"update_content"`
-	DeveloperName string     `json:"developer_name"`
-	AdLevel       string     `json:"ad_level"`       // 无广告、少量广告、超多广告、广告软件
-	PaymentType   string     `json:"payment_type"`   // 免费、内购、少量内购、不给钱不让用
-	OperationType string     `json:"operation_type"` // 团队开发、独立开发、开源软件
-	DownloadURL   string     `json:"download_url"`
-	Status        string     `json:"status"`        // pending、rejected、approved
-	RejectReason  string     `json:"reject_reason"` // 拒绝原因
-	ReviewerID    *int64     `json:"reviewer_id"`   // 审核员ID
-	ReviewTime    *time.Time `json:"review_time"`   // 审核时间
-	UploaderName  string     `json:"uploader_name"` // 上传者用户名
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
+	ID                int64      `json:"id"`
+	UserID            int64      `json:"user_id"`
+	PackageName       string     `json:"package_name"`
+	Name              string     `json:"name"`
+	IconURL           string     `json:"icon_url"`
+	Version           string     `json:"version"`
+	VersionCode       int        `json:"version_code"`
+	Size              int64      `json:"size"`
+	Channel           string     `json:"channel"` // 官方版、国际版、测试版、定制版
+	MainCategory      string     `json:"main_category"`
+	SubCategory       string     `json:"sub_category"`
+	Screenshots       string     `json:"screenshots"` // JSON数组
+	Description       string     `json:"description"`
+	ShareDesc         string     `json:"share_desc"` // 分享说明
+	UpdateContent     string     `json:"update_content"`
+	DeveloperName     string     `json:"developer_name"`
+	DeveloperID       int64      `json:"developer_id"`   // 开发者资料ID，0 表示未指定
+	AdLevel           string     `json:"ad_level"`       // 无广告、少量广告、超多广告、广告软件
+	PaymentType       string     `json:"payment_type"`   // 免费、内购、少量内购、不给钱不让用
+	OperationType     string     `json:"operation_type"` // 团队开发、独立开发、开源软件
+	DownloadURL       string     `json:"download_url"`
+	SignerFingerprint string     `json:"signer_fingerprint"` // 签名证书 SHA-256 指纹
+	ProposedTags      string     `json:"proposed_tags"`      // 上传者提议的标签（JSON数组）
+	Status            string     `json:"status"`             // pending、rejected、approved、changes_requested、expired（要求修改后超时未重新提交）
+	Revision          int        `json:"revision"`           // 提交次数，重新提交后加1
+	RejectReason      string     `json:"reject_reason"`      // 拒绝原因
+	ReviewerID        *int64     `json:"reviewer_id"`        // 审核员ID
+	ReviewTime        *time.Time `json:"review_time"`        // 审核时间
+	UploaderName      string     `json:"uploader_name"`      // 上传者用户名
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
 }
 
 // UploadAppRequest 上传应用请求
 type UploadAppRequest struct {
-	PackageName   string   `json:"package_name" binding:"required"`
-	Name          string   `json:"name" binding:"required"`
-	IconURL       string   `json:"icon_url" binding:"required"`
-	Version       string   `json:"version" binding:"required"`
-	VersionCode   int      `json:"version_code" binding:"required"`
-	Size          int64    `json:"size" binding:"required"`
-	Channel       string   `json:"channel" binding:"required,oneof=official international test custom"`
-	MainCategory  string   `json:"main_category" binding:"required"`
-	SubCategory   string   `json:"sub_category" binding:"required"`
-	Screenshots   []string `json:"screenshots" binding:"required"`
-	Description   string   `json:"description" binding:"required"`
-	ShareDesc     string   `json:"share_desc"`
-	UpdateContent string   `json:"update_content" binding:"required"`
-	DeveloperName string   `json:"developer_name" binding:"required"`
-	AdLevel       string   `json:"ad_level" binding:"required,oneof=none few many adware"`
-	PaymentType   string   `json:"payment_type" binding:"required,oneof=free iap few_iap paid"`
-	OperationType string   `json:"operation_type" binding:"required,oneof=team indie opensource"`
-	DownloadURL   string   `json:"download_url" binding:"required"`
+	PackageName       string   `json:"package_name" binding:"required"`
+	Name              string   `json:"name" binding:"required"`
+	IconURL           string   `json:"icon_url" binding:"required"`
+	Version           string   `json:"version" binding:"required"`
+	VersionCode       int      `json:"version_code" binding:"required"`
+	Size              int64    `json:"size" binding:"required"`
+	Channel           string   `json:"channel" binding:"required,oneof=official international test custom"`
+	MainCategory      string   `json:"main_category" binding:"required"`
+	SubCategory       string   `json:"sub_category" binding:"required"`
+	Screenshots       []string `json:"screenshots" binding:"required"`
+	Description       string   `json:"description" binding:"required"`
+	ShareDesc         string   `json:"share_desc"`
+	UpdateContent     string   `json:"update_content" binding:"required"`
+	DeveloperName     string   `json:"developer_name" binding:"required_without=DeveloperID"`
+	DeveloperID       int64    `json:"developer_id"` // 开发者资料ID（可选，必须是该开发者的成员），填写后开发者名称使用资料中的名称
+	AdLevel           string   `json:"ad_level" binding:"required,oneof=none few many adware"`
+	PaymentType       string   `json:"payment_type" binding:"required,oneof=free iap few_iap paid"`
+	OperationType     string   `json:"operation_type" binding:"required,oneof=team indie opensource"`
+	DownloadURL       string   `json:"download_url" binding:"required"`
+	SignerFingerprint string   `json:"signer_fingerprint"` // 签名证书 SHA-256 指纹（可选，64位十六进制，可带冒号）
+	Tags              []string `json:"tags"`               // 提议的标签（可选，最多10个），审核通过后生效
 }
 
 // ReviewAppRequest 审核应用请求
 type ReviewAppRequest struct {
 	TaskID       int64  `json:"task_id" binding:"required"`
-	Accept       int    `json:"accept" binding:"oneof=0 1"` // 0: 拒绝, 1: 通过
-	RejectReason string `json:"reject_reason"`              // 拒绝原因（拒绝时必填）
+	Accept       int    `json:"accept" binding:"oneof=0 1 2"` // 0: 拒绝, 1: 通过, 2: 要求修改
+	RejectReason string `json:"reject_reason"`                // 拒绝原因（拒绝时必填），要求修改时为修改说明
+	// 通过时采用的标签，传空列表时清空应用的标签；不传时采用上传者提议的标签，上传者也没有提议时保留应用原有的标签
+	Tags          *[]string       `json:"tags"`
+	Checklist     ReviewChecklist `json:"checklist"`      // 检查清单
+	Notes         string          `json:"notes"`          // 内部备注（只对审核员可见）
+	FieldComments []FieldComment  `json:"field_comments"` // 针对具体字段的修改意见（要求修改时使用）
+}
+
+// FieldComment 审核员针对上传任务某个字段的意见
+type FieldComment struct {
+	Field   string `json:"field"` // 字段名，与上传应用请求中的字段名相同
+	Comment string `json:"comment"`
+}
+
+// UploadConflict 上传内容与已上架版本或其他上传任务的冲突
+type UploadConflict struct {
+	// version_exists 版本已存在、version_code_lower 版本代码不大于最新版本、pending_task 有其他未完成的上传任务、
+	// uploader_mismatch 应用此前由其他用户上传、signer_mismatch 签名证书与最新版本不同、
+	// developer_mismatch 指定的开发者与应用所属的开发者不同
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	TaskID  int64  `json:"task_id,omitempty"` // pending_task 时为冲突的上传任务ID
+}
+
+// UploadTimelineEvent 上传任务时间线中的一条记录
+type UploadTimelineEvent struct {
+	Type          string           `json:"type"` // submitted 提交、resubmitted 重新提交、reviewed 审核
+	Revision      int              `json:"revision"`
+	Time          string           `json:"time"`
+	ChangedFields []string         `json:"changed_fields,omitempty"` // 重新提交时修改了的字段
+	Decision      string           `json:"decision,omitempty"`       // approved、rejected、changes_requested
+	Message       string           `json:"message,omitempty"`        // 拒绝原因或修改说明
+	FieldComments []FieldComment   `json:"field_comments,omitempty"`
+	ReviewerName  string           `json:"reviewer_name,omitempty"` // 以下字段只对审核员可见
+	Checklist     *ReviewChecklist `json:"checklist,omitempty"`
+	Notes         string           `json:"notes,omitempty"`
+}
+
+// ReviewChecklist 审核检查清单
+type ReviewChecklist struct {
+	AdLevelVerified       bool `json:"ad_level_verified"`      // 已核实广告级别
+	PermissionsReasonable bool `json:"permissions_reasonable"` // 权限申请合理
+	NoMalwareFound        bool `json:"no_malware_found"`       // 未发现恶意代码
+}
+
+// BatchReviewRequest 批量审核请求
+type BatchReviewRequest struct {
+	TaskIDs      []int64         `json:"task_ids" binding:"required,min=1,max=100"`
+	Accept       int             `json:"accept" binding:"oneof=0 1"` // 0: 拒绝, 1: 通过
+	RejectReason string          `json:"reject_reason"`              // 拒绝原因（拒绝时必填）
+	Checklist    ReviewChecklist `json:"checklist"`
+	Notes        string          `json:"notes"`
+}
+
+// BatchReviewResult 批量审核中单个任务的结果
+type BatchReviewResult struct {
+	TaskID  int64  `json:"task_id"`
+	Success bool   `json:"success"`
+	Status  string `json:"status,omitempty"`  // 审核后的状态
+	Message string `json:"message,omitempty"` // 失败原因
+}
+
+// AssignReviewRequest 分配审核任务请求
+type AssignReviewRequest struct {
+	TaskIDs    []int64 `json:"task_ids" binding:"required,min=1,max=100"`
+	ReviewerID int64   `json:"reviewer_id" binding:"required"`
+}
+
+// ReviewRecord 审核记录
+type ReviewRecord struct {
+	ID            int64           `json:"id"`
+	ReviewerID    int64           `json:"reviewer_id"`
+	ReviewerName  string          `json:"reviewer_name"`
+	Decision      string          `json:"decision"` // approved、rejected、changes_requested
+	Revision      int             `json:"revision"` // 审核的是第几次提交
+	Checklist     ReviewChecklist `json:"checklist"`
+	Notes         string          `json:"notes"`
+	RejectReason  string          `json:"reject_reason,omitempty"` // 拒绝原因或修改说明
+	FieldComments []FieldComment  `json:"field_comments,omitempty"`
+	Batch         bool            `json:"batch"` // 是否为批量审核
+	CreatedAt     string          `json:"created_at"`
+}
+
+// ReviewerStats 审核员工作量统计
+type ReviewerStats struct {
+	ReviewerID       int64   `json:"reviewer_id"`
+	ReviewerName     string  `json:"reviewer_name"`
+	Reviewed         int     `json:"reviewed"`          // 审核数
+	Approved         int     `json:"approved"`          // 通过数
+	Rejected         int     `json:"rejected"`          // 拒绝数
+	ChangesRequested int     `json:"changes_requested"` // 要求修改数
+	Batch            int     `json:"batch"`             // 其中批量审核数
+	AvgWaitHours     float64 `json:"avg_wait_hours"`    // 从上传到审核的平均等待时间（小时）
+	ActiveClaims     int     `json:"active_claims"`     // 当前认领中的任务数
+}
+
+// ReviewStats 审核统计
+type ReviewStats struct {
+	From         string          `json:"from"`
+	To           string          `json:"to"`
+	Pending      int             `json:"pending"`        // 当前待审核数
+	Unclaimed    int             `json:"unclaimed"`      // 其中未被认领的数量
+	Reviewed     int             `json:"reviewed"`       // 统计范围内的审核数
+	AvgWaitHours float64         `json:"avg_wait_hours"` // 统计范围内从上传到审核的平均等待时间（小时）
+	Reviewers    []ReviewerStats `json:"reviewers"`
+}
+
+// Developer 开发者资料
+type Developer struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	AvatarURL   string `json:"avatar_url"`
+	Website     string `json:"website"`
+	Email       string `json:"email"`
+	Contact     string `json:"contact"` // 其他联系方式
+	Description string `json:"description"`
+	Verified    bool   `json:"verified"`              // 是否已认证
+	VerifiedAt  string `json:"verified_at,omitempty"` // 认证时间
+	Claimed     bool   `json:"claimed"`               // 是否已有用户认领（有成员）
+	AppCount    int    `json:"app_count"`             // 关联的应用数
+	CreatedAt   string `json:"created_at"`
+}
+
+// DeveloperBrief 应用详情中显示的开发者信息
+type DeveloperBrief struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+	Verified  bool   `json:"verified"`
+}
+
+// DeveloperMember 开发者成员
+type DeveloperMember struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Avatar   string `json:"avatar"`
+	Role     string `json:"role"` // owner、member
+	JoinedAt string `json:"joined_at"`
+}
+
+// DeveloperStats 开发者所有应用的汇总数据
+type DeveloperStats struct {
+	AppCount       int     `json:"app_count"`
+	TotalDownloads int     `json:"total_downloads"`
+	Rating         float64 `json:"rating"`       // 按评分人数加权的平均评分
+	RatingCount    int     `json:"rating_count"` // 评分总人数
+}
+
+// DeveloperApp 开发者页面中的应用
+type DeveloperApp struct {
+	PackageName   string  `json:"package_name"`
+	Name          string  `json:"name"`
+	IconURL       string  `json:"icon_url"`
+	Version       string  `json:"version"`
+	Rating        float64 `json:"rating"`
+	RatingCount   int     `json:"rating_count"`
+	DownloadCount int     `json:"download_count"`
+	MainCategory  string  `json:"main_category"`
+	SubCategory   string  `json:"sub_category"`
+}
+
+// SaveDeveloperRequest 创建/修改开发者资料请求
+type SaveDeveloperRequest struct {
+	Name        string `json:"name" binding:"required,max=50"`
+	AvatarURL   string `json:"avatar_url"`
+	Website     string `json:"website" binding:"omitempty,url"`
+	Email       string `json:"email" binding:"omitempty,email"`
+	Contact     string `json:"contact" binding:"max=100"`
+	Description string `json:"description" binding:"max=1000"`
+}
+
+// ClaimDeveloperRequest 认领开发者资料请求
+type ClaimDeveloperRequest struct {
+	Message string `json:"message" binding:"required,max=500"` // 认领说明，如官网或应用商店中可以证明身份的信息
+}
+
+// DeveloperClaim 开发者认领申请
+type DeveloperClaim struct {
+	ID            int64  `json:"id"`
+	DeveloperID   int64  `json:"developer_id"`
+	DeveloperName string `json:"developer_name"`
+	UserID        int64  `json:"user_id"`
+	Username      string `json:"username"`
+	Message       string `json:"message"`
+	Status        string `json:"status"` // pending、approved、rejected
+	ReviewerName  string `json:"reviewer_name,omitempty"`
+	ReviewNote    string `json:"review_note,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	ReviewedAt    string `json:"reviewed_at,omitempty"`
+}
+
+// ReviewDeveloperClaimRequest 审核开发者认领请求
+type ReviewDeveloperClaimRequest struct {
+	Approve *bool  `json:"approve" binding:"required"`
+	Note    string `json:"note" binding:"max=500"`
+}
+
+// VerifyDeveloperRequest 设置开发者认证状态请求
+type VerifyDeveloperRequest struct {
+	Verified *bool `json:"verified" binding:"required"`
+}
+
+// AddDeveloperMemberRequest 邀请开发者成员或修改已有成员角色的请求
+type AddDeveloperMemberRequest struct {
+	UserID int64  `json:"user_id" binding:"required"`
+	Role   string `json:"role" binding:"omitempty,oneof=owner member"` // 默认为 member
+}
+
+// DeveloperInvite 开发者成员邀请，被邀请的用户接受后才会成为成员
+type DeveloperInvite struct {
+	ID            int64  `json:"id"`
+	DeveloperID   int64  `json:"developer_id"`
+	DeveloperName string `json:"developer_name"`
+	UserID        int64  `json:"user_id"`
+	Username      string `json:"username"`
+	Role          string `json:"role"` // owner、member
+	InvitedByName string `json:"invited_by_name"`
+	Status        string `json:"status"` // pending、accepted、rejected、cancelled
+	CreatedAt     string `json:"created_at"`
+	RespondedAt   string `json:"responded_at,omitempty"`
+}
+
+// TransferAppRequest 转移应用所有权请求
+type TransferAppRequest struct {
+	ToDeveloperID int64  `json:"to_developer_id" binding:"required"`
+	Note          string `json:"note" binding:"max=500"`
+}
+
+// AppTransfer 应用所有权转移记录
+type AppTransfer struct {
+	ID                int64  `json:"id"`
+	PackageName       string `json:"package_name"`
+	AppName           string `json:"app_name"`
+	FromDeveloperID   int64  `json:"from_developer_id"`
+	FromDeveloperName string `json:"from_developer_name"`
+	ToDeveloperID     int64  `json:"to_developer_id"`
+	ToDeveloperName   string `json:"to_developer_name"`
+	RequestedByName   string `json:"requested_by_name"`
+	Note              string `json:"note"`
+	Status            string `json:"status"` // pending、accepted、rejected、cancelled
+	CreatedAt         string `json:"created_at"`
+	RespondedAt       string `json:"responded_at,omitempty"`
+}
+
+// SetAppDeveloperRequest 设置应用的开发者请求
+type SetAppDeveloperRequest struct {
+	DeveloperID int64 `json:"developer_id" binding:"required"`
 }
 
 // AppChannel 应用渠道
@@ -467,3 +1140,182 @@ type AppOperationType struct {
 	Value string `json:"value"`
 	Label string `json:"label"`
 }
+
+// CoinTransaction 硬币流水（复式记账，每笔转移对应付款方和收款方两条记录）
+type CoinTransaction struct {
+	ID               int64     `json:"id"`
+	TxNo             string    `json:"tx_no"`             // 交易号，同一笔转移的两条记录相同
+	UserID           int64     `json:"user_id"`           // 账户用户ID，0 表示系统账户
+	CounterpartyID   int64     `json:"counterparty_id"`   // 对手方用户ID，0 表示系统账户
+	CounterpartyName string    `json:"counterparty_name"` // 对手方用户名
+	Amount           int       `json:"amount"`            // 变动金额，正数为收入，负数为支出
+	BalanceAfter     int       `json:"balance_after"`     // 变动后余额
+	Type             string    `json:"type"`              // 流水类型: reward, level_up, coin_post, coin_comment, coin_app...
+	RefType          string    `json:"ref_type"`          // 关联对象类型: post, comment, app...
+	RefID            int64     `json:"ref_id"`            // 关联对象ID
+	IdempotencyKey   string    `json:"-"`                 // 幂等键
+	Remark           string    `json:"remark"`            // 备注
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// CoinReconcileItem 硬币对账差异项
+type CoinReconcileItem struct {
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username"`
+	Coins      int    `json:"coins"`      // users.coins 中的余额
+	LedgerSum  int    `json:"ledger_sum"` // 流水合计
+	Difference int    `json:"difference"` // 余额 - 流水合计
+}
+
+// RewardProgressItem 奖励动作的规则及今日进度
+type RewardProgressItem struct {
+	Action      string `json:"action"`
+	Name        string `json:"name"`
+	Exp         int    `json:"exp"`          // 每次奖励经验
+	Coins       int    `json:"coins"`        // 每次奖励硬币
+	DailyCap    int    `json:"daily_cap"`    // 每日最多奖励次数，0 表示不限
+	Count       int    `json:"count"`        // 今日已奖励次数
+	Remaining   int    `json:"remaining"`    // 今日剩余奖励次数，-1 表示不限
+	EarnedExp   int    `json:"earned_exp"`   // 今日已获得经验
+	EarnedCoins int    `json:"earned_coins"` // 今日已获得硬币
+}
+
+// Achievement 成就定义（从成就配置文件加载）
+type Achievement struct {
+	Code        string `json:"code"`        // 成就唯一标识
+	Name        string `json:"name"`        // 徽章名称
+	Description string `json:"description"` // 达成条件说明
+	IconURL     string `json:"icon_url"`    // 徽章图标URL
+	Metric      string `json:"metric"`      // 统计指标: checkin_count, post_count, received_likes, featured_post_count...
+	Threshold   int    `json:"threshold"`   // 指标达到该值时授予徽章
+}
+
+// AchievementProgress 用户的成就进度
+type AchievementProgress struct {
+	Achievement
+	Progress  int        `json:"progress"`   // 当前指标值
+	Achieved  bool       `json:"achieved"`   // 是否已获得
+	AwardedAt *time.Time `json:"awarded_at"` // 获得时间
+}
+
+// UserBadge 用户获得的徽章
+type UserBadge struct {
+	ID              int64     `json:"id"`
+	UserID          int64     `json:"user_id"`
+	AchievementCode string    `json:"achievement_code"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	IconURL         string    `json:"icon_url"`
+	IsDisplayed     bool      `json:"is_displayed"`  // 是否在个人主页展示
+	DisplayOrder    int       `json:"display_order"` // 展示顺序
+	AwardedAt       time.Time `json:"awarded_at"`
+}
+
+// SetDisplayedBadgesRequest 设置展示徽章请求
+type SetDisplayedBadgesRequest struct {
+	Codes []string `json:"codes"` // 按展示顺序排列的成就标识，为空表示不展示
+}
+
+// FeaturePostRequest 设置精华帖请求
+type FeaturePostRequest struct {
+	Featured bool `json:"featured"`
+}
+
+// Tip 打赏记录（投币帖子、评论、应用时写入，可附带留言）
+type Tip struct {
+	ID             int64     `json:"id"`
+	TxNo           string    `json:"tx_no"` // 对应的硬币流水交易号
+	TipperID       int64     `json:"tipper_id"`
+	TipperName     string    `json:"tipper_name"`
+	TipperAvatar   string    `json:"tipper_avatar"`
+	ReceiverID     int64     `json:"receiver_id"` // 收款的创作者ID，0 表示无（全部由系统回收）
+	TargetType     string    `json:"target_type"` // 打赏对象类型: post, comment, app
+	TargetID       int64     `json:"target_id"`
+	Amount         int       `json:"amount"`          // 打赏硬币数
+	ReceiverAmount int       `json:"receiver_amount"` // 创作者实际获得的硬币数
+	Message        string    `json:"message"`         // 打赏留言
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TipperRankItem 打赏榜条目
+type TipperRankItem struct {
+	Rank        int    `json:"rank"`
+	UserID      int64  `json:"user_id"`
+	Username    string `json:"username"`
+	Avatar      string `json:"avatar"`
+	TotalCoins  int    `json:"total_coins"`  // 累计打赏硬币数
+	TipCount    int    `json:"tip_count"`    // 打赏次数
+	LastMessage string `json:"last_message"` // 最近一条打赏留言
+	LastTipAt   string `json:"last_tip_at"`
+}
+
+// CreatorRankItem 创作者收益排行榜条目
+type CreatorRankItem struct {
+	Rank        int    `json:"rank"`
+	UserID      int64  `json:"user_id"`
+	Username    string `json:"username"`
+	Avatar      string `json:"avatar"`
+	TotalCoins  int    `json:"total_coins"`  // 周期内获得的打赏硬币数
+	TipCount    int    `json:"tip_count"`    // 周期内收到的打赏次数
+	TipperCount int    `json:"tipper_count"` // 周期内打赏的人数
+}
+
+// UserCosmetics 用户已装备的装扮，用于在用户信息旁展示
+type UserCosmetics struct {
+	AvatarFrame       string `json:"avatar_frame,omitempty"`       // 头像框图片URL
+	NameColor         string `json:"name_color,omitempty"`         // 昵称颜色
+	ProfileBackground string `json:"profile_background,omitempty"` // 个人主页背景图片URL
+}
+
+// ShopItem 商店商品
+type ShopItem struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Type         string    `json:"type"`  // 商品类型: avatar_frame, name_color, profile_background, makeup_card, board_ticket
+	Value        string    `json:"value"` // 装扮的取值：头像框/背景为图片URL，昵称颜色为色值；道具为空
+	IconURL      string    `json:"icon_url"`
+	Price        int       `json:"price"`          // 价格（硬币）
+	Stock        int       `json:"stock"`          // 剩余库存，-1 表示不限
+	SoldCount    int       `json:"sold_count"`     // 已售数量
+	PerUserLimit int       `json:"per_user_limit"` // 每人限购数量，0 表示不限
+	IsActive     bool      `json:"is_active"`      // 是否上架
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UserItem 用户背包中的物品
+type UserItem struct {
+	ID         int64     `json:"id"`
+	ItemID     int64     `json:"item_id"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Value      string    `json:"value"`
+	IconURL    string    `json:"icon_url"`
+	Quantity   int       `json:"quantity"`    // 持有数量（装扮为1，道具为剩余数量）
+	IsEquipped bool      `json:"is_equipped"` // 是否已装备（仅装扮）
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// SaveShopItemRequest 创建/更新商品请求
+type SaveShopItemRequest struct {
+	Name         string `json:"name" binding:"required,max=50"`
+	Description  string `json:"description"`
+	Type         string `json:"type" binding:"required,oneof=avatar_frame name_color profile_background makeup_card board_ticket"`
+	Value        string `json:"value"`
+	IconURL      string `json:"icon_url"`
+	Price        int    `json:"price" binding:"min=0"`
+	Stock        int    `json:"stock" binding:"min=-1"`
+	PerUserLimit int    `json:"per_user_limit" binding:"min=0"`
+	IsActive     *bool  `json:"is_active"` // 不传时默认上架
+}
+
+// BuyShopItemRequest 购买商品请求
+type BuyShopItemRequest struct {
+	Quantity int `json:"quantity"` // 购买数量，默认1，装扮只能购买1个
+}
+
+// MakeupCheckInRequest 补签请求
+type MakeupCheckInRequest struct {
+	Date string `json:"date" binding:"required"` // 补签日期 YYYY-MM-DD
+}
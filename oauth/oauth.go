@@ -0,0 +1,356 @@
+package oauth
+
+import (
+	"TaruApp/config"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 身份提供方类型
+const (
+	KindGitHub = "github" // GitHub OAuth2（用户信息接口不是 OIDC 标准格式）
+	KindOIDC   = "oidc"   // 标准 OIDC（Google 和通用 OIDC）
+)
+
+// Identity 第三方账号信息
+type Identity struct {
+	Subject       string // 第三方账号的唯一ID
+	Username      string // 第三方用户名（用于自动注册时生成用户名）
+	Name          string // 显示名称
+	Email         string
+	EmailVerified bool
+	AvatarURL     string
+}
+
+// Provider 一个 OAuth2/OIDC 身份提供方
+type Provider struct {
+	Name         string
+	Kind         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// 端点为空且 Issuer 不为空时，首次使用前通过 OIDC discovery 获取
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+
+	mu sync.Mutex
+}
+
+// httpClient 访问身份提供方使用的 HTTP 客户端
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]*Provider{}
+)
+
+// Init 根据配置注册已启用的身份提供方
+func Init() {
+	cfg := config.AppConfig
+	callback := func(name string) string {
+		return cfg.OAuthRedirectBaseURL + "/api/auth/oauth/" + name + "/callback"
+	}
+
+	list := []*Provider{}
+	if cfg.GitHubClientID != "" {
+		list = append(list, &Provider{
+			Name:         "github",
+			Kind:         KindGitHub,
+			ClientID:     cfg.GitHubClientID,
+			ClientSecret: cfg.GitHubClientSecret,
+			RedirectURL:  callback("github"),
+			Scopes:       []string{"read:user", "user:email"},
+			AuthURL:      "https://github.com/login/oauth/authorize",
+			TokenURL:     "https://github.com/login/oauth/access_token",
+			UserInfoURL:  "https://api.github.com/user",
+		})
+	}
+	if cfg.GoogleClientID != "" {
+		list = append(list, &Provider{
+			Name:         "google",
+			Kind:         KindOIDC,
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+			RedirectURL:  callback("google"),
+			Scopes:       []string{"openid", "email", "profile"},
+			AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+			TokenURL:     "https://oauth2.googleapis.com/token",
+			UserInfoURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+		})
+	}
+	if cfg.OIDCIssuer != "" && cfg.OIDCProviderName != "" {
+		scopes := cfg.OIDCScopes
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+		list = append(list, &Provider{
+			Name:         cfg.OIDCProviderName,
+			Kind:         KindOIDC,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  callback(cfg.OIDCProviderName),
+			Scopes:       scopes,
+			Issuer:       cfg.OIDCIssuer,
+		})
+	}
+
+	for _, p := range list {
+		Register(p)
+	}
+}
+
+// Register 注册（或替换）身份提供方
+func Register(p *Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[p.Name] = p
+}
+
+// Get 按名称获取身份提供方
+func Get(name string) (*Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Names 返回已启用的身份提供方名称
+func Names() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GenerateCodeVerifier 生成 PKCE code_verifier（43 个字符）
+func GenerateCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge 计算 PKCE code_challenge（S256）
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL 生成跳转到身份提供方的授权地址
+func (p *Provider) AuthCodeURL(ctx context.Context, state, codeChallenge string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + params.Encode(), nil
+}
+
+// Exchange 使用授权码和 code_verifier 换取访问令牌
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := doJSON(req, &token); err != nil {
+		return "", err
+	}
+	// GitHub 出错时也返回 200，需要检查 error 字段
+	if token.Error != "" {
+		return "", fmt.Errorf("%s: %s", token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("身份提供方未返回访问令牌")
+	}
+	return token.AccessToken, nil
+}
+
+// FetchIdentity 使用访问令牌获取第三方账号信息
+func (p *Provider) FetchIdentity(ctx context.Context, accessToken string) (*Identity, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+	if p.Kind == KindGitHub {
+		return p.fetchGitHubIdentity(ctx, accessToken)
+	}
+
+	var claims struct {
+		Subject           string `json:"sub"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+		Email             string `json:"email"`
+		EmailVerified     any    `json:"email_verified"` // 部分提供方返回字符串 "true"
+		Picture           string `json:"picture"`
+	}
+	if err := p.getJSON(ctx, p.UserInfoURL, accessToken, &claims); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("身份提供方未返回用户ID")
+	}
+
+	verified := false
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified, _ = strconv.ParseBool(v)
+	}
+	return &Identity{
+		Subject:       claims.Subject,
+		Username:      claims.PreferredUsername,
+		Name:          claims.Name,
+		Email:         claims.Email,
+		EmailVerified: verified && claims.Email != "",
+		AvatarURL:     claims.Picture,
+	}, nil
+}
+
+// fetchGitHubIdentity 获取 GitHub 账号信息，公开邮箱为空时从邮箱列表中取已验证的主邮箱
+func (p *Provider) fetchGitHubIdentity(ctx context.Context, accessToken string) (*Identity, error) {
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := p.getJSON(ctx, p.UserInfoURL, accessToken, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, errors.New("身份提供方未返回用户ID")
+	}
+
+	identity := &Identity{
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Username:  user.Login,
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.getJSON(ctx, p.UserInfoURL+"/emails", accessToken, &emails); err == nil {
+		for _, e := range emails {
+			if e.Primary && e.Verified {
+				identity.Email = e.Email
+				identity.EmailVerified = true
+				break
+			}
+		}
+	}
+	return identity, nil
+}
+
+// discover 通过 OIDC discovery 获取端点（只在首次成功时请求一次）
+func (p *Provider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Issuer == "" || (p.AuthURL != "" && p.TokenURL != "" && p.UserInfoURL != "") {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	var doc struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	if err := doJSON(req, &doc); err != nil {
+		return fmt.Errorf("获取 OIDC 配置失败: %v", err)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserInfoEndpoint == "" {
+		return errors.New("OIDC 配置缺少必要的端点")
+	}
+	p.AuthURL = doc.AuthorizationEndpoint
+	p.TokenURL = doc.TokenEndpoint
+	p.UserInfoURL = doc.UserInfoEndpoint
+	return nil
+}
+
+// getJSON 携带访问令牌请求 JSON 接口
+func (p *Provider) getJSON(ctx context.Context, endpoint, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	return doJSON(req, v)
+}
+
+// doJSON 发送请求并解析 JSON 响应
+func doJSON(req *http.Request, v any) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回 %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,107 @@
+package oauth_test
+
+import (
+	"TaruApp/oauth"
+	"TaruApp/oauth/oauthtest"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// authorize 访问授权地址，返回身份提供方跳转回来的 code 和 state
+func authorize(t *testing.T, authorizeURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authorizeURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("授权接口返回 %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func newTestProvider(issuer string) *oauth.Provider {
+	return &oauth.Provider{
+		Name:        "mock",
+		Kind:        oauth.KindOIDC,
+		ClientID:    "client-id",
+		RedirectURL: "http://localhost/api/auth/oauth/mock/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+		Issuer:      issuer,
+	}
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	idp := oauthtest.NewMockIdP(oauth.Identity{
+		Subject:       "subject-1",
+		Username:      "alice",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+	})
+	idp.ClientID = "client-id"
+	srv := httptest.NewServer(idp)
+	defer srv.Close()
+
+	ctx := context.Background()
+	provider := newTestProvider(srv.URL)
+	verifier, err := oauth.GenerateCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizeURL, err := provider.AuthCodeURL(ctx, "state-1", oauth.CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := authorize(t, authorizeURL)
+	if state != "state-1" {
+		t.Fatalf("state = %q", state)
+	}
+
+	accessToken, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := provider.FetchIdentity(ctx, accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "subject-1" || identity.Email != "alice@example.com" || !identity.EmailVerified {
+		t.Fatalf("identity = %+v", identity)
+	}
+
+	// 授权码只能使用一次
+	if _, err = provider.Exchange(ctx, code, verifier); err == nil {
+		t.Fatal("重复使用授权码应当失败")
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	srv := httptest.NewServer(oauthtest.NewMockIdP(oauth.Identity{Subject: "subject-1"}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	provider := newTestProvider(srv.URL)
+	verifier, _ := oauth.GenerateCodeVerifier()
+	authorizeURL, err := provider.AuthCodeURL(ctx, "state-1", oauth.CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, authorizeURL)
+
+	other, _ := oauth.GenerateCodeVerifier()
+	if _, err = provider.Exchange(ctx, code, other); err == nil {
+		t.Fatal("code_verifier 不匹配时应当失败")
+	}
+}
@@ -0,0 +1,168 @@
+// Package oauthtest 提供测试用的模拟 OIDC 身份提供方
+package oauthtest
+
+import (
+	"TaruApp/oauth"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// MockIdP 本地模拟的 OIDC 身份提供方，只在测试中使用
+//
+// 用 httptest.NewServer(oauthtest.NewMockIdP(identity)) 启动后，把服务地址作为 Provider.Issuer 即可。
+// 授权接口不需要登录，直接带上授权码跳转回 redirect_uri；令牌接口会校验 client_id、redirect_uri 和 PKCE。
+type MockIdP struct {
+	ClientID string // 不为空时校验 client_id
+
+	mu       sync.Mutex
+	identity oauth.Identity
+	codes    map[string]mockGrant
+	tokens   map[string]oauth.Identity
+}
+
+// mockGrant 已签发但未兑换的授权码
+type mockGrant struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	identity      oauth.Identity
+}
+
+// NewMockIdP 创建模拟身份提供方，授权时返回指定的账号信息
+func NewMockIdP(identity oauth.Identity) *MockIdP {
+	return &MockIdP{
+		identity: identity,
+		codes:    map[string]mockGrant{},
+		tokens:   map[string]oauth.Identity{},
+	}
+}
+
+// SetIdentity 修改之后授权返回的账号信息
+func (m *MockIdP) SetIdentity(identity oauth.Identity) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.identity = identity
+}
+
+// ServeHTTP 实现 discovery、授权、令牌和用户信息接口
+func (m *MockIdP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		issuer := "http://" + r.Host
+		writeMockJSON(w, http.StatusOK, map[string]any{
+			"issuer":                           issuer,
+			"authorization_endpoint":           issuer + "/authorize",
+			"token_endpoint":                   issuer + "/token",
+			"userinfo_endpoint":                issuer + "/userinfo",
+			"code_challenge_methods_supported": []string{"S256"},
+		})
+	case "/authorize":
+		m.authorize(w, r)
+	case "/token":
+		m.token(w, r)
+	case "/userinfo":
+		m.userInfo(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *MockIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if m.ClientID != "" && q.Get("client_id") != m.ClientID {
+		http.Error(w, "invalid client_id", http.StatusBadRequest)
+		return
+	}
+
+	code := mockRandom()
+	m.mu.Lock()
+	m.codes[code] = mockGrant{
+		clientID:      q.Get("client_id"),
+		redirectURI:   q.Get("redirect_uri"),
+		codeChallenge: q.Get("code_challenge"),
+		identity:      m.identity,
+	}
+	m.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (m *MockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	m.mu.Lock()
+	grant, ok := m.codes[code]
+	delete(m.codes, code) // 授权码只能使用一次
+	m.mu.Unlock()
+
+	if !ok || grant.clientID != r.PostForm.Get("client_id") || grant.redirectURI != r.PostForm.Get("redirect_uri") ||
+		oauth.CodeChallenge(r.PostForm.Get("code_verifier")) != grant.codeChallenge {
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	accessToken := mockRandom()
+	m.mu.Lock()
+	m.tokens[accessToken] = grant.identity
+	m.mu.Unlock()
+
+	writeMockJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (m *MockIdP) userInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	m.mu.Lock()
+	identity, ok := m.tokens[accessToken]
+	m.mu.Unlock()
+	if !ok {
+		writeMockJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+
+	writeMockJSON(w, http.StatusOK, map[string]any{
+		"sub":                identity.Subject,
+		"preferred_username": identity.Username,
+		"name":               identity.Name,
+		"email":              identity.Email,
+		"email_verified":     identity.EmailVerified,
+		"picture":            identity.AvatarURL,
+	})
+}
+
+func writeMockJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func mockRandom() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval 清理过期数据的最短间隔
+const sweepInterval = time.Minute
+
+// MemoryStore 进程内的限流存储（只在单实例内有效，重启后清空）
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	counters  map[string]*counter
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time // 令牌补满的时间，之后可以直接删除
+}
+
+type counter struct {
+	count     int
+	expiresAt time.Time
+}
+
+// NewMemoryStore 创建内存限流存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  map[string]*bucket{},
+		counters: map[string]*counter{},
+	}
+}
+
+// Take 从令牌桶中取出一个令牌
+func (s *MemoryStore) Take(key string, limit Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Period.Seconds() // 每秒补充的令牌数
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updatedAt: now}
+		s.buckets[key] = b
+	} else {
+		b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+		b.updatedAt = now
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait, nil
+	}
+	b.tokens--
+	b.fullAt = now.Add(time.Duration((capacity - b.tokens) / rate * float64(time.Second)))
+	return true, 0, nil
+}
+
+// Incr 计数器加一
+func (s *MemoryStore) Incr(key string, window time.Duration) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expiresAt) {
+		c = &counter{expiresAt: now.Add(window)}
+		s.counters[key] = c
+	}
+	c.count++
+	return c.count, c.expiresAt.Sub(now), nil
+}
+
+// Get 获取计数器
+func (s *MemoryStore) Get(key string) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expiresAt) {
+		return 0, 0, nil
+	}
+	return c.count, c.expiresAt.Sub(now), nil
+}
+
+// Delete 删除计数器
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	return nil
+}
+
+// sweep 清理已补满的令牌桶和过期的计数器（调用方需持有锁）
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if !now.Before(b.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, c := range s.counters {
+		if !now.Before(c.expiresAt) {
+			delete(s.counters, key)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"TaruApp/config"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit 令牌桶限制：桶容量为 Requests，每 Period 补满一次（匀速补充）
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// String 返回 "次数/时间" 格式，如 10/1m0s
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// Store 限流数据存储接口。内存实现只在单实例内有效，多实例部署时可以换成共享存储（如 Redis）
+type Store interface {
+	// Take 从令牌桶中取出一个令牌，令牌不足时返回 false 和需要等待的时间
+	Take(key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+	// Incr 计数器加一，返回当前计数和剩余有效时间；计数器从首次计数起 window 后过期
+	Incr(key string, window time.Duration) (count int, ttl time.Duration, err error)
+	// Get 返回计数器的当前计数和剩余有效时间，不存在时计数为 0
+	Get(key string) (count int, ttl time.Duration, err error)
+	// Delete 删除计数器
+	Delete(key string) error
+}
+
+// 限流规则名称
+const (
+	RuleRegister = "register" // 注册（按 IP）
+	RuleLogin    = "login"    // 登录（按 IP）
+	RuleAuth     = "auth"     // 两步验证、刷新令牌、找回密码、发送验证码等
+	RulePost     = "post"     // 发帖（按用户）
+	RuleComment  = "comment"  // 评论（按用户）
+	RuleDownload = "download" // 记录下载（按 IP）
+	RuleUpdate   = "update"   // 检查应用更新（按 IP）
+	RuleWrite    = "write"    // 登录后的其他写操作（按用户）
+)
+
+// defaultLimits 内置默认规则，可通过 RATE_LIMITS 覆盖
+var defaultLimits = map[string]Limit{
+	RuleRegister: {5, time.Hour},
+	RuleLogin:    {10, time.Minute},
+	RuleAuth:     {20, time.Minute},
+	RulePost:     {10, time.Minute},
+	RuleComment:  {30, time.Minute},
+	RuleDownload: {30, time.Minute},
+	RuleUpdate:   {30, time.Minute},
+	RuleWrite:    {120, time.Minute},
+}
+
+var (
+	// Default 全局限流存储
+	Default Store = NewMemoryStore()
+
+	limitsMu sync.RWMutex
+	limits   = copyLimits(defaultLimits)
+)
+
+// Init 根据配置加载限流规则，RATE_LIMIT_ENABLED 为 false 时关闭所有规则
+func Init() {
+	if !config.AppConfig.RateLimitEnabled {
+		limitsMu.Lock()
+		limits = map[string]Limit{}
+		limitsMu.Unlock()
+		return
+	}
+
+	loaded := copyLimits(defaultLimits)
+	for _, item := range config.AppConfig.RateLimits {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			log.Printf("忽略无效的限流规则: %s", item)
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if strings.TrimSpace(value) == "off" {
+			delete(loaded, name)
+			continue
+		}
+		limit, err := ParseLimit(value)
+		if err != nil {
+			log.Printf("忽略无效的限流规则 %s: %v", item, err)
+			continue
+		}
+		loaded[name] = limit
+	}
+
+	limitsMu.Lock()
+	limits = loaded
+	limitsMu.Unlock()
+}
+
+// ParseLimit 解析 "次数/时间" 格式的限制，如 10/1m、5/1h、100/30s
+func ParseLimit(s string) (Limit, error) {
+	count, period, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("格式应为 次数/时间")
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("次数无效: %s", count)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("时间无效: %s", period)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// GetLimit 获取规则的限制，规则不存在或已关闭时返回 false
+func GetLimit(rule string) (Limit, bool) {
+	limitsMu.RLock()
+	defer limitsMu.RUnlock()
+	limit, ok := limits[rule]
+	return limit, ok
+}
+
+// Allow 按规则检查 key（如 IP 或用户ID）是否可以继续请求，不允许时返回需要等待的时间。
+// 存储出错时放行，避免限流故障导致整个服务不可用
+func Allow(rule, key string) (bool, time.Duration) {
+	limit, ok := GetLimit(rule)
+	if !ok {
+		return true, 0
+	}
+	allowed, retryAfter, err := Default.Take("rl:"+rule+":"+key, limit)
+	if err != nil {
+		log.Printf("限流检查失败: rule=%s key=%s err=%v", rule, key, err)
+		return true, 0
+	}
+	return allowed, retryAfter
+}
+
+// loginFailureKey、loginLockKey 登录失败计数和锁定状态的存储键
+func loginFailureKey(key string) string { return "login_fail:" + key }
+func loginLockKey(key string) string    { return "login_lock:" + key }
+
+// LoginLockedFor 返回登录被锁定的剩余时间，未锁定时返回 0
+func LoginLockedFor(key string) time.Duration {
+	count, ttl, err := Default.Get(loginLockKey(key))
+	if err != nil {
+		log.Printf("查询登录锁定状态失败: %v", err)
+		return 0
+	}
+	if count == 0 {
+		return 0
+	}
+	return ttl
+}
+
+// RecordLoginFailure 记录一次登录失败；失败次数在 LOGIN_FAILURE_WINDOW 内达到 LOGIN_MAX_FAILURES 时锁定，返回锁定时间
+func RecordLoginFailure(key string) time.Duration {
+	cfg := config.AppConfig
+	if cfg.LoginMaxFailures <= 0 {
+		return 0
+	}
+
+	count, _, err := Default.Incr(loginFailureKey(key), time.Duration(cfg.LoginFailureWindow)*time.Minute)
+	if err != nil {
+		log.Printf("记录登录失败次数失败: %v", err)
+		return 0
+	}
+	if count < cfg.LoginMaxFailures {
+		return 0
+	}
+
+	lockout := time.Duration(cfg.LoginLockoutDuration) * time.Minute
+	if _, _, err := Default.Incr(loginLockKey(key), lockout); err != nil {
+		log.Printf("锁定登录失败: %v", err)
+		return 0
+	}
+	Default.Delete(loginFailureKey(key))
+	return lockout
+}
+
+// ResetLoginFailures 登录成功后清除失败计数
+func ResetLoginFailures(key string) {
+	if err := Default.Delete(loginFailureKey(key)); err != nil {
+		log.Printf("清除登录失败次数失败: %v", err)
+	}
+}
+
+func copyLimits(src map[string]Limit) map[string]Limit {
+	dst := make(map[string]Limit, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
@@ -0,0 +1,246 @@
+package rbac
+
+import (
+	"TaruApp/database"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+)
+
+// 权限
+const (
+	PermAll             = "*"                // 全部权限（仅系统管理员角色）
+	PermAppReview       = "app.review"       // 审核应用、查看所有上传任务
+	PermAppReviewLead   = "app.review_lead"  // 分配审核任务、批量审核、查看审核统计
+	PermUserSetLevel    = "user.set_level"   // 设置用户等级
+	PermUserTag         = "user.tag"         // 管理用户标签
+	PermUserRestrict    = "user.restrict"    // 禁言、暂停和封禁用户
+	PermRoleManage      = "role.manage"      // 管理角色、为用户分配角色
+	PermBoardManage     = "board.manage"     // 管理所有板块，创建板块不需要创建券
+	PermPostModerate    = "post.moderate"    // 删除任意帖子和评论、设置精华帖
+	PermShopManage      = "shop.manage"      // 管理商城商品
+	PermCoinReconcile   = "coin.reconcile"   // 硬币对账
+	PermConfigReload    = "config.reload"    // 重新加载奖励规则和成就定义
+	PermAuditView       = "audit.view"       // 查看和导出审计日志
+	PermStatsView       = "stats.view"       // 查看运营统计
+	PermAppManage       = "app.manage"       // 回滚和下架任意应用的版本
+	PermCategoryManage  = "category.manage"  // 管理应用分类
+	PermDeveloperManage = "developer.manage" // 审核开发者认领、认证开发者、设置应用的开发者
+)
+
+// 系统内置角色
+const (
+	RoleAdmin     = "admin"
+	RoleReviewer  = "reviewer"
+	RoleModerator = "moderator"
+)
+
+// Permission 权限说明
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions 可分配的权限列表
+var Permissions = []Permission{
+	{PermAppReview, "审核应用、查看所有上传任务"},
+	{PermAppReviewLead, "分配审核任务、批量审核、查看审核统计"},
+	{PermUserSetLevel, "设置用户等级"},
+	{PermUserTag, "管理用户标签"},
+	{PermUserRestrict, "禁言、暂停和封禁用户"},
+	{PermRoleManage, "管理角色、为用户分配角色"},
+	{PermBoardManage, "管理所有板块，创建板块不需要创建券"},
+	{PermPostModerate, "删除任意帖子和评论、设置精华帖"},
+	{PermShopManage, "管理商城商品"},
+	{PermCoinReconcile, "硬币对账"},
+	{PermConfigReload, "重新加载奖励规则和成就定义"},
+	{PermAuditView, "查看和导出审计日志"},
+	{PermStatsView, "查看运营统计"},
+	{PermAppManage, "回滚和下架任意应用的版本"},
+	{PermCategoryManage, "管理应用分类"},
+	{PermDeveloperManage, "审核开发者认领、认证开发者、设置应用的开发者"},
+}
+
+// IsValidPermission 检查权限名称是否存在
+func IsValidPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultRoles 首次启动时创建的系统角色
+var defaultRoles = []struct {
+	name        string
+	displayName string
+	description string
+	permissions []string
+}{
+	{RoleAdmin, "管理员", "拥有全部权限", []string{PermAll}},
+	{RoleReviewer, "审核员", "审核用户上传的应用", []string{PermAppReview}},
+	{RoleModerator, "版主", "管理板块和帖子", []string{PermBoardManage, PermPostModerate}},
+}
+
+// legacyAdminLevel 引入角色前表示管理员的 level 值
+const legacyAdminLevel = 50
+
+// legacyReviewerLevel 引入角色前表示审核员的 level 值
+const legacyReviewerLevel = 80
+
+// cacheTTL 用户权限缓存时间，角色变更时会主动失效
+const cacheTTL = time.Minute
+
+type cachedPermissions struct {
+	permissions map[string]bool
+	loadedAt    time.Time
+}
+
+var (
+	cacheMu sync.RWMutex
+	cache   = map[int64]cachedPermissions{}
+)
+
+// EnsureDefaultRoles 创建系统角色；首次创建时按原来的 level 为已有的管理员和审核员分配角色。
+// adminUsernames 中的用户每次启动都会确保拥有管理员角色（用于初始化第一个管理员）
+func EnsureDefaultRoles(adminUsernames []string) error {
+	var count int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM roles").Scan(&count); err != nil {
+		return err
+	}
+	firstRun := count == 0
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, role := range defaultRoles {
+		var roleID int64
+		err := tx.QueryRow("SELECT id FROM roles WHERE name = ?", role.name).Scan(&roleID)
+		if err == sql.ErrNoRows {
+			result, err := tx.Exec(
+				"INSERT INTO roles (name, display_name, description, is_system) VALUES (?, ?, ?, 1)",
+				role.name, role.displayName, role.description,
+			)
+			if err != nil {
+				return err
+			}
+			roleID, _ = result.LastInsertId()
+			for _, perm := range role.permissions {
+				if _, err := tx.Exec("INSERT INTO role_permissions (role_id, permission) VALUES (?, ?)", roleID, perm); err != nil {
+					return err
+				}
+			}
+			log.Printf("✓ 创建系统角色: %s", role.name)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if firstRun {
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO user_roles (user_id, role_id)
+			SELECT u.id, r.id FROM users u, roles r WHERE r.name = ? AND u.level >= ?
+		`, RoleAdmin, legacyAdminLevel)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO user_roles (user_id, role_id)
+			SELECT u.id, r.id FROM users u, roles r WHERE r.name = ? AND u.level >= ?
+		`, RoleReviewer, legacyReviewerLevel)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, username := range adminUsernames {
+		result, err := tx.Exec(`
+			INSERT OR IGNORE INTO user_roles (user_id, role_id)
+			SELECT u.id, r.id FROM users u, roles r WHERE r.name = ? AND u.username = ?
+		`, RoleAdmin, username)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			log.Printf("✓ 已为用户 %s 分配管理员角色", username)
+		}
+		if _, err := tx.Exec("UPDATE users SET level = ? WHERE username = ? AND level < ?", legacyAdminLevel, username, legacyAdminLevel); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UserPermissions 获取用户拥有的权限（带缓存）
+func UserPermissions(userID int64) (map[string]bool, error) {
+	cacheMu.RLock()
+	cached, ok := cache[userID]
+	cacheMu.RUnlock()
+	if ok && time.Since(cached.loadedAt) < cacheTTL {
+		return cached.permissions, nil
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT DISTINCT rp.permission
+		FROM user_roles ur
+		JOIN role_permissions rp ON ur.role_id = rp.role_id
+		WHERE ur.user_id = ?
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := map[string]bool{}
+	for rows.Next() {
+		var perm string
+		if err := rows.Scan(&perm); err == nil {
+			permissions[perm] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	cacheMu.Lock()
+	cache[userID] = cachedPermissions{permissions: permissions, loadedAt: time.Now()}
+	cacheMu.Unlock()
+	return permissions, nil
+}
+
+// HasPermission 检查用户是否拥有指定权限
+func HasPermission(userID int64, permission string) (bool, error) {
+	permissions, err := UserPermissions(userID)
+	if err != nil {
+		return false, err
+	}
+	return permissions[PermAll] || permissions[permission], nil
+}
+
+// Can 检查用户是否拥有指定权限，查询失败时视为没有权限
+func Can(userID int64, permission string) bool {
+	ok, err := HasPermission(userID, permission)
+	if err != nil {
+		log.Printf("查询用户权限失败: user_id=%d err=%v", userID, err)
+	}
+	return ok
+}
+
+// Invalidate 清除用户的权限缓存
+func Invalidate(userID int64) {
+	cacheMu.Lock()
+	delete(cache, userID)
+	cacheMu.Unlock()
+}
+
+// InvalidateAll 清除所有用户的权限缓存（修改角色权限后调用）
+func InvalidateAll() {
+	cacheMu.Lock()
+	cache = map[int64]cachedPermissions{}
+	cacheMu.Unlock()
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 访问令牌校验错误
+var (
+	ErrTokenMalformed = errors.New("令牌格式错误")
+	ErrTokenSignature = errors.New("令牌签名无效")
+	ErrTokenExpired   = errors.New("令牌已过期")
+)
+
+// AccessClaims 访问令牌中携带的用户信息
+type AccessClaims struct {
+	UserID    int64  `json:"sub"`
+	Username  string `json:"name"`
+	Level     int    `json:"lvl"`           // 权限等级
+	SessionID string `json:"sid"`           // 所属登录会话（刷新令牌族）
+	TwoFactor bool   `json:"tfa,omitempty"` // 会话是否通过了两步验证
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// tokenHeader 访问令牌头部，kid 用于在轮换密钥时选择校验密钥
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// SigningKeyID 根据密钥计算密钥ID（不泄露密钥本身）
+func SigningKeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:4])
+}
+
+// SignAccessToken 使用 HMAC-SHA256 签发访问令牌（JWT 格式）
+func SignAccessToken(claims AccessClaims, secret string) (string, error) {
+	header, err := json.Marshal(tokenHeader{Alg: "HS256", Typ: "JWT", Kid: SigningKeyID(secret)})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + signToken(signingInput, secret), nil
+}
+
+// ParseAccessToken 校验访问令牌的签名和有效期，secrets 中任意一个密钥签发的令牌都视为有效
+func ParseAccessToken(token string, secrets []string) (*AccessClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	var header tokenHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrTokenMalformed
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+	valid := false
+	for _, secret := range secrets {
+		if secret == "" || SigningKeyID(secret) != header.Kid {
+			continue
+		}
+		if hmac.Equal([]byte(signToken(signingInput, secret)), []byte(parts[2])) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrTokenSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	var claims AccessClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+// HashToken 计算刷新令牌的哈希，数据库中只保存哈希值
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// signToken 计算签名
+func signToken(signingInput, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
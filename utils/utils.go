@@ -3,7 +3,6 @@ package utils
 import (
 	"crypto/md5"
 	"crypto/rand"
-	"crypto/rc4"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
@@ -12,9 +11,6 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// RC4Key RC4加密的密钥
-const RC4Key = "TaruApp2025SecretKey"
-
 // GenerateToken 生成随机token
 func GenerateToken() (string, error) {
 	b := make([]byte, 32)
@@ -24,35 +20,31 @@ func GenerateToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-// RC4Encrypt RC4加密
-func RC4Encrypt(plaintext string) (string, error) {
-	cipher, err := rc4.NewCipher([]byte(RC4Key))
-	if err != nil {
+// RandomHex 生成指定字节数的随机十六进制字符串
+func RandomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-
-	ciphertext := make([]byte, len(plaintext))
-	cipher.XORKeyStream(ciphertext, []byte(plaintext))
-
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return hex.EncodeToString(b), nil
 }
 
-// RC4Decrypt RC4解密
-func RC4Decrypt(ciphertext string) (string, error) {
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
-	if err != nil {
-		return "", err
-	}
-
-	cipher, err := rc4.NewCipher([]byte(RC4Key))
-	if err != nil {
-		return "", err
+// RandomDigits 生成指定位数的随机数字验证码
+func RandomDigits(n int) (string, error) {
+	digits := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(digits) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, v := range buf {
+			// 丢弃 250-255，保证每个数字出现的概率相同
+			if v < 250 && len(digits) < n {
+				digits = append(digits, '0'+v%10)
+			}
+		}
 	}
-
-	plaintext := make([]byte, len(data))
-	cipher.XORKeyStream(plaintext, data)
-
-	return string(plaintext), nil
+	return string(digits), nil
 }
 
 // HashPassword 使用bcrypt加密密码